@@ -0,0 +1,851 @@
+package kubedump
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+type archiveFormat string
+
+const (
+	archiveFormatTar   archiveFormat = "tar"
+	archiveFormatTarGz archiveFormat = "tar.gz"
+	archiveFormatZip   archiveFormat = "zip"
+)
+
+// namespaceOrKindPattern matches the names of the directories which may be at the root of a dump.
+var namespaceOrKindPattern = regexp.MustCompile(`^([a-z0-9]([-a-z0-9]*[a-z0-9])?|[A-Z][a-zA-Z0-9]*)$`)
+
+// maxLinkHops is the maximum number of symlinks followed when resolving a path in an archive.
+const maxLinkHops = 40
+
+// archiveEntry is a file, directory or symlink read from an archive.
+type archiveEntry struct {
+	name    string
+	mode    fs.FileMode
+	modTime time.Time
+
+	// size is the size of a file, whose content is read from the archive by open only when it is needed.
+	size int64
+	open func() (io.ReadCloser, error)
+
+	target   string
+	children []string
+}
+
+func (entry *archiveEntry) Name() string {
+	if entry.name == "." {
+		return "."
+	}
+
+	return path.Base(entry.name)
+}
+
+func (entry *archiveEntry) Size() int64 {
+	if entry.mode.Type() == fs.ModeSymlink {
+		return int64(len(entry.target))
+	}
+
+	return entry.size
+}
+
+func (entry *archiveEntry) Mode() fs.FileMode  { return entry.mode }
+func (entry *archiveEntry) ModTime() time.Time { return entry.modTime }
+func (entry *archiveEntry) IsDir() bool        { return entry.mode.IsDir() }
+func (entry *archiveEntry) Sys() any           { return nil }
+
+// archiveFS is a read-only DumpFS over an archive. The structure of the archive is held in memory, while the content
+// of each file is read from the archive when it is opened.
+type archiveFS struct {
+	entries map[string]*archiveEntry
+
+	// closer closes the archive once the archiveFS is no longer needed.
+	closer io.Closer
+}
+
+// Close closes the archive. Files opened from the archiveFS can not be read once it is closed.
+func (fsys *archiveFS) Close() error {
+	if fsys.closer == nil {
+		return nil
+	}
+
+	return fsys.closer.Close()
+}
+
+func newArchiveFS() *archiveFS {
+	return &archiveFS{
+		entries: map[string]*archiveEntry{
+			".": {name: ".", mode: fs.ModeDir | 0755},
+		},
+	}
+}
+
+// mkdirAll adds the directory name and all of its parents.
+func (fsys *archiveFS) mkdirAll(name string) *archiveEntry {
+	if entry, found := fsys.entries[name]; found {
+		return entry
+	}
+
+	parent := fsys.mkdirAll(path.Dir(name))
+	entry := &archiveEntry{name: name, mode: fs.ModeDir | 0755}
+
+	fsys.entries[name] = entry
+	parent.children = append(parent.children, path.Base(name))
+
+	return entry
+}
+
+// add adds an entry to the archive, replacing any existing entry with the same name.
+func (fsys *archiveFS) add(entry *archiveEntry) {
+	if entry.mode.IsDir() {
+		dir := fsys.mkdirAll(entry.name)
+		dir.mode = entry.mode
+		dir.modTime = entry.modTime
+		return
+	}
+
+	if _, found := fsys.entries[entry.name]; !found {
+		parent := fsys.mkdirAll(path.Dir(entry.name))
+		parent.children = append(parent.children, path.Base(entry.name))
+	}
+
+	fsys.entries[entry.name] = entry
+}
+
+// resolve returns the entry at name, following any symlinks in its parent directories, and the final element only if
+// followLast is true. Symlinks pointing outside the archive are treated as missing.
+func (fsys *archiveFS) resolve(op string, name string, followLast bool) (*archiveEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	hops := 0
+
+	var resolve func(name string, followLast bool) (*archiveEntry, error)
+	resolve = func(name string, followLast bool) (*archiveEntry, error) {
+		current := fsys.entries["."]
+		if name == "." {
+			return current, nil
+		}
+
+		components := strings.Split(name, "/")
+		for i, component := range components {
+			if !current.IsDir() {
+				return nil, fs.ErrNotExist
+			}
+
+			entry, found := fsys.entries[path.Join(current.name, component)]
+			if !found {
+				return nil, fs.ErrNotExist
+			}
+
+			if entry.mode.Type() == fs.ModeSymlink && (followLast || i < len(components)-1) {
+				if hops++; hops > maxLinkHops {
+					return nil, errors.New("too many levels of symbolic links")
+				}
+
+				target := path.Join(path.Dir(entry.name), entry.target)
+				if path.IsAbs(entry.target) || !fs.ValidPath(target) {
+					return nil, fs.ErrNotExist
+				}
+
+				resolved, err := resolve(target, true)
+				if err != nil {
+					return nil, err
+				}
+
+				entry = resolved
+			}
+
+			current = entry
+		}
+
+		return current, nil
+	}
+
+	entry, err := resolve(name, followLast)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	return entry, nil
+}
+
+func (fsys *archiveFS) Open(name string) (fs.File, error) {
+	entry, err := fsys.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &archiveFile{
+		fsys:  fsys,
+		entry: entry,
+	}
+
+	if entry.open != nil {
+		if file.reader, err = entry.open(); err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+
+	return file, nil
+}
+
+func (fsys *archiveFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entry, err := fsys.resolve("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if !entry.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+
+	return fsys.dirEntries(entry), nil
+}
+
+func (fsys *archiveFS) dirEntries(dir *archiveEntry) []fs.DirEntry {
+	entries := make([]fs.DirEntry, 0, len(dir.children))
+	for _, child := range dir.children {
+		entries = append(entries, fs.FileInfoToDirEntry(fsys.entries[path.Join(dir.name, child)]))
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries
+}
+
+func (fsys *archiveFS) ReadFile(name string) ([]byte, error) {
+	entry, err := fsys.resolve("read", name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errors.New("is a directory")}
+	}
+
+	if entry.open == nil {
+		return []byte{}, nil
+	}
+
+	r, err := entry.open()
+	if err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+
+	return data, nil
+}
+
+func (fsys *archiveFS) ReadLink(name string) (string, error) {
+	entry, err := fsys.resolve("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+
+	if entry.mode.Type() != fs.ModeSymlink {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+
+	return entry.target, nil
+}
+
+func (fsys *archiveFS) Lstat(name string) (fs.FileInfo, error) {
+	entry, err := fsys.resolve("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// archiveFile is an open file or directory in an archiveFS.
+type archiveFile struct {
+	fsys    *archiveFS
+	entry   *archiveEntry
+	reader  io.ReadCloser
+	dirRead int
+}
+
+func (file *archiveFile) Read(p []byte) (int, error) {
+	if file.entry.IsDir() {
+		return 0, &fs.PathError{Op: "read", Path: file.entry.name, Err: errors.New("is a directory")}
+	}
+
+	if file.reader == nil {
+		return 0, io.EOF
+	}
+
+	return file.reader.Read(p)
+}
+
+func (file *archiveFile) Stat() (fs.FileInfo, error) {
+	return file.entry, nil
+}
+
+func (file *archiveFile) Close() error {
+	if file.reader == nil {
+		return nil
+	}
+
+	return file.reader.Close()
+}
+
+func (file *archiveFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !file.entry.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: file.entry.name, Err: errors.New("not a directory")}
+	}
+
+	entries := file.fsys.dirEntries(file.entry)[file.dirRead:]
+	if n > 0 && len(entries) == 0 {
+		return nil, io.EOF
+	}
+
+	if n > 0 && n < len(entries) {
+		entries = entries[:n]
+	}
+
+	file.dirRead += len(entries)
+
+	return entries, nil
+}
+
+// stripRoot returns the single top-level directory holding every entry in the archive, or an empty string if there is
+// none. A top-level directory whose name is not a valid namespace or kind is always stripped. Otherwise, since namespace
+// and kind directories only hold directories, and a namespace only holds kinds while a kind never holds kinds, it is
+// only stripped if its children could not be those of a namespace or kind.
+func stripRoot(entries []*archiveEntry) string {
+	root := ""
+	children := make(map[string]bool)
+
+	for _, entry := range entries {
+		first, rest, _ := strings.Cut(entry.name, "/")
+		if root != "" && first != root {
+			return ""
+		}
+
+		root = first
+
+		if rest == "" {
+			if !entry.IsDir() {
+				return ""
+			}
+
+			continue
+		}
+
+		child, _, isDir := strings.Cut(rest, "/")
+		children[child] = children[child] || isDir || entry.IsDir()
+	}
+
+	if !namespaceOrKindPattern.MatchString(root) {
+		return root
+	}
+
+	for child, isDir := range children {
+		if !isDir || isKindDir(root) == isKindDir(child) {
+			return root
+		}
+	}
+
+	return ""
+}
+
+// newArchiveFSFromEntries builds an archiveFS from the given entries, stripping any single top-level directory.
+func newArchiveFSFromEntries(entries []*archiveEntry) *archiveFS {
+	fsys := newArchiveFS()
+	root := stripRoot(entries)
+
+	for _, entry := range entries {
+		if root != "" {
+			if entry.name == root {
+				continue
+			}
+
+			entry.name = strings.TrimPrefix(entry.name, root+"/")
+		}
+
+		fsys.add(entry)
+	}
+
+	return fsys
+}
+
+// cleanArchiveName converts the name of a file in an archive to a path valid for an fs.FS, or returns false if the
+// file would be outside the archive.
+func cleanArchiveName(name string) (string, bool) {
+	name = path.Clean(strings.TrimLeft(name, "/"))
+	if name == "." || !fs.ValidPath(name) {
+		return "", false
+	}
+
+	return name, true
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (reader *countingReader) Read(p []byte) (int, error) {
+	n, err := reader.r.Read(p)
+	reader.n += int64(n)
+
+	return n, err
+}
+
+// sectionOpener returns an open func reading size bytes from r at offset.
+func sectionOpener(r io.ReaderAt, offset int64, size int64) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		return io.NopCloser(io.NewSectionReader(r, offset, size)), nil
+	}
+}
+
+// readTar reads the entries of the uncompressed tar archive in r. Only the headers are read, recording where the
+// content of each file starts so it can be read later.
+func readTar(r io.ReaderAt, size int64) ([]*archiveEntry, error) {
+	// tar reads whole blocks without buffering ahead, so once a header is read the count is the offset of its content
+	counter := &countingReader{r: io.NewSectionReader(r, 0, size)}
+	reader := tar.NewReader(counter)
+	entries := make([]*archiveEntry, 0)
+	byName := make(map[string]*archiveEntry)
+
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("could not read tar header: %w", err)
+		}
+
+		name, ok := cleanArchiveName(header.Name)
+		if !ok {
+			continue
+		}
+
+		entry := &archiveEntry{
+			name:    name,
+			modTime: header.ModTime,
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			entry.mode = fs.ModeDir | fs.FileMode(header.Mode).Perm()
+		case tar.TypeSymlink:
+			entry.mode = fs.ModeSymlink | 0777
+			entry.target = header.Linkname
+		case tar.TypeLink:
+			linked, found := byName[path.Clean(strings.TrimLeft(header.Linkname, "/"))]
+			if !found {
+				return nil, fmt.Errorf("hard link '%s' points to unknown file '%s'", header.Name, header.Linkname)
+			}
+
+			entry.mode = linked.mode
+			entry.size = linked.size
+			entry.open = linked.open
+		case tar.TypeReg:
+			entry.mode = fs.FileMode(header.Mode).Perm()
+			entry.size = header.Size
+			entry.open = sectionOpener(r, counter.n, header.Size)
+		default:
+			continue
+		}
+
+		entries = append(entries, entry)
+		byName[name] = entry
+	}
+
+	return entries, nil
+}
+
+// readZip reads the entries of the zip archive in reader. The content of each file is decompressed when it is opened.
+func readZip(reader *zip.Reader) ([]*archiveEntry, error) {
+	entries := make([]*archiveEntry, 0, len(reader.File))
+
+	for _, file := range reader.File {
+		name, ok := cleanArchiveName(file.Name)
+		if !ok {
+			continue
+		}
+
+		entry := &archiveEntry{
+			name:    name,
+			mode:    file.Mode(),
+			modTime: file.Modified,
+		}
+
+		switch {
+		case entry.mode.IsDir():
+		case entry.mode.Type() == fs.ModeSymlink:
+			// zip stores the destination of a symlink as its content
+			target, err := readZipFile(file)
+			if err != nil {
+				return nil, err
+			}
+
+			entry.target = string(target)
+		default:
+			entry.size = int64(file.UncompressedSize64)
+			entry.open = file.Open
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	r, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("could not open '%s': %w", file.Name, err)
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("could not read '%s': %w", file.Name, err)
+	}
+
+	return data, nil
+}
+
+// readArchive opens the archive at archivePath, which is kept open until the returned archiveFS is closed. A gzipped
+// tar archive can not be read from the middle, so it is decompressed to an unnamed temporary file first.
+func readArchive(archivePath string, format archiveFormat) (*archiveFS, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	fsys, err := readArchiveFile(f, format)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return fsys, nil
+}
+
+func readArchiveFile(f *os.File, format archiveFormat) (*archiveFS, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("could not stat archive: %w", err)
+	}
+
+	if format == archiveFormatZip {
+		reader, err := zip.NewReader(f, info.Size())
+		if err != nil {
+			return nil, err
+		}
+
+		entries, err := readZip(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		fsys := newArchiveFSFromEntries(entries)
+		fsys.closer = f
+
+		return fsys, nil
+	}
+
+	if format == archiveFormatTarGz {
+		decompressed, err := decompressToTemp(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		f = decompressed
+
+		if info, err = f.Stat(); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("could not stat decompressed archive: %w", err)
+		}
+	}
+
+	entries, err := readTar(f, info.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	fsys := newArchiveFSFromEntries(entries)
+	fsys.closer = f
+
+	return fsys, nil
+}
+
+// decompressToTemp decompresses the gzip stream in r to a temporary file, which is removed once it is closed.
+func decompressToTemp(r io.Reader) (*os.File, error) {
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("could not read gzip header: %w", err)
+	}
+	defer gzipReader.Close()
+
+	f, err := os.CreateTemp("", "kubedump-*.tar")
+	if err != nil {
+		return nil, fmt.Errorf("could not create temporary file: %w", err)
+	}
+
+	// the file is unlinked right away, so it is removed as soon as it is closed
+	if err := os.Remove(f.Name()); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("could not remove temporary file: %w", err)
+	}
+
+	if _, err := io.Copy(f, gzipReader); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("could not decompress archive: %w", err)
+	}
+
+	return f, nil
+}
+
+// WriteArchive writes the dump in dir to an archive at archivePath, whose format is chosen by its extension (.tar,
+// .tar.gz, .tgz, or .zip). Every file is placed under a top-level directory with the same name as dir, so the archive
+// extracts to a copy of the dump.
+func WriteArchive(dir string, archivePath string) error {
+	format, ok := archiveFormatOf(archivePath)
+	if !ok {
+		return fmt.Errorf("unsupported archive format for '%s'", archivePath)
+	}
+
+	f, err := os.Create(archivePath)
+	if err != nil {
+		return fmt.Errorf("could not create archive: %w", err)
+	}
+
+	if err := writeArchive(f, dir, format); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("could not close archive: %w", err)
+	}
+
+	return nil
+}
+
+// archiveWalkFunc is called for each file in the dump being archived, with the name it should have in the archive and
+// the destination of the file if it is a symlink.
+type archiveWalkFunc func(filePath string, name string, info fs.FileInfo, target string) error
+
+func walkArchiveDir(dir string, fn archiveWalkFunc) error {
+	root := filepath.Base(dir)
+
+	return filepath.WalkDir(dir, func(filePath string, d fs.DirEntry, err error) error {
+		// files may be removed while a running dump is archived, like rotated log segments
+		if errors.Is(err, fs.ErrNotExist) && filePath != dir {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		relative, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		target := ""
+		if info.Mode().Type() == fs.ModeSymlink {
+			if target, err = os.Readlink(filePath); err != nil {
+				return err
+			}
+		}
+
+		return fn(filePath, path.Join(root, filepath.ToSlash(relative)), info, target)
+	})
+}
+
+func writeArchive(w io.Writer, dir string, format archiveFormat) error {
+	if format == archiveFormatZip {
+		return writeZip(w, dir)
+	}
+
+	if format == archiveFormatTar {
+		return writeTar(w, dir)
+	}
+
+	gzipWriter := gzip.NewWriter(w)
+	if err := writeTar(gzipWriter, dir); err != nil {
+		return err
+	}
+
+	if err := gzipWriter.Close(); err != nil {
+		return fmt.Errorf("could not write gzip footer: %w", err)
+	}
+
+	return nil
+}
+
+func writeTar(w io.Writer, dir string) error {
+	writer := tar.NewWriter(w)
+
+	err := walkArchiveDir(dir, func(filePath string, name string, info fs.FileInfo, target string) error {
+		header, err := tar.FileInfoHeader(info, target)
+		if err != nil {
+			return fmt.Errorf("could not create header for '%s': %w", filePath, err)
+		}
+
+		header.Name = name
+		if info.IsDir() {
+			header.Name += "/"
+		}
+
+		if !info.Mode().IsRegular() {
+			if err := writer.WriteHeader(header); err != nil {
+				return fmt.Errorf("could not write header for '%s': %w", filePath, err)
+			}
+
+			return nil
+		}
+
+		return writeTarFile(writer, header, filePath)
+	})
+	if err != nil {
+		return fmt.Errorf("could not write tar: %w", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("could not write tar footer: %w", err)
+	}
+
+	return nil
+}
+
+// isAppendOnly returns true if the file at filePath is only ever appended to while a dump is running.
+func isAppendOnly(filePath string) bool {
+	name := filepath.Base(filePath)
+	return IsLogFile(name) || strings.HasSuffix(name, EventsFileSuffix)
+}
+
+// writeTarFile writes the regular file at filePath to writer. The dump may still be running, so the size in the header
+// must match the file as it is read rather than as it was when the directory was walked: append-only files are copied
+// up to their size once opened, and any other file, which may be rewritten in place, is read whole first. Files
+// removed or renamed by log rotation since the walk are skipped.
+func writeTarFile(writer *tar.Writer, header *tar.Header, filePath string) error {
+	f, err := os.Open(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("could not stat '%s': %w", filePath, err)
+	}
+
+	var r io.Reader = f
+	header.Size = info.Size()
+	header.ModTime = info.ModTime()
+
+	if !isAppendOnly(filePath) {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return fmt.Errorf("could not read '%s': %w", filePath, err)
+		}
+
+		r = bytes.NewReader(data)
+		header.Size = int64(len(data))
+	}
+
+	if err := writer.WriteHeader(header); err != nil {
+		return fmt.Errorf("could not write header for '%s': %w", filePath, err)
+	}
+
+	if _, err := io.CopyN(writer, r, header.Size); err != nil {
+		return fmt.Errorf("could not copy '%s': %w", filePath, err)
+	}
+
+	return nil
+}
+
+func writeZip(w io.Writer, dir string) error {
+	writer := zip.NewWriter(w)
+
+	err := walkArchiveDir(dir, func(filePath string, name string, info fs.FileInfo, target string) error {
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return fmt.Errorf("could not create header for '%s': %w", filePath, err)
+		}
+
+		header.Name = name
+		if info.IsDir() {
+			header.Name += "/"
+		} else if info.Mode().IsRegular() {
+			header.Method = zip.Deflate
+		}
+
+		fileWriter, err := writer.CreateHeader(header)
+		if err != nil {
+			return fmt.Errorf("could not write header for '%s': %w", filePath, err)
+		}
+
+		switch {
+		case target != "":
+			_, err = io.WriteString(fileWriter, target)
+			return err
+		case info.Mode().IsRegular():
+			return copyFileTo(fileWriter, filePath)
+		default:
+			return nil
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("could not write zip: %w", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("could not write zip footer: %w", err)
+	}
+
+	return nil
+}
+
+func copyFileTo(w io.Writer, filePath string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("could not copy '%s': %w", filePath, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,196 @@
+package kubedump
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveRoundTrip(t *testing.T) {
+	for _, ext := range []string{".tar", ".tar.gz", ".tgz", ".zip"} {
+		t.Run(ext, func(t *testing.T) {
+			archivePath := path.Join(t.TempDir(), "LinkedService"+ext)
+			require.NoError(t, WriteArchive(dumpDir, archivePath))
+
+			fsys, err := OpenDump(archivePath)
+			require.NoError(t, err)
+
+			resources := []string{}
+			err = ForEachResourceFS(fsys, func(builder ResourcePathBuilder) error {
+				resources = append(resources, fmt.Sprintf("%s:%s/%s", builder.Kind, builder.Namespace, builder.Name))
+				return nil
+			})
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []string{"Service:default/sample-service", "Pod:default/sample-pod", "ConfigMap:default/sample-configmap", "Secret:default/sample-secret"}, resources)
+
+			target, err := fsys.ReadLink("default/Service/sample-service/Pod/sample-pod")
+			require.NoError(t, err)
+			assert.Equal(t, "../../../Pod/sample-pod", target)
+
+			info, err := fsys.Lstat("default/Service/sample-service/Pod/sample-pod")
+			require.NoError(t, err)
+			assert.Equal(t, fs.ModeSymlink, info.Mode().Type())
+
+			expected, err := os.ReadFile(filepath.Join(dumpDir, "default", "Pod", "sample-pod", "sample-pod.yaml"))
+			require.NoError(t, err)
+
+			actual, err := fs.ReadFile(fsys, "default/Service/sample-service/Pod/sample-pod/sample-pod.yaml")
+			require.NoError(t, err)
+			assert.Equal(t, expected, actual)
+
+			assert.NoError(t, fstest.TestFS(fsys,
+				"kubedump.log",
+				"default/Pod/sample-pod/sample-pod.yaml",
+				"default/Secret/sample-secret/sample-secret.yaml",
+			))
+		})
+	}
+}
+
+func TestOpenDumpDirectory(t *testing.T) {
+	fsys, err := OpenDump(dumpDir)
+	require.NoError(t, err)
+
+	target, err := fsys.ReadLink("default/Pod/sample-pod/Secret/sample-secret")
+	require.NoError(t, err)
+	assert.Equal(t, "../../../Secret/sample-secret", target)
+
+	links, err := ComputeLinksFS(fsys)
+	require.NoError(t, err)
+	assert.Contains(t, links, ResourceLink{
+		Parent: ResourcePathBuilder{}.WithNamespace("default").WithKind("Pod").WithName("sample-pod"),
+		Child:  ResourcePathBuilder{}.WithNamespace("default").WithKind("Secret").WithName("sample-secret"),
+		Types:  []LinkType{LinkTypeVolume},
+	})
+}
+
+func TestOpenDumpUnsupported(t *testing.T) {
+	file := path.Join(t.TempDir(), "dump.rar")
+	require.NoError(t, os.WriteFile(file, []byte{}, 0644))
+
+	_, err := OpenDump(file)
+	assert.Error(t, err)
+}
+
+// writeTestTar writes a tar archive holding the given files, and a symlink for each entry of links.
+func writeTestTar(t *testing.T, files map[string]string, links map[string]string) string {
+	buf := &bytes.Buffer{}
+	writer := tar.NewWriter(buf)
+
+	for name, content := range files {
+		require.NoError(t, writer.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: int64(len(content))}))
+		_, err := writer.Write([]byte(content))
+		require.NoError(t, err)
+	}
+
+	for name, target := range links {
+		require.NoError(t, writer.WriteHeader(&tar.Header{Typeflag: tar.TypeSymlink, Name: name, Linkname: target}))
+	}
+
+	require.NoError(t, writer.Close())
+
+	archivePath := path.Join(t.TempDir(), "dump.tar")
+	require.NoError(t, os.WriteFile(archivePath, buf.Bytes(), 0644))
+
+	return archivePath
+}
+
+func TestOpenDumpArchiveRoot(t *testing.T) {
+	// a dump holding a single namespace is not mistaken for a top-level directory
+	fsys, err := OpenDump(writeTestTar(t, map[string]string{
+		"default/Pod/sample-pod/sample-pod.yaml": "",
+	}, nil))
+	require.NoError(t, err)
+	assert.NoError(t, fstest.TestFS(fsys, "default/Pod/sample-pod/sample-pod.yaml"))
+
+	fsys, err = OpenDump(writeTestTar(t, map[string]string{
+		"./sample.dump/kubedump.log":                           "",
+		"./sample.dump/default/Pod/sample-pod/sample-pod.yaml": "",
+	}, nil))
+	require.NoError(t, err)
+	assert.NoError(t, fstest.TestFS(fsys, "kubedump.log", "default/Pod/sample-pod/sample-pod.yaml"))
+}
+
+func TestOpenDumpArchiveLinks(t *testing.T) {
+	fsys, err := OpenDump(writeTestTar(t, map[string]string{
+		"default/Pod/sample-pod/sample-pod.yaml": "kind: Pod",
+	}, map[string]string{
+		"default/Service/sample-service/Pod/sample-pod": "../../../Pod/sample-pod",
+		"default/Service/sample-service/Pod/escaped":    "../../../../../outside",
+		"default/Service/sample-service/Pod/loop":       "loop",
+	}))
+	require.NoError(t, err)
+
+	data, err := fs.ReadFile(fsys, "default/Service/sample-service/Pod/sample-pod/sample-pod.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "kind: Pod", string(data))
+
+	_, err = fs.Stat(fsys, "default/Service/sample-service/Pod/escaped")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	_, err = fs.Stat(fsys, "default/Service/sample-service/Pod/loop")
+	assert.Error(t, err)
+
+	_, err = fsys.ReadLink("default/Pod/sample-pod")
+	assert.ErrorIs(t, err, fs.ErrInvalid)
+}
+
+func TestWriteTarFileChanged(t *testing.T) {
+	dir := t.TempDir()
+	logPath := path.Join(dir, "sample-container.log")
+	resourcePath := path.Join(dir, "sample-pod.yaml")
+
+	require.NoError(t, os.WriteFile(logPath, []byte("first\n"), 0644))
+	require.NoError(t, os.WriteFile(resourcePath, []byte("kind: Pod\nmetadata: {}\n"), 0644))
+
+	logInfo, err := os.Stat(logPath)
+	require.NoError(t, err)
+
+	resourceInfo, err := os.Stat(resourcePath)
+	require.NoError(t, err)
+
+	// the files change between walking the dump and archiving them
+	require.NoError(t, appendFile(logPath, []byte("second\n")))
+	require.NoError(t, os.WriteFile(resourcePath, []byte("kind: Pod\n"), 0644))
+
+	buf := &bytes.Buffer{}
+	writer := tar.NewWriter(buf)
+
+	for _, file := range []struct {
+		filePath string
+		info     fs.FileInfo
+	}{{logPath, logInfo}, {resourcePath, resourceInfo}} {
+		header, err := tar.FileInfoHeader(file.info, "")
+		require.NoError(t, err)
+
+		require.NoError(t, writeTarFile(writer, header, file.filePath))
+	}
+
+	require.NoError(t, writeTarFile(writer, &tar.Header{Name: "removed.log"}, path.Join(dir, "removed.log")))
+	require.NoError(t, writer.Close())
+
+	entries, err := readTar(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+
+	fsys := newArchiveFSFromEntries(entries)
+
+	data, err := fs.ReadFile(fsys, "sample-container.log")
+	require.NoError(t, err)
+	assert.Equal(t, "first\nsecond\n", string(data))
+
+	data, err = fs.ReadFile(fsys, "sample-pod.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "kind: Pod\n", string(data))
+
+	_, err = fs.Stat(fsys, "removed.log")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
@@ -1,30 +1,544 @@
 package kubedump
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
 
-	"k8s.io/apimachinery/pkg/runtime/schema"
+	kubedump "github.com/joshmeranda/kubedump/pkg"
+	"github.com/joshmeranda/kubedump/pkg/controller"
+	"github.com/joshmeranda/kubedump/pkg/filter"
+	"github.com/joshmeranda/kubedump/pkg/upload"
+	"github.com/urfave/cli/v2"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"sigs.k8s.io/yaml"
 )
 
+const (
+	ConfigFileName = "kubedump.yaml"
+
+	FlagNameConfig = "config"
+)
+
+// Config holds the settings used by kubedump. Settings are resolved from (in order of precedence) command line flags,
+// environment variables, the selected profile, the config file, and finally the defaults from DefaultConfig.
 type Config struct {
 	LogSyncTimeout   string
-	ExcludeResources []schema.GroupVersionResource
+	IncludeResources []ResourceSelector
+	ExcludeResources []ResourceSelector
 	DefaultFilter    string
 	DefaultNWorkers  int
+	RedactSecrets    bool
+
+	// DefaultDestination is a template for the dump destination path. The template can reference the selected profile
+	// name with {{ .Profile }} and the time the dump was started with {{ .Time }}.
+	DefaultDestination string
+
+	// Logs limits the size of the container logs in a dump.
+	Logs LogsConfig
+
+	// Upload configures uploading dumps to S3 compatible object storage.
+	Upload UploadConfig
+
+	// Ring configures holding only the most recent events and logs in memory until triggered.
+	Ring RingConfig
+
+	// Triggers collect extra information about resources and events matching them while dumping.
+	Triggers []TriggerConfig
+
+	Profiles map[string]Profile
+
+	// profile is the name of the profile which was applied to the config, if any.
+	profile string
+}
+
+// Profile is a named set of dump options which can be selected with `kubedump dump --profile <name>`. Any values left
+// empty in the profile fall back to the top level config.
+type Profile struct {
+	Filter           string
+	IncludeResources []ResourceSelector
+	ExcludeResources []ResourceSelector
+	LogSyncTimeout   string
+
+	// RedactSecrets overrides the top level RedactSecrets if set, so a profile may turn redaction on or off.
+	RedactSecrets *bool
+
+	// Destination is a template for the dump destination path, see Config.DefaultDestination.
+	Destination string
+
+	// Logs, Upload, and Ring override each of the matching top level values which they set.
+	Logs   LogsConfig
+	Upload UploadConfig
+	Ring   RingConfig
+}
+
+// LogsConfig limits the size of the container logs in a dump. Sizes are given as quantities (ex "100Mi" or "1G"), and
+// are unlimited if empty.
+type LogsConfig struct {
+	// MaxContainerSize is the size a container's log file may reach before it is rotated.
+	MaxContainerSize string
+
+	// MaxSegments is the number of rotated log segments kept for each container, or 0 to keep every segment.
+	MaxSegments int
+
+	// MaxTotalSize is the size every log file in the dump, including rotated segments, may add up to.
+	MaxTotalSize string
+
+	// DropPolicy is either "newest" to drop new logs once MaxTotalSize is reached, or "oldest" to remove the oldest
+	// rotated segments to make room for new logs.
+	DropPolicy string
+}
+
+func parseSize(name string, size string) (int64, error) {
+	if size == "" {
+		return 0, nil
+	}
+
+	quantity, err := resource.ParseQuantity(size)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse %s '%s': %w", name, size, err)
+	}
+
+	if quantity.Sign() < 0 {
+		return 0, fmt.Errorf("%s must not be negative, but found '%s'", name, size)
+	}
+
+	return quantity.Value(), nil
+}
+
+// override replaces the values of config with those set in other.
+func (config *LogsConfig) override(other LogsConfig) {
+	if other.MaxContainerSize != "" {
+		config.MaxContainerSize = other.MaxContainerSize
+	}
+
+	if other.MaxSegments != 0 {
+		config.MaxSegments = other.MaxSegments
+	}
+
+	if other.MaxTotalSize != "" {
+		config.MaxTotalSize = other.MaxTotalSize
+	}
+
+	if other.DropPolicy != "" {
+		config.DropPolicy = other.DropPolicy
+	}
+}
+
+// Limits parses the configured log limits.
+func (config LogsConfig) Limits() (kubedump.LogLimits, error) {
+	var err error
+	limits := kubedump.LogLimits{
+		MaxSegments: config.MaxSegments,
+		DropPolicy:  kubedump.LogDropPolicy(config.DropPolicy),
+	}
+
+	if limits.MaxContainerSize, err = parseSize("max container log size", config.MaxContainerSize); err != nil {
+		return kubedump.LogLimits{}, err
+	}
+
+	if limits.MaxTotalSize, err = parseSize("max log size", config.MaxTotalSize); err != nil {
+		return kubedump.LogLimits{}, err
+	}
+
+	if limits.MaxSegments < 0 {
+		return kubedump.LogLimits{}, fmt.Errorf("MaxSegments must not be negative, but found %d", limits.MaxSegments)
+	}
+
+	switch limits.DropPolicy {
+	case "":
+		limits.DropPolicy = kubedump.LogDropNewest
+	case kubedump.LogDropNewest, kubedump.LogDropOldest:
+	default:
+		return kubedump.LogLimits{}, fmt.Errorf("unsupported log drop policy '%s'", config.DropPolicy)
+	}
+
+	return limits, nil
+}
+
+// triggerNamePattern restricts trigger names to characters which are safe to use in the names of incident directories.
+var triggerNamePattern = regexp.MustCompile("^[a-zA-Z0-9][a-zA-Z0-9_.-]*$")
+
+// TriggerConfig defines a trigger which takes actions for each resource or event matching its filter, writing the
+// results to the dump as an incident.
+type TriggerConfig struct {
+	Name string
+
+	// On is the filter a resource or event must match to fire the trigger.
+	On string
+
+	// Actions are the names of the actions to take when the trigger fires. If empty, every action is taken.
+	Actions []string
+}
+
+// UnmarshalJSON reads a "true" key as On, since YAML 1.1 reads an unquoted `on` key as a boolean, so `on: <filter>`
+// reaches us as `"true": <filter>`.
+func (config *TriggerConfig) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("trigger must be an object: %w", err)
+	}
+
+	if on, found := fields["true"]; found {
+		delete(fields, "true")
+		fields["On"] = on
+	}
+
+	fixed, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	// use an alias type to avoid recursing back into this method
+	type rawTrigger TriggerConfig
+
+	decoder := json.NewDecoder(bytes.NewReader(fixed))
+	decoder.DisallowUnknownFields()
+
+	var raw rawTrigger
+	if err := decoder.Decode(&raw); err != nil {
+		return fmt.Errorf("could not unmarshal trigger: %w", err)
+	}
+
+	*config = TriggerConfig(raw)
+
+	return nil
+}
+
+// Trigger parses the trigger's filter and actions.
+func (config TriggerConfig) Trigger() (controller.Trigger, error) {
+	if !triggerNamePattern.MatchString(config.Name) {
+		return controller.Trigger{}, fmt.Errorf("invalid trigger name '%s'", config.Name)
+	}
+
+	on, err := filter.Parse(config.On)
+	if err != nil {
+		return controller.Trigger{}, fmt.Errorf("could not parse filter '%s' for trigger '%s': %w", config.On, config.Name, err)
+	}
+
+	trigger := controller.Trigger{
+		Name: config.Name,
+		On:   on,
+	}
+
+	for _, action := range config.Actions {
+		if !slices.Contains(controller.TriggerActions, controller.TriggerAction(action)) {
+			return controller.Trigger{}, fmt.Errorf("unsupported action '%s' for trigger '%s'", action, config.Name)
+		}
+
+		trigger.Actions = append(trigger.Actions, controller.TriggerAction(action))
+	}
+
+	return trigger, nil
+}
+
+// destinationTemplateData is the data available to a destination template.
+type destinationTemplateData struct {
+	Profile string
+	Time    string
 }
 
 func DefaultConfig() *Config {
 	return &Config{
-		LogSyncTimeout:   "2s",
-		ExcludeResources: []schema.GroupVersionResource{},
-		DefaultFilter:    "",
-		DefaultNWorkers:  5,
+		LogSyncTimeout:     "2s",
+		IncludeResources:   []ResourceSelector{},
+		ExcludeResources:   []ResourceSelector{},
+		DefaultFilter:      "",
+		DefaultNWorkers:    5,
+		RedactSecrets:      false,
+		DefaultDestination: "kubedump.dump",
+		Logs: LogsConfig{
+			MaxSegments: 5,
+			DropPolicy:  string(kubedump.LogDropNewest),
+		},
+		Upload: UploadConfig{
+			Endpoint:   "https://s3.amazonaws.com",
+			PartSize:   upload.DefaultPartSize,
+			MaxRetries: upload.DefaultMaxRetries,
+		},
+		Profiles: map[string]Profile{},
+	}
+}
+
+// Profile returns the profile with the given name, or an empty profile if name is empty.
+func (config *Config) Profile(name string) (Profile, error) {
+	if name == "" {
+		return Profile{}, nil
+	}
+
+	profile, found := config.Profiles[name]
+	if !found {
+		return Profile{}, fmt.Errorf("no such profile '%s'", name)
+	}
+
+	return profile, nil
+}
+
+// ApplyProfile overrides the config values with any values set in the named profile.
+func (config *Config) ApplyProfile(name string) error {
+	profile, err := config.Profile(name)
+	if err != nil {
+		return err
+	}
+
+	config.profile = name
+
+	if profile.Filter != "" {
+		config.DefaultFilter = profile.Filter
+	}
+
+	if profile.IncludeResources != nil {
+		config.IncludeResources = profile.IncludeResources
+	}
+
+	if profile.ExcludeResources != nil {
+		config.ExcludeResources = profile.ExcludeResources
+	}
+
+	if profile.LogSyncTimeout != "" {
+		config.LogSyncTimeout = profile.LogSyncTimeout
+	}
+
+	if profile.RedactSecrets != nil {
+		config.RedactSecrets = *profile.RedactSecrets
+	}
+
+	if profile.Destination != "" {
+		config.DefaultDestination = profile.Destination
+	}
+
+	config.Logs.override(profile.Logs)
+	config.Upload.override(profile.Upload)
+	config.Ring.override(profile.Ring)
+
+	return nil
+}
+
+// ApplyFlags overrides the config values with any flags or environment variables set in ctx.
+func (config *Config) ApplyFlags(ctx *cli.Context) error {
+	var err error
+
+	if ctx.IsSet(FlagNameLogSyncTimeout) {
+		config.LogSyncTimeout = ctx.Duration(FlagNameLogSyncTimeout).String()
+	}
+
+	if ctx.IsSet(FlagNameIncludeResource) {
+		if config.IncludeResources, err = ParseResourceSelectors(ctx.StringSlice(FlagNameIncludeResource)); err != nil {
+			return fmt.Errorf("could not parse included resources: %w", err)
+		}
+	}
+
+	if ctx.IsSet(FlagNameExcludeResource) {
+		if config.ExcludeResources, err = ParseResourceSelectors(ctx.StringSlice(FlagNameExcludeResource)); err != nil {
+			return fmt.Errorf("could not parse excluded resources: %w", err)
+		}
+	}
+
+	if ctx.IsSet(FlagNameFilter) {
+		config.DefaultFilter = ctx.String(FlagNameFilter)
+	}
+
+	if ctx.IsSet(FlagNameWorkers) {
+		config.DefaultNWorkers = ctx.Int(FlagNameWorkers)
+	}
+
+	if ctx.IsSet(FlagNameRedactSecrets) {
+		config.RedactSecrets = ctx.Bool(FlagNameRedactSecrets)
+	}
+
+	if ctx.IsSet(FlagNameDestination) {
+		config.DefaultDestination = ctx.String(FlagNameDestination)
+	}
+
+	if ctx.IsSet(FlagNameMaxContainerLogSize) {
+		config.Logs.MaxContainerSize = ctx.String(FlagNameMaxContainerLogSize)
+	}
+
+	if ctx.IsSet(FlagNameMaxLogSize) {
+		config.Logs.MaxTotalSize = ctx.String(FlagNameMaxLogSize)
+	}
+
+	if ctx.IsSet(FlagNameLogDropPolicy) {
+		config.Logs.DropPolicy = ctx.String(FlagNameLogDropPolicy)
+	}
+
+	if ctx.IsSet(FlagNameUploadEndpoint) {
+		config.Upload.Endpoint = ctx.String(FlagNameUploadEndpoint)
+	}
+
+	if ctx.IsSet(FlagNameUploadBucket) {
+		config.Upload.Bucket = ctx.String(FlagNameUploadBucket)
+	}
+
+	if ctx.IsSet(FlagNameUploadPrefix) {
+		config.Upload.Prefix = ctx.String(FlagNameUploadPrefix)
+	}
+
+	if ctx.IsSet(FlagNameSnapshotInterval) {
+		config.Upload.SnapshotInterval = ctx.Duration(FlagNameSnapshotInterval).String()
+	}
+
+	if ctx.IsSet(FlagNameRing) {
+		config.Ring.Window = ctx.Duration(FlagNameRing).String()
+	}
+
+	if ctx.IsSet(FlagNameRingPost) {
+		config.Ring.PostWindow = ctx.Duration(FlagNameRingPost).String()
+	}
+
+	if ctx.IsSet(FlagNameRingMaxSize) {
+		config.Ring.MaxSize = ctx.String(FlagNameRingMaxSize)
+	}
+
+	if ctx.IsSet(FlagNameRingTrigger) {
+		config.Ring.Trigger = ctx.String(FlagNameRingTrigger)
+	}
+
+	if ctx.IsSet(FlagNameRingTriggerAddress) {
+		config.Ring.TriggerAddress = ctx.String(FlagNameRingTriggerAddress)
+	}
+
+	return nil
+}
+
+// Validate checks that every value in the config, and in each of its profiles, is valid.
+func (config *Config) Validate() error {
+	if err := validateSettings(config.DefaultFilter, config.LogSyncTimeout, config.DefaultDestination); err != nil {
+		return err
+	}
+
+	if config.DefaultNWorkers <= 0 {
+		return fmt.Errorf("DefaultNWorkers must be greater than 0, but found %d", config.DefaultNWorkers)
+	}
+
+	if _, err := config.Logs.Limits(); err != nil {
+		return err
+	}
+
+	if err := config.Upload.Validate(); err != nil {
+		return err
+	}
+
+	if err := config.Ring.Validate(); err != nil {
+		return err
+	}
+
+	if _, err := config.ParseTriggers(); err != nil {
+		return err
+	}
+
+	for name, profile := range config.Profiles {
+		if err := validateSettings(profile.Filter, profile.LogSyncTimeout, profile.Destination); err != nil {
+			return fmt.Errorf("invalid profile '%s': %w", name, err)
+		}
+
+		// the nested settings of a profile may only be valid along with the top level values they do not override
+		profiled := *config
+		if err := profiled.ApplyProfile(name); err != nil {
+			return err
+		}
+
+		if _, err := profiled.Logs.Limits(); err != nil {
+			return fmt.Errorf("invalid profile '%s': %w", name, err)
+		}
+
+		if err := profiled.Upload.Validate(); err != nil {
+			return fmt.Errorf("invalid profile '%s': %w", name, err)
+		}
+
+		if err := profiled.Ring.Validate(); err != nil {
+			return fmt.Errorf("invalid profile '%s': %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func validateSettings(rawFilter string, logSyncTimeout string, destination string) error {
+	if _, err := filter.Parse(rawFilter); err != nil {
+		return fmt.Errorf("could not parse filter '%s': %w", rawFilter, err)
+	}
+
+	if logSyncTimeout != "" {
+		if _, err := time.ParseDuration(logSyncTimeout); err != nil {
+			return fmt.Errorf("could not parse log sync timeout '%s': %w", logSyncTimeout, err)
+		}
 	}
+
+	if _, err := template.New("destination").Parse(destination); err != nil {
+		return fmt.Errorf("could not parse destination template '%s': %w", destination, err)
+	}
+
+	return nil
 }
 
+// Filter parses the configured filter.
+func (config *Config) Filter() (filter.Expression, error) {
+	expr, err := filter.Parse(config.DefaultFilter)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse filter '%s': %w", config.DefaultFilter, err)
+	}
+
+	return expr, nil
+}
+
+// ParseTriggers parses each of the configured triggers, checking that no two triggers share a name.
+func (config *Config) ParseTriggers() ([]controller.Trigger, error) {
+	triggers := make([]controller.Trigger, 0, len(config.Triggers))
+	names := map[string]bool{}
+
+	for _, triggerConfig := range config.Triggers {
+		if names[triggerConfig.Name] {
+			return nil, fmt.Errorf("found more than one trigger named '%s'", triggerConfig.Name)
+		}
+
+		names[triggerConfig.Name] = true
+
+		trigger, err := triggerConfig.Trigger()
+		if err != nil {
+			return nil, err
+		}
+
+		triggers = append(triggers, trigger)
+	}
+
+	return triggers, nil
+}
+
+// GetLogSyncTimeout parses the configured log sync timeout.
+func (config *Config) GetLogSyncTimeout() (time.Duration, error) {
+	timeout, err := time.ParseDuration(config.LogSyncTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse log sync timeout '%s': %w", config.LogSyncTimeout, err)
+	}
+
+	return timeout, nil
+}
+
+// RenderDestination renders the configured destination template.
+func (config *Config) RenderDestination(now time.Time) (string, error) {
+	tmpl, err := template.New("destination").Option("missingkey=error").Parse(config.DefaultDestination)
+	if err != nil {
+		return "", fmt.Errorf("could not parse destination template: %w", err)
+	}
+
+	builder := strings.Builder{}
+	if err := tmpl.Execute(&builder, destinationTemplateData{Profile: config.profile, Time: now.Format(DefaultTimeFormat)}); err != nil {
+		return "", fmt.Errorf("could not render destination template: %w", err)
+	}
+
+	return builder.String(), nil
+}
+
+// ConfigFromFile loads the config at the given path, using default values for any setting not found in the file. Any
+// unknown fields in the file will result in an error.
 func ConfigFromFile(path string) (*Config, error) {
 	bytes, err := os.ReadFile(path)
 	if err != nil {
@@ -32,20 +546,74 @@ func ConfigFromFile(path string) (*Config, error) {
 	}
 
 	config := DefaultConfig()
-	if err := yaml.Unmarshal(bytes, &config); err != nil {
-		return nil, fmt.Errorf("could not unmarshal config file: %w", err)
+	if err := yaml.UnmarshalStrict(bytes, config); err != nil {
+		return nil, fmt.Errorf("could not unmarshal config file '%s': %w", path, err)
 	}
 
 	return config, nil
 }
 
-func ConfigFromDefaultFile() (*Config, error) {
+// DefaultConfigPath returns the path to the config file in the user's config directory.
+func DefaultConfigPath() (string, error) {
 	dir, err := os.UserConfigDir()
 	if err != nil {
-		return nil, fmt.Errorf("could not get user config dir: %w", err)
+		return "", fmt.Errorf("could not get user config dir: %w", err)
 	}
 
-	path := path.Join(dir, "kubedump.yaml")
+	return path.Join(dir, ConfigFileName), nil
+}
+
+func ConfigFromDefaultFile() (*Config, error) {
+	path, err := DefaultConfigPath()
+	if err != nil {
+		return nil, err
+	}
 
 	return ConfigFromFile(path)
 }
+
+// LoadConfig loads the config file given by the config flag or KUBEDUMP_CONFIG, or the default config file if neither
+// is set. If the default config file does not exist, the default config is used. The returned bool is true if no config
+// file was found.
+func LoadConfig(ctx *cli.Context) (*Config, bool, error) {
+	if configPath := ctx.String(FlagNameConfig); configPath != "" {
+		config, err := ConfigFromFile(configPath)
+		if err != nil {
+			return nil, false, fmt.Errorf("could not load kubedump config: %w", err)
+		}
+
+		return config, false, nil
+	}
+
+	config, err := ConfigFromDefaultFile()
+	if os.IsNotExist(err) {
+		return DefaultConfig(), true, nil
+	} else if err != nil {
+		return nil, false, fmt.Errorf("could not load kubedump config: %w", err)
+	}
+
+	return config, false, nil
+}
+
+// ResolveConfig loads the config file, and applies the selected profile and any flags or environment variables set in
+// ctx, returning the validated effective config.
+func ResolveConfig(ctx *cli.Context) (*Config, bool, error) {
+	config, notFound, err := LoadConfig(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := config.ApplyProfile(ctx.String(FlagNameProfile)); err != nil {
+		return nil, false, err
+	}
+
+	if err := config.ApplyFlags(ctx); err != nil {
+		return nil, false, err
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, false, fmt.Errorf("invalid config: %w", err)
+	}
+
+	return config, notFound, nil
+}
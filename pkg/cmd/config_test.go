@@ -0,0 +1,268 @@
+package kubedump
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	kubedump "github.com/joshmeranda/kubedump/pkg"
+	"github.com/joshmeranda/kubedump/pkg/controller"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+	"sigs.k8s.io/yaml"
+)
+
+const sampleConfig = `
+DefaultFilter: namespace default
+LogSyncTimeout: 10s
+Profiles:
+  ingress:
+    Filter: namespace ingress-nginx
+    IncludeResources:
+      - networking.k8s.io/*
+      - services
+    RedactSecrets: true
+    Destination: "kubedump-{{ .Profile }}-{{ .Time }}.dump"
+  debug:
+    RedactSecrets: false
+`
+
+func writeConfig(t *testing.T, data string) string {
+	configPath := path.Join(t.TempDir(), ConfigFileName)
+	require.NoError(t, os.WriteFile(configPath, []byte(data), 0644))
+
+	return configPath
+}
+
+// resolveConfigWithArgs runs `kubedump config show` with the given arguments and returns the resolved config.
+func resolveConfigWithArgs(t *testing.T, args ...string) (*Config, error) {
+	var config *Config
+
+	app := NewKubedumpApp()
+	app.Commands = []*cli.Command{
+		{
+			Name: "show",
+			Action: func(ctx *cli.Context) error {
+				var err error
+				config, _, err = ResolveConfig(ctx)
+				return err
+			},
+			Flags: configFlags(),
+		},
+	}
+
+	err := app.Run(append([]string{"kubedump"}, args...))
+
+	return config, err
+}
+
+func TestConfigProfile(t *testing.T) {
+	config := DefaultConfig()
+	require.NoError(t, yaml.UnmarshalStrict([]byte(sampleConfig), config))
+
+	profile, err := config.Profile("ingress")
+	require.NoError(t, err)
+
+	assert.Equal(t, "namespace ingress-nginx", profile.Filter)
+	assert.Equal(t, []ResourceSelector{{Group: "networking.k8s.io", Resource: "*"}, {Resource: "services"}}, profile.IncludeResources)
+	require.NotNil(t, profile.RedactSecrets)
+	assert.True(t, *profile.RedactSecrets)
+
+	profile, err = config.Profile("")
+	require.NoError(t, err)
+	assert.Equal(t, Profile{}, profile)
+
+	_, err = config.Profile("storage")
+	assert.Error(t, err)
+}
+
+func TestConfigApplyProfile(t *testing.T) {
+	config := DefaultConfig()
+	require.NoError(t, yaml.UnmarshalStrict([]byte(sampleConfig), config))
+
+	require.NoError(t, config.ApplyProfile("ingress"))
+
+	assert.Equal(t, "namespace ingress-nginx", config.DefaultFilter)
+	assert.Equal(t, "10s", config.LogSyncTimeout)
+	assert.True(t, config.RedactSecrets)
+
+	destination, err := config.RenderDestination(time.Date(2023, 10, 1, 12, 30, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, "kubedump-ingress-2023-10-01-12:30:00.dump", destination)
+}
+
+func TestConfigApplyProfileRedactSecrets(t *testing.T) {
+	config := DefaultConfig()
+	require.NoError(t, yaml.UnmarshalStrict([]byte(sampleConfig+"RedactSecrets: true\n"), config))
+
+	// a profile which does not set RedactSecrets keeps the top level value
+	config.Profiles["empty"] = Profile{}
+	require.NoError(t, config.ApplyProfile("empty"))
+	assert.True(t, config.RedactSecrets)
+
+	require.NoError(t, config.ApplyProfile("debug"))
+	assert.False(t, config.RedactSecrets)
+}
+
+func TestConfigFromFileUnknownField(t *testing.T) {
+	_, err := ConfigFromFile(writeConfig(t, "DefaultFiltre: namespace default\n"))
+	assert.Error(t, err)
+
+	_, err = ConfigFromFile(writeConfig(t, "ExcludeResources:\n  - Group: apps\n    Resorce: deployments\n"))
+	assert.Error(t, err)
+
+	_, err = ConfigFromFile(writeConfig(t, "Triggers:\n  - Name: crash-loop\n    Action: [marker]\n"))
+	assert.Error(t, err)
+}
+
+func TestConfigValidate(t *testing.T) {
+	config := DefaultConfig()
+	assert.NoError(t, config.Validate())
+
+	config.LogSyncTimeout = "soon"
+	assert.Error(t, config.Validate())
+
+	config = DefaultConfig()
+	config.Profiles["bad"] = Profile{Filter: "pod and"}
+	assert.Error(t, config.Validate())
+}
+
+func TestConfigParseTriggers(t *testing.T) {
+	config, err := ConfigFromFile(writeConfig(t, `
+Triggers:
+  - name: crash-loop
+    on: field .status.containerStatuses[*].state.waiting.reason = CrashLoopBackOff
+    actions: [marker, previous-logs]
+  - name: warnings
+    on: field .type = Warning
+`))
+	require.NoError(t, err)
+
+	triggers, err := config.ParseTriggers()
+	require.NoError(t, err)
+	require.Len(t, triggers, 2)
+
+	assert.Equal(t, "crash-loop", triggers[0].Name)
+	assert.Equal(t, []controller.TriggerAction{controller.TriggerActionMarker, controller.TriggerActionPreviousLogs}, triggers[0].Actions)
+	assert.Equal(t, "warnings", triggers[1].Name)
+	assert.Empty(t, triggers[1].Actions)
+
+	config.Triggers = append(config.Triggers, TriggerConfig{Name: "warnings", On: "label app=web"})
+	assert.Error(t, config.Validate(), "trigger names should be unique")
+
+	_, err = TriggerConfig{Name: "bad/name"}.Trigger()
+	assert.Error(t, err)
+
+	_, err = TriggerConfig{Name: "bad-filter", On: "pod and"}.Trigger()
+	assert.Error(t, err)
+
+	_, err = TriggerConfig{Name: "bad-action", Actions: []string{"reboot"}}.Trigger()
+	assert.Error(t, err)
+}
+
+func TestLogsConfigLimits(t *testing.T) {
+	limits, err := LogsConfig{MaxContainerSize: "1Mi", MaxSegments: 3, MaxTotalSize: "1G"}.Limits()
+	require.NoError(t, err)
+	assert.Equal(t, kubedump.LogLimits{
+		MaxContainerSize: 1 << 20,
+		MaxSegments:      3,
+		MaxTotalSize:     1_000_000_000,
+		DropPolicy:       kubedump.LogDropNewest,
+	}, limits)
+
+	_, err = LogsConfig{MaxContainerSize: "lots"}.Limits()
+	assert.Error(t, err)
+
+	_, err = LogsConfig{MaxTotalSize: "-1Mi"}.Limits()
+	assert.Error(t, err)
+
+	_, err = LogsConfig{DropPolicy: "random"}.Limits()
+	assert.Error(t, err)
+
+	config, err := resolveConfigWithArgs(t, "show", "--max-container-log-size", "10Mi", "--max-log-size", "1Gi", "--log-drop-policy", "oldest")
+	require.NoError(t, err)
+	assert.Equal(t, LogsConfig{MaxContainerSize: "10Mi", MaxSegments: 5, MaxTotalSize: "1Gi", DropPolicy: "oldest"}, config.Logs)
+}
+
+func TestResolveConfigPrecedence(t *testing.T) {
+	configPath := writeConfig(t, sampleConfig)
+
+	config, err := resolveConfigWithArgs(t, "--config", configPath, "show")
+	require.NoError(t, err)
+	assert.Equal(t, "namespace default", config.DefaultFilter)
+	assert.Equal(t, "10s", config.LogSyncTimeout)
+	assert.Equal(t, 5, config.DefaultNWorkers)
+
+	config, err = resolveConfigWithArgs(t, "--config", configPath, "show", "--profile", "ingress")
+	require.NoError(t, err)
+	assert.Equal(t, "namespace ingress-nginx", config.DefaultFilter)
+
+	t.Setenv("KUBEDUMP_FILTER", "namespace from-env")
+
+	config, err = resolveConfigWithArgs(t, "--config", configPath, "show", "--profile", "ingress")
+	require.NoError(t, err)
+	assert.Equal(t, "namespace from-env", config.DefaultFilter)
+
+	config, err = resolveConfigWithArgs(t, "--config", configPath, "show", "--profile", "ingress", "--filter", "namespace from-flag", "--log-sync-timeout", "1s")
+	require.NoError(t, err)
+	assert.Equal(t, "namespace from-flag", config.DefaultFilter)
+	assert.Equal(t, "1s", config.LogSyncTimeout)
+}
+
+func TestResolveConfigProfileSections(t *testing.T) {
+	configPath := writeConfig(t, `
+Logs:
+  MaxContainerSize: 10Mi
+Ring:
+  Window: 5m
+  MaxSize: 64Mi
+Profiles:
+  flaky:
+    Logs:
+      MaxTotalSize: 1Gi
+    Upload:
+      Bucket: dumps
+    Ring:
+      Window: 15m
+      Trigger: Pod default/web-*
+`)
+
+	config, err := resolveConfigWithArgs(t, "--config", configPath, "show")
+	require.NoError(t, err)
+	assert.Equal(t, RingConfig{Window: "5m", MaxSize: "64Mi"}, config.Ring)
+	assert.False(t, config.Upload.Enabled())
+
+	config, err = resolveConfigWithArgs(t, "--config", configPath, "show", "--profile", "flaky")
+	require.NoError(t, err)
+	assert.Equal(t, LogsConfig{MaxContainerSize: "10Mi", MaxSegments: 5, MaxTotalSize: "1Gi", DropPolicy: "newest"}, config.Logs)
+	assert.Equal(t, "dumps", config.Upload.Bucket)
+	assert.Equal(t, "https://s3.amazonaws.com", config.Upload.Endpoint)
+	assert.Equal(t, RingConfig{Window: "15m", MaxSize: "64Mi", Trigger: "Pod default/web-*"}, config.Ring)
+	assert.True(t, config.Ring.Enabled())
+
+	t.Setenv("KUBEDUMP_RING", "1m")
+
+	config, err = resolveConfigWithArgs(t, "--config", configPath, "show", "--profile", "flaky", "--ring-max-size", "1Gi")
+	require.NoError(t, err)
+	assert.Equal(t, RingConfig{Window: "1m0s", MaxSize: "1Gi", Trigger: "Pod default/web-*"}, config.Ring)
+
+	config, err = resolveConfigWithArgs(t, "--config", configPath, "show", "--profile", "flaky", "--ring", "0s")
+	require.NoError(t, err)
+	assert.False(t, config.Ring.Enabled())
+
+	_, err = resolveConfigWithArgs(t, "--config", writeConfig(t, "Profiles:\n  bad:\n    Ring:\n      Trigger: pod and\n"), "show")
+	assert.ErrorContains(t, err, "invalid profile 'bad'")
+}
+
+func TestResolveConfigMissingFile(t *testing.T) {
+	_, err := resolveConfigWithArgs(t, "--config", path.Join(t.TempDir(), "missing.yaml"), "show")
+	assert.Error(t, err)
+
+	t.Setenv("KUBEDUMP_CONFIG", writeConfig(t, "DefaultNWorkers: 3\n"))
+
+	config, err := resolveConfigWithArgs(t, "show")
+	require.NoError(t, err)
+	assert.Equal(t, 3, config.DefaultNWorkers)
+}
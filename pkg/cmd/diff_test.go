@@ -0,0 +1,102 @@
+package kubedump
+
+import (
+	"bytes"
+	"path"
+	"testing"
+	"time"
+
+	kubedump "github.com/joshmeranda/kubedump/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apicorev1 "k8s.io/api/core/v1"
+	apimetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func testDiffPod(resourceVersion string, image string) *apicorev1.Pod {
+	return &apicorev1.Pod{
+		TypeMeta: apimetav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: apimetav1.ObjectMeta{
+			Name:            "web",
+			Namespace:       "default",
+			ResourceVersion: resourceVersion,
+			Labels:          map[string]string{"app": "web"},
+		},
+		Spec: apicorev1.PodSpec{
+			Containers: []apicorev1.Container{{Name: "app", Image: image}},
+		},
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	staging, prod := t.TempDir(), t.TempDir()
+
+	pod := testDiffPod("1", "web:1")
+	pod.Annotations = map[string]string{"example.com/owner": "team"}
+	writeTestResource(t, staging, pod)
+	writeTestResource(t, staging, &apicorev1.ConfigMap{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "web-config", Namespace: "default"},
+	})
+
+	pod = testDiffPod("2", "web:2")
+	pod.Labels["tier"] = "frontend"
+	pod.Annotations = map[string]string{"example.com/owner": "other-team"}
+	writeTestResource(t, prod, pod)
+	writeTestResource(t, prod, &apicorev1.Secret{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "web-secret", Namespace: "default"},
+	})
+
+	app := NewKubedumpApp()
+	out := &bytes.Buffer{}
+	app.Writer = out
+
+	require.NoError(t, app.Run([]string{"kubedump", "diff", staging, prod}))
+	assert.Equal(t, `- ConfigMap default/web-config
+~ Pod default/web
+    ~ metadata.annotations["example.com/owner"]: "team" -> "other-team"
+    + metadata.labels.tier: "frontend"
+    ~ spec.containers[name=app].image: "web:1" -> "web:2"
++ Secret default/web-secret
+`, out.String())
+
+	out.Reset()
+	require.NoError(t, app.Run([]string{"kubedump", "diff", "--ignore", "metadata.labels", "--ignore", "spec.containers.image", staging, prod, "Pod default/*"}))
+	assert.Equal(t, `~ Pod default/web
+    ~ metadata.annotations["example.com/owner"]: "team" -> "other-team"
+    ~ metadata.resourceVersion: "1" -> "2"
+`, out.String())
+}
+
+func TestDiffPointsInTime(t *testing.T) {
+	dbPath := path.Join(t.TempDir(), kubedump.DBFileName)
+
+	sink, err := kubedump.NewDBSink(dbPath)
+	require.NoError(t, err)
+
+	writePod := func(pod *apicorev1.Pod) {
+		obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pod)
+		require.NoError(t, err)
+		require.NoError(t, sink.WriteResource(&unstructured.Unstructured{Object: obj}))
+	}
+
+	writePod(testDiffPod("1", "web:1"))
+	time.Sleep(10 * time.Millisecond)
+	from := time.Now().UTC().Format(time.RFC3339Nano)
+	time.Sleep(10 * time.Millisecond)
+	writePod(testDiffPod("2", "web:2"))
+
+	require.NoError(t, sink.Close())
+
+	app := NewKubedumpApp()
+	out := &bytes.Buffer{}
+	app.Writer = out
+
+	require.NoError(t, app.Run([]string{"kubedump", "diff", "--from", from, dbPath}))
+	assert.Equal(t, "~ Pod default/web\n    ~ spec.containers[name=app].image: \"web:1\" -> \"web:2\"\n", out.String())
+
+	assert.Error(t, app.Run([]string{"kubedump", "diff", "--to", from, dbPath}), "--to without --from should fail")
+}
@@ -2,6 +2,8 @@ package kubedump
 
 import (
 	"fmt"
+	"io"
+	"io/fs"
 	"log/slog"
 	"os"
 	"path"
@@ -9,15 +11,37 @@ import (
 
 	kubedump "github.com/joshmeranda/kubedump/pkg"
 	"github.com/joshmeranda/kubedump/pkg/filter"
-	cp "github.com/otiai10/copy"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// FilterModeMatching copies only the resources matching the filter.
+	FilterModeMatching = "matching"
+
+	// FilterModeRelated copies the resources matching the filter, and the resources they are linked to or linked
+	// under, transitively.
+	FilterModeRelated = "related"
 )
 
 type filteringOptions struct {
 	Filter              filter.Expression
 	DestinationBasePath string
+	Mode                string
 	Logger              *slog.Logger
 }
 
+// dumpLink is a symlink from the resource directory of parent to the resource directory of child.
+type dumpLink struct {
+	Parent kubedump.ResourcePathBuilder
+	Child  kubedump.ResourcePathBuilder
+
+	// Path is the path of the symlink relative to the dump.
+	Path string
+
+	// Target is the relative path the symlink points to.
+	Target string
+}
+
 func isSymlink(filePath string) (bool, error) {
 	info, err := os.Lstat(filePath)
 
@@ -28,102 +52,279 @@ func isSymlink(filePath string) (bool, error) {
 	return info.Mode()&os.ModeSymlink == os.ModeSymlink, nil
 }
 
-func filterKubedumpDir(dir string, opts filteringOptions) error {
-	if err := os.MkdirAll(opts.DestinationBasePath, 0755); err != nil {
-		return fmt.Errorf("could not create destination: %w", err)
+// isResourceFile returns true if the given file name is one of the files expected in a resource directory.
+func isResourceFile(resource kubedump.Resource, name string) bool {
+	switch name {
+	case resource.GetName() + ".yaml", resource.GetName() + ".events", resource.GetName() + kubedump.LinksFileSuffix, resource.GetName() + kubedump.RulesFileSuffix,
+		resource.GetName() + kubedump.NodePodsFileSuffix, resource.GetName() + kubedump.NodeConditionsFileSuffix:
+		return true
+	default:
+		return kubedump.IsLogFile(name)
 	}
+}
 
-	if err := kubedump.ForEachResource(dir, func(builder kubedump.ResourcePathBuilder) error {
-		return filterResourceDir(builder, opts)
-	}); err != nil {
-		return err
+// resourceBuilderFromPath returns the builder for the resource whose directory is at resourceDir, relative to the root
+// of the dump.
+func resourceBuilderFromPath(resourceDir string) (kubedump.ResourcePathBuilder, error) {
+	if !fs.ValidPath(resourceDir) {
+		return kubedump.ResourcePathBuilder{}, fmt.Errorf("'%s' is outside of the dump", resourceDir)
 	}
 
-	return nil
+	builder := kubedump.ResourcePathBuilder{}
+	parts := strings.Split(resourceDir, "/")
+
+	switch len(parts) {
+	case 2:
+		return builder.WithKind(parts[0]).WithName(parts[1]), nil
+	case 3:
+		return builder.WithNamespace(parts[0]).WithKind(parts[1]).WithName(parts[2]), nil
+	default:
+		return kubedump.ResourcePathBuilder{}, fmt.Errorf("'%s' is not a resource directory", resourceDir)
+	}
 }
 
-func filterResourceDir(builder kubedump.ResourcePathBuilder, opts filteringOptions) error {
+// findDumpLinks returns the links to other resources found in the resource directory of builder.
+func findDumpLinks(fsys kubedump.DumpFS, builder kubedump.ResourcePathBuilder, logger *slog.Logger) ([]dumpLink, error) {
+	links := make([]dumpLink, 0)
 	resourceDir := builder.Build()
-	resourceFile := path.Join(resourceDir, builder.Name+".yaml")
-	resource, err := kubedump.NewResourceFromFile(resourceFile)
+
+	err := fs.WalkDir(fsys, resourceDir, func(linkPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.Type()&fs.ModeSymlink != fs.ModeSymlink {
+			return nil
+		}
+
+		target, err := fsys.ReadLink(linkPath)
+		if err != nil {
+			return fmt.Errorf("could not read link at '%s': %w", linkPath, err)
+		}
+
+		child, err := resourceBuilderFromPath(path.Join(path.Dir(linkPath), target))
+		if err != nil {
+			logger.Warn(fmt.Sprintf("ignoring link at '%s': %s", linkPath, err))
+			return nil
+		}
+
+		if _, err := fs.Stat(fsys, child.Build()); err != nil {
+			logger.Warn(fmt.Sprintf("ignoring broken link at '%s'", linkPath))
+			return nil
+		}
+
+		links = append(links, dumpLink{
+			Parent: builder,
+			Child:  child,
+			Path:   linkPath,
+			Target: target,
+		})
+
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("could not unmarshal resource file: %w", err)
+		return nil, fmt.Errorf("could not walk resource dir '%s': %w", resourceDir, err)
+	}
+
+	return links, nil
+}
+
+// relatedClosure adds to selected every resource transitively linked under a selected resource, and every resource a
+// selected resource is transitively linked under.
+func relatedClosure(selected map[kubedump.ResourcePathBuilder]bool, links []dumpLink) {
+	children := make(map[kubedump.ResourcePathBuilder][]kubedump.ResourcePathBuilder)
+	parents := make(map[kubedump.ResourcePathBuilder][]kubedump.ResourcePathBuilder)
+
+	for _, link := range links {
+		children[link.Parent] = append(children[link.Parent], link.Child)
+		parents[link.Child] = append(parents[link.Child], link.Parent)
+	}
+
+	matching := make([]kubedump.ResourcePathBuilder, 0, len(selected))
+	for builder := range selected {
+		matching = append(matching, builder)
+	}
+
+	// owners and children are followed separately, so that the other children of an owner are not included
+	for _, edges := range []map[kubedump.ResourcePathBuilder][]kubedump.ResourcePathBuilder{children, parents} {
+		visited := make(map[kubedump.ResourcePathBuilder]bool)
+		queue := append([]kubedump.ResourcePathBuilder{}, matching...)
+
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
+
+			if visited[current] {
+				continue
+			}
+
+			visited[current] = true
+			selected[current] = true
+			queue = append(queue, edges[current]...)
+		}
 	}
+}
+
+// filterKubedumpDir copies the resources selected from the dump in fsys to the destination directory.
+func filterKubedumpDir(fsys kubedump.DumpFS, opts filteringOptions) error {
+	if opts.Mode != FilterModeMatching && opts.Mode != FilterModeRelated {
+		return fmt.Errorf("unsupported filter mode '%s'", opts.Mode)
+	}
+
+	selected := make(map[kubedump.ResourcePathBuilder]bool)
+	links := make([]dumpLink, 0)
+
+	if err := kubedump.ForEachResourceFS(fsys, func(builder kubedump.ResourcePathBuilder) error {
+		resource, err := kubedump.NewResourceFromFS(fsys, path.Join(builder.Build(), builder.Name+".yaml"))
+		if err != nil {
+			return fmt.Errorf("could not unmarshal resource file: %w", err)
+		}
+
+		if opts.Filter.Matches(resource) {
+			selected[builder] = true
+		}
+
+		resourceLinks, err := findDumpLinks(fsys, builder, opts.Logger)
+		if err != nil {
+			return err
+		}
+
+		links = append(links, resourceLinks...)
 
-	if !opts.Filter.Matches(resource) {
 		return nil
+	}); err != nil {
+		return err
+	}
+
+	if opts.Mode == FilterModeRelated {
+		relatedClosure(selected, links)
+	}
+
+	if err := os.MkdirAll(opts.DestinationBasePath, 0755); err != nil {
+		return fmt.Errorf("could not create destination: %w", err)
+	}
+
+	for builder := range selected {
+		if err := copyResourceDir(fsys, builder, selected, opts); err != nil {
+			opts.Logger.Error(fmt.Sprintf("could not copy resource '%s': %s", builder.Build(), err))
+		}
 	}
 
-	if err := copyResourceDir(resource, resourceDir, opts); err != nil {
-		opts.Logger.Error(fmt.Sprintf("could not copy resource '%s': %s", resource, err))
+	for _, link := range links {
+		if !selected[link.Parent] || !selected[link.Child] {
+			continue
+		}
+
+		linkPath := path.Join(opts.DestinationBasePath, link.Path)
+		if err := os.MkdirAll(path.Dir(linkPath), 0755); err != nil {
+			return fmt.Errorf("could not create parents for '%s': %w", linkPath, err)
+		}
+
+		if err := os.Symlink(link.Target, linkPath); err != nil {
+			return fmt.Errorf("could not create symlink '%s': %w", linkPath, err)
+		}
 	}
 
 	return nil
 }
 
-func copyResourceDir(resource kubedump.Resource, resourceDir string, opts filteringOptions) error {
-	resourceDestinationDir := kubedump.ResourcePathBuilder{}.
-		WithBase(opts.DestinationBasePath).
-		WithResource(resource).
-		Build()
+// copyResourceDir copies the files in the resource directory of builder to the destination. Links are not copied, and
+// references to resources which were not selected are removed from the links file.
+func copyResourceDir(fsys kubedump.DumpFS, builder kubedump.ResourcePathBuilder, selected map[kubedump.ResourcePathBuilder]bool, opts filteringOptions) error {
+	resourceDir := builder.Build()
+	resourceDestinationDir := builder.WithBase(opts.DestinationBasePath).Build()
 
-	// todo: will probably skip symlinks
-	// copy resource dir
-	if err := cp.Copy(resourceDir, resourceDestinationDir, cp.Options{}); err != nil {
-		return fmt.Errorf("could not copy resource dir: %s", resourceDir)
+	if err := os.MkdirAll(resourceDestinationDir, 0755); err != nil {
+		return fmt.Errorf("could not create resource dir: %w", err)
 	}
 
-	// check for child resources
-	entries, err := os.ReadDir(resourceDir)
+	entries, err := fs.ReadDir(fsys, resourceDir)
 	if err != nil {
 		return fmt.Errorf("could not read resource dir '%s': %w", resourceDir, err)
 	}
 
+	resource := kubedump.NewResourceBuilder().WithName(builder.Name).Build()
+
 	for _, entry := range entries {
-		if entry.IsDir() {
-			if err := copySubResourceKind(entry.Name(), path.Join(resourceDir, entry.Name()), resource, opts); err != nil {
-				opts.Logger.Error(fmt.Sprintf("could not copy '%s' resource for '%s': %s", entry.Name(), resource, err))
+		filePath := path.Join(resourceDir, entry.Name())
+		destinationPath := path.Join(resourceDestinationDir, entry.Name())
+
+		switch {
+		case entry.IsDir() || entry.Type()&fs.ModeSymlink == fs.ModeSymlink:
+			// links are recreated once all resources are copied
+			continue
+		case entry.Name() == builder.Name+kubedump.LinksFileSuffix:
+			if err := copyLinksFile(fsys, filePath, destinationPath, selected); err != nil {
+				return err
 			}
-		} else if entry.Name() != resource.GetName()+".yaml" && !strings.HasSuffix(entry.Name(), ".log") {
-			opts.Logger.Warn(fmt.Sprintf("found unexpected file: %s", path.Join(resourceDir, entry.Name())))
+		case isResourceFile(resource, entry.Name()):
+			if err := copyFile(fsys, filePath, destinationPath); err != nil {
+				return err
+			}
+		default:
+			opts.Logger.Warn(fmt.Sprintf("found unexpected file: %s", filePath))
 		}
 	}
 
 	return nil
 }
 
-func copySubResourceKind(kind string, dir string, parent kubedump.Resource, opts filteringOptions) error {
-	entries, err := os.ReadDir(dir)
+// copyLinksFile copies the references in a links file to the selected resources.
+func copyLinksFile(fsys kubedump.DumpFS, linksFile string, destination string, selected map[kubedump.ResourcePathBuilder]bool) error {
+	data, err := fs.ReadFile(fsys, linksFile)
 	if err != nil {
-		return fmt.Errorf("could not read dir for kind '%s' in resource '%s': %w", kind, parent, err)
+		return fmt.Errorf("could not read links file '%s': %w", linksFile, err)
 	}
 
-	for _, entry := range entries {
-		linkPath := path.Join(dir, entry.Name())
+	var references []kubedump.LinkReference
+	if err := yaml.Unmarshal(data, &references); err != nil {
+		return fmt.Errorf("could not unmarshal links file '%s': %w", linksFile, err)
+	}
 
-		if isLink, err := isSymlink(linkPath); isLink {
-			linkDest, err := os.Readlink(linkPath)
-			if err != nil {
-				opts.Logger.Error(fmt.Sprintf("could not read link at '%s': %s", linkPath, err))
-			}
+	kept := make([]kubedump.LinkReference, 0, len(references))
+	for _, reference := range references {
+		child := kubedump.ResourcePathBuilder{}.
+			WithNamespace(reference.Namespace).
+			WithKind(reference.Kind).
+			WithName(reference.Name)
 
-			realPath := path.Clean(path.Join(dir, linkDest))
+		if selected[child] {
+			kept = append(kept, reference)
+		}
+	}
 
-			resourceFile := path.Join(realPath, entry.Name()+".yaml")
-			resource, err := kubedump.NewResourceFromFile(resourceFile)
-			if err != nil {
-				return fmt.Errorf("could not unmarshal resoruce file: %w", err)
-			}
+	if len(kept) == 0 {
+		return nil
+	}
 
-			if err := copyResourceDir(resource, realPath, opts); err != nil {
-				opts.Logger.Error(fmt.Sprintf("could not copy resourec '%s': %s", resource, err))
-			}
-		} else if err != nil {
-			opts.Logger.Error(fmt.Sprintf("could not check if path '%s' is a symbolic link: %s", linkPath, err))
-		} else {
-			opts.Logger.Warn(fmt.Sprintf("encountered unexpected file '%s'", path.Join(dir, entry.Name())))
-		}
+	if data, err = yaml.Marshal(kept); err != nil {
+		return fmt.Errorf("could not marshal links file '%s': %w", destination, err)
+	}
+
+	if err := os.WriteFile(destination, data, 0644); err != nil {
+		return fmt.Errorf("could not write links file '%s': %w", destination, err)
 	}
 
 	return nil
 }
+
+// copyFile copies the file at name in fsys to destination.
+func copyFile(fsys fs.FS, name string, destination string) error {
+	src, err := fsys.Open(name)
+	if err != nil {
+		return fmt.Errorf("could not open file '%s': %w", name, err)
+	}
+	defer src.Close()
+
+	dst, err := os.Create(destination)
+	if err != nil {
+		return fmt.Errorf("could not create file '%s': %w", destination, err)
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return fmt.Errorf("could not copy file '%s': %w", name, err)
+	}
+
+	return dst.Close()
+}
@@ -1,13 +1,17 @@
 package kubedump
 
 import (
+	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
 	"testing"
 
+	kubedump "github.com/joshmeranda/kubedump/pkg"
 	"github.com/joshmeranda/kubedump/tests"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
 )
 
 var (
@@ -68,6 +72,71 @@ func TestFilteringLinked(t *testing.T) {
 
 	assert.NoDirExists(t, path.Join(destination, "default", "Pod"))
 	assert.DirExists(t, path.Join(destination, "default", "Service"))
-	// todo: clean up broken links
-	// assert.NoFileExists(t, path.Join(destination, "default", "Service", "sample-service", "Pod", "sample-pod.yaml"))
+	assert.NoDirExists(t, path.Join(destination, "default", "Service", "sample-service", "Pod"))
+	assert.NoFileExists(t, path.Join(destination, "default", "Service", "sample-service", "sample-service"+kubedump.LinksFileSuffix))
+}
+
+func TestFilteringRelated(t *testing.T) {
+	teardown, destination, basePath := setupFiltering(t, linkedServiceDumpPath)
+	defer teardown()
+
+	app := NewKubedumpApp()
+
+	if err := app.Run([]string{"kubedump", "filter", "--verbose", "--mode", FilterModeRelated, "--destination", destination, basePath, "Secret default/sample-secret"}); err != nil {
+		t.Fatalf("filtering failed: %s", err)
+	}
+
+	assert.FileExists(t, path.Join(destination, "default", "Secret", "sample-secret", "sample-secret.yaml"))
+	assert.FileExists(t, path.Join(destination, "default", "Pod", "sample-pod", "sample-pod.yaml"))
+	assert.FileExists(t, path.Join(destination, "default", "Service", "sample-service", "sample-service.yaml"))
+
+	// the pod's other children are not related to the secret
+	assert.NoDirExists(t, path.Join(destination, "default", "ConfigMap"))
+	assert.NoDirExists(t, path.Join(destination, "default", "Pod", "sample-pod", "ConfigMap"))
+
+	for _, link := range []string{
+		path.Join(destination, "default", "Service", "sample-service", "Pod", "sample-pod"),
+		path.Join(destination, "default", "Pod", "sample-pod", "Secret", "sample-secret"),
+	} {
+		isLink, err := isSymlink(link)
+		require.NoError(t, err)
+		assert.True(t, isLink)
+	}
+
+	assert.FileExists(t, path.Join(destination, "default", "Service", "sample-service", "Pod", "sample-pod", "sample-pod.yaml"))
+
+	data, err := os.ReadFile(path.Join(destination, "default", "Pod", "sample-pod", "sample-pod"+kubedump.LinksFileSuffix))
+	require.NoError(t, err)
+
+	var references []kubedump.LinkReference
+	require.NoError(t, yaml.Unmarshal(data, &references))
+	assert.Equal(t, []kubedump.LinkReference{
+		{Kind: "Secret", Namespace: "default", Name: "sample-secret", Types: []kubedump.LinkType{kubedump.LinkTypeVolume}},
+	}, references)
+}
+
+func TestFilteringArchive(t *testing.T) {
+	teardown, destination, basePath := setupFiltering(t, linkedServiceDumpPath)
+	defer teardown()
+
+	archivePath := basePath + ".tar.gz"
+	require.NoError(t, kubedump.WriteArchive(basePath, archivePath))
+
+	destination += ".zip"
+
+	app := NewKubedumpApp()
+
+	if err := app.Run([]string{"kubedump", "filter", "--mode", FilterModeRelated, "--destination", destination, archivePath, "Service default/sample-service"}); err != nil {
+		t.Fatalf("filtering failed: %s", err)
+	}
+
+	fsys, err := kubedump.OpenDump(destination)
+	require.NoError(t, err)
+
+	target, err := fsys.ReadLink("default/Service/sample-service/Pod/sample-pod")
+	require.NoError(t, err)
+	assert.Equal(t, "../../../Pod/sample-pod", target)
+
+	_, err = fs.Stat(fsys, "default/Pod/sample-pod/Secret/sample-secret/sample-secret.yaml")
+	assert.NoError(t, err)
 }
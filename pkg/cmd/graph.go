@@ -0,0 +1,239 @@
+package kubedump
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	kubedump "github.com/joshmeranda/kubedump/pkg"
+	"github.com/joshmeranda/kubedump/pkg/filter"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	GraphFormatDot     = "dot"
+	GraphFormatJson    = "json"
+	GraphFormatMermaid = "mermaid"
+)
+
+// GraphNode is a resource in the relationship graph.
+type GraphNode struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Namespace string    `json:"namespace,omitempty"`
+	Name      string    `json:"name"`
+	UID       types.UID `json:"uid,omitempty"`
+
+	// Missing is true if the resource is referenced by another resource but was not found in the dump.
+	Missing bool `json:"missing,omitempty"`
+}
+
+// GraphEdge is a relationship between two resources in the graph, pointing from the parent to the child as in the
+// symlinks created by `kubedump link`.
+type GraphEdge struct {
+	From  string              `json:"from"`
+	To    string              `json:"to"`
+	Types []kubedump.LinkType `json:"types"`
+}
+
+// ResourceGraph is the relationship graph between the resources in a dump.
+type ResourceGraph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// graphNodeId returns the id of the resource at builder in the graph.
+func graphNodeId(builder kubedump.ResourcePathBuilder) string {
+	if builder.Namespace == "" {
+		return builder.Kind + "/" + builder.Name
+	}
+
+	return builder.Kind + "/" + builder.Namespace + "/" + builder.Name
+}
+
+// BuildGraph builds the relationship graph for the dump in fsys. Only resources matching expr, and any resources they
+// are directly related to, are included in the graph.
+func BuildGraph(fsys fs.FS, expr filter.Expression) (*ResourceGraph, error) {
+	links, err := kubedump.ComputeLinksFS(fsys)
+	if err != nil {
+		return nil, fmt.Errorf("could not compute links: %w", err)
+	}
+
+	resources := make(map[string]kubedump.Resource)
+	matched := make(map[string]bool)
+
+	if err := kubedump.ForEachResourceFS(fsys, func(builder kubedump.ResourcePathBuilder) error {
+		resource, err := kubedump.NewResourceFromFS(fsys, path.Join(builder.Build(), builder.Name+".yaml"))
+		if err != nil {
+			return fmt.Errorf("could not read resource '%s': %w", builder.Name, err)
+		}
+
+		id := graphNodeId(builder)
+		resources[id] = resource
+		matched[id] = expr.Matches(resource)
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[string]GraphNode)
+	addNode := func(builder kubedump.ResourcePathBuilder) string {
+		id := graphNodeId(builder)
+
+		if _, found := nodes[id]; !found {
+			node := GraphNode{
+				ID:        id,
+				Kind:      builder.Kind,
+				Namespace: builder.Namespace,
+				Name:      builder.Name,
+			}
+
+			if resource, found := resources[id]; found {
+				node.UID = resource.GetUID()
+			} else {
+				node.Missing = true
+			}
+
+			nodes[id] = node
+		}
+
+		return id
+	}
+
+	graph := &ResourceGraph{
+		Nodes: []GraphNode{},
+		Edges: []GraphEdge{},
+	}
+
+	for id, isMatch := range matched {
+		if isMatch {
+			resource := resources[id]
+			addNode(kubedump.ResourcePathBuilder{}.
+				WithNamespace(resource.GetNamespace()).
+				WithKind(resource.GetKind()).
+				WithName(resource.GetName()))
+		}
+	}
+
+	for _, link := range links {
+		if !matched[graphNodeId(link.Parent)] && !matched[graphNodeId(link.Child)] {
+			continue
+		}
+
+		graph.Edges = append(graph.Edges, GraphEdge{
+			From:  addNode(link.Parent),
+			To:    addNode(link.Child),
+			Types: link.Types,
+		})
+	}
+
+	for _, node := range nodes {
+		graph.Nodes = append(graph.Nodes, node)
+	}
+
+	sort.Slice(graph.Nodes, func(i, j int) bool {
+		return graph.Nodes[i].ID < graph.Nodes[j].ID
+	})
+
+	return graph, nil
+}
+
+// label returns a human-readable label for the node.
+func (node GraphNode) label() string {
+	if node.Namespace == "" {
+		return node.Kind + "\n" + node.Name
+	}
+
+	return node.Kind + "\n" + node.Namespace + "/" + node.Name
+}
+
+func edgeLabel(edge GraphEdge) string {
+	types := make([]string, 0, len(edge.Types))
+	for _, t := range edge.Types {
+		types = append(types, string(t))
+	}
+
+	return strings.Join(types, ",")
+}
+
+// WriteGraph writes the graph to w in the given format.
+func WriteGraph(w io.Writer, graph *ResourceGraph, format string) error {
+	switch format {
+	case GraphFormatDot:
+		return writeGraphDot(w, graph)
+	case GraphFormatJson:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		if err := encoder.Encode(graph); err != nil {
+			return fmt.Errorf("could not encode graph: %w", err)
+		}
+
+		return nil
+	case GraphFormatMermaid:
+		return writeGraphMermaid(w, graph)
+	default:
+		return fmt.Errorf("received invalid format: %s", format)
+	}
+}
+
+func writeGraphDot(w io.Writer, graph *ResourceGraph) error {
+	builder := strings.Builder{}
+	builder.WriteString("digraph kubedump {\n")
+
+	for _, node := range graph.Nodes {
+		attributes := fmt.Sprintf("label=%q", node.label())
+		if node.Missing {
+			attributes += ", style=dashed"
+		}
+
+		builder.WriteString(fmt.Sprintf("\t%q [%s];\n", node.ID, attributes))
+	}
+
+	for _, edge := range graph.Edges {
+		builder.WriteString(fmt.Sprintf("\t%q -> %q [label=%q];\n", edge.From, edge.To, edgeLabel(edge)))
+	}
+
+	builder.WriteString("}\n")
+
+	if _, err := io.WriteString(w, builder.String()); err != nil {
+		return fmt.Errorf("could not write graph: %w", err)
+	}
+
+	return nil
+}
+
+func writeGraphMermaid(w io.Writer, graph *ResourceGraph) error {
+	// mermaid ids cannot contain most punctuation, so nodes are given ids by their index
+	ids := make(map[string]string, len(graph.Nodes))
+
+	builder := strings.Builder{}
+	builder.WriteString("graph LR\n")
+
+	for i, node := range graph.Nodes {
+		id := fmt.Sprintf("n%d", i)
+		ids[node.ID] = id
+
+		label := strings.ReplaceAll(node.label(), "\n", "<br/>")
+		if node.Missing {
+			builder.WriteString(fmt.Sprintf("\t%s([\"%s\"])\n", id, label))
+		} else {
+			builder.WriteString(fmt.Sprintf("\t%s[\"%s\"]\n", id, label))
+		}
+	}
+
+	for _, edge := range graph.Edges {
+		builder.WriteString(fmt.Sprintf("\t%s -->|%s| %s\n", ids[edge.From], edgeLabel(edge), ids[edge.To]))
+	}
+
+	if _, err := io.WriteString(w, builder.String()); err != nil {
+		return fmt.Errorf("could not write graph: %w", err)
+	}
+
+	return nil
+}
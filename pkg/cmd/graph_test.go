@@ -0,0 +1,126 @@
+package kubedump
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+
+	kubedump "github.com/joshmeranda/kubedump/pkg"
+	"github.com/joshmeranda/kubedump/pkg/filter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiappsv1 "k8s.io/api/apps/v1"
+	apicorev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	apimetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+// writeTestResource writes obj to its resource file in the dump at base.
+func writeTestResource(t *testing.T, base string, obj runtime.Object) {
+	accessor, err := meta.Accessor(obj)
+	require.NoError(t, err)
+
+	builder := kubedump.ResourcePathBuilder{}.
+		WithBase(base).
+		WithNamespace(accessor.GetNamespace()).
+		WithKind(obj.GetObjectKind().GroupVersionKind().Kind).
+		WithName(accessor.GetName())
+
+	data, err := yaml.Marshal(obj)
+	require.NoError(t, err)
+
+	require.NoError(t, os.MkdirAll(builder.Build(), 0755))
+	require.NoError(t, os.WriteFile(path.Join(builder.Build(), builder.Name+".yaml"), data, 0644))
+}
+
+func setupGraphDump(t *testing.T) string {
+	base := t.TempDir()
+
+	writeTestResource(t, base, &apiappsv1.ReplicaSet{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "apps/v1", Kind: "ReplicaSet"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "web-abc", Namespace: "default", UID: "rs-uid"},
+	})
+	writeTestResource(t, base, &apicorev1.Pod{
+		TypeMeta: apimetav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: apimetav1.ObjectMeta{
+			Name:            "web-abc-xyz",
+			Namespace:       "default",
+			UID:             "pod-uid",
+			OwnerReferences: []apimetav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web-abc", UID: "rs-uid"}},
+		},
+		Spec: apicorev1.PodSpec{
+			ServiceAccountName: "web",
+			Volumes: []apicorev1.Volume{
+				{Name: "config", VolumeSource: apicorev1.VolumeSource{ConfigMap: &apicorev1.ConfigMapVolumeSource{LocalObjectReference: apicorev1.LocalObjectReference{Name: "web-config"}}}},
+			},
+		},
+	})
+	writeTestResource(t, base, &apicorev1.ConfigMap{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "web-config", Namespace: "default", UID: "cm-uid"},
+	})
+	writeTestResource(t, base, &apicorev1.ConfigMap{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "unrelated", Namespace: "other", UID: "other-uid"},
+	})
+
+	return base
+}
+
+func TestBuildGraph(t *testing.T) {
+	base := setupGraphDump(t)
+
+	expr, err := filter.Parse("namespace default")
+	require.NoError(t, err)
+
+	graph, err := BuildGraph(kubedump.DirFS(base), expr)
+	require.NoError(t, err)
+
+	assert.Equal(t, []GraphNode{
+		{ID: "ConfigMap/default/web-config", Kind: "ConfigMap", Namespace: "default", Name: "web-config", UID: "cm-uid"},
+		{ID: "Pod/default/web-abc-xyz", Kind: "Pod", Namespace: "default", Name: "web-abc-xyz", UID: "pod-uid"},
+		{ID: "ReplicaSet/default/web-abc", Kind: "ReplicaSet", Namespace: "default", Name: "web-abc", UID: "rs-uid"},
+		{ID: "ServiceAccount/default/web", Kind: "ServiceAccount", Namespace: "default", Name: "web", Missing: true},
+	}, graph.Nodes)
+
+	assert.ElementsMatch(t, []GraphEdge{
+		{From: "Pod/default/web-abc-xyz", To: "ConfigMap/default/web-config", Types: []kubedump.LinkType{kubedump.LinkTypeVolume}},
+		{From: "Pod/default/web-abc-xyz", To: "ServiceAccount/default/web", Types: []kubedump.LinkType{kubedump.LinkTypeServiceAccount}},
+		{From: "ReplicaSet/default/web-abc", To: "Pod/default/web-abc-xyz", Types: []kubedump.LinkType{kubedump.LinkTypeOwner}},
+	}, graph.Edges)
+}
+
+func TestWriteGraph(t *testing.T) {
+	base := setupGraphDump(t)
+
+	expr, err := filter.Parse("namespace default")
+	require.NoError(t, err)
+
+	graph, err := BuildGraph(kubedump.DirFS(base), expr)
+	require.NoError(t, err)
+
+	buffer := bytes.Buffer{}
+	require.NoError(t, WriteGraph(&buffer, graph, GraphFormatDot))
+	assert.Contains(t, buffer.String(), "digraph kubedump {")
+	assert.Contains(t, buffer.String(), `"ReplicaSet/default/web-abc" -> "Pod/default/web-abc-xyz" [label="owner"];`)
+	assert.Contains(t, buffer.String(), `"ServiceAccount/default/web" [label="ServiceAccount\ndefault/web", style=dashed];`)
+
+	buffer.Reset()
+	require.NoError(t, WriteGraph(&buffer, graph, GraphFormatMermaid))
+	assert.Contains(t, buffer.String(), "graph LR")
+	assert.Contains(t, buffer.String(), `n2["ReplicaSet<br/>default/web-abc"]`)
+	assert.Contains(t, buffer.String(), "n2 -->|owner| n1")
+
+	buffer.Reset()
+	require.NoError(t, WriteGraph(&buffer, graph, GraphFormatJson))
+
+	decoded := ResourceGraph{}
+	require.NoError(t, json.Unmarshal(buffer.Bytes(), &decoded))
+	assert.Equal(t, *graph, decoded)
+
+	assert.Error(t, WriteGraph(&buffer, graph, "svg"))
+}
@@ -1,6 +1,7 @@
 package kubedump
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log/slog"
@@ -17,9 +18,12 @@ import (
 	"github.com/urfave/cli/v2"
 	"gopkg.in/yaml.v2"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	sigsyaml "sigs.k8s.io/yaml"
 )
 
 const (
@@ -30,21 +34,76 @@ const (
 
 	FlagNameLogSyncTimeout = "log-sync-timeout"
 
+	FlagNameDiscoveryRetryInterval = "discovery-retry-interval"
+
+	FlagNameWatchApiExtensions = "watch-api-extensions"
+
+	FlagNameLinkResources = "link-resources"
+
+	FlagNameArchive = "archive"
+
+	FlagNameFormat = "format"
+
+	FlagNameRing               = "ring"
+	FlagNameRingPost           = "ring-post"
+	FlagNameRingMaxSize        = "ring-max-size"
+	FlagNameRingTrigger        = "ring-trigger"
+	FlagNameRingTriggerAddress = "ring-trigger-address"
+
+	FlagNameIncludeResource = "include-resource"
+	FlagNameExcludeResource = "exclude-resource"
+
+	FlagNameProfile       = "profile"
+	FlagNameRedactSecrets = "redact-secrets"
+
+	FlagNameDestination = "destination"
+	FlagNameFilter      = "filter"
+	FlagNameWorkers     = "workers"
+
+	FlagNameMaxContainerLogSize = "max-container-log-size"
+	FlagNameMaxLogSize          = "max-log-size"
+	FlagNameLogDropPolicy       = "log-drop-policy"
+
+	FlagNameUploadEndpoint   = "upload-endpoint"
+	FlagNameUploadBucket     = "upload-bucket"
+	FlagNameUploadPrefix     = "upload-prefix"
+	FlagNameSnapshotInterval = "snapshot-interval"
+
 	DiscoverFormatYAML   = "yaml"
 	DiscoverFormatStruct = "go-struct"
+
+	// DumpFormatDir stores a dump as a directory tree.
+	DumpFormatDir = "dir"
+
+	// DumpFormatDB stores a dump in a single database file in the destination directory.
+	DumpFormatDB = "db"
 )
 
 var Version = ""
 
 var flagLogSyncTimeout = cli.DurationFlag{
 	Name:    FlagNameLogSyncTimeout,
-	Usage:   "specify a timeout for container log syncs",
-	Value:   time.Second * 2,
+	Usage:   "specify a timeout for container log syncs (default: 2s)",
 	EnvVars: []string{"KUBEDUMP_LOG_SYNC_TIMEOUT"},
 }
 
+var flagDiscoveryRetryInterval = cli.DurationFlag{
+	Name:    FlagNameDiscoveryRetryInterval,
+	Usage:   "how often to retry discovery for api groups which could not be discovered (0 to disable)",
+	Value:   0,
+	EnvVars: []string{"KUBEDUMP_DISCOVERY_RETRY_INTERVAL"},
+}
+
 func Dump(ctx *cli.Context) error {
-	basePath := ctx.String("destination")
+	kubedumpConfig, configNotFound, err := ResolveConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	basePath, err := kubedumpConfig.RenderDestination(time.Now())
+	if err != nil {
+		return fmt.Errorf("could not determine destination: %w", err)
+	}
 
 	if err := os.MkdirAll(basePath, 0755); err != nil && !os.IsExist(err) {
 		return fmt.Errorf("could not create base path '%s': %w", basePath, err)
@@ -63,54 +122,104 @@ func Dump(ctx *cli.Context) error {
 		loggerOptions.Level = slog.LevelDebug
 	}
 
-	logger := slog.New(slog.NewTextHandler(out, loggerOptions))
+	recorder := newErrorRecorder(slog.NewTextHandler(out, loggerOptions))
+	logger := slog.New(recorder)
 
-	kubedumpConfig, err := ConfigFromDefaultFile()
+	if configNotFound {
+		logger.Warn("no config found, using defaults")
+	}
+
+	if profileName := ctx.String(FlagNameProfile); profileName != "" {
+		logger.Info(fmt.Sprintf("using profile '%s'", profileName))
+	}
+
+	dumpFilter, err := kubedumpConfig.Filter()
 	if err != nil {
-		if os.IsNotExist(err) {
-			logger.Warn("no config found, using defaults")
-			kubedumpConfig = DefaultConfig()
-		} else {
-			return fmt.Errorf("could not load kubedump config: %w", err)
-		}
+		return err
 	}
 
-	var dumpFilter filter.Expression
-	if rawFilter := ctx.String("filter"); rawFilter != "" {
-		if dumpFilter, err = filter.Parse(rawFilter); err != nil {
-			return fmt.Errorf("could not parse filter from user '%s': %w", rawFilter, err)
-		}
-	} else {
-		if dumpFilter, err = filter.Parse(kubedumpConfig.DefaultFilter); err != nil {
-			return fmt.Errorf("could not parse filter from config '%s': %w", kubedumpConfig.DefaultFilter, err)
+	var uploader *dumpUploader
+	if kubedumpConfig.Upload.Enabled() {
+		if uploader, err = newDumpUploader(kubedumpConfig.Upload, basePath, logger); err != nil {
+			return err
 		}
 	}
 
+	logSyncTimeout, err := kubedumpConfig.GetLogSyncTimeout()
+	if err != nil {
+		return err
+	}
+
+	triggers, err := kubedumpConfig.ParseTriggers()
+	if err != nil {
+		return err
+	}
+
 	config, err := clientcmd.BuildConfigFromFlags("", ctx.String("kubeconfig"))
 	if err != nil {
 		return fmt.Errorf("could not load config: %w", err)
 	}
 
-	resources, err := kubedump.Discover(config)
+	resourceFilter := NewResourceFilter(kubedumpConfig.IncludeResources, kubedumpConfig.ExcludeResources)
+
+	resources, discoveryErr := discover(config, resourceFilter, logger)
+	if discoveryErr != nil && !discovery.IsGroupDiscoveryFailedError(discoveryErr) {
+		return discoveryErr
+	}
+
+	opts := controller.Options{
+		BasePath:           basePath,
+		ParentContext:      ctx.Context,
+		Logger:             logger,
+		LogSyncTimeout:     logSyncTimeout,
+		Resources:          resources,
+		ResourceFilter:     resourceFilter,
+		WatchApiExtensions: ctx.Bool(FlagNameWatchApiExtensions),
+		RedactSecrets:      kubedumpConfig.RedactSecrets,
+		LinkResources:      ctx.Bool(FlagNameLinkResources),
+		Triggers:           triggers,
+	}
+
+	logLimits, err := kubedumpConfig.Logs.Limits()
 	if err != nil {
 		return err
 	}
-	resources = lo.Filter(resources, func(gvr schema.GroupVersionResource, i int) bool {
-		for _, excluded := range kubedumpConfig.ExcludeResources {
-			if gvr == excluded {
-				return false
-			}
+
+	switch format := ctx.String(FlagNameFormat); format {
+	case DumpFormatDir:
+		sink := kubedump.NewDirSink(basePath)
+		sink.LogLimits = logLimits
+		if uploader != nil {
+			sink.OnRotate = uploader.uploadSegment
 		}
 
-		return true
-	})
+		opts.Sink = sink
+	case DumpFormatDB:
+		if logLimits.MaxContainerSize > 0 || logLimits.MaxTotalSize > 0 {
+			logger.Warn("log size limits are not supported by the db format and will be ignored")
+		}
 
-	opts := controller.Options{
-		BasePath:       basePath,
-		ParentContext:  ctx.Context,
-		Logger:         logger,
-		LogSyncTimeout: ctx.Duration(FlagNameLogSyncTimeout),
-		Resources:      resources,
+		sink, err := kubedump.NewDBSink(path.Join(basePath, kubedump.DBFileName))
+		if err != nil {
+			return err
+		}
+
+		if uploader != nil {
+			uploader.db = sink
+		}
+
+		opts.Sink = sink
+	default:
+		return fmt.Errorf("unsupported dump format '%s'", format)
+	}
+
+	var ring *kubedump.RingSink
+	if kubedumpConfig.Ring.Enabled() {
+		if ring, err = kubedumpConfig.Ring.Sink(opts.Sink, logger); err != nil {
+			return err
+		}
+
+		opts.Sink = ring
 	}
 
 	var client kubernetes.Interface
@@ -129,22 +238,182 @@ func Dump(ctx *cli.Context) error {
 		return fmt.Errorf("could not create controller: %w", err)
 	}
 
-	var nWorkers int
-	if nWorkers = ctx.Int("workers"); nWorkers == 0 {
-		nWorkers = kubedumpConfig.DefaultNWorkers
+	manifest := &kubedump.Manifest{
+		KubedumpVersion: Version,
+		Cluster:         config.Host,
+		Context:         kubeconfigContext(ctx.String("kubeconfig")),
+		Format:          ctx.String(FlagNameFormat),
+		StartTime:       time.Now().UTC(),
+		Filter:          kubedumpConfig.DefaultFilter,
+		Resources:       resourceNames(c.WatchedResources()),
+	}
+
+	if err := kubedump.WriteManifest(basePath, manifest); err != nil {
+		return err
 	}
 
-	if err = c.Start(nWorkers, dumpFilter); err != nil {
+	// the ring triggers are started before the controller, so that failing to listen for them leaves nothing running
+	stopRingTriggers := func() {}
+	if ring != nil {
+		if stopRingTriggers, err = startRingTriggers(ctx.Context, ring, kubedumpConfig.Ring.TriggerAddress, logger); err != nil {
+			if closeErr := opts.Sink.Close(); closeErr != nil {
+				logger.Warn(fmt.Sprintf("could not close sink: %s", closeErr))
+			}
+
+			return err
+		}
+	}
+
+	if err = c.Start(kubedumpConfig.DefaultNWorkers, dumpFilter); err != nil {
+		stopRingTriggers()
+
 		return fmt.Errorf("could not Start controller: %w", err)
 	}
 
+	if uploader != nil {
+		uploader.StartSnapshots()
+	}
+
+	if retryInterval := ctx.Duration(FlagNameDiscoveryRetryInterval); discoveryErr != nil && retryInterval > 0 {
+		go retryDiscovery(ctx.Context, retryInterval, config, resourceFilter, logger, c)
+	}
+
 	<-ctx.Context.Done()
 
+	stopRingTriggers()
+
+	// snapshots read from the sink, so they are stopped before the controller closes it
+	if uploader != nil {
+		uploader.StopSnapshots()
+	}
+
 	if err = c.Stop(); err != nil {
 		return fmt.Errorf("could not Stop controller: %w", err)
 	}
 
-	return err
+	stopTime := time.Now().UTC()
+	manifest.StopTime = &stopTime
+	manifest.Resources = resourceNames(c.WatchedResources())
+
+	if manifest.Counts, err = countDumpResources(basePath, manifest.Format); err != nil {
+		logger.Warn(fmt.Sprintf("could not count dumped resources: %s", err))
+	}
+
+	manifest.Errors = recorder.Errors()
+
+	// a db dump also holds its manifest, so the database file is self describing when it is handed off on its own
+	if manifest.Format == DumpFormatDB {
+		if err := writeDBManifest(path.Join(basePath, kubedump.DBFileName), manifest); err != nil {
+			return err
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("could not close log file: %w", err)
+	}
+
+	// the checksums are recorded once the log file is closed, since it would otherwise keep changing
+	if err := writeManifestWithChecksums(basePath, manifest); err != nil {
+		return err
+	}
+
+	archivePath := ""
+
+	if ctx.Bool(FlagNameArchive) {
+		archivePath = strings.TrimSuffix(basePath, string(filepath.Separator)) + ".tar.gz"
+
+		if err := kubedump.WriteArchive(basePath, archivePath); err != nil {
+			return fmt.Errorf("could not archive dump: %w", err)
+		}
+
+		if err := os.RemoveAll(basePath); err != nil {
+			return fmt.Errorf("could not remove archived dump: %w", err)
+		}
+	}
+
+	if uploader != nil {
+		if err := uploader.Close(archivePath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// discover finds the resources to watch on the cluster, ignoring any resources rejected by resourceFilter. If some api
+// groups could not be discovered, they are logged and the resources which could be discovered are returned alongside
+// the discovery error.
+func discover(config *rest.Config, resourceFilter func(schema.GroupVersionResource) bool, logger *slog.Logger) ([]schema.GroupVersionResource, error) {
+	resources, err := kubedump.Discover(config)
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, err
+	}
+
+	for groupVersion, groupErr := range kubedump.FailedGroups(err) {
+		logger.Warn(fmt.Sprintf("could not discover resources for group '%s': %s", groupVersion, groupErr))
+	}
+
+	resources = lo.Filter(resources, func(gvr schema.GroupVersionResource, i int) bool {
+		return resourceFilter(gvr)
+	})
+
+	return resources, err
+}
+
+// retryDiscovery periodically re-runs discovery and adds any newly discovered resources to the controller until every
+// group has been discovered or ctx is done.
+func retryDiscovery(ctx context.Context, interval time.Duration, config *rest.Config, resourceFilter func(schema.GroupVersionResource) bool, logger *slog.Logger, c *controller.Controller) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		logger.Debug("retrying discovery for failed groups")
+
+		resources, err := discover(config, resourceFilter, logger)
+		if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+			logger.Error(fmt.Sprintf("could not retry discovery: %s", err))
+			continue
+		}
+
+		c.AddResources(resources...)
+
+		if err == nil {
+			logger.Info("all groups were discovered")
+			return
+		}
+	}
+}
+
+func ConfigValidate(ctx *cli.Context) error {
+	if _, _, err := ResolveConfig(ctx); err != nil {
+		return err
+	}
+
+	fmt.Println("config is valid")
+
+	return nil
+}
+
+func ConfigShow(ctx *cli.Context) error {
+	config, _, err := ResolveConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	data, err := sigsyaml.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("could not marshal config: %w", err)
+	}
+
+	fmt.Print(string(data))
+
+	return nil
 }
 
 func Filter(ctx *cli.Context) error {
@@ -175,7 +444,7 @@ func Filter(ctx *cli.Context) error {
 	}
 
 	if inPlace {
-		destination = os.TempDir()
+		destination = basePath
 	} else if destination == "" {
 		destination = fmt.Sprintf("kubedump-filtered-%s.dump", time.Now().Format(DefaultTimeFormat))
 	}
@@ -189,22 +458,55 @@ func Filter(ctx *cli.Context) error {
 
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &loggerOptions))
 
+	fsys, err := kubedump.OpenDump(basePath)
+	if err != nil {
+		return err
+	}
+	defer kubedump.CloseDump(fsys)
+
+	// the filtered dump is written to a temporary directory when it will replace the original or be archived
+	filteredPath := destination
+	if inPlace || kubedump.IsArchive(destination) {
+		tempDir, err := os.MkdirTemp(filepath.Dir(destination), ".kubedump-filtered-*")
+		if err != nil {
+			return fmt.Errorf("could not create temporary directory: %w", err)
+		}
+		defer os.RemoveAll(tempDir)
+
+		filteredPath = path.Join(tempDir, archiveRootName(destination))
+	}
+
 	opts := filteringOptions{
 		Filter:              expression,
-		DestinationBasePath: destination,
+		DestinationBasePath: filteredPath,
+		Mode:                ctx.String("mode"),
 		Logger:              logger,
 	}
 
-	if err := filterKubedumpDir(basePath, opts); err != nil {
+	if err := filterKubedumpDir(fsys, opts); err != nil {
 		return fmt.Errorf("failed to filter kubedumper dir: %w", err)
 	}
 
-	if inPlace {
+	var sources []string
+	if !inPlace {
+		sources = []string{basePath}
+	}
+
+	entry := newManifestEntry("filter", fmt.Sprintf("%s '%s'", opts.Mode, rawFilter), sources...)
+	if err := writeDerivedManifest(fsys, filteredPath, entry, logger); err != nil {
+		return err
+	}
+
+	if kubedump.IsArchive(destination) {
+		if err := kubedump.WriteArchive(filteredPath, destination); err != nil {
+			return fmt.Errorf("could not write filtered dump to '%s': %w", destination, err)
+		}
+	} else if inPlace {
 		if err := os.RemoveAll(basePath); err != nil {
 			return fmt.Errorf("could not remove dump at '%s': %w", basePath, err)
 		}
 
-		if err := os.Rename(destination, basePath); err != nil {
+		if err := os.Rename(filteredPath, basePath); err != nil {
 			return fmt.Errorf("could not rename filtered dump at '%s': %w", basePath, err)
 		}
 	}
@@ -212,6 +514,80 @@ func Filter(ctx *cli.Context) error {
 	return nil
 }
 
+// archiveRootName returns the name of the top-level directory of the archive at archivePath.
+func archiveRootName(archivePath string) string {
+	name := filepath.Base(archivePath)
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+
+	return name
+}
+
+func Convert(ctx *cli.Context) error {
+	if nargs := ctx.Args().Len(); nargs != 2 {
+		return fmt.Errorf("expected exactly 2 args, but received %d", nargs)
+	}
+
+	src, dst := ctx.Args().Get(0), ctx.Args().Get(1)
+
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("destination '%s' already exists", dst)
+	}
+
+	logger := slog.New(slog.NewTextHandler(ctx.App.ErrWriter, nil))
+	entry := newManifestEntry("convert", "", src)
+
+	switch {
+	case strings.HasSuffix(src, ".db"):
+		if err := kubedump.ConvertFromDB(src, dst); err != nil {
+			return fmt.Errorf("could not convert '%s': %w", src, err)
+		}
+
+		manifest := dbManifest(src, logger)
+		manifest.History = append(manifest.History, entry)
+
+		counts, err := kubedump.CountResourcesFS(kubedump.DirFS(dst))
+		if err != nil {
+			return err
+		}
+
+		manifest.Counts = counts
+
+		if err := writeManifestWithChecksums(dst, manifest); err != nil {
+			return err
+		}
+	case strings.HasSuffix(dst, ".db"):
+		fsys, err := kubedump.OpenDump(src)
+		if err != nil {
+			return err
+		}
+		defer kubedump.CloseDump(fsys)
+
+		if err := kubedump.ConvertToDB(fsys, dst); err != nil {
+			return fmt.Errorf("could not convert '%s': %w", src, err)
+		}
+
+		manifest := derivedManifest(fsys, entry, logger)
+		if manifest.Counts, err = kubedump.CountResourcesFS(fsys); err != nil {
+			return err
+		}
+
+		// the checksums of the directory dump say nothing about the database
+		manifest.Checksums = nil
+
+		if err := writeDBManifest(dst, manifest); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("expected either the source or destination to be a .db file")
+	}
+
+	return nil
+}
+
 func Link(ctx *cli.Context) error {
 	if nargs := ctx.Args().Len(); nargs != 1 {
 		return fmt.Errorf("expected exactly 1 arg, but received %d", nargs)
@@ -222,7 +598,270 @@ func Link(ctx *cli.Context) error {
 		return fmt.Errorf("failed to determine root dir: %w", err)
 	}
 
-	return LinkDump(root)
+	opts := kubedump.LinkOptions{
+		Reconcile: ctx.Bool("reconcile"),
+		DryRun:    ctx.Bool("dry-run"),
+	}
+
+	// an archive is linked by extracting it, linking the extracted dump, and archiving it again in its place
+	dir := root
+	if kubedump.IsArchive(root) {
+		tempDir, err := os.MkdirTemp(filepath.Dir(root), ".kubedump-link-*")
+		if err != nil {
+			return fmt.Errorf("could not create temporary directory: %w", err)
+		}
+		defer os.RemoveAll(tempDir)
+
+		dir = path.Join(tempDir, archiveRootName(root))
+
+		if err := extractDump(root, dir); err != nil {
+			return err
+		}
+	}
+
+	changes, err := kubedump.LinkDump(dir, opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.DryRun {
+		for _, change := range changes {
+			fmt.Fprintln(ctx.App.Writer, change)
+		}
+
+		return nil
+	}
+
+	var details string
+	if opts.Reconcile {
+		details = "reconcile"
+	}
+
+	logger := slog.New(slog.NewTextHandler(ctx.App.ErrWriter, nil))
+
+	if err := writeDerivedManifest(kubedump.DirFS(dir), dir, newManifestEntry("link", details), logger); err != nil {
+		return err
+	}
+
+	if dir == root {
+		return nil
+	}
+
+	archivePath := path.Join(filepath.Dir(dir), filepath.Base(root))
+	if err := kubedump.WriteArchive(dir, archivePath); err != nil {
+		return fmt.Errorf("could not archive linked dump: %w", err)
+	}
+
+	if err := os.Rename(archivePath, root); err != nil {
+		return fmt.Errorf("could not replace archive '%s': %w", root, err)
+	}
+
+	return nil
+}
+
+// extractDump extracts the archived dump at archivePath to dir.
+func extractDump(archivePath string, dir string) error {
+	fsys, err := kubedump.OpenDump(archivePath)
+	if err != nil {
+		return err
+	}
+	defer kubedump.CloseDump(fsys)
+
+	if err := kubedump.ExtractDump(fsys, dir); err != nil {
+		return fmt.Errorf("could not extract '%s': %w", archivePath, err)
+	}
+
+	return nil
+}
+
+func Merge(ctx *cli.Context) error {
+	if nargs := ctx.Args().Len(); nargs < 2 {
+		return fmt.Errorf("expected at least 2 args, but received %d", nargs)
+	}
+
+	destination := ctx.String("destination")
+	if destination == "" {
+		destination = fmt.Sprintf("kubedump-merged-%s.dump", time.Now().Format(DefaultTimeFormat))
+	}
+
+	dumpPaths := make([]string, 0, ctx.Args().Len())
+	for _, arg := range ctx.Args().Slice() {
+		dumpPath, err := filepath.Abs(arg)
+		if err != nil {
+			return fmt.Errorf("failed to determine dump dir: %w", err)
+		}
+
+		dumpPaths = append(dumpPaths, dumpPath)
+	}
+
+	logger := slog.New(slog.NewTextHandler(ctx.App.ErrWriter, nil))
+
+	conflicts, err := kubedump.MergeDumps(destination, dumpPaths...)
+	if err != nil {
+		return fmt.Errorf("could not merge dumps: %w", err)
+	}
+
+	for _, conflict := range conflicts {
+		logger.Warn(conflict.String())
+	}
+
+	manifest, err := mergedManifest(dumpPaths, logger)
+	if err != nil {
+		return err
+	}
+
+	manifest.History = append(manifest.History, newManifestEntry("merge", "", dumpPaths...))
+
+	if strings.HasSuffix(destination, ".db") {
+		manifest.Format = DumpFormatDB
+		manifest.Checksums = nil
+
+		if manifest.Counts, err = countDBResources(destination); err != nil {
+			return err
+		}
+
+		return writeDBManifest(destination, manifest)
+	}
+
+	manifest.Format = DumpFormatDir
+
+	if manifest.Counts, err = kubedump.CountResourcesFS(kubedump.DirFS(destination)); err != nil {
+		return err
+	}
+
+	return writeManifestWithChecksums(destination, manifest)
+}
+
+func Diff(ctx *cli.Context) error {
+	from, err := parseDiffTime(ctx.String("from"))
+	if err != nil {
+		return err
+	}
+
+	to, err := parseDiffTime(ctx.String("to"))
+	if err != nil {
+		return err
+	}
+
+	var pathA, pathB, rawFilter string
+
+	// two points in time are compared within a single db dump, otherwise two dumps are compared
+	if !from.IsZero() || !to.IsZero() {
+		if nargs := ctx.Args().Len(); nargs < 1 || nargs > 2 {
+			return fmt.Errorf("expected 1 or 2 args, but received %d", nargs)
+		}
+
+		if from.IsZero() {
+			return fmt.Errorf("--to requires --from")
+		}
+
+		pathA, pathB, rawFilter = ctx.Args().Get(0), ctx.Args().Get(0), ctx.Args().Get(1)
+	} else {
+		if nargs := ctx.Args().Len(); nargs < 2 || nargs > 3 {
+			return fmt.Errorf("expected 2 or 3 args, but received %d", nargs)
+		}
+
+		pathA, pathB, rawFilter = ctx.Args().Get(0), ctx.Args().Get(1), ctx.Args().Get(2)
+	}
+
+	expression, err := filter.Parse(rawFilter)
+	if err != nil {
+		return fmt.Errorf("could not parse filter '%s': %w", rawFilter, err)
+	}
+
+	a, err := kubedump.LoadSnapshot(pathA, from)
+	if err != nil {
+		return fmt.Errorf("could not load '%s': %w", pathA, err)
+	}
+
+	b, err := kubedump.LoadSnapshot(pathB, to)
+	if err != nil {
+		return fmt.Errorf("could not load '%s': %w", pathB, err)
+	}
+
+	diffs := kubedump.DiffSnapshots(a, b, kubedump.DiffOptions{
+		Filter: expression.Matches,
+		Ignore: ctx.StringSlice("ignore"),
+	})
+
+	return kubedump.WriteDiff(ctx.App.Writer, diffs)
+}
+
+// parseDiffTime parses the time given to `kubedump diff`, or returns the zero time if it is empty.
+func parseDiffTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not parse time '%s': %w", value, err)
+	}
+
+	return t, nil
+}
+
+func Verify(ctx *cli.Context) error {
+	if nargs := ctx.Args().Len(); nargs != 1 {
+		return fmt.Errorf("expected exactly 1 arg, but received %d", nargs)
+	}
+
+	root, err := filepath.Abs(ctx.Args().First())
+	if err != nil {
+		return fmt.Errorf("failed to determine root dir: %w", err)
+	}
+
+	fsys, err := kubedump.OpenDump(root)
+	if err != nil {
+		return err
+	}
+	defer kubedump.CloseDump(fsys)
+
+	problems, err := kubedump.VerifyFS(fsys)
+	if err != nil {
+		return fmt.Errorf("could not verify dump: %w", err)
+	}
+
+	for _, problem := range problems {
+		fmt.Fprintln(ctx.App.Writer, problem)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("found %d problems in dump '%s'", len(problems), root)
+	}
+
+	return nil
+}
+
+func Graph(ctx *cli.Context) error {
+	if nargs := ctx.Args().Len(); nargs < 1 || nargs > 2 {
+		return fmt.Errorf("expected 1 or 2 args, but received %d", nargs)
+	}
+
+	root, err := filepath.Abs(ctx.Args().First())
+	if err != nil {
+		return fmt.Errorf("failed to determine root dir: %w", err)
+	}
+
+	rawFilter := ctx.Args().Get(1)
+
+	expression, err := filter.Parse(rawFilter)
+	if err != nil {
+		return fmt.Errorf("could not parse filter '%s': %w", rawFilter, err)
+	}
+
+	fsys, err := kubedump.OpenDump(root)
+	if err != nil {
+		return err
+	}
+	defer kubedump.CloseDump(fsys)
+
+	graph, err := BuildGraph(fsys, expression)
+	if err != nil {
+		return fmt.Errorf("could not build graph: %w", err)
+	}
+
+	return WriteGraph(ctx.App.Writer, graph, ctx.String("format"))
 }
 
 func Discover(ctx *cli.Context) error {
@@ -238,10 +877,14 @@ func Discover(ctx *cli.Context) error {
 	}
 
 	resources, err := kubedump.Discover(config)
-	if err != nil {
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
 		return err
 	}
 
+	for groupVersion, groupErr := range kubedump.FailedGroups(err) {
+		fmt.Fprintf(os.Stderr, "could not discover resources for group '%s': %s\n", groupVersion, groupErr)
+	}
+
 	switch format {
 	case DiscoverFormatYAML:
 		bytes, err := yaml.Marshal(resources)
@@ -264,6 +907,112 @@ func Discover(ctx *cli.Context) error {
 	return nil
 }
 
+// configFlags returns the flags which can be used to override values in the kubedump config.
+func configFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.PathFlag{
+			Name:    FlagNameDestination,
+			Usage:   "the directory path where the collected data will be stored (default: kubedump.dump)",
+			Aliases: []string{"d"},
+			EnvVars: []string{"KUBEDUMP_DESTINATION"},
+		},
+		&cli.StringFlag{
+			Name:    FlagNameFilter,
+			Usage:   "the filter to use when collecting cluster resources",
+			Aliases: []string{"f"},
+			EnvVars: []string{"KUBEDUMP_FILTER"},
+		},
+		&cli.IntFlag{
+			Name:    FlagNameWorkers,
+			Usage:   "specify how many workers should run concurrently to process dump operations (default: 5)",
+			Aliases: []string{"w"},
+			EnvVars: []string{"KUBEDUMP_N_WORKERS", "KUBEUDMP_N_WORKERS"},
+		},
+		&flagLogSyncTimeout,
+		&cli.StringFlag{
+			Name:    FlagNameProfile,
+			Usage:   "the name of the config profile to use, any other flags will override the profile's values",
+			Aliases: []string{"p"},
+			EnvVars: []string{"KUBEDUMP_PROFILE"},
+		},
+		&cli.BoolFlag{
+			Name:    FlagNameRedactSecrets,
+			Usage:   "redact the values of secrets before they are written to disk",
+			EnvVars: []string{"KUBEDUMP_REDACT_SECRETS"},
+		},
+		&cli.StringSliceFlag{
+			Name:    FlagNameIncludeResource,
+			Usage:   "only watch resources matching the given selector (<resource>, <group>/<resource>, or <group>/<version>/<resource>), may be specified more than once",
+			EnvVars: []string{"KUBEDUMP_INCLUDE_RESOURCES"},
+		},
+		&cli.StringSliceFlag{
+			Name:    FlagNameExcludeResource,
+			Usage:   "do not watch resources matching the given selector (<resource>, <group>/<resource>, or <group>/<version>/<resource>), may be specified more than once",
+			EnvVars: []string{"KUBEDUMP_EXCLUDE_RESOURCES"},
+		},
+		&cli.StringFlag{
+			Name:    FlagNameMaxContainerLogSize,
+			Usage:   "rotate a container's log file once it reaches this size (ex 100Mi)",
+			EnvVars: []string{"KUBEDUMP_MAX_CONTAINER_LOG_SIZE"},
+		},
+		&cli.StringFlag{
+			Name:    FlagNameMaxLogSize,
+			Usage:   "the size every log file in the dump may add up to (ex 1Gi)",
+			EnvVars: []string{"KUBEDUMP_MAX_LOG_SIZE"},
+		},
+		&cli.StringFlag{
+			Name:    FlagNameLogDropPolicy,
+			Usage:   "which logs to drop once the max log size is reached, either 'newest' or 'oldest'",
+			EnvVars: []string{"KUBEDUMP_LOG_DROP_POLICY"},
+		},
+		&cli.StringFlag{
+			Name:    FlagNameUploadEndpoint,
+			Usage:   "the url of the S3 compatible service to upload dumps to",
+			EnvVars: []string{"KUBEDUMP_UPLOAD_ENDPOINT"},
+		},
+		&cli.StringFlag{
+			Name:    FlagNameUploadBucket,
+			Usage:   "upload the dump to this bucket when stopped",
+			EnvVars: []string{"KUBEDUMP_UPLOAD_BUCKET"},
+		},
+		&cli.StringFlag{
+			Name:    FlagNameUploadPrefix,
+			Usage:   "the prefix of every uploaded object",
+			EnvVars: []string{"KUBEDUMP_UPLOAD_PREFIX"},
+		},
+		&cli.DurationFlag{
+			Name:    FlagNameSnapshotInterval,
+			Usage:   "how often to upload an archive of the dump in progress",
+			EnvVars: []string{"KUBEDUMP_SNAPSHOT_INTERVAL"},
+		},
+		&cli.DurationFlag{
+			Name:    FlagNameRing,
+			Usage:   "only hold the last `DURATION` of events and logs in memory, writing them to the dump when triggered (0 to disable)",
+			EnvVars: []string{"KUBEDUMP_RING"},
+		},
+		&cli.DurationFlag{
+			Name:    FlagNameRingPost,
+			Usage:   "how long to keep writing to the dump after a ring trigger (defaults to --ring)",
+			EnvVars: []string{"KUBEDUMP_RING_POST"},
+		},
+		&cli.StringFlag{
+			Name:    FlagNameRingMaxSize,
+			Usage:   "the most memory the held events and logs may use before the oldest are dropped (ex 256Mi)",
+			EnvVars: []string{"KUBEDUMP_RING_MAX_SIZE"},
+		},
+		&cli.StringFlag{
+			Name:    FlagNameRingTrigger,
+			Usage:   "a filter triggering the ring when a resource or event matches it",
+			EnvVars: []string{"KUBEDUMP_RING_TRIGGER"},
+		},
+		&cli.StringFlag{
+			Name:    FlagNameRingTriggerAddress,
+			Usage:   "the address to listen on for POST requests to /trigger which trigger the ring",
+			EnvVars: []string{"KUBEDUMP_RING_TRIGGER_ADDRESS"},
+		},
+	}
+}
+
 func NewKubedumpApp() *cli.App {
 	return &cli.App{
 		Name:    "kubedump",
@@ -276,20 +1025,7 @@ func NewKubedumpApp() *cli.App {
 				Action: func(ctx *cli.Context) error {
 					return Dump(ctx)
 				},
-				Flags: []cli.Flag{
-					&cli.PathFlag{
-						Name:    "destination",
-						Usage:   "the directory path where the collected data will be stored",
-						Value:   "kubedump.dump",
-						Aliases: []string{"d"},
-						EnvVars: []string{"KUBEDUMP_DESTINATION"},
-					},
-					&cli.StringFlag{
-						Name:    "filter",
-						Usage:   "the filter to use when collecting cluster resources",
-						Aliases: []string{"f"},
-						EnvVars: []string{"KUBEDUMP_FILTER"},
-					},
+				Flags: append([]cli.Flag{
 					&cli.BoolFlag{
 						Name:    "verbose",
 						Usage:   "run kubedump verbosely",
@@ -297,13 +1033,48 @@ func NewKubedumpApp() *cli.App {
 						Aliases: []string{"V"},
 						EnvVars: []string{"KUBEDUMP_VERBOSE"},
 					},
-					&cli.IntFlag{
-						Name:    "workers",
-						Usage:   "specify how many workers should run concurrently to process dump operations",
-						Aliases: []string{"w"},
-						EnvVars: []string{"KUBEUDMP_N_WORKERS"},
+					&flagDiscoveryRetryInterval,
+					&cli.BoolFlag{
+						Name:    FlagNameWatchApiExtensions,
+						Usage:   "watch for CustomResourceDefinitions and APIServices installed or removed during the dump",
+						Value:   true,
+						EnvVars: []string{"KUBEDUMP_WATCH_API_EXTENSIONS"},
+					},
+					&cli.BoolFlag{
+						Name:    FlagNameLinkResources,
+						Usage:   "link related resources as they are dumped rather than waiting for `kubedump link`",
+						Value:   true,
+						EnvVars: []string{"KUBEDUMP_LINK_RESOURCES"},
+					},
+					&cli.BoolFlag{
+						Name:    FlagNameArchive,
+						Usage:   "write the dump to a .tar.gz archive next to the destination when stopped, and remove the dump directory",
+						EnvVars: []string{"KUBEDUMP_ARCHIVE"},
+					},
+					&cli.StringFlag{
+						Name:    FlagNameFormat,
+						Usage:   "how to store the dump, either 'dir' for a directory tree or 'db' for a single database file in the destination",
+						Value:   DumpFormatDir,
+						EnvVars: []string{"KUBEDUMP_FORMAT"},
+					},
+				}, configFlags()...),
+			},
+			{
+				Name:  "config",
+				Usage: "inspect the kubedump config",
+				Subcommands: []*cli.Command{
+					{
+						Name:   "validate",
+						Usage:  "validate the config file and its profiles",
+						Action: ConfigValidate,
+						Flags:  configFlags(),
+					},
+					{
+						Name:   "show",
+						Usage:  "print the effective config after applying the selected profile, environment variables, and flags",
+						Action: ConfigShow,
+						Flags:  configFlags(),
 					},
-					&flagLogSyncTimeout,
 				},
 			},
 			{
@@ -323,6 +1094,11 @@ func NewKubedumpApp() *cli.App {
 						Value:   false,
 						Aliases: []string{"i"},
 					},
+					&cli.StringFlag{
+						Name:  "mode",
+						Usage: fmt.Sprintf("copy only the %s resources, or the %s resources which are linked to or linked under them", FilterModeMatching, FilterModeRelated),
+						Value: FilterModeMatching,
+					},
 					&cli.BoolFlag{
 						Name:    "verbose",
 						Usage:   "run kubedump verbosely",
@@ -331,10 +1107,79 @@ func NewKubedumpApp() *cli.App {
 					},
 				},
 			},
+			{
+				Name:      "merge",
+				Usage:     "merge overlapping dumps into a single dump",
+				Action:    Merge,
+				ArgsUsage: "<dump>...",
+				Flags: []cli.Flag{
+					&cli.PathFlag{
+						Name:    "destination",
+						Aliases: []string{"d"},
+						Usage:   "the name of the resulting dump, which is written as a db dump if it ends with .db",
+					},
+				},
+			},
+			{
+				Name:      "convert",
+				Usage:     "convert a dump between the directory and database formats",
+				UsageText: "kubedump convert <dump> <kubedump.db> | kubedump convert <kubedump.db> <dir>",
+				Action:    Convert,
+			},
 			{
 				Name:   "link",
 				Usage:  "add symlinks to resources which are related (pods to deployment,. secrets to pods, etc.)",
 				Action: Link,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "reconcile",
+						Usage: "fix symlinks pointing to the wrong resource and remove links which are no longer valid",
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "print the changes which would be made without making them",
+					},
+				},
+			},
+			{
+				Name:      "diff",
+				Usage:     "print the resources which were added, removed, or changed between two dumps, or two points in time of a db dump",
+				UsageText: "kubedump diff <dump> <dump> [filter] | kubedump diff --from <time> [--to <time>] <kubedump.db> [filter]",
+				Action:    Diff,
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:  "ignore",
+						Usage: "the dot separated paths of fields which are not compared",
+						Value: cli.NewStringSlice(kubedump.DefaultDiffIgnoredFields...),
+					},
+					&cli.StringFlag{
+						Name:  "from",
+						Usage: "compare a db dump as it was at this RFC 3339 time",
+					},
+					&cli.StringFlag{
+						Name:  "to",
+						Usage: "compare against the db dump as it was at this RFC 3339 time, rather than when it was stopped",
+					},
+				},
+			},
+			{
+				Name:      "verify",
+				Usage:     "check a dump for missing or modified files, truncated resources, and dangling symlinks",
+				Action:    Verify,
+				ArgsUsage: "<dump>",
+			},
+			{
+				Name:      "graph",
+				Usage:     "print the relationship graph between the resources in a dump",
+				Action:    Graph,
+				ArgsUsage: "<dir> [filter]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: fmt.Sprintf("the format to use when printing the graph (%s, %s, or %s)", GraphFormatDot, GraphFormatJson, GraphFormatMermaid),
+						Value: GraphFormatDot,
+					},
+				},
 			},
 			{
 				Name:      "discover",
@@ -351,6 +1196,12 @@ func NewKubedumpApp() *cli.App {
 			},
 		},
 		Flags: []cli.Flag{
+			&cli.PathFlag{
+				Name:    FlagNameConfig,
+				Usage:   "path to the kubedump config file (defaults to kubedump.yaml in the user config directory)",
+				Aliases: []string{"c"},
+				EnvVars: []string{"KUBEDUMP_CONFIG"},
+			},
 			&cli.StringFlag{
 				Name:    "kubeconfig",
 				Usage:   "path to the kubeconfig file to use when configuring the k8s client",
@@ -2,14 +2,17 @@ package kubedump
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
 	"path"
 	"testing"
 
+	kubedump "github.com/joshmeranda/kubedump/pkg"
 	"github.com/joshmeranda/kubedump/tests"
 	cp "github.com/otiai10/copy"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
 )
 
 func setupLink(t *testing.T, dumpDir string) (func(), string, error) {
@@ -48,18 +51,71 @@ func TestLink(t *testing.T) {
 	require.NoError(t, err)
 	defer teardown()
 
-	err = LinkDump(dumpDir)
+	_, err = kubedump.LinkDump(dumpDir, kubedump.LinkOptions{})
 	require.NoError(t, err)
 
 	isLink, err := isSymlink(path.Join(dumpDir, "default", "Service", "sample-service", "Pod", "sample-pod"))
 	require.NoError(t, err)
 	assert.True(t, isLink)
+	assert.FileExists(t, path.Join(dumpDir, "default", "Service", "sample-service", "Pod", "sample-pod", "sample-pod.yaml"))
 
-	isLink, err = isSymlink(path.Join(dumpDir, "default", "Pod", "sample-pod", "ConfigMap", "sample-configmap-volume"))
+	isLink, err = isSymlink(path.Join(dumpDir, "default", "Pod", "sample-pod", "ConfigMap", "sample-configmap"))
 	require.NoError(t, err)
 	assert.True(t, isLink)
+	assert.FileExists(t, path.Join(dumpDir, "default", "Pod", "sample-pod", "ConfigMap", "sample-configmap", "sample-configmap.yaml"))
 
-	isLink, err = isSymlink(path.Join(dumpDir, "default", "Pod", "sample-pod", "Secret", "sample-secret-volume"))
+	isLink, err = isSymlink(path.Join(dumpDir, "default", "Pod", "sample-pod", "Secret", "sample-secret"))
 	require.NoError(t, err)
 	assert.True(t, isLink)
+	assert.FileExists(t, path.Join(dumpDir, "default", "Pod", "sample-pod", "Secret", "sample-secret", "sample-secret.yaml"))
+
+	data, err := os.ReadFile(path.Join(dumpDir, "default", "Pod", "sample-pod", "sample-pod"+kubedump.LinksFileSuffix))
+	require.NoError(t, err)
+
+	var references []kubedump.LinkReference
+	require.NoError(t, yaml.Unmarshal(data, &references))
+	assert.ElementsMatch(t, []kubedump.LinkReference{
+		{Kind: "ConfigMap", Namespace: "default", Name: "sample-configmap", Types: []kubedump.LinkType{kubedump.LinkTypeVolume}},
+		{Kind: "Secret", Namespace: "default", Name: "sample-secret", Types: []kubedump.LinkType{kubedump.LinkTypeVolume}},
+	}, references)
+}
+
+func TestLinkArchive(t *testing.T) {
+	teardown, dumpDir, err := setupLink(t, serviceDumpPath)
+	require.NoError(t, err)
+	defer teardown()
+
+	archivePath := path.Join(t.TempDir(), "sample.dump.tar.gz")
+	require.NoError(t, kubedump.WriteArchive(dumpDir, archivePath))
+
+	before, err := os.ReadFile(archivePath)
+	require.NoError(t, err)
+
+	app := NewKubedumpApp()
+
+	require.NoError(t, app.Run([]string{"kubedump", "link", "--dry-run", archivePath}))
+
+	after, err := os.ReadFile(archivePath)
+	require.NoError(t, err)
+	assert.Equal(t, before, after)
+
+	require.NoError(t, app.Run([]string{"kubedump", "link", archivePath}))
+
+	fsys, err := kubedump.OpenDump(archivePath)
+	require.NoError(t, err)
+	defer kubedump.CloseDump(fsys)
+
+	target, err := fsys.ReadLink("default/Service/sample-service/Pod/sample-pod")
+	require.NoError(t, err)
+	assert.Equal(t, "../../../Pod/sample-pod", target)
+
+	_, err = fs.Stat(fsys, "default/Pod/sample-pod/Secret/sample-secret/sample-secret.yaml")
+	assert.NoError(t, err)
+
+	_, err = fs.Stat(fsys, kubedump.ManifestFileName)
+	assert.NoError(t, err)
+
+	entries, err := os.ReadDir(path.Dir(archivePath))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
 }
@@ -0,0 +1,291 @@
+package kubedump
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	kubedump "github.com/joshmeranda/kubedump/pkg"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// maxManifestErrors is the most errors recorded in a manifest, so that a dump which fails constantly does not end up
+// with an enormous manifest.
+const maxManifestErrors = 100
+
+// errorRecorder is a slog.Handler recording the message of every error logged through it before passing the record on
+// to the wrapped handler.
+type errorRecorder struct {
+	slog.Handler
+
+	mu      *sync.Mutex
+	errors  *[]string
+	dropped *int
+}
+
+func newErrorRecorder(handler slog.Handler) *errorRecorder {
+	return &errorRecorder{
+		Handler: handler,
+		mu:      &sync.Mutex{},
+		errors:  &[]string{},
+		dropped: new(int),
+	}
+}
+
+func (recorder *errorRecorder) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelError || recorder.Handler.Enabled(ctx, level)
+}
+
+func (recorder *errorRecorder) Handle(ctx context.Context, record slog.Record) error {
+	if record.Level >= slog.LevelError {
+		recorder.mu.Lock()
+		if len(*recorder.errors) < maxManifestErrors {
+			*recorder.errors = append(*recorder.errors, fmt.Sprintf("[%s] %s", record.Time.UTC().Format(time.RFC3339), record.Message))
+		} else {
+			*recorder.dropped++
+		}
+		recorder.mu.Unlock()
+	}
+
+	if !recorder.Handler.Enabled(ctx, record.Level) {
+		return nil
+	}
+
+	return recorder.Handler.Handle(ctx, record)
+}
+
+func (recorder *errorRecorder) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := *recorder
+	next.Handler = recorder.Handler.WithAttrs(attrs)
+	return &next
+}
+
+func (recorder *errorRecorder) WithGroup(name string) slog.Handler {
+	next := *recorder
+	next.Handler = recorder.Handler.WithGroup(name)
+	return &next
+}
+
+// Errors returns the recorded errors, noting how many were not recorded once maxManifestErrors was reached.
+func (recorder *errorRecorder) Errors() []string {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	errs := append([]string{}, *recorder.errors...)
+	if *recorder.dropped > 0 {
+		errs = append(errs, fmt.Sprintf("%d more errors were not recorded", *recorder.dropped))
+	}
+
+	return errs
+}
+
+// kubeconfigContext returns the current context of the kubeconfig at kubeconfigPath, or an empty string if it can not be
+// loaded, as when running in-cluster.
+func kubeconfigContext(kubeconfigPath string) string {
+	if kubeconfigPath == "" {
+		return ""
+	}
+
+	config, err := clientcmd.LoadFromFile(kubeconfigPath)
+	if err != nil {
+		return ""
+	}
+
+	return config.CurrentContext
+}
+
+// resourceNames formats resources like the strings accepted by ParseResourceSelector.
+func resourceNames(resources []schema.GroupVersionResource) []string {
+	names := make([]string, 0, len(resources))
+
+	for _, resource := range resources {
+		names = append(names, ResourceSelector{Group: resource.Group, Version: resource.Version, Resource: resource.Resource}.String())
+	}
+
+	return names
+}
+
+// newManifestEntry creates an entry for the history of a dump recording a run of command.
+func newManifestEntry(command string, details string, sources ...string) kubedump.ManifestEntry {
+	return kubedump.ManifestEntry{
+		Command:         command,
+		Time:            time.Now().UTC(),
+		KubedumpVersion: Version,
+		Sources:         sources,
+		Details:         details,
+	}
+}
+
+// readManifest returns the manifest of the dump in fsys, or an empty manifest if the dump has none.
+func readManifest(fsys fs.FS, logger *slog.Logger) *kubedump.Manifest {
+	manifest, err := kubedump.ReadManifestFS(fsys)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			logger.Warn(fmt.Sprintf("ignoring invalid manifest: %s", err))
+		}
+
+		return &kubedump.Manifest{}
+	}
+
+	return manifest
+}
+
+// derivedManifest returns the manifest of the dump in fsys with entry added to its history.
+func derivedManifest(fsys fs.FS, entry kubedump.ManifestEntry, logger *slog.Logger) *kubedump.Manifest {
+	manifest := readManifest(fsys, logger)
+	manifest.History = append(manifest.History, entry)
+
+	return manifest
+}
+
+// writeDerivedManifest writes the manifest of the dump in fsys, with entry added to its history, to the directory dump
+// at dir. The counts and checksums in the manifest are updated to match the files in dir.
+func writeDerivedManifest(fsys fs.FS, dir string, entry kubedump.ManifestEntry, logger *slog.Logger) error {
+	manifest := derivedManifest(fsys, entry, logger)
+
+	counts, err := kubedump.CountResourcesFS(kubedump.DirFS(dir))
+	if err != nil {
+		return err
+	}
+
+	manifest.Counts = counts
+
+	return writeManifestWithChecksums(dir, manifest)
+}
+
+// writeManifestWithChecksums records the checksums of every file in the directory dump at dir in manifest, and writes
+// it to dir.
+func writeManifestWithChecksums(dir string, manifest *kubedump.Manifest) error {
+	checksums, err := kubedump.ChecksumsFS(kubedump.DirFS(dir))
+	if err != nil {
+		return err
+	}
+
+	manifest.Checksums = checksums
+
+	return kubedump.WriteManifest(dir, manifest)
+}
+
+// countDumpResources counts the resources of each kind in the dump at basePath, written in the given format.
+func countDumpResources(basePath string, format string) (map[string]int, error) {
+	if format != DumpFormatDB {
+		return kubedump.CountResourcesFS(kubedump.DirFS(basePath))
+	}
+
+	return countDBResources(path.Join(basePath, kubedump.DBFileName))
+}
+
+// countDBResources counts the resources of each kind in the db dump at dbPath.
+func countDBResources(dbPath string) (map[string]int, error) {
+	dump, err := kubedump.OpenDBDump(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer dump.Close()
+
+	return dump.CountResources()
+}
+
+// mergedManifest combines the manifests of the dumps at dumpPaths. The manifest of the earliest dump is used as a base,
+// covering the time from the earliest start to the latest stop and every resource watched by any of the dumps.
+func mergedManifest(dumpPaths []string, logger *slog.Logger) (*kubedump.Manifest, error) {
+	var merged *kubedump.Manifest
+	resources := map[string]bool{}
+
+	for _, dumpPath := range dumpPaths {
+		var manifest *kubedump.Manifest
+
+		if strings.HasSuffix(dumpPath, ".db") {
+			manifest = dbManifest(dumpPath, logger)
+		} else {
+			fsys, err := kubedump.OpenDump(dumpPath)
+			if err != nil {
+				return nil, err
+			}
+
+			manifest = readManifest(fsys, logger)
+			kubedump.CloseDump(fsys)
+		}
+
+		for _, resource := range manifest.Resources {
+			resources[resource] = true
+		}
+
+		switch {
+		case merged == nil:
+			merged = manifest
+			continue
+		case manifest.StartTime.IsZero():
+		case merged.StartTime.IsZero() || manifest.StartTime.Before(merged.StartTime):
+			manifest.Errors = append(manifest.Errors, merged.Errors...)
+			manifest.StopTime = laterTime(manifest.StopTime, merged.StopTime)
+			merged = manifest
+			continue
+		}
+
+		merged.Errors = append(merged.Errors, manifest.Errors...)
+		merged.StopTime = laterTime(merged.StopTime, manifest.StopTime)
+	}
+
+	merged.Resources = make([]string, 0, len(resources))
+	for resource := range resources {
+		merged.Resources = append(merged.Resources, resource)
+	}
+
+	sort.Strings(merged.Resources)
+
+	return merged, nil
+}
+
+// laterTime returns the later of a and b, ignoring either if it is nil.
+func laterTime(a *time.Time, b *time.Time) *time.Time {
+	if a == nil || (b != nil && b.After(*a)) {
+		return b
+	}
+
+	return a
+}
+
+// writeDBManifest stores manifest in the db dump at dbPath.
+func writeDBManifest(dbPath string, manifest *kubedump.Manifest) error {
+	sink, err := kubedump.NewDBSink(dbPath)
+	if err != nil {
+		return err
+	}
+
+	if err := sink.WriteManifest(manifest); err != nil {
+		sink.Close()
+		return err
+	}
+
+	return sink.Close()
+}
+
+// dbManifest returns the manifest stored in the db dump at dbPath, falling back to the manifest beside the database for
+// dumps which were written before the manifest was stored in the database. If neither can be read, an empty manifest is
+// returned.
+func dbManifest(dbPath string, logger *slog.Logger) *kubedump.Manifest {
+	dump, err := kubedump.OpenDBDump(dbPath)
+	if err == nil {
+		manifest, err := dump.Manifest()
+		dump.Close()
+
+		if err == nil {
+			return manifest
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			logger.Warn(fmt.Sprintf("ignoring invalid manifest: %s", err))
+		}
+	}
+
+	return readManifest(os.DirFS(filepath.Dir(dbPath)), logger)
+}
@@ -0,0 +1,170 @@
+package kubedump
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	kubedump "github.com/joshmeranda/kubedump/pkg"
+	"github.com/joshmeranda/kubedump/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorRecorder(t *testing.T) {
+	out := &bytes.Buffer{}
+	recorder := newErrorRecorder(slog.NewTextHandler(out, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	logger := slog.New(recorder).With("component", "test")
+
+	logger.Info("not recorded or written")
+	logger.Error("could not get logs")
+
+	for i := 0; i < maxManifestErrors+1; i++ {
+		logger.Error("repeated error")
+	}
+
+	errs := recorder.Errors()
+	require.Len(t, errs, maxManifestErrors+1)
+	assert.Contains(t, errs[0], "could not get logs")
+	assert.Equal(t, "2 more errors were not recorded", errs[maxManifestErrors])
+
+	assert.NotContains(t, out.String(), "not recorded or written")
+	assert.Contains(t, out.String(), "could not get logs")
+}
+
+func TestManifestPropagation(t *testing.T) {
+	teardown, destination, basePath := setupFiltering(t, serviceDumpPath)
+	defer teardown()
+
+	require.NoError(t, kubedump.WriteManifest(basePath, &kubedump.Manifest{
+		KubedumpVersion: "v1.0.0",
+		Cluster:         "https://127.0.0.1:6443",
+		Filter:          "namespace default",
+		Resources:       []string{"v1/pods", "v1/services"},
+	}))
+
+	app := NewKubedumpApp()
+	app.ErrWriter = io.Discard
+
+	require.NoError(t, app.Run([]string{"kubedump", "filter", "--destination", destination, basePath, "Pod default/sample-pod"}))
+	require.NoError(t, app.Run([]string{"kubedump", "link", destination}))
+
+	dbPath := path.Join(path.Dir(destination), kubedump.DBFileName)
+	require.NoError(t, app.Run([]string{"kubedump", "convert", destination, dbPath}))
+
+	converted := path.Join(path.Dir(destination), "Converted.dump")
+	require.NoError(t, app.Run([]string{"kubedump", "convert", dbPath, converted}))
+
+	manifest, err := kubedump.ReadManifestFS(os.DirFS(converted))
+	require.NoError(t, err)
+
+	assert.Equal(t, "https://127.0.0.1:6443", manifest.Cluster)
+	assert.Equal(t, "namespace default", manifest.Filter)
+	assert.Equal(t, map[string]int{"Pod": 1}, manifest.Counts)
+
+	require.Len(t, manifest.History, 4)
+	assert.Equal(t, "filter", manifest.History[0].Command)
+	assert.Equal(t, []string{basePath}, manifest.History[0].Sources)
+	assert.Equal(t, "matching 'Pod default/sample-pod'", manifest.History[0].Details)
+	assert.Equal(t, "link", manifest.History[1].Command)
+	assert.Equal(t, "convert", manifest.History[2].Command)
+	assert.Equal(t, []string{destination}, manifest.History[2].Sources)
+	assert.Equal(t, "convert", manifest.History[3].Command)
+	assert.Equal(t, []string{dbPath}, manifest.History[3].Sources)
+}
+
+func TestVerify(t *testing.T) {
+	teardown, destination, basePath := setupFiltering(t, linkedServiceDumpPath)
+	defer teardown()
+
+	app := NewKubedumpApp()
+	out := &bytes.Buffer{}
+	app.Writer = out
+	app.ErrWriter = io.Discard
+
+	assert.Error(t, app.Run([]string{"kubedump", "verify", basePath}), "a dump without a manifest should fail verification")
+	assert.Contains(t, out.String(), "missing: "+kubedump.ManifestFileName)
+
+	require.NoError(t, app.Run([]string{"kubedump", "filter", "--destination", destination, basePath, "namespace default"}))
+	require.NoError(t, app.Run([]string{"kubedump", "link", destination}))
+
+	out.Reset()
+	require.NoError(t, app.Run([]string{"kubedump", "verify", destination}))
+	assert.Empty(t, out.String())
+
+	require.NoError(t, os.Truncate(path.Join(destination, "default", "Pod", "sample-pod", "sample-pod.yaml"), 0))
+
+	assert.Error(t, app.Run([]string{"kubedump", "verify", destination}))
+	assert.Contains(t, out.String(), "modified: default/Pod/sample-pod/sample-pod.yaml")
+}
+
+func TestMerge(t *testing.T) {
+	teardown, destination, basePath := setupFiltering(t, serviceDumpPath)
+	defer teardown()
+
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	stop := start.Add(time.Hour)
+
+	require.NoError(t, kubedump.WriteManifest(basePath, &kubedump.Manifest{
+		Cluster:   "https://127.0.0.1:6443",
+		StartTime: start.Add(time.Minute),
+		StopTime:  &stop,
+		Resources: []string{"v1/pods"},
+		Errors:    []string{"second error"},
+	}))
+
+	other := path.Join(t.TempDir(), "Other.dump")
+	require.NoError(t, tests.CopyTree(linkedServiceDumpPath, other))
+	require.NoError(t, kubedump.WriteManifest(other, &kubedump.Manifest{
+		Cluster:   "https://127.0.0.1:6443",
+		StartTime: start,
+		Resources: []string{"v1/pods", "v1/secrets"},
+		Errors:    []string{"first error"},
+	}))
+
+	app := NewKubedumpApp()
+	app.ErrWriter = io.Discard
+
+	require.NoError(t, app.Run([]string{"kubedump", "merge", "-d", destination, basePath, other}))
+	require.NoError(t, app.Run([]string{"kubedump", "verify", destination}))
+
+	assert.FileExists(t, path.Join(destination, "default", "ConfigMap", "sample-configmap", "sample-configmap.yaml"))
+	assert.FileExists(t, path.Join(destination, "default", "Service", "sample-service", "Pod", "sample-pod", "sample-pod.yaml"))
+
+	manifest, err := kubedump.ReadManifestFS(os.DirFS(destination))
+	require.NoError(t, err)
+
+	assert.Equal(t, start, manifest.StartTime)
+	assert.Equal(t, &stop, manifest.StopTime)
+	assert.Equal(t, []string{"v1/pods", "v1/secrets"}, manifest.Resources)
+	assert.Equal(t, []string{"first error", "second error"}, manifest.Errors)
+	require.Len(t, manifest.History, 1)
+	assert.Equal(t, "merge", manifest.History[0].Command)
+	assert.Equal(t, []string{basePath, other}, manifest.History[0].Sources)
+}
+
+func TestMergeDB(t *testing.T) {
+	teardown, _, basePath := setupFiltering(t, serviceDumpPath)
+	defer teardown()
+
+	dbPath := path.Join(t.TempDir(), "linked.db")
+	require.NoError(t, kubedump.ConvertToDB(kubedump.DirFS(linkedServiceDumpPath), dbPath))
+
+	destination := path.Join(t.TempDir(), "merged.db")
+
+	app := NewKubedumpApp()
+	app.ErrWriter = io.Discard
+
+	require.NoError(t, app.Run([]string{"kubedump", "merge", "-d", destination, basePath, dbPath}))
+
+	manifest := dbManifest(destination, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	assert.Equal(t, DumpFormatDB, manifest.Format)
+	assert.NotEmpty(t, manifest.Counts)
+	assert.Nil(t, manifest.Checksums)
+	require.Len(t, manifest.History, 1)
+	assert.Equal(t, []string{basePath, dbPath}, manifest.History[0].Sources)
+}
@@ -0,0 +1,161 @@
+package kubedump
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/IGLOU-EU/go-wildcard"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// coreGroupAlias may be used in place of the empty core group when writing a ResourceSelector as a string.
+const coreGroupAlias = "core"
+
+// ResourceSelector selects resources by their group, version, and resource name. Each field may contain '*'
+// wildcards, and an empty Version matches any version.
+//
+// A selector may be written in the config as either an object with the Group, Version, and Resource fields or as a
+// string using one of the following formats:
+//
+//	<resource>                   a resource in the core group (ex "pods")
+//	<group>/<resource>           a resource in the given group at any version (ex "traefik.containo.us/*")
+//	<group>/<version>/<resource> a resource at a specific version (ex "*.metrics.k8s.io/v1beta1/pods")
+//
+// The core group may be written as "core" or left empty.
+type ResourceSelector struct {
+	Group    string
+	Version  string
+	Resource string
+}
+
+func ParseResourceSelector(s string) (ResourceSelector, error) {
+	var selector ResourceSelector
+
+	switch split := strings.Split(s, "/"); len(split) {
+	case 1:
+		selector.Resource = split[0]
+	case 2:
+		selector.Group, selector.Resource = split[0], split[1]
+	case 3:
+		selector.Group, selector.Version, selector.Resource = split[0], split[1], split[2]
+	default:
+		return ResourceSelector{}, fmt.Errorf("too many components in resource selector '%s'", s)
+	}
+
+	if selector.Group == coreGroupAlias {
+		selector.Group = ""
+	}
+
+	if selector.Resource == "" {
+		return ResourceSelector{}, fmt.Errorf("resource selector '%s' does not specify a resource", s)
+	}
+
+	return selector, nil
+}
+
+func (selector ResourceSelector) String() string {
+	group := selector.Group
+	if group == "" {
+		group = coreGroupAlias
+	}
+
+	if selector.Version == "" {
+		return fmt.Sprintf("%s/%s", group, selector.Resource)
+	}
+
+	return fmt.Sprintf("%s/%s/%s", group, selector.Version, selector.Resource)
+}
+
+func (selector ResourceSelector) MarshalJSON() ([]byte, error) {
+	return json.Marshal(selector.String())
+}
+
+// UnmarshalJSON reads a selector written either as a string for ParseResourceSelector, or as an object with the Group,
+// Version, and Resource fields. Unknown fields in an object are treated as errors to catch typos.
+func (selector *ResourceSelector) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		parsed, err := ParseResourceSelector(s)
+		if err != nil {
+			return err
+		}
+
+		*selector = parsed
+
+		return nil
+	}
+
+	// use an alias type to avoid recursing back into this method
+	type rawSelector ResourceSelector
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var raw rawSelector
+	if err := decoder.Decode(&raw); err != nil {
+		return fmt.Errorf("could not unmarshal resource selector, which must be a string or an object: %w", err)
+	}
+
+	*selector = ResourceSelector(raw)
+
+	return nil
+}
+
+// Matches returns true if the given resource is selected.
+func (selector ResourceSelector) Matches(gvr schema.GroupVersionResource) bool {
+	return matchPattern(selector.Group, gvr.Group) &&
+		(selector.Version == "" || matchPattern(selector.Version, gvr.Version)) &&
+		matchPattern(selector.Resource, gvr.Resource)
+}
+
+// matchPattern matches s against the given wildcard pattern. An empty pattern only matches an empty string.
+func matchPattern(pattern string, s string) bool {
+	if pattern == "" {
+		return s == ""
+	}
+
+	return wildcard.MatchSimple(pattern, s)
+}
+
+// ParseResourceSelectors parses each of the given strings as a ResourceSelector.
+func ParseResourceSelectors(raw []string) ([]ResourceSelector, error) {
+	selectors := make([]ResourceSelector, 0, len(raw))
+
+	for _, s := range raw {
+		selector, err := ParseResourceSelector(s)
+		if err != nil {
+			return nil, err
+		}
+
+		selectors = append(selectors, selector)
+	}
+
+	return selectors, nil
+}
+
+// NewResourceFilter returns a function which returns true for resources which should be watched. If include is not
+// empty, a resource must match at least one of its selectors. A resource matching any selector in exclude is never
+// watched.
+func NewResourceFilter(include []ResourceSelector, exclude []ResourceSelector) func(schema.GroupVersionResource) bool {
+	return func(gvr schema.GroupVersionResource) bool {
+		for _, selector := range exclude {
+			if selector.Matches(gvr) {
+				return false
+			}
+		}
+
+		if len(include) == 0 {
+			return true
+		}
+
+		for _, selector := range include {
+			if selector.Matches(gvr) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
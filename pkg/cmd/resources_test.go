@@ -0,0 +1,93 @@
+package kubedump
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+func TestParseResourceSelector(t *testing.T) {
+	selector, err := ParseResourceSelector("pods")
+	require.NoError(t, err)
+	assert.Equal(t, ResourceSelector{Resource: "pods"}, selector)
+
+	selector, err = ParseResourceSelector("traefik.containo.us/*")
+	require.NoError(t, err)
+	assert.Equal(t, ResourceSelector{Group: "traefik.containo.us", Resource: "*"}, selector)
+
+	selector, err = ParseResourceSelector("core/v1/pods")
+	require.NoError(t, err)
+	assert.Equal(t, ResourceSelector{Version: "v1", Resource: "pods"}, selector)
+
+	_, err = ParseResourceSelector("a/b/c/d")
+	assert.Error(t, err)
+
+	_, err = ParseResourceSelector("apps/")
+	assert.Error(t, err)
+}
+
+func TestResourceSelectorMatches(t *testing.T) {
+	pods := schema.GroupVersionResource{Group: "", Version: "v1", Resource: "pods"}
+	metricsPods := schema.GroupVersionResource{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "pods"}
+	middlewares := schema.GroupVersionResource{Group: "traefik.containo.us", Version: "v1alpha1", Resource: "middlewares"}
+
+	assert.True(t, ResourceSelector{Resource: "pods"}.Matches(pods))
+	assert.False(t, ResourceSelector{Resource: "pods"}.Matches(metricsPods))
+	assert.True(t, ResourceSelector{Group: "*", Resource: "pods"}.Matches(pods))
+	assert.True(t, ResourceSelector{Group: "*", Resource: "pods"}.Matches(metricsPods))
+	assert.True(t, ResourceSelector{Group: "*.k8s.io", Resource: "*"}.Matches(metricsPods))
+	assert.True(t, ResourceSelector{Group: "traefik.containo.us", Resource: "*"}.Matches(middlewares))
+	assert.False(t, ResourceSelector{Group: "traefik.containo.us", Version: "v1", Resource: "*"}.Matches(middlewares))
+}
+
+func TestNewResourceFilter(t *testing.T) {
+	pods := schema.GroupVersionResource{Group: "", Version: "v1", Resource: "pods"}
+	secrets := schema.GroupVersionResource{Group: "", Version: "v1", Resource: "secrets"}
+	deployments := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+
+	filter := NewResourceFilter(nil, nil)
+	assert.True(t, filter(pods))
+
+	filter = NewResourceFilter(nil, []ResourceSelector{{Resource: "secrets"}})
+	assert.True(t, filter(pods))
+	assert.False(t, filter(secrets))
+
+	filter = NewResourceFilter([]ResourceSelector{{Resource: "*"}}, []ResourceSelector{{Resource: "secrets"}})
+	assert.True(t, filter(pods))
+	assert.False(t, filter(secrets))
+	assert.False(t, filter(deployments))
+}
+
+func TestConfigResourceSelectors(t *testing.T) {
+	data := []byte(`
+ExcludeResources:
+  - traefik.containo.us/*
+  - Group: ""
+    Version: v1
+    Resource: secrets
+`)
+
+	config := DefaultConfig()
+	require.NoError(t, yaml.Unmarshal(data, config))
+
+	assert.Equal(t, []ResourceSelector{
+		{Group: "traefik.containo.us", Resource: "*"},
+		{Group: "", Version: "v1", Resource: "secrets"},
+	}, config.ExcludeResources)
+}
+
+func TestResourceSelectorUnmarshalUnknownField(t *testing.T) {
+	var selector ResourceSelector
+
+	err := yaml.Unmarshal([]byte("Group: apps\nResorce: deployments\n"), &selector)
+	assert.ErrorContains(t, err, `unknown field "Resorce"`)
+
+	require.NoError(t, yaml.Unmarshal([]byte("Group: apps\nResource: deployments\n"), &selector))
+	assert.Equal(t, ResourceSelector{Group: "apps", Resource: "deployments"}, selector)
+
+	err = yaml.Unmarshal([]byte("[apps, deployments]\n"), &selector)
+	assert.ErrorContains(t, err, "must be a string or an object")
+}
@@ -0,0 +1,248 @@
+package kubedump
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	kubedump "github.com/joshmeranda/kubedump/pkg"
+	"github.com/joshmeranda/kubedump/pkg/filter"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// RingTriggerPath is the path which triggers a ring buffer flush when sent a POST request.
+const RingTriggerPath = "/trigger"
+
+// RingConfig configures holding only the most recent events and logs in memory, writing them to the dump when the ring
+// is triggered. The ring is disabled unless Window is set to a positive duration.
+type RingConfig struct {
+	// Window is how long events and logs are held for (ex "15m").
+	Window string
+
+	// PostWindow is how long to keep writing to the dump after a trigger, defaulting to Window.
+	PostWindow string
+
+	// MaxSize is the most memory the held events and logs may use before the oldest are dropped (ex "256Mi"), and is
+	// unlimited if empty.
+	MaxSize string
+
+	// Trigger is a filter triggering the ring when a resource or event matches it.
+	Trigger string
+
+	// TriggerAddress is the address to listen on for POST requests to RingTriggerPath which trigger the ring.
+	TriggerAddress string
+}
+
+func parseDuration(name string, duration string) (time.Duration, error) {
+	if duration == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse %s '%s': %w", name, duration, err)
+	}
+
+	return d, nil
+}
+
+// override replaces the values of config with those set in other.
+func (config *RingConfig) override(other RingConfig) {
+	if other.Window != "" {
+		config.Window = other.Window
+	}
+
+	if other.PostWindow != "" {
+		config.PostWindow = other.PostWindow
+	}
+
+	if other.MaxSize != "" {
+		config.MaxSize = other.MaxSize
+	}
+
+	if other.Trigger != "" {
+		config.Trigger = other.Trigger
+	}
+
+	if other.TriggerAddress != "" {
+		config.TriggerAddress = other.TriggerAddress
+	}
+}
+
+func (config RingConfig) Enabled() bool {
+	window, err := parseDuration("ring window", config.Window)
+	return err == nil && window > 0
+}
+
+// Validate checks the values of the config, even if the ring is disabled.
+func (config RingConfig) Validate() error {
+	if _, err := parseDuration("ring window", config.Window); err != nil {
+		return err
+	}
+
+	if _, err := parseDuration("ring post window", config.PostWindow); err != nil {
+		return err
+	}
+
+	if _, err := parseSize("ring max size", config.MaxSize); err != nil {
+		return err
+	}
+
+	if config.Trigger != "" {
+		if _, err := filter.Parse(config.Trigger); err != nil {
+			return fmt.Errorf("could not parse ring trigger: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Sink wraps inner in a RingSink as configured.
+func (config RingConfig) Sink(inner kubedump.Sink, logger *slog.Logger) (*kubedump.RingSink, error) {
+	window, err := parseDuration("ring window", config.Window)
+	if err != nil {
+		return nil, err
+	}
+
+	postWindow, err := parseDuration("ring post window", config.PostWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	maxBytes, err := parseSize("ring max size", config.MaxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	sink, err := newRingSink(inner, window, postWindow, config.Trigger, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	sink.MaxBytes = maxBytes
+
+	return sink, nil
+}
+
+// newRingSink wraps inner in a RingSink holding the last window of events and logs. If triggerFilter is not empty,
+// the sink is triggered by any resource or event matching it.
+func newRingSink(inner kubedump.Sink, window time.Duration, postWindow time.Duration, triggerFilter string, logger *slog.Logger) (*kubedump.RingSink, error) {
+	sink := kubedump.NewRingSink(inner, window)
+
+	if postWindow > 0 {
+		sink.PostWindow = postWindow
+	}
+
+	sink.OnTrigger = func(reason string) {
+		logger.Info(fmt.Sprintf("flushing ring buffer: %s", reason))
+	}
+
+	if triggerFilter != "" {
+		expr, err := filter.Parse(triggerFilter)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse ring trigger: %w", err)
+		}
+
+		sink.TriggerOn = func(u *unstructured.Unstructured) bool {
+			return expr.Matches(kubedump.NewResourceBuilder().FromUnstructured(u).Build())
+		}
+	}
+
+	return sink, nil
+}
+
+// ringTriggerHandler triggers sink on each POST request, using the "reason" query parameter as the reason if given.
+func ringTriggerHandler(sink *kubedump.RingSink, logger *slog.Logger) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(RingTriggerPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		reason := r.URL.Query().Get("reason")
+		if reason == "" {
+			reason = fmt.Sprintf("http request from %s", r.RemoteAddr)
+		}
+
+		if err := sink.Trigger(reason); err != nil {
+			logger.Error(fmt.Sprintf("could not flush ring buffer: %s", err))
+			http.Error(w, "could not flush ring buffer", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	return mux
+}
+
+// startRingTriggers triggers sink whenever one of ringTriggerSignals is received, and, if address is not empty, on
+// POST requests to RingTriggerPath at address. The returned function stops listening for triggers.
+func startRingTriggers(ctx context.Context, sink *kubedump.RingSink, address string, logger *slog.Logger) (func(), error) {
+	var server *http.Server
+
+	if address != "" {
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return nil, fmt.Errorf("could not listen for ring triggers: %w", err)
+		}
+
+		server = &http.Server{
+			Handler:           ringTriggerHandler(sink, logger),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		go func() {
+			if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error(fmt.Sprintf("ring trigger server stopped: %s", err))
+			}
+		}()
+
+		logger.Info(fmt.Sprintf("listening for ring triggers at http://%s%s", listener.Addr(), RingTriggerPath))
+	}
+
+	signalChan := make(chan os.Signal, 1)
+	done := make(chan struct{})
+
+	if len(ringTriggerSignals) > 0 {
+		signal.Notify(signalChan, ringTriggerSignals...)
+	}
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-done:
+				return
+			case sig := <-signalChan:
+				if err := sink.Trigger(fmt.Sprintf("received %s", sig)); err != nil {
+					logger.Error(fmt.Sprintf("could not flush ring buffer: %s", err))
+				}
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signalChan)
+		close(done)
+
+		if server != nil {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				logger.Warn(fmt.Sprintf("could not stop ring trigger server: %s", err))
+			}
+		}
+	}, nil
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package kubedump
+
+import (
+	"os"
+	"syscall"
+)
+
+// ringTriggerSignals are the signals which trigger a ring buffer flush.
+var ringTriggerSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,7 @@
+package kubedump
+
+import "os"
+
+// ringTriggerSignals is empty since windows has no user defined signals, so rings can only be triggered over http or by
+// a filter.
+var ringTriggerSignals = []os.Signal{}
@@ -0,0 +1,73 @@
+package kubedump
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	kubedump "github.com/joshmeranda/kubedump/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func ringTestPod(name string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	u.SetKind("Pod")
+	u.SetName(name)
+	u.SetNamespace("default")
+
+	return u
+}
+
+func TestRingTriggerHandler(t *testing.T) {
+	base := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	sink, err := newRingSink(kubedump.NewDirSink(base), time.Minute, 0, "", logger)
+	require.NoError(t, err)
+
+	require.NoError(t, sink.WriteResource(ringTestPod("sample-pod")))
+
+	server := httptest.NewServer(ringTriggerHandler(sink, logger))
+	defer server.Close()
+
+	response, err := http.Get(server.URL + RingTriggerPath)
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, response.StatusCode)
+	assert.NoFileExists(t, path.Join(base, "default", "Pod", "sample-pod", "sample-pod.yaml"))
+
+	response, err = http.Post(server.URL+RingTriggerPath+"?reason=test", "", nil)
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+	assert.FileExists(t, path.Join(base, "default", "Pod", "sample-pod", "sample-pod.yaml"))
+
+	require.NoError(t, sink.Close())
+}
+
+func TestRingTriggerFilter(t *testing.T) {
+	base := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	_, err := newRingSink(kubedump.NewDirSink(base), time.Minute, 0, "pod and", logger)
+	assert.Error(t, err)
+
+	sink, err := newRingSink(kubedump.NewDirSink(base), time.Minute, 0, "Pod default/crashing-*", logger)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, sink.PostWindow)
+
+	require.NoError(t, sink.WriteResource(ringTestPod("sample-pod")))
+	assert.NoDirExists(t, path.Join(base, "default"))
+
+	require.NoError(t, sink.WriteResource(ringTestPod("crashing-pod")))
+	assert.FileExists(t, path.Join(base, "default", "Pod", "sample-pod", "sample-pod.yaml"))
+	assert.FileExists(t, path.Join(base, "default", "Pod", "crashing-pod", "crashing-pod.yaml"))
+
+	require.NoError(t, sink.Close())
+}
@@ -0,0 +1,332 @@
+package kubedump
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	kubedump "github.com/joshmeranda/kubedump/pkg"
+	"github.com/joshmeranda/kubedump/pkg/upload"
+)
+
+// UploadConfig configures uploading dumps to S3 compatible object storage. Uploading is disabled unless Bucket is set.
+// Credentials are read from the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and AWS_SESSION_TOKEN environment variables.
+type UploadConfig struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	PathStyle bool
+
+	// PartSize is the size in bytes of each part of a multipart upload.
+	PartSize   int64
+	MaxRetries int
+
+	// SnapshotInterval is how often an archive of the dump in progress is uploaded. If empty, only the finished dump is
+	// uploaded.
+	SnapshotInterval string
+}
+
+// override replaces the values of config with those set in other. PathStyle can only be turned on.
+func (config *UploadConfig) override(other UploadConfig) {
+	if other.Endpoint != "" {
+		config.Endpoint = other.Endpoint
+	}
+
+	if other.Region != "" {
+		config.Region = other.Region
+	}
+
+	if other.Bucket != "" {
+		config.Bucket = other.Bucket
+	}
+
+	if other.Prefix != "" {
+		config.Prefix = other.Prefix
+	}
+
+	if other.PathStyle {
+		config.PathStyle = true
+	}
+
+	if other.PartSize != 0 {
+		config.PartSize = other.PartSize
+	}
+
+	if other.MaxRetries != 0 {
+		config.MaxRetries = other.MaxRetries
+	}
+
+	if other.SnapshotInterval != "" {
+		config.SnapshotInterval = other.SnapshotInterval
+	}
+}
+
+func (config UploadConfig) Enabled() bool {
+	return config.Bucket != ""
+}
+
+// Validate checks the values of the config, even if uploading is disabled.
+func (config UploadConfig) Validate() error {
+	if config.SnapshotInterval != "" {
+		if _, err := time.ParseDuration(config.SnapshotInterval); err != nil {
+			return fmt.Errorf("could not parse snapshot interval '%s': %w", config.SnapshotInterval, err)
+		}
+	}
+
+	if config.Enabled() {
+		if _, err := config.Uploader(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Uploader creates an uploader for the configured bucket.
+func (config UploadConfig) Uploader() (*upload.Uploader, error) {
+	uploader, err := upload.NewUploader(upload.Options{
+		Endpoint:  config.Endpoint,
+		Region:    config.Region,
+		Bucket:    config.Bucket,
+		Prefix:    config.Prefix,
+		PathStyle: config.PathStyle,
+		Credentials: upload.Credentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		},
+		PartSize:   config.PartSize,
+		MaxRetries: config.MaxRetries,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid upload config: %w", err)
+	}
+
+	return uploader, nil
+}
+
+// dumpUploader uploads periodic snapshots of a dump in progress, rotated log segments, and the finished dump. Objects
+// are named after the dump directory: snapshots are uploaded to "<dump>/snapshots/<time>.tar.gz", log segments to
+// "<dump>/logs/<namespace>/Pod/<pod>/<container>.log.<n>" numbered from 1 in the order they were rotated, and the
+// finished dump to "<dump>.tar.gz".
+type dumpUploader struct {
+	queue    *upload.Queue
+	basePath string
+	logger   *slog.Logger
+
+	// db is the sink of a dump using the db format, which is copied for snapshots rather than archived while it is
+	// being written. It must be set before snapshots are started.
+	db *kubedump.DBSink
+
+	interval time.Duration
+
+	// segments counts the log segments uploaded for each log file, so each segment is uploaded to its own object.
+	segmentsMu sync.Mutex
+	segments   map[string]int
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+func newDumpUploader(config UploadConfig, basePath string, logger *slog.Logger) (*dumpUploader, error) {
+	uploader, err := config.Uploader()
+	if err != nil {
+		return nil, err
+	}
+
+	var interval time.Duration
+	if config.SnapshotInterval != "" {
+		if interval, err = time.ParseDuration(config.SnapshotInterval); err != nil {
+			return nil, fmt.Errorf("could not parse snapshot interval '%s': %w", config.SnapshotInterval, err)
+		}
+	}
+
+	// uploads continue after the dump is stopped, so they must not use the dump's context
+	dumpUploader := &dumpUploader{
+		queue:    upload.NewQueue(context.Background(), uploader, logger),
+		basePath: basePath,
+		logger:   logger,
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+
+	return dumpUploader, nil
+}
+
+// StartSnapshots starts uploading snapshots of the dump in progress, if a snapshot interval is configured.
+func (dumpUploader *dumpUploader) StartSnapshots() {
+	if dumpUploader.interval > 0 {
+		dumpUploader.wg.Add(1)
+		go dumpUploader.snapshotLoop(dumpUploader.interval)
+	}
+}
+
+func (dumpUploader *dumpUploader) dumpName() string {
+	return filepath.Base(strings.TrimSuffix(dumpUploader.basePath, string(filepath.Separator)))
+}
+
+func (dumpUploader *dumpUploader) snapshotLoop(interval time.Duration) {
+	defer dumpUploader.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-dumpUploader.stop:
+			return
+		case t := <-ticker.C:
+			name := path.Join(dumpUploader.dumpName(), "snapshots", t.UTC().Format(DefaultTimeFormat)+".tar.gz")
+
+			if err := dumpUploader.uploadSnapshot(name); err != nil {
+				dumpUploader.logger.Error(fmt.Sprintf("could not snapshot dump: %s", err))
+			}
+		}
+	}
+}
+
+// uploadSnapshot archives the dump in progress and queues it to be uploaded to the object for name. The database of a
+// db dump is open for writing, so the archive is made from a copy of the dump holding a consistent copy of the
+// database.
+func (dumpUploader *dumpUploader) uploadSnapshot(name string) error {
+	if dumpUploader.db == nil {
+		return dumpUploader.uploadArchive(dumpUploader.basePath, name)
+	}
+
+	stagingDir, err := os.MkdirTemp("", "kubedump-snapshot-*")
+	if err != nil {
+		return fmt.Errorf("could not create snapshot directory: %w", err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	dir := filepath.Join(stagingDir, dumpUploader.dumpName())
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return fmt.Errorf("could not create snapshot directory: %w", err)
+	}
+
+	fsys := os.DirFS(dumpUploader.basePath)
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return fmt.Errorf("could not read dump directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.Name() == kubedump.DBFileName || !entry.Type().IsRegular() {
+			continue
+		}
+
+		if err := copyFile(fsys, entry.Name(), filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	if err := dumpUploader.db.CopyTo(filepath.Join(dir, kubedump.DBFileName)); err != nil {
+		return err
+	}
+
+	return dumpUploader.uploadArchive(dir, name)
+}
+
+// uploadSegment queues the rotated log segment at segmentPath, opened as segment, to be uploaded. The segment is
+// renamed and compressed by later rotations, so it is copied to a temporary file first.
+func (dumpUploader *dumpUploader) uploadSegment(segmentPath string, segment *os.File) {
+	defer segment.Close()
+
+	relative, err := filepath.Rel(dumpUploader.basePath, segmentPath)
+	if err != nil {
+		dumpUploader.logger.Error(fmt.Sprintf("could not upload log segment '%s': %s", segmentPath, err))
+		return
+	}
+
+	f, err := os.CreateTemp("", "kubedump-*.log")
+	if err != nil {
+		dumpUploader.logger.Error(fmt.Sprintf("could not create temporary log segment: %s", err))
+		return
+	}
+
+	if _, err := io.Copy(f, segment); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		dumpUploader.logger.Error(fmt.Sprintf("could not upload log segment '%s': %s", segmentPath, err))
+		return
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		dumpUploader.logger.Error(fmt.Sprintf("could not upload log segment '%s': %s", segmentPath, err))
+		return
+	}
+
+	logPath := strings.TrimSuffix(filepath.ToSlash(relative), path.Ext(relative))
+
+	dumpUploader.segmentsMu.Lock()
+	if dumpUploader.segments == nil {
+		dumpUploader.segments = make(map[string]int)
+	}
+	dumpUploader.segments[logPath]++
+	n := dumpUploader.segments[logPath]
+	dumpUploader.segmentsMu.Unlock()
+
+	name := path.Join(dumpUploader.dumpName(), "logs", fmt.Sprintf("%s.%d", logPath, n))
+
+	dumpUploader.queue.Add(name, f.Name(), true)
+}
+
+// uploadArchive archives the dump in dir to a temporary file and queues it to be uploaded to the object for name.
+func (dumpUploader *dumpUploader) uploadArchive(dir string, name string) error {
+	f, err := os.CreateTemp("", "kubedump-*.tar.gz")
+	if err != nil {
+		return fmt.Errorf("could not create temporary archive: %w", err)
+	}
+	f.Close()
+
+	if err := kubedump.WriteArchive(dir, f.Name()); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	dumpUploader.queue.Add(name, f.Name(), true)
+
+	return nil
+}
+
+// StopSnapshots stops taking snapshots, waiting for any snapshot in progress to be archived.
+func (dumpUploader *dumpUploader) StopSnapshots() {
+	dumpUploader.stopOnce.Do(func() {
+		close(dumpUploader.stop)
+	})
+
+	dumpUploader.wg.Wait()
+}
+
+// Close stops taking snapshots, uploads the finished dump, and waits for every upload to finish. If archivePath is not
+// empty, it is uploaded as the finished dump rather than archiving the dump directory.
+func (dumpUploader *dumpUploader) Close(archivePath string) error {
+	dumpUploader.StopSnapshots()
+
+	name := dumpUploader.dumpName() + ".tar.gz"
+
+	if archivePath != "" {
+		dumpUploader.queue.Add(name, archivePath, false)
+	} else if err := dumpUploader.uploadArchive(dumpUploader.basePath, name); err != nil {
+		dumpUploader.queue.Close()
+		return fmt.Errorf("could not archive dump for upload: %w", err)
+	}
+
+	if err := dumpUploader.queue.Close(); err != nil {
+		return fmt.Errorf("could not upload dump: %w", err)
+	}
+
+	return nil
+}
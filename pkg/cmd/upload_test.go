@@ -0,0 +1,182 @@
+package kubedump
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	kubedump "github.com/joshmeranda/kubedump/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordPuts starts a server accepting every PUT and recording the paths and bodies it received.
+func recordPuts(t *testing.T) (*httptest.Server, func() map[string][]byte) {
+	mu := sync.Mutex{}
+	puts := map[string][]byte{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+
+		mu.Lock()
+		puts[r.URL.Path] = body
+		mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() map[string][]byte {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return puts
+	}
+}
+
+func TestUploadConfigFromArgs(t *testing.T) {
+	config, err := resolveConfigWithArgs(t, "show", "--upload-bucket", "dumps", "--upload-prefix", "ci", "--snapshot-interval", "1m")
+	require.NoError(t, err)
+
+	assert.True(t, config.Upload.Enabled())
+	assert.Equal(t, "dumps", config.Upload.Bucket)
+	assert.Equal(t, "ci", config.Upload.Prefix)
+	assert.Equal(t, "1m0s", config.Upload.SnapshotInterval)
+
+	_, err = resolveConfigWithArgs(t, "show", "--upload-bucket", "dumps", "--upload-endpoint", "localhost:9000")
+	assert.Error(t, err)
+}
+
+func TestDumpUploader(t *testing.T) {
+	server, puts := recordPuts(t)
+
+	basePath := path.Join(t.TempDir(), "sample.dump")
+	require.NoError(t, os.MkdirAll(path.Join(basePath, "default", "Pod", "sample-pod"), 0755))
+	require.NoError(t, os.WriteFile(path.Join(basePath, "default", "Pod", "sample-pod", "sample-pod.yaml"), []byte("kind: Pod\n"), 0644))
+
+	config := UploadConfig{
+		Endpoint:         server.URL,
+		Bucket:           "bucket",
+		Prefix:           "ci",
+		PathStyle:        true,
+		SnapshotInterval: "10ms",
+	}
+
+	uploader, err := newDumpUploader(config, basePath, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+
+	uploader.StartSnapshots()
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, uploader.Close(""))
+
+	snapshots := 0
+	for p := range puts() {
+		if matched, _ := path.Match("/bucket/ci/sample.dump/snapshots/*.tar.gz", p); matched {
+			snapshots++
+		}
+	}
+	assert.Greater(t, snapshots, 0)
+
+	archive, found := puts()["/bucket/ci/sample.dump.tar.gz"]
+	require.True(t, found)
+
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	require.NoError(t, err)
+
+	names := []string{}
+	reader := tar.NewReader(gz)
+	for header, err := reader.Next(); err == nil; header, err = reader.Next() {
+		names = append(names, header.Name)
+	}
+	assert.Contains(t, names, "sample.dump/default/Pod/sample-pod/sample-pod.yaml")
+}
+
+// archiveFiles returns the content of each file in a gzipped tar archive by its name.
+func archiveFiles(t *testing.T, archive []byte) map[string][]byte {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	require.NoError(t, err)
+
+	files := map[string][]byte{}
+	reader := tar.NewReader(gz)
+	for header, err := reader.Next(); err == nil; header, err = reader.Next() {
+		files[header.Name], _ = io.ReadAll(reader)
+	}
+
+	return files
+}
+
+func TestDumpUploaderDBSnapshot(t *testing.T) {
+	server, puts := recordPuts(t)
+
+	basePath := path.Join(t.TempDir(), "sample.dump")
+	require.NoError(t, os.MkdirAll(basePath, 0755))
+	require.NoError(t, os.WriteFile(path.Join(basePath, "kubedump.log"), []byte("started\n"), 0644))
+
+	sink, err := kubedump.NewDBSink(path.Join(basePath, kubedump.DBFileName))
+	require.NoError(t, err)
+	defer sink.Close()
+
+	require.NoError(t, sink.AppendLog("default", "sample-pod", "sample-container", []byte("hello\n")))
+
+	uploader, err := newDumpUploader(UploadConfig{Endpoint: server.URL, Bucket: "bucket", PathStyle: true}, basePath, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	uploader.db = sink
+
+	require.NoError(t, uploader.uploadSnapshot("snapshot.tar.gz"))
+	require.NoError(t, uploader.queue.Close())
+
+	archive, found := puts()["/bucket/snapshot.tar.gz"]
+	require.True(t, found)
+
+	files := archiveFiles(t, archive)
+	assert.Equal(t, []byte("started\n"), files["sample.dump/kubedump.log"])
+
+	dbPath := path.Join(t.TempDir(), kubedump.DBFileName)
+	require.NoError(t, os.WriteFile(dbPath, files["sample.dump/"+kubedump.DBFileName], 0644))
+
+	dump, err := kubedump.OpenDBDump(dbPath)
+	require.NoError(t, err)
+	defer dump.Close()
+
+	logs := []byte{}
+	require.NoError(t, dump.ForEachLog(func(namespace string, pod string, container string, data []byte) error {
+		logs = append(logs, data...)
+		return nil
+	}))
+	assert.Equal(t, []byte("hello\n"), logs)
+}
+
+func TestDumpUploaderLogSegments(t *testing.T) {
+	server, puts := recordPuts(t)
+
+	basePath := path.Join(t.TempDir(), "sample.dump")
+
+	uploader, err := newDumpUploader(UploadConfig{Endpoint: server.URL, Bucket: "bucket", PathStyle: true}, basePath, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+
+	sink := kubedump.NewDirSink(basePath)
+	sink.LogLimits = kubedump.LogLimits{MaxContainerSize: 8}
+	sink.OnRotate = uploader.uploadSegment
+
+	require.NoError(t, sink.AppendLog("default", "sample-pod", "sample-container", []byte("first\n")))
+	require.NoError(t, sink.AppendLog("default", "sample-pod", "sample-container", []byte("second\n")))
+	require.NoError(t, sink.AppendLog("default", "sample-pod", "sample-container", []byte("third\n")))
+	require.NoError(t, sink.Close())
+
+	require.NoError(t, uploader.queue.Close())
+
+	assert.Equal(t, []byte("first\n"), puts()["/bucket/sample.dump/logs/default/Pod/sample-pod/sample-container.log.1"])
+	assert.Equal(t, []byte("second\n"), puts()["/bucket/sample.dump/logs/default/Pod/sample-pod/sample-container.log.2"])
+}
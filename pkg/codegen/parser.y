@@ -31,7 +31,7 @@ func couldNotParseErr(err error) error {
 
 
 // todo: should be a better name than "IDENTIFIER"
-%token<s> IDENTIFIER NAMESPACE LABEL
+%token<s> IDENTIFIER NAMESPACE LABEL FIELD EQUALS NOT_EQUALS
 
 %type<expression> expr single_expr
 %type<labels> labels
@@ -70,6 +70,22 @@ single_expr: IDENTIFIER IDENTIFIER {
 		$$ = namespaceExpression{ namespacePattern: $2 }
 	}
 	| LABEL labels { $$ = labelExpression{ labels: $2 } }
+	| FIELD IDENTIFIER EQUALS IDENTIFIER {
+		path, err := parseFieldPath($2)
+		if err != nil {
+			yylex.Error(fmt.Sprintf("could not parse field path '%s': %s", $2, err))
+		}
+
+		$$ = fieldExpression{ path: path, valuePattern: $4 }
+	}
+	| FIELD IDENTIFIER NOT_EQUALS IDENTIFIER {
+		path, err := parseFieldPath($2)
+		if err != nil {
+			yylex.Error(fmt.Sprintf("could not parse field path '%s': %s", $2, err))
+		}
+
+		$$ = notExpression{ inner: fieldExpression{ path: path, valuePattern: $4 } }
+	}
 
 labels: IDENTIFIER {
 		key, val, err := splitLabelPattern($1)
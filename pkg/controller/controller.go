@@ -4,10 +4,12 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	kubedump "github.com/joshmeranda/kubedump/pkg"
 	"github.com/joshmeranda/kubedump/pkg/filter"
 	apicorev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -31,19 +33,68 @@ type Options struct {
 	Logger         *slog.Logger
 	LogSyncTimeout time.Duration
 	Resources      []schema.GroupVersionResource
+
+	// ResourceFilter is used to determine if a resource should be watched, returning true if the resource should be
+	// watched. If nil, all resources are watched.
+	ResourceFilter func(schema.GroupVersionResource) bool
+
+	// WatchApiExtensions will have the controller watch CustomResourceDefinitions and APIServices, adding and removing
+	// watched resources as they are installed or removed from the cluster.
+	WatchApiExtensions bool
+
+	// RedactSecrets will replace the values of any Secret's data, and its last applied configuration, before it is
+	// written to disk.
+	RedactSecrets bool
+
+	// LinkResources will have the controller link related resources as they are dumped, rather than leaving it to
+	// `kubedump link`.
+	LinkResources bool
+
+	// Sink is where the collected resources, events, logs, and links are stored. If nil, they are written to a directory
+	// at BasePath. The sink is closed when the controller is stopped.
+	Sink kubedump.Sink
+
+	// Triggers take actions when a dumped resource or a received event matches them, writing the results to the Sink as
+	// an incident.
+	Triggers []Trigger
+}
+
+// resourceInformer wraps an informer with the channel used to stop it, allowing informers to be started and stopped
+// independently of each other.
+type resourceInformer struct {
+	informer cache.SharedIndexInformer
+	stopChan chan struct{}
+}
+
+func (ri *resourceInformer) run() {
+	if ri.stopChan != nil {
+		return
+	}
+
+	ri.stopChan = make(chan struct{})
+	go ri.informer.Run(ri.stopChan)
+}
+
+func (ri *resourceInformer) stop() {
+	if ri.stopChan == nil {
+		return
+	}
+
+	close(ri.stopChan)
+	ri.stopChan = nil
 }
 
 // todo: move job handling into job.go
 type Controller struct {
 	Options
 
-	kubeclientset kubernetes.Interface
-	startTime     time.Time
+	kubeclientset    kubernetes.Interface
+	dynamicclientset dynamic.Interface
+	startTime        time.Time
 
 	filterExpr filter.Expression
 
-	informerFactory dynamicinformer.DynamicSharedInformerFactory
-	stopChan        chan struct{}
+	stopChan chan struct{}
 
 	workerWaitGroup sync.WaitGroup
 
@@ -56,7 +107,31 @@ type Controller struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 
-	informers map[string]cache.SharedIndexInformer
+	informers   map[string]*resourceInformer
+	informersMu sync.Mutex
+
+	// dynamicResources maps the name of CustomResourceDefinitions and APIServices to the resources they provide.
+	dynamicResources   map[string][]schema.GroupVersionResource
+	dynamicResourcesMu sync.Mutex
+
+	// adoptedResources maps the name of CustomResourceDefinitions and APIServices to the resources in dynamicResources
+	// which were already watched at another version than the one they provide, and is guarded by dynamicResourcesMu.
+	adoptedResources map[string][]schema.GroupVersionResource
+
+	// apiServices maps the name of each available APIService to the group version its resources were discovered for,
+	// and is guarded by dynamicResourcesMu.
+	apiServices map[string]schema.GroupVersion
+
+	// linker is used to link resources as they are dumped, and is nil if LinkResources is not set.
+	linker *kubedump.LiveLinker
+
+	// triggered holds the triggerKey of each trigger which is currently matching a resource.
+	triggered   map[string]bool
+	triggeredMu sync.Mutex
+
+	// eventTriggered maps the eventTriggerKey of each trigger fired by an event to when it fired, and is guarded by
+	// triggeredMu.
+	eventTriggered map[string]time.Time
 }
 
 func NewController(
@@ -72,12 +147,16 @@ func NewController(
 		ctx, cancel = context.WithCancel(context.Background())
 	}
 
+	if opts.Sink == nil {
+		opts.Sink = kubedump.NewDirSink(opts.BasePath)
+	}
+
 	controller := &Controller{
-		Options:       opts,
-		kubeclientset: kubeclientset,
+		Options:          opts,
+		kubeclientset:    kubeclientset,
+		dynamicclientset: dynamicclientset,
 
-		informerFactory: dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicclientset, ResyncTime, apicorev1.NamespaceAll, nil),
-		stopChan:        nil,
+		stopChan: nil,
 
 		logStreams: make(map[string]Stream),
 
@@ -86,17 +165,85 @@ func NewController(
 		ctx:    ctx,
 		cancel: cancel,
 
-		informers: make(map[string]cache.SharedIndexInformer),
+		informers: make(map[string]*resourceInformer),
+
+		dynamicResources: make(map[string][]schema.GroupVersionResource),
+		adoptedResources: make(map[string][]schema.GroupVersionResource),
+		apiServices:      make(map[string]schema.GroupVersion),
+
+		triggered:      make(map[string]bool),
+		eventTriggered: make(map[string]time.Time),
+	}
+
+	if opts.LinkResources {
+		controller.linker = kubedump.NewLiveLinker(opts.Sink)
 	}
 
 	if len(opts.Resources) == 0 {
 		opts.Logger.Warn("no resources were specified")
 	}
 
-	for _, resource := range opts.Resources {
+	controller.AddResources(opts.Resources...)
+
+	eventInformer := informers.NewSharedInformerFactory(kubeclientset, ResyncTime).Events().V1().Events().Informer()
+	_, err := eventInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.handleEvent,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not add event handler: %w", err)
+	}
+
+	controller.informers["events.k8s.io/v1"] = &resourceInformer{informer: eventInformer}
+
+	if opts.WatchApiExtensions {
+		controller.watchApiExtensions()
+	}
+
+	return controller, nil
+}
+
+func resourceKey(resource schema.GroupVersionResource) string {
+	return fmt.Sprintf("%s:%s:%s", resource.Group, resource.Version, resource.Resource)
+}
+
+// addInformer registers and, if the controller is running, starts an informer for the given resource. The caller must
+// hold informersMu.
+func (controller *Controller) addInformer(key string, resource schema.GroupVersionResource, handler cache.ResourceEventHandler) {
+	informer := dynamicinformer.NewFilteredDynamicInformer(controller.dynamicclientset, resource, apicorev1.NamespaceAll, ResyncTime, cache.Indexers{}, nil).Informer()
+
+	if _, err := informer.AddEventHandler(handler); err != nil {
+		controller.Logger.Error(fmt.Sprintf("could not add event handler for resource '%s': %s", resource.Resource, err))
+		return
+	}
+
+	ri := &resourceInformer{informer: informer}
+	controller.informers[key] = ri
+
+	if controller.stopChan != nil {
+		ri.run()
+	}
+}
+
+// AddResources registers informers for the given resources. Resources which already have an informer or which do not
+// pass the ResourceFilter are ignored. If the controller is running, the new informers are started immediately.
+func (controller *Controller) AddResources(resources ...schema.GroupVersionResource) {
+	controller.informersMu.Lock()
+	defer controller.informersMu.Unlock()
+
+	for _, resource := range resources {
+		key := resourceKey(resource)
+		if _, found := controller.informers[key]; found {
+			continue
+		}
+
+		if controller.ResourceFilter != nil && !controller.ResourceFilter(resource) {
+			controller.Logger.Debug(fmt.Sprintf("ignoring excluded resource '%s'", resource))
+			continue
+		}
+
 		controller.Logger.Debug(fmt.Sprintf("registering resource '%s'", resource.Resource))
 
-		handler := cache.ResourceEventHandlerFuncs{
+		controller.addInformer(key, resource, cache.ResourceEventHandlerFuncs{
 			AddFunc: func(obj any) {
 				controller.onAdd(resource, obj)
 			},
@@ -106,27 +253,63 @@ func NewController(
 			DeleteFunc: func(obj any) {
 				controller.onDelete(resource, obj)
 			},
+		})
+	}
+}
+
+// RemoveResources stops and removes the informers for the given resources. Resources without an informer are ignored.
+func (controller *Controller) RemoveResources(resources ...schema.GroupVersionResource) {
+	controller.informersMu.Lock()
+	defer controller.informersMu.Unlock()
+
+	for _, resource := range resources {
+		key := resourceKey(resource)
+
+		ri, found := controller.informers[key]
+		if !found {
+			continue
 		}
-		informer := controller.informerFactory.ForResource(resource).Informer()
 
-		if _, err := informer.AddEventHandler(handler); err != nil {
-			controller.Logger.Error(fmt.Sprintf("could not add event handler for resource '%s': %s", resource.Resource, err))
-		} else {
-			controller.informers[fmt.Sprintf("%s:%s:%s", resource.Group, resource.Version, resource.Resource)] = informer
+		controller.Logger.Debug(fmt.Sprintf("unregistering resource '%s'", resource.Resource))
+
+		ri.stop()
+		delete(controller.informers, key)
+	}
+}
+
+// WatchedResources returns the resources which currently have an informer, sorted by group, version, and resource.
+func (controller *Controller) WatchedResources() []schema.GroupVersionResource {
+	controller.informersMu.Lock()
+	defer controller.informersMu.Unlock()
+
+	resources := make([]schema.GroupVersionResource, 0, len(controller.informers))
+
+	for key := range controller.informers {
+		if split := strings.Split(key, ":"); len(split) == 3 {
+			resources = append(resources, schema.GroupVersionResource{Group: split[0], Version: split[1], Resource: split[2]})
 		}
 	}
 
-	eventInformer := informers.NewSharedInformerFactory(kubeclientset, ResyncTime).Events().V1().Events().Informer()
-	_, err := eventInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: controller.handleEvent,
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].String() < resources[j].String()
 	})
-	if err != nil {
-		return nil, fmt.Errorf("could not add event handler: %w", err)
-	}
 
-	controller.informers["events.k8s.io/v1"] = eventInformer
+	return resources
+}
+
+// watchedVersion returns the version at which the given group and resource is being watched, or an empty string if it
+// is not watched.
+func (controller *Controller) watchedVersion(group string, resource string) string {
+	controller.informersMu.Lock()
+	defer controller.informersMu.Unlock()
 
-	return controller, nil
+	for key := range controller.informers {
+		if split := strings.Split(key, ":"); len(split) == 3 && split[0] == group && split[2] == resource {
+			return split[1]
+		}
+	}
+
+	return ""
 }
 
 func (controller *Controller) syncLogStreams() {
@@ -191,11 +374,15 @@ func (controller *Controller) Start(nWorkers int, expr filter.Expression) error
 	defer runtime.HandleCrash()
 
 	controller.filterExpr = expr
-	controller.stopChan = make(chan struct{})
 
 	controller.Logger.Info("starting controller")
 
-	controller.informerFactory.Start(controller.stopChan)
+	controller.informersMu.Lock()
+	controller.stopChan = make(chan struct{})
+	for _, ri := range controller.informers {
+		ri.run()
+	}
+	controller.informersMu.Unlock()
 
 	controller.startTime = time.Now().UTC()
 
@@ -237,8 +424,13 @@ func (controller *Controller) Stop() error {
 	}
 	controller.Logger.Info("Stopping controller")
 
+	controller.informersMu.Lock()
+	for _, ri := range controller.informers {
+		ri.stop()
+	}
 	close(controller.stopChan)
 	controller.stopChan = nil
+	controller.informersMu.Unlock()
 
 	controller.workQueue.ShutDownWithDrain()
 
@@ -246,5 +438,9 @@ func (controller *Controller) Stop() error {
 
 	controller.filterExpr = nil
 
+	if err := controller.Sink.Close(); err != nil {
+		return fmt.Errorf("could not close sink: %w", err)
+	}
+
 	return nil
 }
@@ -25,6 +25,7 @@ import (
 	dynamicfake "k8s.io/client-go/dynamic/fake"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/yaml"
 )
 
 var testControllerResources = []schema.GroupVersionResource{
@@ -275,3 +276,402 @@ func TestPod(t *testing.T) {
 
 	tests.AssertResource(t, basePath, handledPod, false)
 }
+
+func TestAddResources(t *testing.T) {
+	handledConfigMap, configMap := resourceToHandled(t, &apicorev1.ConfigMap{
+		TypeMeta: apimetav1.TypeMeta{
+			Kind:       "ConfigMap",
+			APIVersion: "v1",
+		},
+		ObjectMeta: apimetav1.ObjectMeta{
+			Name:      "sample-configmap",
+			Namespace: tests.ResourceNamespace,
+			UID:       "sample-configmap-uid",
+		},
+	})
+
+	teardown, _, basePath, ctx, controller := fakeControllerSetup(t, configMap)
+	defer teardown()
+
+	err := controller.Start(tests.UnitNWorkers, filterForResource(t, handledConfigMap))
+	assert.NoError(t, err)
+
+	controller.AddResources(schema.GroupVersionResource{Group: "", Version: "v1", Resource: "configmaps"})
+
+	if err := tests.WaitForPath(ctx, tests.TestWaitDuration, kubedump.ResourcePathBuilder{}.WithBase(basePath).WithResource(handledConfigMap).Build()); err != nil {
+		t.Fatalf("error waiting for resource path: %s", handledConfigMap)
+	}
+
+	err = controller.Stop()
+	assert.NoError(t, err)
+}
+
+func TestLinkResources(t *testing.T) {
+	handledPod, pod := resourceToHandled(t, &apicorev1.Pod{
+		TypeMeta: apimetav1.TypeMeta{
+			Kind:       "Pod",
+			APIVersion: "v1",
+		},
+		ObjectMeta: apimetav1.ObjectMeta{
+			Name:      "sample-pod",
+			Namespace: tests.ResourceNamespace,
+			UID:       "sample-pod-uid",
+		},
+		Spec: apicorev1.PodSpec{
+			ServiceAccountName: "sample-service-account",
+		},
+	})
+
+	_, serviceAccount := resourceToHandled(t, &apicorev1.ServiceAccount{
+		TypeMeta: apimetav1.TypeMeta{
+			Kind:       "ServiceAccount",
+			APIVersion: "v1",
+		},
+		ObjectMeta: apimetav1.ObjectMeta{
+			Name:      "sample-service-account",
+			Namespace: tests.ResourceNamespace,
+			UID:       "sample-service-account-uid",
+		},
+	})
+
+	teardown, _, basePath, ctx, controller := fakeControllerSetup(t, pod, serviceAccount)
+	defer teardown()
+
+	controller.linker = kubedump.NewLiveLinker(controller.Sink)
+
+	expr, err := filter.Parse("namespace " + tests.ResourceNamespace)
+	require.NoError(t, err)
+
+	err = controller.Start(tests.UnitNWorkers, expr)
+	assert.NoError(t, err)
+
+	podDir := kubedump.ResourcePathBuilder{}.WithBase(basePath).WithResource(handledPod).Build()
+	linkedFile := path.Join(podDir, "ServiceAccount", "sample-service-account", "sample-service-account.yaml")
+	if err := tests.WaitForPath(ctx, tests.TestWaitDuration, linkedFile); err != nil {
+		t.Fatalf("error waiting for linked service account: %s", err)
+	}
+
+	err = controller.Stop()
+	assert.NoError(t, err)
+}
+
+func TestWatchCustomResourceDefinitions(t *testing.T) {
+	widgetResource := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+
+	crd := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata": map[string]any{
+			"name": "widgets.example.com",
+		},
+		"spec": map[string]any{
+			"group": "example.com",
+			"scope": "Namespaced",
+			"names": map[string]any{
+				"plural": "widgets",
+				"kind":   "Widget",
+			},
+			"versions": []any{
+				map[string]any{"name": "v1alpha1", "served": true, "storage": false},
+				map[string]any{"name": "v1", "served": true, "storage": true},
+			},
+		},
+	}}
+
+	widget := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "example.com/v1",
+		"kind":       "Widget",
+		"metadata": map[string]any{
+			"name":      "sample-widget",
+			"namespace": tests.ResourceNamespace,
+		},
+	}}
+	handledWidget := kubedump.NewResourceBuilder().FromUnstructured(widget).Build()
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		CustomResourceDefinitionResource: "CustomResourceDefinitionList",
+		ApiServiceResource:               "APIServiceList",
+		widgetResource:                   "WidgetList",
+	}, crd, widget)
+
+	basePath := path.Join(t.TempDir(), "kubedump-test")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	controller, err := NewController(fake.NewSimpleClientset(), dynamicClient, Options{
+		BasePath:           basePath,
+		ParentContext:      ctx,
+		Logger:             slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		LogSyncTimeout:     time.Second,
+		WatchApiExtensions: true,
+	})
+	require.NoError(t, err)
+
+	err = controller.Start(tests.UnitNWorkers, filterForResource(t, handledWidget))
+	require.NoError(t, err)
+
+	if err := tests.WaitForPath(ctx, tests.TestWaitDuration, kubedump.ResourcePathBuilder{}.WithBase(basePath).WithResource(handledWidget).Build()); err != nil {
+		t.Fatalf("error waiting for resource path: %s", handledWidget)
+	}
+
+	assert.Equal(t, "v1", controller.watchedVersion("example.com", "widgets"))
+
+	err = dynamicClient.Resource(CustomResourceDefinitionResource).Delete(ctx, crd.GetName(), apimetav1.DeleteOptions{})
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return controller.watchedVersion("example.com", "widgets") == ""
+	}, tests.TestWaitDuration, time.Millisecond*100)
+
+	err = controller.Stop()
+	assert.NoError(t, err)
+}
+
+func TestDynamicResourceWatchedAtAnotherVersion(t *testing.T) {
+	teardown, _, _, _, controller := fakeControllerSetup(t)
+	defer teardown()
+
+	v1beta1 := schema.GroupVersionResource{Group: "example.com", Version: "v1beta1", Resource: "widgets"}
+	v1 := v1beta1.GroupResource().WithVersion("v1")
+
+	controller.AddResources(v1beta1)
+
+	// the resource stays watched at the version it was already watched at, for as long as the extension provides it
+	for i := 0; i < 2; i++ {
+		controller.setDynamicResources("widgets.example.com", []schema.GroupVersionResource{v1})
+		assert.Equal(t, []schema.GroupVersionResource{v1beta1}, controller.dynamicResources["widgets.example.com"])
+		assert.Equal(t, "v1beta1", controller.watchedVersion("example.com", "widgets"))
+	}
+
+	controller.setDynamicResources("widgets.example.com", nil)
+	assert.NotContains(t, controller.dynamicResources, "widgets.example.com")
+	assert.Equal(t, "", controller.watchedVersion("example.com", "widgets"))
+}
+
+func TestApiServiceDiscoveredOnChange(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.Resources = []*apimetav1.APIResourceList{
+		{GroupVersion: "metrics.example.com/v1beta1", APIResources: []apimetav1.APIResource{{Name: "widgets", Verbs: []string{"list", "watch"}}}},
+		{GroupVersion: "metrics.example.com/v1", APIResources: []apimetav1.APIResource{{Name: "widgets", Verbs: []string{"list", "watch"}}}},
+	}
+
+	controller, err := NewController(client, dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()), Options{
+		BasePath:       t.TempDir(),
+		Logger:         slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		LogSyncTimeout: time.Second,
+	})
+	require.NoError(t, err)
+
+	apiService := &unstructured.Unstructured{Object: map[string]any{
+		"metadata": map[string]any{"name": "v1beta1.metrics.example.com"},
+		"spec": map[string]any{
+			"group":   "metrics.example.com",
+			"version": "v1beta1",
+			"service": map[string]any{"name": "metrics", "namespace": "default"},
+		},
+		"status": map[string]any{
+			"conditions": []any{map[string]any{"type": "Available", "status": "True"}},
+		},
+	}}
+
+	discoveries := func() int {
+		return len(client.Actions())
+	}
+
+	controller.onApiService(apiService)
+	assert.Equal(t, 1, discoveries())
+	assert.Equal(t, "v1beta1", controller.watchedVersion("metrics.example.com", "widgets"))
+
+	// resyncs of an unchanged service are not discovered again
+	controller.onApiService(apiService)
+	assert.Equal(t, 1, discoveries())
+
+	require.NoError(t, unstructured.SetNestedSlice(apiService.Object, []any{map[string]any{"type": "Available", "status": "False"}}, "status", "conditions"))
+	controller.onApiService(apiService)
+	assert.Equal(t, 1, discoveries())
+	assert.Equal(t, "", controller.watchedVersion("metrics.example.com", "widgets"))
+
+	// becoming available again, or changing version, discovers the resources again
+	require.NoError(t, unstructured.SetNestedSlice(apiService.Object, []any{map[string]any{"type": "Available", "status": "True"}}, "status", "conditions"))
+	controller.onApiService(apiService)
+	assert.Equal(t, 2, discoveries())
+
+	require.NoError(t, unstructured.SetNestedField(apiService.Object, "v1", "spec", "version"))
+	controller.onApiService(apiService)
+	assert.Equal(t, 3, discoveries())
+	assert.Equal(t, []schema.GroupVersionResource{{Group: "metrics.example.com", Version: "v1", Resource: "widgets"}}, controller.dynamicResources["v1beta1.metrics.example.com"])
+}
+
+func TestCustomResourceDefinitionResource(t *testing.T) {
+	crd := &unstructured.Unstructured{Object: map[string]any{
+		"spec": map[string]any{
+			"group": "example.com",
+			"scope": "Cluster",
+			"names": map[string]any{"plural": "widgets"},
+			"versions": []any{
+				map[string]any{"name": "v1beta1", "served": true, "storage": false},
+				map[string]any{"name": "v1", "served": true, "storage": true},
+			},
+		},
+	}}
+
+	resource, ok := customResourceDefinitionResource(crd)
+	assert.True(t, ok)
+	assert.Equal(t, schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}, resource)
+
+	require.NoError(t, unstructured.SetNestedSlice(crd.Object, []any{
+		map[string]any{"name": "v1", "served": false, "storage": true},
+	}, "spec", "versions"))
+
+	_, ok = customResourceDefinitionResource(crd)
+	assert.False(t, ok)
+}
+
+func TestTrigger(t *testing.T) {
+	handledPod, pod := resourceToHandled(t, &apicorev1.Pod{
+		TypeMeta: apimetav1.TypeMeta{
+			Kind:       "Pod",
+			APIVersion: "v1",
+		},
+		ObjectMeta: apimetav1.ObjectMeta{
+			Name:      "crashing-pod",
+			Namespace: tests.ResourceNamespace,
+			UID:       "crashing-pod-uid",
+		},
+		Status: apicorev1.PodStatus{
+			ContainerStatuses: []apicorev1.ContainerStatus{
+				{
+					Name:         "app",
+					RestartCount: 3,
+					State: apicorev1.ContainerState{
+						Waiting: &apicorev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+					},
+				},
+			},
+		},
+	})
+
+	teardown, _, basePath, ctx, controller := fakeControllerSetup(t, pod)
+	defer teardown()
+
+	on, err := filter.Parse("field .status.containerStatuses[*].state.waiting.reason = CrashLoopBackOff")
+	require.NoError(t, err)
+
+	controller.Triggers = []Trigger{{Name: "crash-loop", On: on}}
+
+	err = controller.Start(tests.UnitNWorkers, filterForResource(t, handledPod))
+	assert.NoError(t, err)
+
+	if err := tests.WaitForPath(ctx, tests.TestWaitDuration, path.Join(basePath, kubedump.IncidentsDirName)); err != nil {
+		t.Fatalf("error waiting for incident: %s", err)
+	}
+
+	err = controller.Stop()
+	assert.NoError(t, err)
+
+	incidents, err := os.ReadDir(path.Join(basePath, kubedump.IncidentsDirName))
+	require.NoError(t, err)
+	require.Len(t, incidents, 1, "the trigger should only fire once while the pod keeps matching")
+	assert.True(t, strings.HasSuffix(incidents[0].Name(), "-crash-loop-pod-crashing-pod"))
+
+	incidentDir := path.Join(basePath, kubedump.IncidentsDirName, incidents[0].Name())
+
+	data, err := os.ReadFile(path.Join(incidentDir, kubedump.IncidentMarkerFileName))
+	require.NoError(t, err)
+
+	var marker kubedump.IncidentMarker
+	require.NoError(t, yaml.Unmarshal(data, &marker))
+	assert.Equal(t, "crash-loop", marker.Trigger)
+	assert.Equal(t, "Pod", marker.Kind)
+	assert.Equal(t, tests.ResourceNamespace, marker.Namespace)
+	assert.Equal(t, "crashing-pod", marker.Name)
+
+	assert.FileExists(t, path.Join(incidentDir, "resources", tests.ResourceNamespace, "Pod", "crashing-pod.yaml"))
+	assert.FileExists(t, path.Join(incidentDir, "logs", tests.ResourceNamespace, "crashing-pod", "app.previous.log"))
+
+	data, err = os.ReadFile(path.Join(incidentDir, "describe.txt"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "Waiting (CrashLoopBackOff)")
+}
+
+func TestEventTriggerCooldown(t *testing.T) {
+	teardown, _, _, _, controller := fakeControllerSetup(t)
+	defer teardown()
+
+	on, err := filter.Parse("namespace " + tests.ResourceNamespace)
+	require.NoError(t, err)
+
+	trigger := Trigger{Name: "back-off", On: on, Actions: []TriggerAction{TriggerActionMarker}}
+	controller.Triggers = []Trigger{trigger}
+
+	newEvent := func(name string, pod string) *apieventsv1.Event {
+		return &apieventsv1.Event{
+			ObjectMeta: apimetav1.ObjectMeta{Name: name, Namespace: tests.ResourceNamespace},
+			Reason:     "BackOff",
+			Regarding:  apicorev1.ObjectReference{Kind: "Pod", Namespace: tests.ResourceNamespace, Name: pod},
+		}
+	}
+
+	key := eventTriggerKey(trigger, "Pod", tests.ResourceNamespace, "crashing-pod")
+
+	controller.checkEventTriggers(newEvent("first", "crashing-pod"))
+	fired := controller.eventTriggered[key]
+	require.False(t, fired.IsZero())
+
+	// repeated events regarding the same pod do not fire the trigger again, but events regarding another pod do
+	controller.checkEventTriggers(newEvent("first", "crashing-pod"))
+	controller.checkEventTriggers(newEvent("second", "crashing-pod"))
+	controller.checkEventTriggers(newEvent("other", "other-pod"))
+
+	assert.Equal(t, fired, controller.eventTriggered[key])
+	assert.Len(t, controller.eventTriggered, 2)
+	assert.Eventually(t, func() bool { return controller.workQueue.Len() == 2 }, time.Second, 10*time.Millisecond)
+
+	// deleting the pod lets the trigger fire for it again
+	pod := kubedump.NewResourceBuilder().WithKind("Pod").WithNamespace(tests.ResourceNamespace).WithName("crashing-pod").Build()
+	controller.checkTriggers(HandleDelete, pod)
+	assert.NotContains(t, controller.eventTriggered, key)
+
+	controller.checkEventTriggers(newEvent("third", "crashing-pod"))
+	assert.Contains(t, controller.eventTriggered, key)
+}
+
+func TestDescribeRedactsSecret(t *testing.T) {
+	handledSecret, secret := resourceToHandled(t, &apicorev1.Secret{
+		TypeMeta: apimetav1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: apimetav1.ObjectMeta{
+			Name:      "sample-secret",
+			Namespace: tests.ResourceNamespace,
+			Annotations: map[string]string{
+				"kubectl.kubernetes.io/last-applied-configuration": `{"kind":"Secret","data":{"password":"aHVudGVyMg=="}}`,
+			},
+		},
+		Data: map[string][]byte{
+			"password": []byte("hunter2"),
+		},
+	})
+
+	teardown, _, basePath, _, controller := fakeControllerSetup(t, secret)
+	defer teardown()
+
+	controller.RedactSecrets = true
+
+	require.NoError(t, controller.Start(tests.UnitNWorkers, filterForResource(t, handledSecret)))
+
+	require.Eventually(t, func() bool {
+		return controller.cachedResource("Secret", tests.ResourceNamespace, "sample-secret") != nil
+	}, tests.TestWaitDuration, 10*time.Millisecond)
+
+	err := controller.describe("sample-incident", kubedump.IncidentMarker{Kind: "Secret", Namespace: tests.ResourceNamespace, Name: "sample-secret"})
+	require.NoError(t, err)
+
+	require.NoError(t, controller.Stop())
+
+	data, err := os.ReadFile(path.Join(basePath, kubedump.IncidentsDirName, "sample-incident", "describe.txt"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "aHVudGVyMg==")
+	assert.Contains(t, string(data), "kubectl.kubernetes.io/last-applied-configuration="+RedactedValue)
+}
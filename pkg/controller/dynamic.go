@@ -0,0 +1,244 @@
+package controller
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+var (
+	CustomResourceDefinitionResource = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+	ApiServiceResource               = schema.GroupVersionResource{Group: "apiregistration.k8s.io", Version: "v1", Resource: "apiservices"}
+)
+
+// watchApiExtensions registers informers for CustomResourceDefinitions and APIServices which add and remove watched
+// resources as the extensions are installed and removed.
+func (controller *Controller) watchApiExtensions() {
+	controller.informersMu.Lock()
+	defer controller.informersMu.Unlock()
+
+	controller.addInformer("watch:"+resourceKey(CustomResourceDefinitionResource), CustomResourceDefinitionResource, cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.onCustomResourceDefinition,
+		UpdateFunc: func(_ any, new any) {
+			controller.onCustomResourceDefinition(new)
+		},
+		DeleteFunc: controller.onDynamicResourceDelete,
+	})
+
+	controller.addInformer("watch:"+resourceKey(ApiServiceResource), ApiServiceResource, cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.onApiService,
+		UpdateFunc: func(_ any, new any) {
+			controller.onApiService(new)
+		},
+		DeleteFunc: controller.onDynamicResourceDelete,
+	})
+}
+
+// setDynamicResources replaces the resources provided by the named extension, removing any which are no longer
+// provided and adding any new resources. A resource which is already watched at another version, other than one the
+// extension provided before, is adopted at that version and recorded as provided by the extension so it is removed
+// along with it.
+func (controller *Controller) setDynamicResources(name string, resources []schema.GroupVersionResource) {
+	controller.dynamicResourcesMu.Lock()
+	defer controller.dynamicResourcesMu.Unlock()
+
+	existing := controller.dynamicResources[name]
+	existingAdopted := controller.adoptedResources[name]
+
+	var added []schema.GroupVersionResource
+	var adopted []schema.GroupVersionResource
+	var kept []schema.GroupVersionResource
+	for _, resource := range resources {
+		watched := resource.GroupResource().WithVersion(controller.watchedVersion(resource.Group, resource.Resource))
+
+		switch {
+		case slices.Contains(existing, resource), watched.Version == resource.Version:
+			kept = append(kept, resource)
+		case watched.Version != "" && (!slices.Contains(existing, watched) || slices.Contains(existingAdopted, watched)):
+			// avoid watching the same resource at multiple versions
+			controller.Logger.Debug(fmt.Sprintf("resource '%s' is already watched at version '%s'", resource, watched.Version))
+			adopted = append(adopted, watched)
+			kept = append(kept, watched)
+		default:
+			added = append(added, resource)
+			kept = append(kept, resource)
+		}
+	}
+
+	var removed []schema.GroupVersionResource
+	for _, resource := range existing {
+		if !slices.Contains(kept, resource) {
+			removed = append(removed, resource)
+		}
+	}
+
+	if len(removed) > 0 {
+		controller.Logger.Info(fmt.Sprintf("removing resources for '%s': %v", name, removed))
+		controller.RemoveResources(removed...)
+	}
+
+	if len(added) > 0 {
+		controller.Logger.Info(fmt.Sprintf("adding resources for '%s': %v", name, added))
+		controller.AddResources(added...)
+	}
+
+	if len(kept) == 0 {
+		delete(controller.dynamicResources, name)
+	} else {
+		controller.dynamicResources[name] = kept
+	}
+
+	if len(adopted) == 0 {
+		delete(controller.adoptedResources, name)
+	} else {
+		controller.adoptedResources[name] = adopted
+	}
+}
+
+func (controller *Controller) onDynamicResourceDelete(obj any) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		controller.Logger.Error(fmt.Sprintf("received non-unstructured data: %T", obj))
+		return
+	}
+
+	controller.dynamicResourcesMu.Lock()
+	delete(controller.apiServices, u.GetName())
+	controller.dynamicResourcesMu.Unlock()
+
+	controller.setDynamicResources(u.GetName(), nil)
+}
+
+func (controller *Controller) onCustomResourceDefinition(obj any) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		controller.Logger.Error(fmt.Sprintf("received non-unstructured data: %T", obj))
+		return
+	}
+
+	resource, ok := customResourceDefinitionResource(u)
+	if !ok {
+		controller.setDynamicResources(u.GetName(), nil)
+		return
+	}
+
+	controller.setDynamicResources(u.GetName(), []schema.GroupVersionResource{resource})
+}
+
+// customResourceDefinitionResource determines the resource served by a CustomResourceDefinition, preferring the storage
+// version if it is served.
+func customResourceDefinitionResource(u *unstructured.Unstructured) (schema.GroupVersionResource, bool) {
+	group, _, _ := unstructured.NestedString(u.Object, "spec", "group")
+	plural, _, _ := unstructured.NestedString(u.Object, "spec", "names", "plural")
+	versions, _, _ := unstructured.NestedSlice(u.Object, "spec", "versions")
+
+	var version string
+	for _, v := range versions {
+		m, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		if served, _, _ := unstructured.NestedBool(m, "served"); !served {
+			continue
+		}
+
+		name, _, _ := unstructured.NestedString(m, "name")
+
+		if storage, _, _ := unstructured.NestedBool(m, "storage"); storage || version == "" {
+			version = name
+		}
+	}
+
+	if group == "" || plural == "" || version == "" {
+		return schema.GroupVersionResource{}, false
+	}
+
+	return schema.GroupVersionResource{Group: group, Version: version, Resource: plural}, true
+}
+
+// onApiService watches the resources served by an available APIService. Resources are only discovered again when the
+// group version of the service changes or it becomes available again, rather than on every resync.
+func (controller *Controller) onApiService(obj any) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		controller.Logger.Error(fmt.Sprintf("received non-unstructured data: %T", obj))
+		return
+	}
+
+	// local api services are served by the api server itself and are found by discovery
+	if service, _, _ := unstructured.NestedMap(u.Object, "spec", "service"); service == nil {
+		return
+	}
+
+	if !isApiServiceAvailable(u) {
+		controller.dynamicResourcesMu.Lock()
+		delete(controller.apiServices, u.GetName())
+		controller.dynamicResourcesMu.Unlock()
+
+		controller.setDynamicResources(u.GetName(), nil)
+		return
+	}
+
+	group, _, _ := unstructured.NestedString(u.Object, "spec", "group")
+	version, _, _ := unstructured.NestedString(u.Object, "spec", "version")
+	groupVersion := schema.GroupVersion{Group: group, Version: version}
+
+	controller.dynamicResourcesMu.Lock()
+	discovered, found := controller.apiServices[u.GetName()]
+	controller.dynamicResourcesMu.Unlock()
+
+	if found && discovered == groupVersion {
+		return
+	}
+
+	list, err := controller.kubeclientset.Discovery().ServerResourcesForGroupVersion(groupVersion.String())
+	if err != nil {
+		controller.Logger.Warn(fmt.Sprintf("could not discover resources for api service '%s': %s", u.GetName(), err))
+		return
+	}
+
+	var resources []schema.GroupVersionResource
+	for _, resource := range list.APIResources {
+		if strings.Contains(resource.Name, "/") {
+			continue
+		}
+
+		if !slices.Contains(resource.Verbs, "list") || !slices.Contains(resource.Verbs, "watch") {
+			continue
+		}
+
+		resources = append(resources, groupVersion.WithResource(resource.Name))
+	}
+
+	controller.setDynamicResources(u.GetName(), resources)
+
+	controller.dynamicResourcesMu.Lock()
+	controller.apiServices[u.GetName()] = groupVersion
+	controller.dynamicResourcesMu.Unlock()
+}
+
+func isApiServiceAvailable(u *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(u.Object, "status", "conditions")
+
+	for _, c := range conditions {
+		m, ok := c.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		if m["type"] == "Available" {
+			return m["status"] == "True"
+		}
+	}
+
+	return false
+}
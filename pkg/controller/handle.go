@@ -2,8 +2,6 @@ package controller
 
 import (
 	"fmt"
-	"os"
-	"path"
 
 	kubedump "github.com/joshmeranda/kubedump/pkg"
 	eventsv1 "k8s.io/api/events/v1"
@@ -20,52 +18,19 @@ const (
 	HandleDelete HandleKind = "Delete"
 )
 
-const (
-	// [<event-time>] <type> <reason> <from> <message>
-	eventFormat = "[%s] %s %s %s %s\n"
-)
-
 func (controller *Controller) handleEvent(obj any) {
 	event := obj.(*eventsv1.Event)
 	if event.EventTime.Time.Before(controller.startTime) {
 		return
 	}
 
-	resource := kubedump.NewResourceBuilder().
-		WithKind(event.Regarding.Kind).
-		WithName(event.Regarding.Name).
-		WithNamespace(event.Regarding.Namespace).
-		Build()
-
 	// todo: filter event by resource kind
 
-	resourceDir := kubedump.ResourcePathBuilder{}.
-		WithBase(controller.BasePath).
-		WithResource(resource).
-		Build()
-	eventFilePath := path.Join(resourceDir, event.Regarding.Name+".events")
-
-	if err := createPathParents(eventFilePath); err != nil {
-		controller.Logger.Error(fmt.Sprintf("could not create event file '%s': %s", eventFilePath, err))
-		return
-	}
-
-	eventFile, err := os.OpenFile(eventFilePath, os.O_WRONLY|os.O_CREATE, 0644)
-	defer func() {
-		if err := eventFile.Close(); err != nil {
-			controller.Logger.Error(fmt.Sprintf("could not close event file '%s': %s", eventFilePath, err))
-		}
-	}()
-
-	if err != nil {
-		controller.Logger.Error(fmt.Sprintf("could not open event file '%s': %s", eventFilePath, err))
-		return
+	if err := controller.Sink.AppendEvent(event); err != nil {
+		controller.Logger.Error(fmt.Sprintf("could not write event for %s '%s': %s", event.Regarding.Kind, event.Regarding.Name, err))
 	}
 
-	s := fmt.Sprintf(eventFormat, event.EventTime, event.Type, event.Reason, event.ReportingController, event.Note)
-	if _, err = eventFile.Write([]byte(s)); err != nil {
-		controller.Logger.Error(fmt.Sprintf("could not write to event file '%s': %s", eventFilePath, err))
-	}
+	controller.checkEventTriggers(event)
 }
 
 func (controller *Controller) handlePod(handleKind HandleKind, pod kubedump.Resource, u *unstructured.Unstructured) {
@@ -84,7 +49,7 @@ func (controller *Controller) handlePod(handleKind HandleKind, pod kubedump.Reso
 					Container:     &container,
 					Context:       controller.ctx,
 					KubeClientSet: controller.kubeclientset,
-					BasePath:      controller.BasePath,
+					Sink:          controller.Sink,
 					Timeout:       controller.LogSyncTimeout,
 				})
 
@@ -143,13 +108,46 @@ func (controller *Controller) resourceHandlerFunc(handleKind HandleKind, r schem
 		controller.handlePod(handleKind, resource, u)
 	}
 
+	controller.checkTriggers(handleKind, resource)
+
+	if resource.GetKind() == "Secret" && controller.RedactSecrets {
+		u = redactSecret(u)
+	}
+
 	controller.workQueue.AddRateLimited(NewJob(controller.ctx, fmt.Sprintf("%s-%s-%s-%s", JobNameDumpResourcePrefix, resource.GetKind(), resource.GetNamespace(), resource.GetName()), func() {
-		dir := kubedump.ResourcePathBuilder{}.WithBase(controller.BasePath).WithResource(resource).Build()
-		if err := dumpResourceDescription(path.Join(dir, resource.GetName()+".yaml"), u); err != nil {
+		if err := controller.Sink.WriteResource(u); err != nil {
 			controller.Logger.With(
 				"namespace", resource.GetNamespace(),
 				"name", resource.GetName(),
 			).Error(fmt.Sprintf("could not dump pod description: %s", err))
+			return
+		}
+
+		builder := kubedump.ResourcePathBuilder{}.WithNamespace(resource.GetNamespace()).WithKind(resource.GetKind()).WithName(resource.GetName())
+
+		if controller.linker != nil {
+			var err error
+			if handleKind == HandleDelete {
+				err = controller.linker.Delete(builder)
+			} else {
+				err = controller.linker.Update(u)
+			}
+
+			if err != nil {
+				controller.Logger.With(
+					"namespace", resource.GetNamespace(),
+					"name", resource.GetName(),
+				).Error(fmt.Sprintf("could not link resource: %s", err))
+			}
+		}
+
+		if recorder, ok := controller.Sink.(kubedump.DeletionRecorder); ok && handleKind == HandleDelete {
+			if err := recorder.RecordDeletion(builder); err != nil {
+				controller.Logger.With(
+					"namespace", resource.GetNamespace(),
+					"name", resource.GetName(),
+				).Error(fmt.Sprintf("could not record deletion: %s", err))
+			}
 		}
 	}))
 }
@@ -0,0 +1,347 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	kubedump "github.com/joshmeranda/kubedump/pkg"
+	apicorev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// cachedResource returns the resource with the given kind, namespace, and name from the informer caches, or nil if it
+// has not been seen by the controller.
+func (controller *Controller) cachedResource(kind string, namespace string, name string) *unstructured.Unstructured {
+	controller.informersMu.Lock()
+	defer controller.informersMu.Unlock()
+
+	for _, ri := range controller.informers {
+		obj, found, err := ri.informer.GetStore().GetByKey(resourceName(namespace, name))
+		if err != nil || !found {
+			continue
+		}
+
+		if u, ok := obj.(*unstructured.Unstructured); ok && u.GetKind() == kind {
+			return u
+		}
+	}
+
+	return nil
+}
+
+// cachedDependents returns the resources in the informer caches which are owned by the resource with the given uid.
+func (controller *Controller) cachedDependents(uid types.UID) []*unstructured.Unstructured {
+	controller.informersMu.Lock()
+	defer controller.informersMu.Unlock()
+
+	var dependents []*unstructured.Unstructured
+
+	for _, ri := range controller.informers {
+		for _, obj := range ri.informer.GetStore().List() {
+			u, ok := obj.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+
+			for _, owner := range u.GetOwnerReferences() {
+				if owner.UID == uid {
+					dependents = append(dependents, u)
+					break
+				}
+			}
+		}
+	}
+
+	return dependents
+}
+
+// cachedEvents returns the events regarding the resource with the given kind, namespace, and name, sorted by time.
+func (controller *Controller) cachedEvents(kind string, namespace string, name string) []*eventsv1.Event {
+	controller.informersMu.Lock()
+	ri, found := controller.informers["events.k8s.io/v1"]
+	controller.informersMu.Unlock()
+
+	if !found {
+		return nil
+	}
+
+	var events []*eventsv1.Event
+
+	for _, obj := range ri.informer.GetStore().List() {
+		event, ok := obj.(*eventsv1.Event)
+		if ok && event.Regarding.Kind == kind && event.Regarding.Namespace == namespace && event.Regarding.Name == name {
+			events = append(events, event)
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].EventTime.Before(&events[j].EventTime)
+	})
+
+	return events
+}
+
+// relatedResources returns the resource the incident was fired for, its owners, the resources it owns, and the node of
+// a pod, skipping any which have not been seen by the controller.
+func (controller *Controller) relatedResources(marker kubedump.IncidentMarker) []*unstructured.Unstructured {
+	target := controller.cachedResource(marker.Kind, marker.Namespace, marker.Name)
+	if target == nil {
+		return nil
+	}
+
+	related := []*unstructured.Unstructured{target}
+	seen := map[types.UID]bool{target.GetUID(): true}
+
+	add := func(u *unstructured.Unstructured) bool {
+		if u == nil || seen[u.GetUID()] {
+			return false
+		}
+
+		seen[u.GetUID()] = true
+		related = append(related, u)
+
+		return true
+	}
+
+	for owned := target; owned != nil; {
+		var next *unstructured.Unstructured
+
+		for _, owner := range owned.GetOwnerReferences() {
+			if u := controller.cachedResource(owner.Kind, owned.GetNamespace(), owner.Name); add(u) && next == nil {
+				next = u
+			}
+		}
+
+		owned = next
+	}
+
+	for _, dependent := range controller.cachedDependents(target.GetUID()) {
+		add(dependent)
+	}
+
+	if target.GetKind() == "Pod" {
+		if nodeName, _, _ := unstructured.NestedString(target.Object, "spec", "nodeName"); nodeName != "" {
+			add(controller.cachedResource("Node", "", nodeName))
+		}
+	}
+
+	return related
+}
+
+// snapshot writes each of the incident's related resources to "resources/<namespace>/<kind>/<name>.yaml".
+func (controller *Controller) snapshot(name string, marker kubedump.IncidentMarker) error {
+	related := controller.relatedResources(marker)
+	if len(related) == 0 {
+		return fmt.Errorf("%s '%s' has not been seen by the controller", marker.Kind, resourceName(marker.Namespace, marker.Name))
+	}
+
+	for _, u := range related {
+		if u.GetKind() == "Secret" && controller.RedactSecrets {
+			u = redactSecret(u)
+		}
+
+		data, err := yaml.Marshal(u)
+		if err != nil {
+			return fmt.Errorf("could not marshal %s: %w", u.GetKind(), err)
+		}
+
+		builder := kubedump.ResourcePathBuilder{}.WithNamespace(u.GetNamespace()).WithKind(u.GetKind()).WithName(u.GetName())
+		if err := controller.Sink.WriteIncidentFile(name, path.Join("resources", builder.Build()+".yaml"), data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// previousLogs writes the logs of the previous instance of each restarted container in the incident's related pods to
+// "logs/<namespace>/<pod>/<container>.previous.log".
+func (controller *Controller) previousLogs(name string, marker kubedump.IncidentMarker) error {
+	var errs []error
+
+	for _, u := range controller.relatedResources(marker) {
+		if u.GetKind() != "Pod" {
+			continue
+		}
+
+		var pod apicorev1.Pod
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &pod); err != nil {
+			errs = append(errs, fmt.Errorf("could not convert pod '%s': %w", resourceName(u.GetNamespace(), u.GetName()), err))
+			continue
+		}
+
+		for _, status := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+			if status.RestartCount == 0 {
+				continue
+			}
+
+			ctx, cancel := context.WithTimeout(controller.ctx, controller.LogSyncTimeout)
+			data, err := controller.kubeclientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &apicorev1.PodLogOptions{
+				Container: status.Name,
+				Previous:  true,
+			}).DoRaw(ctx)
+			cancel()
+
+			if err != nil {
+				errs = append(errs, fmt.Errorf("could not get previous logs for container '%s' in pod '%s': %w", status.Name, pod.Name, err))
+				continue
+			}
+
+			if err := controller.Sink.WriteIncidentFile(name, path.Join("logs", pod.Namespace, pod.Name, status.Name+".previous.log"), data); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// describe writes a description of the incident's resource and the events regarding it to "describe.txt".
+func (controller *Controller) describe(name string, marker kubedump.IncidentMarker) error {
+	builder := &strings.Builder{}
+	w := tabwriter.NewWriter(builder, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintf(w, "Name:\t%s\n", marker.Name)
+	if marker.Namespace != "" {
+		fmt.Fprintf(w, "Namespace:\t%s\n", marker.Namespace)
+	}
+	fmt.Fprintf(w, "Kind:\t%s\n", marker.Kind)
+
+	if u := controller.cachedResource(marker.Kind, marker.Namespace, marker.Name); u != nil {
+		if u.GetKind() == "Secret" && controller.RedactSecrets {
+			u = redactSecret(u)
+		}
+
+		describeResource(w, u)
+	} else {
+		fmt.Fprintf(w, "Status:\t<not seen by kubedump>\n")
+	}
+
+	events := controller.cachedEvents(marker.Kind, marker.Namespace, marker.Name)
+	if len(events) == 0 {
+		fmt.Fprintf(w, "Events:\t<none>\n")
+	} else {
+		fmt.Fprintf(w, "Events:\n")
+		fmt.Fprintf(w, "  Time\tType\tReason\tFrom\tMessage\n")
+
+		for _, event := range events {
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n", event.EventTime.UTC(), event.Type, event.Reason, event.ReportingController, event.Note)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("could not write description: %w", err)
+	}
+
+	return controller.Sink.WriteIncidentFile(name, "describe.txt", []byte(builder.String()))
+}
+
+// joinMap formats m as sorted "key=value" pairs, or "<none>" if it is empty.
+func joinMap(m map[string]string) string {
+	if len(m) == 0 {
+		return "<none>"
+	}
+
+	pairs := make([]string, 0, len(m))
+	for key, value := range m {
+		pairs = append(pairs, key+"="+value)
+	}
+
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ", ")
+}
+
+// describeResource writes the metadata and status of u, along with the containers of a pod.
+func describeResource(w *tabwriter.Writer, u *unstructured.Unstructured) {
+	fmt.Fprintf(w, "Labels:\t%s\n", joinMap(u.GetLabels()))
+	fmt.Fprintf(w, "Annotations:\t%s\n", joinMap(u.GetAnnotations()))
+	fmt.Fprintf(w, "Created:\t%s\n", u.GetCreationTimestamp().UTC())
+
+	if owners := u.GetOwnerReferences(); len(owners) > 0 {
+		names := make([]string, 0, len(owners))
+		for _, owner := range owners {
+			names = append(names, owner.Kind+"/"+owner.Name)
+		}
+
+		fmt.Fprintf(w, "Owners:\t%s\n", strings.Join(names, ", "))
+	}
+
+	if phase, found, _ := unstructured.NestedString(u.Object, "status", "phase"); found {
+		fmt.Fprintf(w, "Phase:\t%s\n", phase)
+	}
+
+	if conditions, found, _ := unstructured.NestedSlice(u.Object, "status", "conditions"); found && len(conditions) > 0 {
+		fmt.Fprintf(w, "Conditions:\n")
+		fmt.Fprintf(w, "  Type\tStatus\tReason\tMessage\n")
+
+		for _, raw := range conditions {
+			condition, ok := raw.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			fmt.Fprintf(w, "  %v\t%v\t%v\t%v\n", condition["type"], condition["status"], valueOr(condition["reason"]), valueOr(condition["message"]))
+		}
+	}
+
+	if u.GetKind() != "Pod" {
+		return
+	}
+
+	var pod apicorev1.Pod
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &pod); err != nil {
+		return
+	}
+
+	if pod.Spec.NodeName != "" {
+		fmt.Fprintf(w, "Node:\t%s\n", pod.Spec.NodeName)
+	}
+
+	statuses := append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...)
+	if len(statuses) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "Containers:\n")
+
+	for _, status := range statuses {
+		fmt.Fprintf(w, "  %s:\n", status.Name)
+		fmt.Fprintf(w, "    Image:\t%s\n", status.Image)
+		fmt.Fprintf(w, "    State:\t%s\n", describeContainerState(status.State))
+		fmt.Fprintf(w, "    Last State:\t%s\n", describeContainerState(status.LastTerminationState))
+		fmt.Fprintf(w, "    Ready:\t%t\n", status.Ready)
+		fmt.Fprintf(w, "    Restart Count:\t%d\n", status.RestartCount)
+	}
+}
+
+func describeContainerState(state apicorev1.ContainerState) string {
+	switch {
+	case state.Running != nil:
+		return fmt.Sprintf("Running (started %s)", state.Running.StartedAt.UTC())
+	case state.Waiting != nil:
+		return fmt.Sprintf("Waiting (%s)", valueOr(state.Waiting.Reason))
+	case state.Terminated != nil:
+		return fmt.Sprintf("Terminated (%s, exit code %d)", valueOr(state.Terminated.Reason), state.Terminated.ExitCode)
+	default:
+		return "<none>"
+	}
+}
+
+// valueOr formats value, or "<none>" if it is nil or empty.
+func valueOr(value interface{}) string {
+	if value == nil || value == "" {
+		return "<none>"
+	}
+
+	return fmt.Sprint(value)
+}
@@ -3,9 +3,6 @@ package controller
 import (
 	"context"
 	"fmt"
-	"io"
-	"os"
-	"path"
 	"time"
 
 	kubedump "github.com/joshmeranda/kubedump/pkg"
@@ -27,38 +24,22 @@ type LogStreamOptions struct {
 	Container     *apicorev1.Container
 	Context       context.Context
 	KubeClientSet kubernetes.Interface
-	BasePath      string
+	Sink          kubedump.Sink
 	Timeout       time.Duration
 }
 
 type logStream struct {
 	LogStreamOptions
-	out      io.WriteCloser
 	lastRead time.Time
 }
 
 func NewLogStream(opts LogStreamOptions) (Stream, error) {
-	podDir := kubedump.ResourcePathBuilder{}.
-		WithBase(opts.BasePath).
-		WithNamespace(opts.Pod.Namespace).
-		WithKind("Pod").
-		WithName(opts.Pod.Name).
-		Build()
-
-	logFilePath := path.Join(podDir, opts.Container.Name+".log")
-
-	if err := createPathParents(logFilePath); err != nil {
-		return nil, fmt.Errorf("could not create log file '%s': %w", logFilePath, err)
-	}
-
-	logFile, err := os.OpenFile(logFilePath, os.O_WRONLY|os.O_CREATE, 0644)
-	if err != nil {
-		return nil, fmt.Errorf("could not create log file '%s': %w", logFilePath, err)
+	if opts.Sink == nil {
+		return nil, fmt.Errorf("no sink given for logs of container '%s' in pod '%s'", opts.Container.Name, opts.Pod.Name)
 	}
 
 	return &logStream{
 		LogStreamOptions: opts,
-		out:              logFile,
 		lastRead:         time.Time{},
 	}, nil
 }
@@ -90,7 +71,7 @@ func (stream *logStream) Sync() error {
 
 	}
 
-	if _, err := stream.out.Write(body); err != nil {
+	if err := stream.Sink.AppendLog(stream.Pod.Namespace, stream.Pod.Name, stream.Container.Name, body); err != nil {
 		return fmt.Errorf("error witing log response: %w", err)
 	}
 
@@ -98,7 +79,5 @@ func (stream *logStream) Sync() error {
 }
 
 func (stream *logStream) Close() error {
-	err := stream.out.Close()
-
-	return err
+	return nil
 }
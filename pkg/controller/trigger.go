@@ -0,0 +1,226 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	kubedump "github.com/joshmeranda/kubedump/pkg"
+	"github.com/joshmeranda/kubedump/pkg/filter"
+	eventsv1 "k8s.io/api/events/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+const JobNameTriggerPrefix = "trigger"
+
+// incidentTimeFormat is the format of the time at the start of each incident's name, chosen to sort by time and avoid
+// characters which are not allowed in file names on some platforms.
+const incidentTimeFormat = "2006-01-02T15-04-05Z"
+
+// TriggerAction is something done for the resource matched by a Trigger.
+type TriggerAction string
+
+const (
+	// TriggerActionSnapshot writes the matched resource along with its owners, the resources it owns, and the node of a
+	// pod as they were when the trigger fired.
+	TriggerActionSnapshot TriggerAction = "snapshot"
+
+	// TriggerActionPreviousLogs writes the logs of the previous instance of each restarted container in the matched pod,
+	// or in the pods owned by the matched resource.
+	TriggerActionPreviousLogs TriggerAction = "previous-logs"
+
+	// TriggerActionDescribe writes a description of the matched resource and the events regarding it, similar to
+	// `kubectl describe`.
+	TriggerActionDescribe TriggerAction = "describe"
+
+	// TriggerActionMarker writes a kubedump.IncidentMarker noting when and why the trigger fired.
+	TriggerActionMarker TriggerAction = "marker"
+)
+
+// TriggerActions are all the supported trigger actions, and the actions taken by a trigger which does not list any.
+var TriggerActions = []TriggerAction{
+	TriggerActionSnapshot, TriggerActionPreviousLogs, TriggerActionDescribe, TriggerActionMarker,
+}
+
+// Trigger takes its Actions whenever a dumped resource starts matching On, or an event matching On is received. The
+// files written by each action are grouped into an incident in the dump.
+type Trigger struct {
+	Name string
+
+	// On is the filter a resource or event must match to fire the trigger. Events are matched with the "Event" kind, and
+	// the actions are taken for the resource they regard.
+	On filter.Expression
+
+	// Actions are the actions taken when the trigger fires. If empty, every action in TriggerActions is taken.
+	Actions []TriggerAction
+}
+
+// incident is a single firing of a trigger.
+type incident struct {
+	trigger Trigger
+	marker  kubedump.IncidentMarker
+}
+
+func (incident incident) name() string {
+	return fmt.Sprintf("%s-%s-%s-%s", incident.marker.Time.UTC().Format(incidentTimeFormat), incident.trigger.Name, strings.ToLower(incident.marker.Kind), incident.marker.Name)
+}
+
+func (incident incident) actions() []TriggerAction {
+	if len(incident.trigger.Actions) == 0 {
+		return TriggerActions
+	}
+
+	return incident.trigger.Actions
+}
+
+// eventTriggerCooldown is how long a trigger fired by an event is not fired again by events regarding the same
+// resource, so that repeated events, like a container backing off, do not fire it for each event.
+var eventTriggerCooldown = 10 * time.Minute
+
+// triggerKey identifies whether a trigger is currently matching a resource.
+func triggerKey(trigger Trigger, resource kubedump.Resource) string {
+	return trigger.Name + "/" + string(resource.GetUID())
+}
+
+// eventTriggerKey identifies when a trigger was last fired by an event regarding a resource.
+func eventTriggerKey(trigger Trigger, kind string, namespace string, name string) string {
+	return trigger.Name + "/" + kind + "/" + namespace + "/" + name
+}
+
+// checkTriggers fires each trigger which resource has started matching since it was last handled. Triggers only fire
+// once while a resource keeps matching, so they are not fired again on every resync.
+func (controller *Controller) checkTriggers(handleKind HandleKind, resource kubedump.Resource) {
+	if len(controller.Triggers) == 0 {
+		return
+	}
+
+	controller.triggeredMu.Lock()
+	defer controller.triggeredMu.Unlock()
+
+	for _, trigger := range controller.Triggers {
+		key := triggerKey(trigger, resource)
+
+		if handleKind == HandleDelete {
+			delete(controller.eventTriggered, eventTriggerKey(trigger, resource.GetKind(), resource.GetNamespace(), resource.GetName()))
+		}
+
+		if handleKind == HandleDelete || !trigger.On.Matches(resource) {
+			delete(controller.triggered, key)
+			continue
+		}
+
+		if controller.triggered[key] {
+			continue
+		}
+
+		controller.triggered[key] = true
+
+		controller.fire(incident{
+			trigger: trigger,
+			marker: kubedump.IncidentMarker{
+				Trigger:   trigger.Name,
+				Time:      time.Now().UTC(),
+				Reason:    fmt.Sprintf("%s '%s' matched trigger '%s'", resource.GetKind(), resourceName(resource.GetNamespace(), resource.GetName()), trigger.Name),
+				Kind:      resource.GetKind(),
+				Namespace: resource.GetNamespace(),
+				Name:      resource.GetName(),
+			},
+		})
+	}
+}
+
+// checkEventTriggers fires each trigger matching event for the resource the event regards. A trigger is not fired again
+// for events regarding the same resource until eventTriggerCooldown has passed, or the resource is deleted.
+func (controller *Controller) checkEventTriggers(event *eventsv1.Event) {
+	if len(controller.Triggers) == 0 {
+		return
+	}
+
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(event)
+	if err != nil {
+		controller.Logger.Error(fmt.Sprintf("could not convert event for %s '%s': %s", event.Regarding.Kind, event.Regarding.Name, err))
+		return
+	}
+
+	u := &unstructured.Unstructured{Object: obj}
+	u.SetAPIVersion(eventsv1.SchemeGroupVersion.String())
+	u.SetKind("Event")
+
+	resource := kubedump.NewResourceBuilder().FromUnstructured(u).Build()
+
+	controller.triggeredMu.Lock()
+	defer controller.triggeredMu.Unlock()
+
+	now := time.Now()
+
+	for _, trigger := range controller.Triggers {
+		if !trigger.On.Matches(resource) {
+			continue
+		}
+
+		key := eventTriggerKey(trigger, event.Regarding.Kind, event.Regarding.Namespace, event.Regarding.Name)
+		if fired, found := controller.eventTriggered[key]; found && now.Sub(fired) < eventTriggerCooldown {
+			continue
+		}
+
+		controller.eventTriggered[key] = now
+
+		controller.fire(incident{
+			trigger: trigger,
+			marker: kubedump.IncidentMarker{
+				Trigger:   trigger.Name,
+				Time:      now.UTC(),
+				Reason:    fmt.Sprintf("%s event '%s' regarding %s '%s' matched trigger '%s'", event.Type, event.Reason, event.Regarding.Kind, resourceName(event.Regarding.Namespace, event.Regarding.Name), trigger.Name),
+				Kind:      event.Regarding.Kind,
+				Namespace: event.Regarding.Namespace,
+				Name:      event.Regarding.Name,
+			},
+		})
+	}
+}
+
+// fire queues a job taking the actions of the incident's trigger.
+func (controller *Controller) fire(incident incident) {
+	controller.Logger.Info(incident.marker.Reason)
+
+	controller.workQueue.AddRateLimited(NewJob(controller.ctx, fmt.Sprintf("%s-%s", JobNameTriggerPrefix, incident.trigger.Name), func() {
+		name := incident.name()
+
+		for _, action := range incident.actions() {
+			if err := controller.takeAction(name, incident.marker, action); err != nil {
+				controller.Logger.Error(fmt.Sprintf("could not take action '%s' for incident '%s': %s", action, name, err))
+			}
+		}
+	}))
+}
+
+func (controller *Controller) takeAction(name string, marker kubedump.IncidentMarker, action TriggerAction) error {
+	switch action {
+	case TriggerActionMarker:
+		data, err := yaml.Marshal(marker)
+		if err != nil {
+			return fmt.Errorf("could not marshal incident marker: %w", err)
+		}
+
+		return controller.Sink.WriteIncidentFile(name, kubedump.IncidentMarkerFileName, data)
+	case TriggerActionSnapshot:
+		return controller.snapshot(name, marker)
+	case TriggerActionPreviousLogs:
+		return controller.previousLogs(name, marker)
+	case TriggerActionDescribe:
+		return controller.describe(name, marker)
+	default:
+		return fmt.Errorf("unsupported trigger action '%s'", action)
+	}
+}
+
+// resourceName formats a resource's name the same way as the patterns of filter resource expressions.
+func resourceName(namespace string, name string) string {
+	if namespace == "" {
+		return name
+	}
+
+	return namespace + "/" + name
+}
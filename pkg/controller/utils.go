@@ -1,12 +1,11 @@
 package controller
 
 import (
-	"fmt"
+	"encoding/base64"
 	"os"
 	"path"
 
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"sigs.k8s.io/yaml"
 )
 
 // createPathParents ensures that the parent directory for filePath exists.
@@ -20,39 +19,41 @@ func createPathParents(filePath string) error {
 	return nil
 }
 
-// exists checks if a file exists.
-func exists(filePath string) bool {
-	_, err := os.Lstat(filePath)
+// RedactedValue replaces the values of redacted secret data.
+const RedactedValue = "REDACTED"
 
-	return !os.IsNotExist(err)
-}
+// lastAppliedAnnotation holds the configuration last applied with kubectl, which includes the data of a Secret.
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
 
-func dumpResourceDescription(filePath string, u *unstructured.Unstructured) error {
-	if exists(filePath) {
-		if err := os.Truncate(filePath, 0); err != nil {
-			return fmt.Errorf("error truncating obj yaml file '%s' : %w", filePath, err)
-		}
-	} else {
-		if err := createPathParents(filePath); err != nil {
-			return fmt.Errorf("error creating parents for obj file '%s': %s", filePath, err)
+// redactSecret returns a copy of the given Secret with the values of its data, and of its last applied configuration,
+// replaced with RedactedValue.
+func redactSecret(u *unstructured.Unstructured) *unstructured.Unstructured {
+	redacted := u.DeepCopy()
+
+	if annotations := redacted.GetAnnotations(); annotations != nil {
+		if _, found := annotations[lastAppliedAnnotation]; found {
+			annotations[lastAppliedAnnotation] = RedactedValue
+			redacted.SetAnnotations(annotations)
 		}
 	}
 
-	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE, 0644)
-	if err != nil {
-		return fmt.Errorf("could not open file '%s': %w", filePath, err)
-	}
-	defer f.Close()
+	for _, field := range []string{"data", "stringData"} {
+		data, found, _ := unstructured.NestedMap(redacted.Object, field)
+		if !found {
+			continue
+		}
 
-	data, err := yaml.Marshal(u)
-	if err != nil {
-		return fmt.Errorf("could not marshal %s: %w", u.GetKind(), err)
-	}
+		value := RedactedValue
+		if field == "data" {
+			value = base64.StdEncoding.EncodeToString([]byte(RedactedValue))
+		}
 
-	_, err = f.Write(data)
-	if err != nil {
-		return fmt.Errorf("could not write %s to file '%s': %w", u.GetKind(), filePath, err)
+		for key := range data {
+			data[key] = value
+		}
+
+		_ = unstructured.SetNestedMap(redacted.Object, data, field)
 	}
 
-	return nil
+	return redacted
 }
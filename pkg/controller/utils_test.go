@@ -1,11 +1,8 @@
 package controller
 
 import (
-	"os"
-	"path"
 	"testing"
 
-	kubedump "github.com/joshmeranda/kubedump/pkg"
 	"github.com/stretchr/testify/assert"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
@@ -45,42 +42,36 @@ func TestGetSymlinkPaths(t *testing.T) {
 }
 */
 
-func TestDumpResource(t *testing.T) {
-	basePath := t.TempDir()
-
+func TestRedactSecret(t *testing.T) {
 	u := &unstructured.Unstructured{
-		Object: map[string]interface{}{},
+		Object: map[string]interface{}{
+			"kind": "Secret",
+			"metadata": map[string]interface{}{
+				"name": "sample-secret",
+				"annotations": map[string]interface{}{
+					"kubectl.kubernetes.io/last-applied-configuration": `{"kind":"Secret","data":{"password":"aHVudGVyMg=="}}`,
+					"owner": "sample-team",
+				},
+			},
+			"data": map[string]interface{}{
+				"password": "aHVudGVyMg==",
+			},
+			"stringData": map[string]interface{}{
+				"username": "admin",
+			},
+		},
 	}
-	u.SetKind("nothing")
-	u.SetName("some-resource")
-	u.SetNamespace("ns")
-
-	resource := kubedump.NewResourceBuilder().
-		FromUnstructured(u).
-		Build()
-
-	dumpPath := path.Join(basePath, resource.GetNamespace(), resource.GetKind(), resource.GetName(), resource.GetName()+".yaml")
 
-	err := dumpResourceDescription(dumpPath, u)
-	assert.NoError(t, err)
-
-	data, err := os.ReadFile(dumpPath)
-	assert.NoError(t, err)
+	redacted := redactSecret(u)
 
-	expectedData := "kind: nothing\nmetadata:\n  name: some-resource\n  namespace: ns\n"
-	assert.Equal(t, expectedData, string(data))
-
-	// test overwriting file
-	u.SetName("a-resource")
-	err = dumpResourceDescription(dumpPath, u)
-
-	assert.NoError(t, err)
-
-	dumpPath = path.Join(basePath, resource.GetNamespace(), resource.GetKind(), resource.GetName(), resource.GetName()+".yaml")
-
-	data, err = os.ReadFile(dumpPath)
-	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"password": "UkVEQUNURUQ="}, redacted.Object["data"])
+	assert.Equal(t, map[string]interface{}{"username": RedactedValue}, redacted.Object["stringData"])
+	assert.Equal(t, map[string]string{
+		"kubectl.kubernetes.io/last-applied-configuration": RedactedValue,
+		"owner": "sample-team",
+	}, redacted.GetAnnotations())
 
-	expectedData = "kind: nothing\nmetadata:\n  name: a-resource\n  namespace: ns\n"
-	assert.Equal(t, expectedData, string(data))
+	// the original should not be modified
+	assert.Equal(t, map[string]interface{}{"password": "aHVudGVyMg=="}, u.Object["data"])
+	assert.Contains(t, u.GetAnnotations()["kubectl.kubernetes.io/last-applied-configuration"], "aHVudGVyMg==")
 }
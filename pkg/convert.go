@@ -0,0 +1,227 @@
+package kubedump
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// eventTimeFormat is the format of the time at the start of each line of an events file.
+const eventTimeFormat = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// eventLineTime parses the time of a formatted event line, returning fallback if it cannot be parsed.
+func eventLineTime(line []byte, fallback time.Time) time.Time {
+	if !bytes.HasPrefix(line, []byte("[")) {
+		return fallback
+	}
+
+	timestamp, _, found := strings.Cut(string(line[1:]), "]")
+	if !found {
+		return fallback
+	}
+
+	t, err := time.Parse(eventTimeFormat, timestamp)
+	if err != nil {
+		return fallback
+	}
+
+	return t
+}
+
+// modTime returns the modification time of the named file, or the zero time if it cannot be found.
+func modTime(fsys fs.FS, name string) time.Time {
+	info, err := fs.Stat(fsys, name)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
+
+// ConvertToDB writes the dump in fsys to a new db dump at dbPath. Since a directory dump only holds the latest revision
+// of each resource, each resource will have a single revision timestamped with the modification time of its file.
+func ConvertToDB(fsys DumpFS, dbPath string) error {
+	if _, err := os.Stat(dbPath); err == nil {
+		return fmt.Errorf("database '%s' already exists", dbPath)
+	}
+
+	sink, err := NewDBSink(dbPath)
+	if err != nil {
+		return err
+	}
+
+	err = ForEachResourceFS(fsys, func(builder ResourcePathBuilder) error {
+		return convertResourceToDB(fsys, sink, builder)
+	})
+	if err != nil {
+		sink.Close()
+		return err
+	}
+
+	if err := ForEachIncidentFileFS(fsys, sink.WriteIncidentFile); err != nil {
+		sink.Close()
+		return err
+	}
+
+	return sink.Close()
+}
+
+func convertResourceToDB(fsys DumpFS, sink *DBSink, builder ResourcePathBuilder) error {
+	dir := builder.Build()
+	key := resourceKey(builder.Kind, builder.Namespace, builder.Name)
+
+	resourceFile := path.Join(dir, builder.Name+".yaml")
+	data, err := fs.ReadFile(fsys, resourceFile)
+	if err != nil {
+		return fmt.Errorf("could not read resource file '%s': %w", resourceFile, err)
+	}
+
+	if err := sink.writeResource(builder, modTime(fsys, resourceFile), data); err != nil {
+		return err
+	}
+
+	eventsFile := path.Join(dir, builder.Name+EventsFileSuffix)
+	if data, err := fs.ReadFile(fsys, eventsFile); err == nil {
+		fallback := modTime(fsys, eventsFile)
+
+		for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+			if len(line) == 0 {
+				continue
+			}
+
+			if err := sink.appendEventLine(key, eventLineTime(line, fallback), line); err != nil {
+				return err
+			}
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("could not read events file '%s': %w", eventsFile, err)
+	}
+
+	linksFile := path.Join(dir, builder.Name+LinksFileSuffix)
+	if data, err := fs.ReadFile(fsys, linksFile); err == nil {
+		var references []LinkReference
+		if err := yaml.Unmarshal(data, &references); err != nil {
+			return fmt.Errorf("could not unmarshal links file '%s': %w", linksFile, err)
+		}
+
+		if err := sink.RecordLinks(builder, referenceLinks(builder, references)); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("could not read links file '%s': %w", linksFile, err)
+	}
+
+	if builder.Kind != "Pod" {
+		return nil
+	}
+
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return fmt.Errorf("could not read pod dir '%s': %w", dir, err)
+	}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !strings.HasSuffix(entry.Name(), ".log") {
+			continue
+		}
+
+		// rotated segments are joined with the current log file, since a db dump does not rotate logs
+		container := strings.TrimSuffix(entry.Name(), ".log")
+		data, err := ReadContainerLog(fsys, dir, container)
+		if err != nil {
+			return err
+		}
+
+		logFile := path.Join(dir, entry.Name())
+		if err := sink.appendLog(containerKey(builder.Namespace, builder.Name, container), modTime(fsys, logFile), data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// referenceLinks converts the references recorded under parent to links.
+func referenceLinks(parent ResourcePathBuilder, references []LinkReference) []ResourceLink {
+	links := make([]ResourceLink, 0, len(references))
+
+	for _, reference := range references {
+		links = append(links, ResourceLink{
+			Parent: parent,
+			Child:  ResourcePathBuilder{}.WithKind(reference.Kind).WithNamespace(reference.Namespace).WithName(reference.Name),
+			Types:  reference.Types,
+		})
+	}
+
+	return links
+}
+
+// ConvertFromDB writes the db dump at dbPath to a directory dump at dir. Only the latest revision of each resource is
+// written. The rules, pods, and conditions files written by `kubedump link` are not stored in a db dump, but can be
+// regenerated by running `kubedump link` on the result.
+func ConvertFromDB(dbPath string, dir string) error {
+	dump, err := OpenDBDump(dbPath)
+	if err != nil {
+		return err
+	}
+	defer dump.Close()
+
+	sink := NewDirSink(dir)
+	resources := map[ResourcePathBuilder]bool{}
+
+	err = dump.ForEachResource(func(builder ResourcePathBuilder, data []byte) error {
+		resources[builder] = true
+		return sink.writeResource(builder, data)
+	})
+	if err != nil {
+		return fmt.Errorf("could not convert resources: %w", err)
+	}
+
+	err = dump.ForEachEvent(func(builder ResourcePathBuilder, line []byte) error {
+		return sink.appendEventLines(builder, line)
+	})
+	if err != nil {
+		return fmt.Errorf("could not convert events: %w", err)
+	}
+
+	err = dump.ForEachLog(sink.AppendLog)
+	if err != nil {
+		return fmt.Errorf("could not convert logs: %w", err)
+	}
+
+	err = dump.ForEachLinks(func(parent ResourcePathBuilder, references []LinkReference) error {
+		if !resources[parent] {
+			return nil
+		}
+
+		links := []ResourceLink{}
+		for _, link := range referenceLinks(parent, references) {
+			if resources[link.Child] {
+				links = append(links, link)
+			}
+		}
+
+		if len(links) == 0 {
+			return nil
+		}
+
+		return sink.RecordLinks(parent, links)
+	})
+	if err != nil {
+		return fmt.Errorf("could not convert links: %w", err)
+	}
+
+	err = dump.ForEachIncidentFile(sink.WriteIncidentFile)
+	if err != nil {
+		return fmt.Errorf("could not convert incidents: %w", err)
+	}
+
+	return sink.Close()
+}
@@ -0,0 +1,62 @@
+package kubedump
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/otiai10/copy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventLineTime(t *testing.T) {
+	fallback := time.Unix(0, 0)
+	expected := time.Date(2023, 1, 1, 12, 30, 0, 500, time.UTC)
+
+	assert.True(t, expected.Equal(eventLineTime([]byte("["+expected.String()+"] Normal Pulled kubelet pulled image\n"), fallback)))
+	assert.Equal(t, fallback, eventLineTime([]byte("not an event\n"), fallback))
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := path.Join(dir, DBFileName)
+
+	src := path.Join(dir, "src")
+	require.NoError(t, copy.Copy(dumpDir, src))
+
+	events := "[2023-01-01 00:00:00 +0000 UTC] Normal Pulled kubelet pulled image\n"
+	require.NoError(t, os.WriteFile(path.Join(src, "default", "Pod", "sample-pod", "sample-pod"+EventsFileSuffix), []byte(events), 0644))
+	require.NoError(t, os.WriteFile(path.Join(src, "default", "Pod", "sample-pod", "app.log"), []byte("some logs\n"), 0644))
+	require.NoError(t, NewDirSink(src).WriteIncidentFile("crash-loop", "resources/default/Pod/sample-pod.yaml", []byte("kind: Pod\n")))
+
+	require.NoError(t, ConvertToDB(DirFS(src), dbPath))
+	assert.Error(t, ConvertToDB(DirFS(src), dbPath), "converting to an existing database should fail")
+
+	dst := path.Join(dir, "dst")
+	require.NoError(t, ConvertFromDB(dbPath, dst))
+
+	for _, file := range []string{
+		"default/Pod/sample-pod/sample-pod.yaml",
+		"default/Pod/sample-pod/sample-pod" + EventsFileSuffix,
+		"default/Pod/sample-pod/sample-pod" + LinksFileSuffix,
+		"default/Pod/sample-pod/app.log",
+		"default/Service/sample-service/sample-service.yaml",
+		"default/Secret/sample-secret/sample-secret.yaml",
+		IncidentsDirName + "/crash-loop/resources/default/Pod/sample-pod.yaml",
+	} {
+		expected, err := os.ReadFile(filepath.Join(src, file))
+		require.NoError(t, err)
+
+		actual, err := os.ReadFile(filepath.Join(dst, file))
+		require.NoError(t, err)
+
+		assert.Equal(t, string(expected), string(actual), file)
+	}
+
+	target, err := os.Readlink(filepath.Join(dst, "default", "Service", "sample-service", "Pod", "sample-pod"))
+	require.NoError(t, err)
+	assert.Equal(t, "../../../Pod/sample-pod", target)
+}
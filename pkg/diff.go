@@ -0,0 +1,401 @@
+package kubedump
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// The kinds of differences between resources and their fields.
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// DefaultDiffIgnoredFields are the fields which change constantly without saying much about the state of a resource.
+var DefaultDiffIgnoredFields = []string{"metadata.managedFields", "metadata.resourceVersion", "status.observedGeneration"}
+
+// FieldChange is a field which differs between two revisions of a resource.
+type FieldChange struct {
+	// Kind is one of DiffAdded, DiffRemoved, or DiffChanged.
+	Kind string
+
+	// Path is the path to the field, like "spec.containers[0].image".
+	Path string
+
+	Old interface{}
+	New interface{}
+}
+
+// ResourceDiff is a resource which differs between two dumps.
+type ResourceDiff struct {
+	// Kind is one of DiffAdded, DiffRemoved, or DiffChanged.
+	Kind    string
+	Builder ResourcePathBuilder
+
+	// Changes are the fields which changed, if Kind is DiffChanged.
+	Changes []FieldChange
+}
+
+// DiffOptions control which resources and fields are compared by DiffSnapshots.
+type DiffOptions struct {
+	// Filter returns true for the resources which are compared, and a resource is compared if it matches in either
+	// snapshot. If nil, every resource is compared.
+	Filter func(resource Resource) bool
+
+	// Ignore are the dot separated paths of the fields which are not compared. A path through a list applies to each
+	// of its elements, so "spec.containers.image" ignores the image of every container.
+	Ignore []string
+}
+
+// Snapshot is the state of each resource in a dump at some point in time.
+type Snapshot map[ResourcePathBuilder]map[string]interface{}
+
+// LoadSnapshot reads the resources in the dump at dumpPath, which may be a directory, archive, or db dump. A db dump is
+// read as it was at the given time, or as it was when it was stopped if at is zero. Since a db dump does not record when
+// a resource was deleted, a snapshot at a point in time holds every resource written up to then, so comparing two
+// points in time of the same dump never reports a resource as removed.
+func LoadSnapshot(dumpPath string, at time.Time) (Snapshot, error) {
+	snapshot := Snapshot{}
+
+	add := func(builder ResourcePathBuilder, data []byte) error {
+		obj := map[string]interface{}{}
+		if err := yaml.Unmarshal(data, &obj); err != nil {
+			return fmt.Errorf("could not parse %s '%s': %w", builder.Kind, builder.Name, err)
+		}
+
+		snapshot[builder] = obj
+
+		return nil
+	}
+
+	if !strings.HasSuffix(dumpPath, ".db") {
+		if !at.IsZero() {
+			return nil, fmt.Errorf("only db dumps can be read at a point in time")
+		}
+
+		fsys, err := OpenDump(dumpPath)
+		if err != nil {
+			return nil, err
+		}
+		defer CloseDump(fsys)
+
+		err = ForEachResourceFS(fsys, func(builder ResourcePathBuilder) error {
+			data, err := fs.ReadFile(fsys, path.Join(builder.Build(), builder.Name+".yaml"))
+			if err != nil {
+				return fmt.Errorf("could not read resource file: %w", err)
+			}
+
+			return add(builder, data)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return snapshot, nil
+	}
+
+	dump, err := OpenDBDump(dumpPath)
+	if err != nil {
+		return nil, err
+	}
+	defer dump.Close()
+
+	if at.IsZero() {
+		err = dump.ForEachResource(add)
+	} else {
+		err = dump.ForEachResourceAt(at, add)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// matches returns true if the resource described by obj passes filter.
+func matches(filter func(resource Resource) bool, obj map[string]interface{}) bool {
+	if obj == nil {
+		return false
+	}
+
+	return filter(NewResourceBuilder().FromUnstructured(&unstructured.Unstructured{Object: obj}).Build())
+}
+
+// DiffSnapshots returns the resources which were added, removed, or changed from a to b, sorted by their path in a
+// dump.
+func DiffSnapshots(a Snapshot, b Snapshot, opts DiffOptions) []ResourceDiff {
+	builders := make([]ResourcePathBuilder, 0, len(a)+len(b))
+	for builder := range a {
+		builders = append(builders, builder)
+	}
+
+	for builder := range b {
+		if _, found := a[builder]; !found {
+			builders = append(builders, builder)
+		}
+	}
+
+	sort.Slice(builders, func(i, j int) bool {
+		return builders[i].Build() < builders[j].Build()
+	})
+
+	var diffs []ResourceDiff
+
+	for _, builder := range builders {
+		before, inA := a[builder]
+		after, inB := b[builder]
+
+		if opts.Filter != nil && !matches(opts.Filter, before) && !matches(opts.Filter, after) {
+			continue
+		}
+
+		switch {
+		case !inA:
+			diffs = append(diffs, ResourceDiff{Kind: DiffAdded, Builder: builder})
+		case !inB:
+			diffs = append(diffs, ResourceDiff{Kind: DiffRemoved, Builder: builder})
+		default:
+			var changes []FieldChange
+			diffValues("", withoutFields(before, opts.Ignore), withoutFields(after, opts.Ignore), &changes)
+
+			if len(changes) > 0 {
+				diffs = append(diffs, ResourceDiff{Kind: DiffChanged, Builder: builder, Changes: changes})
+			}
+		}
+	}
+
+	return diffs
+}
+
+// withoutFields returns a copy of obj with the fields at each of paths removed.
+func withoutFields(obj map[string]interface{}, paths []string) map[string]interface{} {
+	obj = (&unstructured.Unstructured{Object: obj}).DeepCopy().Object
+
+	for _, fieldPath := range paths {
+		if fieldPath != "" {
+			removeField(obj, strings.Split(fieldPath, "."))
+		}
+	}
+
+	return obj
+}
+
+func removeField(value interface{}, segments []string) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if len(segments) == 1 {
+			delete(value, segments[0])
+		} else if next, found := value[segments[0]]; found {
+			removeField(next, segments[1:])
+		}
+	case []interface{}:
+		for _, element := range value {
+			removeField(element, segments)
+		}
+	}
+}
+
+// fieldPath appends key to the path of a field, quoting keys which could be mistaken for a path.
+func fieldPath(parent string, key string) string {
+	if strings.ContainsAny(key, ".[]\"") {
+		return fmt.Sprintf("%s[%q]", parent, key)
+	}
+
+	if parent == "" {
+		return key
+	}
+
+	return parent + "." + key
+}
+
+// diffValues appends the changes from a to b at the given path to changes.
+func diffValues(at string, a interface{}, b interface{}, changes *[]FieldChange) {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		if b, ok := b.(map[string]interface{}); ok {
+			keys := make([]string, 0, len(a)+len(b))
+			for key := range a {
+				keys = append(keys, key)
+			}
+
+			for key := range b {
+				if _, found := a[key]; !found {
+					keys = append(keys, key)
+				}
+			}
+
+			sort.Strings(keys)
+
+			for _, key := range keys {
+				before, inA := a[key]
+				after, inB := b[key]
+
+				switch {
+				case !inA:
+					*changes = append(*changes, FieldChange{Kind: DiffAdded, Path: fieldPath(at, key), New: after})
+				case !inB:
+					*changes = append(*changes, FieldChange{Kind: DiffRemoved, Path: fieldPath(at, key), Old: before})
+				default:
+					diffValues(fieldPath(at, key), before, after, changes)
+				}
+			}
+
+			return
+		}
+	case []interface{}:
+		if b, ok := b.([]interface{}); ok {
+			diffLists(at, a, b, changes)
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		*changes = append(*changes, FieldChange{Kind: DiffChanged, Path: at, Old: a, New: b})
+	}
+}
+
+// elementNames returns the value of the "name" field of each element of list, or false if any element has no name or
+// shares its name with another element.
+func elementNames(list []interface{}) ([]string, bool) {
+	names := make([]string, 0, len(list))
+	seen := make(map[string]bool, len(list))
+
+	for _, element := range list {
+		element, ok := element.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		name, ok := element["name"].(string)
+		if !ok || seen[name] {
+			return nil, false
+		}
+
+		names = append(names, name)
+		seen[name] = true
+	}
+
+	return names, true
+}
+
+// diffLists appends the changes from list a to list b at the given path to changes. When every element of both lists
+// has a unique name, like containers, ports, or volumes, elements are matched by name so that reordering or inserting
+// an element only reports the elements which actually changed. Otherwise, elements are matched by index.
+func diffLists(at string, a []interface{}, b []interface{}, changes *[]FieldChange) {
+	namesA, namedA := elementNames(a)
+	namesB, namedB := elementNames(b)
+
+	if !namedA || !namedB {
+		for i := 0; i < len(a) || i < len(b); i++ {
+			elementPath := fmt.Sprintf("%s[%d]", at, i)
+
+			switch {
+			case i >= len(a):
+				*changes = append(*changes, FieldChange{Kind: DiffAdded, Path: elementPath, New: b[i]})
+			case i >= len(b):
+				*changes = append(*changes, FieldChange{Kind: DiffRemoved, Path: elementPath, Old: a[i]})
+			default:
+				diffValues(elementPath, a[i], b[i], changes)
+			}
+		}
+
+		return
+	}
+
+	indexB := make(map[string]int, len(b))
+	for i, name := range namesB {
+		indexB[name] = i
+	}
+
+	inA := make(map[string]bool, len(a))
+
+	for i, name := range namesA {
+		inA[name] = true
+		elementPath := fmt.Sprintf("%s[name=%s]", at, name)
+
+		if j, found := indexB[name]; found {
+			diffValues(elementPath, a[i], b[j], changes)
+		} else {
+			*changes = append(*changes, FieldChange{Kind: DiffRemoved, Path: elementPath, Old: a[i]})
+		}
+	}
+
+	for j, name := range namesB {
+		if !inA[name] {
+			*changes = append(*changes, FieldChange{Kind: DiffAdded, Path: fmt.Sprintf("%s[name=%s]", at, name), New: b[j]})
+		}
+	}
+}
+
+// resourceDisplayName formats the name of the resource at builder like the patterns of filter resource expressions.
+func resourceDisplayName(builder ResourcePathBuilder) string {
+	if builder.Namespace == "" {
+		return builder.Name
+	}
+
+	return builder.Namespace + "/" + builder.Name
+}
+
+// diffSymbol returns the symbol prefixing a difference of the given kind.
+func diffSymbol(kind string) string {
+	switch kind {
+	case DiffAdded:
+		return "+"
+	case DiffRemoved:
+		return "-"
+	default:
+		return "~"
+	}
+}
+
+// formatValue formats a field's value as compact json.
+func formatValue(value interface{}) string {
+	buffer := &bytes.Buffer{}
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+
+	if err := encoder.Encode(value); err != nil {
+		return fmt.Sprint(value)
+	}
+
+	return strings.TrimSuffix(buffer.String(), "\n")
+}
+
+// WriteDiff writes diffs to w, with one line for each resource followed by a line for each of its changed fields.
+func WriteDiff(w io.Writer, diffs []ResourceDiff) error {
+	for _, diff := range diffs {
+		if _, err := fmt.Fprintf(w, "%s %s %s\n", diffSymbol(diff.Kind), diff.Builder.Kind, resourceDisplayName(diff.Builder)); err != nil {
+			return fmt.Errorf("could not write diff: %w", err)
+		}
+
+		for _, change := range diff.Changes {
+			var value string
+			switch change.Kind {
+			case DiffAdded:
+				value = formatValue(change.New)
+			case DiffRemoved:
+				value = formatValue(change.Old)
+			default:
+				value = formatValue(change.Old) + " -> " + formatValue(change.New)
+			}
+
+			if _, err := fmt.Fprintf(w, "    %s %s: %s\n", diffSymbol(change.Kind), change.Path, value); err != nil {
+				return fmt.Errorf("could not write diff: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
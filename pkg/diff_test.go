@@ -0,0 +1,99 @@
+package kubedump
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apicorev1 "k8s.io/api/core/v1"
+	apimetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func testDiffPod(containers ...apicorev1.Container) map[string]interface{} {
+	pod := &apicorev1.Pod{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       apicorev1.PodSpec{Containers: containers},
+	}
+
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pod)
+	if err != nil {
+		panic(err)
+	}
+
+	return obj
+}
+
+func TestDiffSnapshotsNamedLists(t *testing.T) {
+	builder := ResourcePathBuilder{}.WithNamespace("default").WithKind("Pod").WithName("web")
+
+	a := Snapshot{builder: testDiffPod(
+		apicorev1.Container{Name: "app", Image: "web:1", Args: []string{"--port"}},
+		apicorev1.Container{Name: "sidecar", Image: "proxy:1"},
+	)}
+	b := Snapshot{builder: testDiffPod(
+		apicorev1.Container{Name: "logger", Image: "logger:1"},
+		apicorev1.Container{Name: "app", Image: "web:2", Args: []string{"--port", "8080"}},
+	)}
+
+	diffs := DiffSnapshots(a, b, DiffOptions{})
+	require.Len(t, diffs, 1)
+	assert.Equal(t, DiffChanged, diffs[0].Kind)
+
+	paths := make(map[string]string)
+	for _, change := range diffs[0].Changes {
+		paths[change.Path] = change.Kind
+	}
+
+	assert.Equal(t, map[string]string{
+		"spec.containers[name=app].args[1]": DiffAdded,
+		"spec.containers[name=app].image":   DiffChanged,
+		"spec.containers[name=sidecar]":     DiffRemoved,
+		"spec.containers[name=logger]":      DiffAdded,
+	}, paths)
+
+	// reordering named elements is not a change
+	b = Snapshot{builder: testDiffPod(
+		apicorev1.Container{Name: "sidecar", Image: "proxy:1"},
+		apicorev1.Container{Name: "app", Image: "web:1", Args: []string{"--port"}},
+	)}
+	assert.Empty(t, DiffSnapshots(a, b, DiffOptions{}))
+}
+
+func TestLoadSnapshotAt(t *testing.T) {
+	dbPath := path.Join(t.TempDir(), DBFileName)
+
+	sink, err := NewDBSink(dbPath)
+	require.NoError(t, err)
+
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	sink.now = func() time.Time {
+		now = now.Add(time.Minute)
+		return now
+	}
+
+	require.NoError(t, sink.WriteResource(&unstructured.Unstructured{Object: testDiffPod(apicorev1.Container{Name: "app", Image: "web:1"})}))
+	require.NoError(t, sink.WriteResource(testUnstructured("ConfigMap", "default", "web-config")))
+	require.NoError(t, sink.Close())
+
+	before, err := LoadSnapshot(dbPath, start.Add(time.Minute+time.Second))
+	require.NoError(t, err)
+	assert.Len(t, before, 1)
+
+	after, err := LoadSnapshot(dbPath, time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, after, 2)
+
+	// deletions are not recorded, so a later point in time only ever adds resources
+	assert.Equal(t, []ResourceDiff{
+		{Kind: DiffAdded, Builder: ResourcePathBuilder{}.WithNamespace("default").WithKind("ConfigMap").WithName("web-config")},
+	}, DiffSnapshots(before, after, DiffOptions{}))
+
+	_, err = LoadSnapshot(path.Dir(dbPath), start)
+	assert.Error(t, err, "only db dumps can be read at a point in time")
+}
@@ -1,24 +1,32 @@
 package kubedump
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/rest"
 )
 
+// Discover returns the preferred namespaced and cluster-scoped resources served by the cluster which can be listed and
+// watched. If some api groups could not be discovered (ex an aggregated api whose backing service is down), the
+// resources of the groups which could be discovered are still returned alongside a *discovery.ErrGroupDiscoveryFailed
+// describing the failed groups. Callers may check for this with discovery.IsGroupDiscoveryFailedError.
 func Discover(config *rest.Config) ([]schema.GroupVersionResource, error) {
 	client, err := discovery.NewDiscoveryClientForConfig(config)
 	if err != nil {
 		return nil, fmt.Errorf("could not create client for discovery: %w", err)
 	}
 
-	apiResources, err := discovery.ServerPreferredNamespacedResources(client)
-	if err != nil {
-		return nil, fmt.Errorf("could not get server resources: %w", err)
+	apiResources, discoveryErr := discovery.ServerPreferredResources(client)
+	if discoveryErr != nil && !discovery.IsGroupDiscoveryFailedError(discoveryErr) {
+		return nil, fmt.Errorf("could not get server resources: %w", discoveryErr)
 	}
 
+	apiResources = discovery.FilteredBy(discovery.SupportsAllVerbs{Verbs: []string{"list", "watch"}}, apiResources)
+
 	resourceGroupVersions := make([]schema.GroupVersionResource, 0)
 	for _, list := range apiResources {
 		groupVersion, err := schema.ParseGroupVersion(list.GroupVersion)
@@ -27,6 +35,11 @@ func Discover(config *rest.Config) ([]schema.GroupVersionResource, error) {
 		}
 
 		for _, resource := range list.APIResources {
+			// skip subresources (ex pods/log)
+			if strings.Contains(resource.Name, "/") {
+				continue
+			}
+
 			resourceGroupVersions = append(resourceGroupVersions, schema.GroupVersionResource{
 				Group:    groupVersion.Group,
 				Version:  groupVersion.Version,
@@ -35,5 +48,16 @@ func Discover(config *rest.Config) ([]schema.GroupVersionResource, error) {
 		}
 	}
 
-	return resourceGroupVersions, nil
+	return resourceGroupVersions, discoveryErr
+}
+
+// FailedGroups returns the group versions which could not be discovered if err is a group discovery error, or nil
+// otherwise.
+func FailedGroups(err error) map[schema.GroupVersion]error {
+	var groupErr *discovery.ErrGroupDiscoveryFailed
+	if errors.As(err, &groupErr) {
+		return groupErr.Groups
+	}
+
+	return nil
 }
@@ -0,0 +1,66 @@
+package kubedump
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apimetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+)
+
+func fakeDiscoveryServer(t *testing.T) *httptest.Server {
+	writeJson := func(w http.ResponseWriter, obj any) {
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(obj))
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, apimetav1.APIVersions{Versions: []string{"v1"}})
+	})
+	mux.HandleFunc("/api/v1", func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, apimetav1.APIResourceList{
+			GroupVersion: "v1",
+			APIResources: []apimetav1.APIResource{
+				{Name: "pods", Kind: "Pod", Namespaced: true, Verbs: []string{"list", "watch"}},
+				{Name: "pods/log", Kind: "Pod", Namespaced: true, Verbs: []string{"get"}},
+				{Name: "persistentvolumes", Kind: "PersistentVolume", Namespaced: false, Verbs: []string{"list", "watch"}},
+				{Name: "bindings", Kind: "Binding", Namespaced: true, Verbs: []string{"create"}},
+			},
+		})
+	})
+	mux.HandleFunc("/apis", func(w http.ResponseWriter, r *http.Request) {
+		groupVersion := apimetav1.GroupVersionForDiscovery{GroupVersion: "metrics.k8s.io/v1beta1", Version: "v1beta1"}
+		writeJson(w, apimetav1.APIGroupList{
+			Groups: []apimetav1.APIGroup{
+				{Name: "metrics.k8s.io", Versions: []apimetav1.GroupVersionForDiscovery{groupVersion}, PreferredVersion: groupVersion},
+			},
+		})
+	})
+	mux.HandleFunc("/apis/metrics.k8s.io/v1beta1", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestDiscoverPartialFailure(t *testing.T) {
+	server := fakeDiscoveryServer(t)
+	defer server.Close()
+
+	resources, err := Discover(&rest.Config{Host: server.URL})
+	assert.True(t, discovery.IsGroupDiscoveryFailedError(err))
+	assert.ElementsMatch(t, []schema.GroupVersionResource{
+		{Group: "", Version: "v1", Resource: "pods"},
+		{Group: "", Version: "v1", Resource: "persistentvolumes"},
+	}, resources)
+
+	failed := FailedGroups(err)
+	assert.Contains(t, failed, schema.GroupVersion{Group: "metrics.k8s.io", Version: "v1beta1"})
+}
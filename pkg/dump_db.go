@@ -0,0 +1,396 @@
+package kubedump
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"sigs.k8s.io/yaml"
+)
+
+// DBDump provides read access to a dump written by a DBSink.
+type DBDump struct {
+	db *bolt.DB
+}
+
+// OpenDBDump opens the db dump at dbPath for reading.
+func OpenDBDump(dbPath string) (*DBDump, error) {
+	db, err := bolt.Open(dbPath, 0644, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("could not open database '%s': %w", dbPath, err)
+	}
+
+	return &DBDump{db: db}, nil
+}
+
+func (dump *DBDump) Close() error {
+	return dump.db.Close()
+}
+
+// view runs fn in a read only transaction, failing if the database is missing any of the buckets of a dump.
+func (dump *DBDump) view(fn func(tx *bolt.Tx) error) error {
+	return dump.db.View(func(tx *bolt.Tx) error {
+		for _, name := range dbBuckets {
+			if tx.Bucket(name) == nil {
+				return fmt.Errorf("database is not a kubedump dump: missing bucket '%s'", name)
+			}
+		}
+
+		return fn(tx)
+	})
+}
+
+// forEachNested calls fn for each value in each nested bucket of parent, in the order they were written.
+func forEachNested(parent *bolt.Bucket, fn func(key string, value []byte) error) error {
+	return parent.ForEachBucket(func(key []byte) error {
+		return parent.Bucket(key).ForEach(func(_ []byte, value []byte) error {
+			return fn(string(key), value)
+		})
+	})
+}
+
+// ForEachResource calls fn with the latest revision of each resource in the dump.
+func (dump *DBDump) ForEachResource(fn func(builder ResourcePathBuilder, data []byte) error) error {
+	return dump.view(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketResources).ForEach(func(key []byte, data []byte) error {
+			builder, err := builderFromResourceKey(string(key))
+			if err != nil {
+				return err
+			}
+
+			return fn(builder, data)
+		})
+	})
+}
+
+// Resource returns the latest revision of the resource at builder.
+func (dump *DBDump) Resource(builder ResourcePathBuilder) ([]byte, error) {
+	var data []byte
+
+	err := dump.view(func(tx *bolt.Tx) error {
+		key := resourceKey(builder.Kind, builder.Namespace, builder.Name)
+
+		if value := tx.Bucket(bucketResources).Get([]byte(key)); value != nil {
+			data = bytes.Clone(value)
+			return nil
+		}
+
+		return fmt.Errorf("resource '%s' not found", key)
+	})
+
+	return data, err
+}
+
+// Revisions returns every revision of the resource at builder, from oldest to newest.
+func (dump *DBDump) Revisions(builder ResourcePathBuilder) ([][]byte, error) {
+	var revisions [][]byte
+
+	err := dump.view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketRevisions).Bucket([]byte(resourceKey(builder.Kind, builder.Namespace, builder.Name)))
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(_ []byte, value []byte) error {
+			revisions = append(revisions, bytes.Clone(value))
+			return nil
+		})
+	})
+
+	return revisions, err
+}
+
+// ForEachResourceAt calls fn with the revision of each resource which was current at t, skipping resources which were
+// first written after t. Deletions are not recorded in a db dump, so a resource deleted before t is still passed with
+// its last revision.
+func (dump *DBDump) ForEachResourceAt(t time.Time, fn func(builder ResourcePathBuilder, data []byte) error) error {
+	return dump.view(func(tx *bolt.Tx) error {
+		// revisions are numbered from 1 in the order they were indexed, so counting the revisions of each resource
+		// indexed up to t gives the sequence of the revision which was current at t
+		counts := map[string]uint64{}
+		var keys []string
+
+		cursor := tx.Bucket(bucketIndexTime).Cursor()
+		end := []byte(t.UTC().Format(indexTimeFormat) + "/\xff")
+
+		for key, value := cursor.First(); key != nil && bytes.Compare(key, end) <= 0; key, value = cursor.Next() {
+			record, resource, _ := strings.Cut(string(value), " ")
+			if record != RecordRevision {
+				continue
+			}
+
+			if counts[resource] == 0 {
+				keys = append(keys, resource)
+			}
+
+			counts[resource]++
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			builder, err := builderFromResourceKey(key)
+			if err != nil {
+				return err
+			}
+
+			bucket := tx.Bucket(bucketRevisions).Bucket([]byte(key))
+			if bucket == nil {
+				return fmt.Errorf("missing revisions for resource '%s'", key)
+			}
+
+			data := bucket.Get(sequenceKey(counts[key]))
+			if data == nil {
+				return fmt.Errorf("missing revision %d for resource '%s'", counts[key], key)
+			}
+
+			if err := fn(builder, data); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// ForEachRevision calls fn with every revision of every resource and the time it was written, in the order they were
+// written. The data passed to fn is only valid until fn returns.
+func (dump *DBDump) ForEachRevision(fn func(builder ResourcePathBuilder, t time.Time, data []byte) error) error {
+	return dump.view(func(tx *bolt.Tx) error {
+		counts := map[string]uint64{}
+
+		cursor := tx.Bucket(bucketIndexTime).Cursor()
+
+		for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+			record, resource, _ := strings.Cut(string(value), " ")
+			if record != RecordRevision {
+				continue
+			}
+
+			timestamp, _, _ := strings.Cut(string(key), "/")
+
+			t, err := time.Parse(indexTimeFormat, timestamp)
+			if err != nil {
+				return fmt.Errorf("invalid time index key '%s': %w", key, err)
+			}
+
+			builder, err := builderFromResourceKey(resource)
+			if err != nil {
+				return err
+			}
+
+			bucket := tx.Bucket(bucketRevisions).Bucket([]byte(resource))
+			if bucket == nil {
+				return fmt.Errorf("missing revisions for resource '%s'", resource)
+			}
+
+			counts[resource]++
+
+			data := bucket.Get(sequenceKey(counts[resource]))
+			if data == nil {
+				return fmt.Errorf("missing revision %d for resource '%s'", counts[resource], resource)
+			}
+
+			if err := fn(builder, t, data); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// scanIndex returns the resources in the index bucket whose keys start with prefix. The parts of each key are in the
+// given order, naming the fields of ResourcePathBuilder.
+func (dump *DBDump) scanIndex(index []byte, prefix string, order [3]string) ([]ResourcePathBuilder, error) {
+	var builders []ResourcePathBuilder
+
+	err := dump.view(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(index).Cursor()
+
+		for key, _ := cursor.Seek([]byte(prefix)); key != nil && bytes.HasPrefix(key, []byte(prefix)); key, _ = cursor.Next() {
+			parts := strings.SplitN(string(key), "/", 3)
+			if len(parts) != 3 {
+				return fmt.Errorf("invalid index key '%s'", key)
+			}
+
+			fields := map[string]string{}
+			for i, field := range order {
+				fields[field] = parts[i]
+			}
+
+			builders = append(builders, ResourcePathBuilder{}.
+				WithKind(fields["kind"]).
+				WithNamespace(fields["namespace"]).
+				WithName(fields["name"]))
+		}
+
+		return nil
+	})
+
+	return builders, err
+}
+
+// ResourcesOfKind returns every resource of the given kind.
+func (dump *DBDump) ResourcesOfKind(kind string) ([]ResourcePathBuilder, error) {
+	return dump.scanIndex(bucketResources, kind+"/", [3]string{"kind", "namespace", "name"})
+}
+
+// ResourcesInNamespace returns every resource in the given namespace, or every cluster scoped resource if namespace
+// is empty.
+func (dump *DBDump) ResourcesInNamespace(namespace string) ([]ResourcePathBuilder, error) {
+	return dump.scanIndex(bucketIndexNamespace, namespace+"/", [3]string{"namespace", "kind", "name"})
+}
+
+// ResourcesNamed returns every resource with the given name.
+func (dump *DBDump) ResourcesNamed(name string) ([]ResourcePathBuilder, error) {
+	return dump.scanIndex(bucketIndexName, name+"/", [3]string{"name", "kind", "namespace"})
+}
+
+// ForEachEvent calls fn with each formatted event line and the resource it regards.
+func (dump *DBDump) ForEachEvent(fn func(builder ResourcePathBuilder, line []byte) error) error {
+	return dump.view(func(tx *bolt.Tx) error {
+		return forEachNested(tx.Bucket(bucketEvents), func(key string, line []byte) error {
+			builder, err := builderFromResourceKey(key)
+			if err != nil {
+				return err
+			}
+
+			return fn(builder, line)
+		})
+	})
+}
+
+// ForEachLog calls fn with each chunk of logs collected for a container.
+func (dump *DBDump) ForEachLog(fn func(namespace string, pod string, container string, data []byte) error) error {
+	return dump.view(func(tx *bolt.Tx) error {
+		return forEachNested(tx.Bucket(bucketLogs), func(key string, data []byte) error {
+			parts := strings.SplitN(key, "/", 3)
+			if len(parts) != 3 {
+				return fmt.Errorf("invalid container key '%s'", key)
+			}
+
+			return fn(parts[0], parts[1], parts[2], data)
+		})
+	})
+}
+
+// ForEachLinks calls fn with the links recorded under each parent resource.
+func (dump *DBDump) ForEachLinks(fn func(parent ResourcePathBuilder, references []LinkReference) error) error {
+	return dump.view(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketLinks).ForEach(func(key []byte, data []byte) error {
+			parent, err := builderFromResourceKey(string(key))
+			if err != nil {
+				return err
+			}
+
+			var references []LinkReference
+			if err := yaml.Unmarshal(data, &references); err != nil {
+				return fmt.Errorf("could not unmarshal links for '%s': %w", key, err)
+			}
+
+			return fn(parent, references)
+		})
+	})
+}
+
+// ForEachIncidentFile calls fn with each file written for an incident.
+func (dump *DBDump) ForEachIncidentFile(fn func(incident string, name string, data []byte) error) error {
+	return dump.view(func(tx *bolt.Tx) error {
+		incidents := tx.Bucket(bucketIncidents)
+		if incidents == nil {
+			return nil
+		}
+
+		return incidents.ForEachBucket(func(incident []byte) error {
+			return incidents.Bucket(incident).ForEach(func(name []byte, data []byte) error {
+				return fn(string(incident), string(name), data)
+			})
+		})
+	})
+}
+
+// Manifest returns the manifest stored in the dump. If the dump has no manifest, the returned error wraps
+// fs.ErrNotExist.
+func (dump *DBDump) Manifest() (*Manifest, error) {
+	var manifest *Manifest
+
+	err := dump.view(func(tx *bolt.Tx) error {
+		var data []byte
+		if meta := tx.Bucket(bucketMeta); meta != nil {
+			data = meta.Get(keyManifest)
+		}
+
+		if data == nil {
+			return fmt.Errorf("could not read manifest: %w", fs.ErrNotExist)
+		}
+
+		manifest = &Manifest{}
+		if err := json.Unmarshal(data, manifest); err != nil {
+			return fmt.Errorf("could not unmarshal manifest: %w", err)
+		}
+
+		return nil
+	})
+
+	return manifest, err
+}
+
+// CountResources returns the number of resources of each kind in the dump.
+func (dump *DBDump) CountResources() (map[string]int, error) {
+	counts := map[string]int{}
+
+	err := dump.ForEachResource(func(builder ResourcePathBuilder, _ []byte) error {
+		counts[builder.Kind]++
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not count resources: %w", err)
+	}
+
+	return counts, nil
+}
+
+// DBRecord is an entry in the time index of a db dump.
+type DBRecord struct {
+	Time time.Time
+
+	// Kind is one of RecordRevision, RecordEvent, or RecordLog.
+	Kind string
+
+	// Key is the resource of a revision or event as "<kind>/<namespace>/<name>", or the container of a log chunk as
+	// "<namespace>/<pod>/<container>".
+	Key string
+}
+
+// Records returns the revisions, events, and log chunks recorded from start up to, but not including, end.
+func (dump *DBDump) Records(start time.Time, end time.Time) ([]DBRecord, error) {
+	var records []DBRecord
+
+	err := dump.view(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(bucketIndexTime).Cursor()
+		startKey := []byte(start.UTC().Format(indexTimeFormat))
+		endKey := []byte(end.UTC().Format(indexTimeFormat))
+
+		for key, value := cursor.Seek(startKey); key != nil && bytes.Compare(key, endKey) < 0; key, value = cursor.Next() {
+			timestamp, _, _ := strings.Cut(string(key), "/")
+
+			t, err := time.Parse(indexTimeFormat, timestamp)
+			if err != nil {
+				return fmt.Errorf("invalid time index key '%s': %w", key, err)
+			}
+
+			kind, recordKey, _ := strings.Cut(string(value), " ")
+			records = append(records, DBRecord{Time: t, Kind: kind, Key: recordKey})
+		}
+
+		return nil
+	})
+
+	return records, err
+}
@@ -0,0 +1,193 @@
+package kubedump
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DumpFS is the file system holding a dump, which may be a directory or an archive. Since dumps link resources with
+// symlinks, it also allows reading symlinks rather than only following them.
+type DumpFS interface {
+	fs.FS
+
+	// ReadLink returns the destination of the named symbolic link.
+	ReadLink(name string) (string, error)
+
+	// Lstat returns a FileInfo describing the named file without following symbolic links.
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+type dirFS struct {
+	fs.FS
+	dir string
+}
+
+// DirFS returns a DumpFS for the dump in the directory dir.
+func DirFS(dir string) DumpFS {
+	return dirFS{
+		FS:  os.DirFS(dir),
+		dir: dir,
+	}
+}
+
+func (fsys dirFS) join(op string, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	return filepath.Join(fsys.dir, filepath.FromSlash(name)), nil
+}
+
+func (fsys dirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(fsys.FS, name)
+}
+
+func (fsys dirFS) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(fsys.FS, name)
+}
+
+func (fsys dirFS) ReadLink(name string) (string, error) {
+	fullPath, err := fsys.join("readlink", name)
+	if err != nil {
+		return "", err
+	}
+
+	return os.Readlink(fullPath)
+}
+
+func (fsys dirFS) Lstat(name string) (fs.FileInfo, error) {
+	fullPath, err := fsys.join("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.Lstat(fullPath)
+}
+
+// IsArchive returns true if the given path has the extension of an archive format which can be read by OpenDump and
+// written by WriteArchive.
+func IsArchive(archivePath string) bool {
+	_, ok := archiveFormatOf(archivePath)
+	return ok
+}
+
+// OpenDump opens the dump at the given path, which may be either a directory or a .tar, .tar.gz, .tgz or .zip archive.
+// If every file in an archive is under a single top-level directory (ex. an archive made with `tar czf
+// kubedump.tar.gz kubedump.dump`), that directory is used as the root of the dump.
+func OpenDump(dumpPath string) (DumpFS, error) {
+	info, err := os.Stat(dumpPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not open dump: %w", err)
+	}
+
+	if info.IsDir() {
+		return DirFS(dumpPath), nil
+	}
+
+	format, ok := archiveFormatOf(dumpPath)
+	if !ok {
+		return nil, fmt.Errorf("'%s' is not a directory or a supported archive", dumpPath)
+	}
+
+	fsys, err := readArchive(dumpPath, format)
+	if err != nil {
+		return nil, fmt.Errorf("could not read archive '%s': %w", dumpPath, err)
+	}
+
+	return fsys, nil
+}
+
+// CloseDump closes the archive of a DumpFS returned by OpenDump. Dumps in a directory hold nothing open.
+func CloseDump(fsys DumpFS) error {
+	if closer, ok := fsys.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// archiveFormatOf returns the archive format for the extension of the given path.
+func archiveFormatOf(archivePath string) (archiveFormat, bool) {
+	switch {
+	case strings.HasSuffix(archivePath, ".tar.gz"), strings.HasSuffix(archivePath, ".tgz"):
+		return archiveFormatTarGz, true
+	case strings.HasSuffix(archivePath, ".tar"):
+		return archiveFormatTar, true
+	case strings.HasSuffix(archivePath, ".zip"):
+		return archiveFormatZip, true
+	default:
+		return "", false
+	}
+}
+
+// ExtractDump copies the dump in fsys to a new directory at dir, keeping its symlinks and modification times.
+func ExtractDump(fsys DumpFS, dir string) error {
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(name))
+
+		switch {
+		case d.IsDir():
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return fmt.Errorf("could not create directory '%s': %w", target, err)
+			}
+
+			return nil
+		case d.Type() == fs.ModeSymlink:
+			link, err := fsys.ReadLink(name)
+			if err != nil {
+				return err
+			}
+
+			if err := os.Symlink(link, target); err != nil {
+				return fmt.Errorf("could not create symlink '%s': %w", target, err)
+			}
+
+			return nil
+		case d.Type().IsRegular():
+			return extractFile(fsys, name, target)
+		default:
+			return nil
+		}
+	})
+}
+
+func extractFile(fsys DumpFS, name string, target string) error {
+	src, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.Create(target)
+	if err != nil {
+		return fmt.Errorf("could not create file '%s': %w", target, err)
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return fmt.Errorf("could not extract '%s': %w", name, err)
+	}
+
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("could not close file '%s': %w", target, err)
+	}
+
+	if err := os.Chtimes(target, info.ModTime(), info.ModTime()); err != nil {
+		return fmt.Errorf("could not set modification time of '%s': %w", target, err)
+	}
+
+	return nil
+}
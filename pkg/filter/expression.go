@@ -90,3 +90,19 @@ func (expr labelExpression) Matches(resource kubedump.Resource) bool {
 
 	return true
 }
+
+// fieldExpression evaluates to true if any value selected by path matches the specified pattern.
+type fieldExpression struct {
+	path         fieldPath
+	valuePattern string
+}
+
+func (expr fieldExpression) Matches(resource kubedump.Resource) bool {
+	for _, value := range expr.path.values(resource.GetObject()) {
+		if wildcard.MatchSimple(expr.valuePattern, value) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,112 @@
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// fieldIndexAll is the index of a fieldPathSegment selecting every element of a list.
+const fieldIndexAll = -1
+
+// fieldPathSegment selects the field with the given name, and then each of the given indices in turn.
+type fieldPathSegment struct {
+	name    string
+	indices []int
+}
+
+// fieldPath is a path to the fields of a resource, written like `.status.containerStatuses[*].state.waiting.reason`.
+type fieldPath []fieldPathSegment
+
+// parseFieldPath parses a path of dot separated field names, each of which may be followed by any number of list
+// indices like `[0]` or `[*]`.
+func parseFieldPath(s string) (fieldPath, error) {
+	if !strings.HasPrefix(s, ".") {
+		return nil, fmt.Errorf("path must start with a '.'")
+	}
+
+	var path fieldPath
+
+	for _, raw := range strings.Split(s[1:], ".") {
+		name, rawIndices, _ := strings.Cut(raw, "[")
+		if name == "" {
+			return nil, fmt.Errorf("field names cannot be empty")
+		}
+
+		segment := fieldPathSegment{name: name}
+
+		if rawIndices != "" {
+			if !strings.HasSuffix(rawIndices, "]") {
+				return nil, fmt.Errorf("index for field '%s' is missing a closing ']'", name)
+			}
+
+			for _, rawIndex := range strings.Split(strings.TrimSuffix(rawIndices, "]"), "][") {
+				if rawIndex == "*" {
+					segment.indices = append(segment.indices, fieldIndexAll)
+					continue
+				}
+
+				index, err := strconv.Atoi(rawIndex)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("index '%s' for field '%s' is not '*' or a non-negative integer", rawIndex, name)
+				}
+
+				segment.indices = append(segment.indices, index)
+			}
+		}
+
+		path = append(path, segment)
+	}
+
+	return path, nil
+}
+
+// values returns the string form of every scalar value selected by the path in obj. Missing fields, out of range
+// indices, and values which are not scalars are ignored.
+func (path fieldPath) values(obj map[string]interface{}) []string {
+	current := []interface{}{obj}
+
+	for _, segment := range path {
+		var next []interface{}
+
+		for _, value := range current {
+			if m, ok := value.(map[string]interface{}); ok {
+				if field, found := m[segment.name]; found {
+					next = append(next, field)
+				}
+			}
+		}
+
+		for _, index := range segment.indices {
+			var indexed []interface{}
+
+			for _, value := range next {
+				list, ok := value.([]interface{})
+				if !ok {
+					continue
+				}
+
+				if index == fieldIndexAll {
+					indexed = append(indexed, list...)
+				} else if index < len(list) {
+					indexed = append(indexed, list[index])
+				}
+			}
+
+			next = indexed
+		}
+
+		current = next
+	}
+
+	var values []string
+
+	for _, value := range current {
+		switch value.(type) {
+		case string, bool, int, int32, int64, float32, float64:
+			values = append(values, fmt.Sprint(value))
+		}
+	}
+
+	return values
+}
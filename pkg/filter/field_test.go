@@ -0,0 +1,93 @@
+package filter
+
+import (
+	"testing"
+
+	kubedump "github.com/joshmeranda/kubedump/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestParseFieldPath(t *testing.T) {
+	type Case struct {
+		Path         string
+		Expected     fieldPath
+		ExpectsError bool
+	}
+
+	cases := []Case{
+		{
+			Path:     ".spec.nodeName",
+			Expected: fieldPath{{name: "spec"}, {name: "nodeName"}},
+		},
+		{
+			Path:     ".spec.containers[0].ports[*]",
+			Expected: fieldPath{{name: "spec"}, {name: "containers", indices: []int{0}}, {name: "ports", indices: []int{fieldIndexAll}}},
+		},
+		{
+			Path:     ".matrix[1][*]",
+			Expected: fieldPath{{name: "matrix", indices: []int{1, fieldIndexAll}}},
+		},
+		{Path: "spec.nodeName", ExpectsError: true},
+		{Path: ".spec..nodeName", ExpectsError: true},
+		{Path: ".", ExpectsError: true},
+		{Path: ".spec.containers[0", ExpectsError: true},
+		{Path: ".spec.containers[-1]", ExpectsError: true},
+		{Path: ".spec.containers[first]", ExpectsError: true},
+	}
+
+	for _, c := range cases {
+		path, err := parseFieldPath(c.Path)
+		if c.ExpectsError {
+			assert.Error(t, err, c.Path)
+		} else {
+			assert.NoError(t, err, c.Path)
+			assert.Equal(t, c.Expected, path, c.Path)
+		}
+	}
+}
+
+func TestField(t *testing.T) {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "Pod",
+		"spec": map[string]interface{}{
+			"nodeName": "node-a",
+		},
+		"status": map[string]interface{}{
+			"containerStatuses": []interface{}{
+				map[string]interface{}{
+					"restartCount": int64(0),
+					"state":        map[string]interface{}{"running": map[string]interface{}{}},
+				},
+				map[string]interface{}{
+					"restartCount": int64(7),
+					"state": map[string]interface{}{
+						"waiting": map[string]interface{}{"reason": "CrashLoopBackOff"},
+					},
+				},
+			},
+		},
+	}}
+	resource := kubedump.NewResourceBuilder().FromUnstructured(u).Build()
+
+	parse := func(path string) fieldPath {
+		parsed, err := parseFieldPath(path)
+		require.NoError(t, err)
+		return parsed
+	}
+
+	assert.True(t, fieldExpression{path: parse(".spec.nodeName"), valuePattern: "node-*"}.Matches(resource))
+	assert.False(t, fieldExpression{path: parse(".spec.nodeName"), valuePattern: "node-b"}.Matches(resource))
+
+	assert.True(t, fieldExpression{path: parse(".status.containerStatuses[*].state.waiting.reason"), valuePattern: "CrashLoopBackOff"}.Matches(resource))
+	assert.False(t, fieldExpression{path: parse(".status.containerStatuses[0].state.waiting.reason"), valuePattern: "CrashLoopBackOff"}.Matches(resource))
+	assert.True(t, fieldExpression{path: parse(".status.containerStatuses[1].restartCount"), valuePattern: "7"}.Matches(resource))
+	assert.False(t, fieldExpression{path: parse(".status.containerStatuses[5].restartCount"), valuePattern: "*"}.Matches(resource))
+
+	// non-scalar values are never matched
+	assert.False(t, fieldExpression{path: parse(".spec"), valuePattern: "*"}.Matches(resource))
+
+	// resources built without an object have no fields
+	assert.False(t, fieldExpression{path: parse(".spec.nodeName"), valuePattern: "*"}.Matches(kubedump.NewResourceBuilder().Build()))
+}
@@ -66,6 +66,12 @@ func (lexer *Lexer) Lex(lval *yySymType) (token int) {
 		return NAMESPACE
 	case "label":
 		return LABEL
+	case "field":
+		return FIELD
+	case "=":
+		return EQUALS
+	case "!=":
+		return NOT_EQUALS
 	case "not":
 		return NOT
 	case "or":
@@ -48,3 +48,30 @@ func TestLex(t *testing.T) {
 	assert.Equal(t, IDENTIFIER, lexer.Lex(lval))
 	assert.Equal(t, "a=b", lval.s)
 }
+
+func TestLexField(t *testing.T) {
+	lval := &yySymType{}
+	lexer := NewLexer("field .status.phase = Running field .spec.nodeName != node-*")
+
+	assert.Equal(t, FIELD, lexer.Lex(lval))
+
+	assert.Equal(t, IDENTIFIER, lexer.Lex(lval))
+	assert.Equal(t, ".status.phase", lval.s)
+
+	assert.Equal(t, EQUALS, lexer.Lex(lval))
+
+	assert.Equal(t, IDENTIFIER, lexer.Lex(lval))
+	assert.Equal(t, "Running", lval.s)
+
+	assert.Equal(t, FIELD, lexer.Lex(lval))
+
+	assert.Equal(t, IDENTIFIER, lexer.Lex(lval))
+	assert.Equal(t, ".spec.nodeName", lval.s)
+
+	assert.Equal(t, NOT_EQUALS, lexer.Lex(lval))
+
+	assert.Equal(t, IDENTIFIER, lexer.Lex(lval))
+	assert.Equal(t, "node-*", lval.s)
+
+	assert.Equal(t, EOF, lexer.Lex(lval))
+}
@@ -221,3 +221,35 @@ func TestParseLabelExpression(t *testing.T) {
 	assert.Error(t, err)
 	assert.Nil(t, expr)
 }
+
+func TestParseFieldExpression(t *testing.T) {
+	expr, err := Parse("field .status.containerStatuses[*].state.waiting.reason = CrashLoopBackOff")
+	assert.NoError(t, err)
+	assert.Equal(t, fieldExpression{
+		path: fieldPath{
+			{name: "status"},
+			{name: "containerStatuses", indices: []int{fieldIndexAll}},
+			{name: "state"},
+			{name: "waiting"},
+			{name: "reason"},
+		},
+		valuePattern: "CrashLoopBackOff",
+	}, expr)
+
+	expr, err = Parse("field .status.phase != Running")
+	assert.NoError(t, err)
+	assert.Equal(t, notExpression{
+		inner: fieldExpression{
+			path:         fieldPath{{name: "status"}, {name: "phase"}},
+			valuePattern: "Running",
+		},
+	}, expr)
+
+	expr, err = Parse("field .status.phase")
+	assert.Error(t, err)
+	assert.Nil(t, expr)
+
+	expr, err = Parse("field status.phase = Running")
+	assert.Error(t, err)
+	assert.Nil(t, expr)
+}
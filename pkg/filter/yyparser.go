@@ -1,11 +1,11 @@
-// Code generated by goyacc -o /home/jmeranda/workspaces/joshmeranda/kubedump/pkg/filter/yyparser.go /home/jmeranda/workspaces/joshmeranda/kubedump/pkg/codegen/parser.y. DO NOT EDIT.
+// Code generated by goyacc -o pkg/filter/yyparser.go pkg/codegen/parser.y. DO NOT EDIT.
 
-//line /home/jmeranda/workspaces/joshmeranda/kubedump/pkg/codegen/parser.y:2
+//line pkg/codegen/parser.y:2
 package filter
 
 import __yyfmt__ "fmt"
 
-//line /home/jmeranda/workspaces/joshmeranda/kubedump/pkg/codegen/parser.y:2
+//line pkg/codegen/parser.y:2
 
 import (
 	"fmt"
@@ -22,7 +22,7 @@ func couldNotParseErr(err error) error {
 	return fmt.Errorf("could not parse expression: %w", err)
 }
 
-//line /home/jmeranda/workspaces/joshmeranda/kubedump/pkg/codegen/parser.y:20
+//line pkg/codegen/parser.y:20
 type yySymType struct {
 	yys        int
 	s          string
@@ -36,6 +36,9 @@ const OR = 57348
 const IDENTIFIER = 57349
 const NAMESPACE = 57350
 const LABEL = 57351
+const FIELD = 57352
+const EQUALS = 57353
+const NOT_EQUALS = 57354
 
 var yyToknames = [...]string{
 	"$end",
@@ -47,6 +50,9 @@ var yyToknames = [...]string{
 	"IDENTIFIER",
 	"NAMESPACE",
 	"LABEL",
+	"FIELD",
+	"EQUALS",
+	"NOT_EQUALS",
 	"'('",
 	"')'",
 }
@@ -57,7 +63,7 @@ const yyEofCode = 1
 const yyErrCode = 2
 const yyInitialStackSize = 16
 
-//line /home/jmeranda/workspaces/joshmeranda/kubedump/pkg/codegen/parser.y:94
+//line pkg/codegen/parser.y:110
 
 //line yacctab:1
 var yyExca = [...]int8{
@@ -68,45 +74,46 @@ var yyExca = [...]int8{
 
 const yyPrivate = 57344
 
-const yyLast = 34
+const yyLast = 42
 
 var yyAct = [...]int8{
-	2, 9, 10, 5, 22, 11, 6, 7, 8, 4,
-	18, 19, 9, 10, 21, 9, 10, 10, 23, 17,
-	15, 20, 6, 7, 8, 13, 14, 3, 1, 16,
-	0, 0, 0, 12,
+	5, 29, 2, 6, 7, 8, 9, 12, 28, 4,
+	25, 26, 24, 20, 21, 10, 11, 23, 6, 7,
+	8, 9, 10, 11, 14, 10, 11, 1, 19, 18,
+	16, 27, 15, 11, 22, 3, 17, 0, 0, 0,
+	0, 13,
 }
 
 var yyPact = [...]int16{
-	-1, -1000, -4, -1000, -1, 15, 19, 13, 12, -1,
-	-1, 10, -1000, -1, -1000, -1000, -3, -1000, -4, 11,
-	-1000, 7, -1000, -1000,
+	-4, -32768, 10, -32768, -4, 11, 25, 23, 22, 21,
+	-4, -4, 20, -32768, -4, -32768, -32768, 5, -32768, -1,
+	10, 27, -32768, 17, -32768, 1, -6, -32768, -32768, -32768,
 }
 
 var yyPgo = [...]int8{
-	0, 0, 27, 29, 28,
+	0, 2, 35, 36, 27,
 }
 
 var yyR1 = [...]int8{
 	0, 4, 4, 1, 1, 1, 1, 1, 1, 2,
-	2, 2, 3, 3,
+	2, 2, 2, 2, 3, 3,
 }
 
 var yyR2 = [...]int8{
 	0, 0, 1, 1, 3, 3, 3, 2, 4, 2,
-	2, 2, 1, 2,
+	2, 2, 4, 4, 1, 2,
 }
 
 var yyChk = [...]int16{
-	-1000, -4, -1, -2, 10, 4, 7, 8, 9, 5,
-	6, -1, -2, 10, 7, 7, -3, 7, -1, -1,
-	11, -1, 7, 11,
+	-32768, -4, -1, -2, 13, 4, 7, 8, 9, 10,
+	5, 6, -1, -2, 13, 7, 7, -3, 7, 7,
+	-1, -1, 14, -1, 7, 11, 12, 14, 7, 7,
 }
 
 var yyDef = [...]int8{
 	1, -2, 2, 3, 0, 0, 0, 0, 0, 0,
-	0, 0, 7, 0, 9, 10, 11, 12, 5, 6,
-	4, 0, 13, 8,
+	0, 0, 0, 7, 0, 9, 10, 11, 14, 0,
+	5, 6, 4, 0, 15, 0, 0, 8, 12, 13,
 }
 
 var yyTok1 = [...]int8{
@@ -114,11 +121,12 @@ var yyTok1 = [...]int8{
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	10, 11,
+	13, 14,
 }
 
 var yyTok2 = [...]int8{
-	2, 3, 4, 5, 6, 7, 8, 9,
+	2, 3, 4, 5, 6, 7, 8, 9, 10, 11,
+	12,
 }
 
 var yyTok3 = [...]int8{
@@ -164,7 +172,7 @@ func yyNewParser() yyParser {
 	return &yyParserImpl{}
 }
 
-const yyFlag = -1000
+const yyFlag = -32768
 
 func yyTokname(c int) string {
 	if c >= 1 && c-1 < len(yyToknames) {
@@ -464,49 +472,49 @@ yydefault:
 
 	case 1:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line /home/jmeranda/workspaces/joshmeranda/kubedump/pkg/codegen/parser.y:41
+//line pkg/codegen/parser.y:41
 		{
 			yylex.(*Lexer).result = truthyExpression{}
 		}
 	case 2:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line /home/jmeranda/workspaces/joshmeranda/kubedump/pkg/codegen/parser.y:42
+//line pkg/codegen/parser.y:42
 		{
 			yylex.(*Lexer).result = yyDollar[1].expression
 		}
 	case 4:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line /home/jmeranda/workspaces/joshmeranda/kubedump/pkg/codegen/parser.y:46
+//line pkg/codegen/parser.y:46
 		{
 			yyVAL.expression = yyDollar[2].expression
 		}
 	case 5:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line /home/jmeranda/workspaces/joshmeranda/kubedump/pkg/codegen/parser.y:47
+//line pkg/codegen/parser.y:47
 		{
 			yyVAL.expression = andExpression{left: yyDollar[1].expression, right: yyDollar[3].expression}
 		}
 	case 6:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line /home/jmeranda/workspaces/joshmeranda/kubedump/pkg/codegen/parser.y:48
+//line pkg/codegen/parser.y:48
 		{
 			yyVAL.expression = orExpression{left: yyDollar[1].expression, right: yyDollar[3].expression}
 		}
 	case 7:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line /home/jmeranda/workspaces/joshmeranda/kubedump/pkg/codegen/parser.y:49
+//line pkg/codegen/parser.y:49
 		{
 			yyVAL.expression = notExpression{inner: yyDollar[2].expression}
 		}
 	case 8:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line /home/jmeranda/workspaces/joshmeranda/kubedump/pkg/codegen/parser.y:50
+//line pkg/codegen/parser.y:50
 		{
 			yyVAL.expression = notExpression{inner: yyDollar[3].expression}
 		}
 	case 9:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line /home/jmeranda/workspaces/joshmeranda/kubedump/pkg/codegen/parser.y:53
+//line pkg/codegen/parser.y:53
 		{
 			namespacePattern, namePattern := splitPattern(yyDollar[2].s)
 			if err := validateNamespace(namespacePattern); err != nil {
@@ -521,7 +529,7 @@ yydefault:
 		}
 	case 10:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line /home/jmeranda/workspaces/joshmeranda/kubedump/pkg/codegen/parser.y:65
+//line pkg/codegen/parser.y:65
 		{
 			if err := validateNamespace(yyDollar[2].s); err != nil {
 				yylex.Error(couldNotParseErr(err).Error())
@@ -531,13 +539,35 @@ yydefault:
 		}
 	case 11:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line /home/jmeranda/workspaces/joshmeranda/kubedump/pkg/codegen/parser.y:72
+//line pkg/codegen/parser.y:72
 		{
 			yyVAL.expression = labelExpression{labels: yyDollar[2].labels}
 		}
 	case 12:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line pkg/codegen/parser.y:73
+		{
+			path, err := parseFieldPath(yyDollar[2].s)
+			if err != nil {
+				yylex.Error(fmt.Sprintf("could not parse field path '%s': %s", yyDollar[2].s, err))
+			}
+
+			yyVAL.expression = fieldExpression{path: path, valuePattern: yyDollar[4].s}
+		}
+	case 13:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line pkg/codegen/parser.y:81
+		{
+			path, err := parseFieldPath(yyDollar[2].s)
+			if err != nil {
+				yylex.Error(fmt.Sprintf("could not parse field path '%s': %s", yyDollar[2].s, err))
+			}
+
+			yyVAL.expression = notExpression{inner: fieldExpression{path: path, valuePattern: yyDollar[4].s}}
+		}
+	case 14:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line /home/jmeranda/workspaces/joshmeranda/kubedump/pkg/codegen/parser.y:74
+//line pkg/codegen/parser.y:90
 		{
 			key, val, err := splitLabelPattern(yyDollar[1].s)
 
@@ -547,9 +577,9 @@ yydefault:
 
 			yyVAL.labels = map[string]string{key: val}
 		}
-	case 13:
+	case 15:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line /home/jmeranda/workspaces/joshmeranda/kubedump/pkg/codegen/parser.y:83
+//line pkg/codegen/parser.y:99
 		{
 			key, val, err := splitLabelPattern(yyDollar[2].s)
 
@@ -2,68 +2,113 @@ package kubedump
 
 import (
 	"fmt"
-	"os"
+	"io/fs"
+	"unicode"
+	"unicode/utf8"
 )
 
 type ForEachFunc = func(ResourcePathBuilder) error
 
-func ForEachResource(base string, fn ForEachFunc) error {
-	return ForEachKind(base, func(builder ResourcePathBuilder) error {
-		dir := builder.BuildKind()
-		entries, err := os.ReadDir(dir)
-		if err != nil {
-			return fmt.Errorf("could not read directory '%s': %w", dir, err)
+// isKindDir returns true if the directory at the root of a dump holds cluster-scoped resources rather than a namespace.
+// Namespace names must be lowercase, while kinds are always capitalized.
+func isKindDir(name string) bool {
+	r, _ := utf8.DecodeRuneInString(name)
+	return unicode.IsUpper(r)
+}
+
+// fsPath converts a path built by a ResourcePathBuilder without a base path to a path valid for an fs.FS.
+func fsPath(name string) string {
+	if name == "" {
+		return "."
+	}
+
+	return name
+}
+
+// withBase passes builders to fn with the given base path.
+func withBase(base string, fn ForEachFunc) ForEachFunc {
+	return func(builder ResourcePathBuilder) error {
+		return fn(builder.WithBase(base))
+	}
+}
+
+// forEachDir passes the builder returned by next for each directory in dir to fn.
+func forEachDir(fsys fs.FS, dir string, fn ForEachFunc, next func(name string) (ResourcePathBuilder, bool)) error {
+	entries, err := fs.ReadDir(fsys, fsPath(dir))
+	if err != nil {
+		return fmt.Errorf("could not read directory '%s': %w", dir, err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
 		}
 
-		for _, entry := range entries {
-			if entry.IsDir() {
-				kindBuilder := builder.WithName(entry.Name())
-				if err := fn(kindBuilder); err != nil {
-					return fmt.Errorf("ForEachFunc failed for namespace '%s': %w", entry.Name(), err)
-				}
+		if builder, ok := next(entry.Name()); ok {
+			if err := fn(builder); err != nil {
+				return fmt.Errorf("ForEachFunc failed for '%s': %w", entry.Name(), err)
 			}
 		}
+	}
+
+	return nil
+}
+
+// ForEachResource iterates over each namespaced and cluster-scoped resource directory and passes the
+// ResourcePathBuilder to fn.
+func ForEachResource(base string, fn ForEachFunc) error {
+	return ForEachResourceFS(DirFS(base), withBase(base, fn))
+}
 
-		return nil
+// ForEachResourceFS is like ForEachResource, but for the dump at the root of fsys. The builders passed to fn have no
+// base path, so their paths are relative to the root of fsys.
+func ForEachResourceFS(fsys fs.FS, fn ForEachFunc) error {
+	return ForEachKindFS(fsys, func(builder ResourcePathBuilder) error {
+		return forEachDir(fsys, builder.BuildKind(), fn, func(name string) (ResourcePathBuilder, bool) {
+			return builder.WithName(name), true
+		})
 	})
 }
 
+// ForEachKind iterates over each kind directory, in each namespace and at the root of the dump for cluster-scoped
+// kinds, and passes the ResourcePathBuilder to fn.
 func ForEachKind(base string, fn ForEachFunc) error {
-	return ForEachNamespace(base, func(builder ResourcePathBuilder) error {
-		dir := builder.BuildNamespace()
-		entries, err := os.ReadDir(dir)
-		if err != nil {
-			return fmt.Errorf("could not read directory '%s': %w", dir, err)
-		}
+	return ForEachKindFS(DirFS(base), withBase(base, fn))
+}
 
-		for _, entry := range entries {
-			if entry.IsDir() {
-				kindBuilder := builder.WithKind(entry.Name())
-				if err := fn(kindBuilder); err != nil {
-					return fmt.Errorf("ForEachFunc failed for namespace '%s': %w", entry.Name(), err)
-				}
-			}
-		}
+// ForEachKindFS is like ForEachKind, but for the dump at the root of fsys.
+func ForEachKindFS(fsys fs.FS, fn ForEachFunc) error {
+	if err := ForEachClusterKindFS(fsys, fn); err != nil {
+		return err
+	}
 
-		return nil
+	return ForEachNamespaceFS(fsys, func(builder ResourcePathBuilder) error {
+		return forEachDir(fsys, builder.BuildNamespace(), fn, func(name string) (ResourcePathBuilder, bool) {
+			return builder.WithKind(name), true
+		})
+	})
+}
+
+// ForEachClusterKind iterates over each cluster-scoped kind directory and passes the ResourcePathBuilder to fn.
+func ForEachClusterKind(base string, fn ForEachFunc) error {
+	return ForEachClusterKindFS(DirFS(base), withBase(base, fn))
+}
+
+// ForEachClusterKindFS is like ForEachClusterKind, but for the dump at the root of fsys.
+func ForEachClusterKindFS(fsys fs.FS, fn ForEachFunc) error {
+	return forEachDir(fsys, ".", fn, func(name string) (ResourcePathBuilder, bool) {
+		return ResourcePathBuilder{}.WithKind(name), isKindDir(name)
 	})
 }
 
 // ForEachNamespace iterates over each namespace directory and passes the ResourcePathBuilder to fn.
 func ForEachNamespace(base string, fn ForEachFunc) error {
-	entries, err := os.ReadDir(base)
-	if err != nil {
-		return fmt.Errorf("could not read directory '%s': %w", base, err)
-	}
-
-	for _, entry := range entries {
-		if entry.IsDir() {
-			builder := ResourcePathBuilder{}.WithBase(base).WithNamespace(entry.Name())
-			if err := fn(builder); err != nil {
-				return fmt.Errorf("ForEachFunc failed for namespace '%s': %w", entry.Name(), err)
-			}
-		}
-	}
+	return ForEachNamespaceFS(DirFS(base), withBase(base, fn))
+}
 
-	return nil
+// ForEachNamespaceFS is like ForEachNamespace, but for the dump at the root of fsys.
+func ForEachNamespaceFS(fsys fs.FS, fn ForEachFunc) error {
+	return forEachDir(fsys, ".", fn, func(name string) (ResourcePathBuilder, bool) {
+		return ResourcePathBuilder{}.WithNamespace(name), !isKindDir(name) && name != IncidentsDirName
+	})
 }
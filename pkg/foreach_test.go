@@ -2,6 +2,7 @@ package kubedump
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -40,3 +41,28 @@ func TestForEachResource(t *testing.T) {
 	require.NoError(t, err)
 	assert.ElementsMatch(t, []string{"Service:default/sample-service", "Pod:default/sample-pod", "ConfigMap:default/sample-configmap", "Secret:default/sample-secret"}, resources)
 }
+
+func TestForEachResourceClusterScoped(t *testing.T) {
+	base := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(base, "default", "Pod", "sample-pod"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(base, "PersistentVolume", "sample-pv"), 0755))
+
+	namespaces := []string{}
+	err := ForEachNamespace(base, func(builder ResourcePathBuilder) error {
+		namespaces = append(namespaces, builder.Namespace)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"default"}, namespaces)
+
+	resources := []string{}
+	err = ForEachResource(base, func(builder ResourcePathBuilder) error {
+		resources = append(resources, builder.Build())
+		return nil
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		filepath.Join(base, "default", "Pod", "sample-pod"),
+		filepath.Join(base, "PersistentVolume", "sample-pv"),
+	}, resources)
+}
@@ -0,0 +1,63 @@
+package kubedump
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"time"
+)
+
+// IncidentsDirName is the directory at the root of a directory dump holding a directory for each incident found by a
+// trigger. The leading underscore keeps it from being mistaken for a namespace or a kind.
+const IncidentsDirName = "_incidents"
+
+// IncidentMarkerFileName is the name of the file holding the IncidentMarker of an incident.
+const IncidentMarkerFileName = "incident.yaml"
+
+// IncidentMarker records when and why a trigger fired, and the resource it fired for.
+type IncidentMarker struct {
+	Trigger   string    `json:"trigger"`
+	Time      time.Time `json:"time"`
+	Reason    string    `json:"reason"`
+	Kind      string    `json:"kind"`
+	Namespace string    `json:"namespace,omitempty"`
+	Name      string    `json:"name"`
+}
+
+// ForEachIncidentFileFS calls fn with each file written for an incident in the dump at the root of fsys. Dumps without
+// any incidents are ignored.
+func ForEachIncidentFileFS(fsys fs.FS, fn func(incident string, name string, data []byte) error) error {
+	incidents, err := fs.ReadDir(fsys, IncidentsDirName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("could not read incidents: %w", err)
+	}
+
+	for _, incident := range incidents {
+		if !incident.IsDir() {
+			continue
+		}
+
+		dir := path.Join(IncidentsDirName, incident.Name())
+
+		err := fs.WalkDir(fsys, dir, func(filePath string, entry fs.DirEntry, err error) error {
+			if err != nil || !entry.Type().IsRegular() {
+				return err
+			}
+
+			data, err := fs.ReadFile(fsys, filePath)
+			if err != nil {
+				return fmt.Errorf("could not read incident file '%s': %w", filePath, err)
+			}
+
+			return fn(incident.Name(), filePath[len(dir)+1:], data)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,570 @@
+package kubedump
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	apicorev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// LinkType describes how a linked resource is referenced by the resource it is linked under.
+type LinkType string
+
+const (
+	LinkTypeOwner           LinkType = "owner"
+	LinkTypeVolume          LinkType = "volume"
+	LinkTypeProjectedVolume LinkType = "projected-volume"
+	LinkTypeCSISecret       LinkType = "csi-secret"
+	LinkTypeEnvFrom         LinkType = "env-from"
+	LinkTypeEnv             LinkType = "env"
+	LinkTypeImagePullSecret LinkType = "image-pull-secret"
+	LinkTypeSelector        LinkType = "selector"
+	LinkTypeEndpoint        LinkType = "endpoint"
+	LinkTypeBackend         LinkType = "backend"
+	LinkTypeNetworkPolicy   LinkType = "network-policy"
+	LinkTypeClaim           LinkType = "claim"
+	LinkTypeEphemeralVolume LinkType = "ephemeral-volume"
+	LinkTypeBoundVolume     LinkType = "bound-volume"
+	LinkTypeStorageClass    LinkType = "storage-class"
+	LinkTypeAttachment      LinkType = "attachment"
+	LinkTypeClaimTemplate   LinkType = "claim-template"
+	LinkTypeServiceAccount  LinkType = "service-account"
+	LinkTypeRoleBinding     LinkType = "role-binding"
+	LinkTypeRoleRef         LinkType = "role-ref"
+	LinkTypeNode            LinkType = "node"
+)
+
+// LinksFileSuffix is the suffix of the file in each resource directory which records the resources linked under it.
+const LinksFileSuffix = ".links"
+
+// errLinkTargetMissing is returned when either side of a link was not found in the dump.
+var errLinkTargetMissing = errors.New("link target does not exist")
+
+// ResourceLink is a relationship between two resources, which is stored as a symlink to the child's resource
+// directory under the parent's resource directory.
+type ResourceLink struct {
+	Parent ResourcePathBuilder
+	Child  ResourcePathBuilder
+	Types  []LinkType
+}
+
+// LinkReference records a linked resource, and how it is referenced, in a resource's links file.
+type LinkReference struct {
+	Kind      string     `json:"kind"`
+	Namespace string     `json:"namespace"`
+	Name      string     `json:"name"`
+	Types     []LinkType `json:"types"`
+}
+
+// linkSet collects links, merging the types of links between the same resources.
+type linkSet struct {
+	links map[string]*ResourceLink
+
+	// changed holds the keys of links which were added or given a new type since the last call to drain.
+	changed []string
+}
+
+func newLinkSet() *linkSet {
+	return &linkSet{links: make(map[string]*ResourceLink)}
+}
+
+func linkKey(parent ResourcePathBuilder, child ResourcePathBuilder) string {
+	return parent.Build() + ":" + child.Build()
+}
+
+func (set *linkSet) add(parent ResourcePathBuilder, child ResourcePathBuilder, linkType LinkType) {
+	key := linkKey(parent, child)
+
+	link, found := set.links[key]
+	if !found {
+		link = &ResourceLink{Parent: parent, Child: child}
+		set.links[key] = link
+	}
+
+	if !slices.Contains(link.Types, linkType) {
+		link.Types = append(link.Types, linkType)
+		set.changed = append(set.changed, key)
+	}
+}
+
+// drain returns the keys of the links which changed since the last call to drain.
+func (set *linkSet) drain() []string {
+	changed := set.changed
+	set.changed = nil
+
+	return changed
+}
+
+// list returns the links in the set sorted by their parent and child paths.
+func (set *linkSet) list() []ResourceLink {
+	keys := make([]string, 0, len(set.links))
+	for key := range set.links {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	links := make([]ResourceLink, 0, len(keys))
+	for _, key := range keys {
+		links = append(links, *set.links[key])
+	}
+
+	return links
+}
+
+// createPathParents ensures that the parent directory for filePath exists.
+// todo: duplicated in pkg/controller/utils.go
+func createPathParents(filePath string) error {
+	dirname := path.Dir(filePath)
+
+	if err := os.MkdirAll(dirname, 0755); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// linkTarget returns the path of the symlink for the link from parent to child, and the relative path it should point
+// to.
+func linkTarget(childBuilder ResourcePathBuilder, parentBuilder ResourcePathBuilder) (string, string, error) {
+	ownerPath := parentBuilder.Build()
+	if _, err := os.Lstat(ownerPath); errors.Is(err, os.ErrNotExist) {
+		return "", "", fmt.Errorf("parent '%s' not found: %w", ownerPath, errLinkTargetMissing)
+	}
+
+	resourcePath := childBuilder.Build()
+	if _, err := os.Lstat(resourcePath); errors.Is(err, os.ErrNotExist) {
+		return "", "", fmt.Errorf("child '%s' not found: %w", resourcePath, errLinkTargetMissing)
+	}
+
+	linkBuilder := childBuilder.
+		WithParentNamespace(parentBuilder.Namespace).
+		WithParentKind(parentBuilder.Kind).
+		WithParentName(parentBuilder.Name)
+	linkDest := linkBuilder.BuildWithParent()
+
+	relative, err := filepath.Rel(path.Dir(linkDest), resourcePath)
+	if err != nil {
+		return "", "", fmt.Errorf("could not get relative path for '%s' and '%s': %w", linkDest, resourcePath, err)
+	}
+
+	return linkDest, relative, nil
+}
+
+func linkToParent(childBuilder ResourcePathBuilder, parentBuilder ResourcePathBuilder) error {
+	linkDest, relative, err := linkTarget(childBuilder, parentBuilder)
+	if err != nil {
+		return err
+	}
+
+	if err := createPathParents(linkDest); err != nil {
+		return fmt.Errorf("could not create parents for '%s': %w", linkDest, err)
+	}
+
+	if err := os.Symlink(relative, linkDest); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("could not create symlink '%s': %w", linkDest, err)
+	}
+
+	return nil
+}
+
+// podLinks adds links from the pod to its Node and ServiceAccount, and each Secret, ConfigMap, and
+// PersistentVolumeClaim it references.
+func (l *linker) podLinks(podPathBuilder ResourcePathBuilder) error {
+	pod := apicorev1.Pod{}
+	if err := l.unmarshal(podPathBuilder, &pod); err != nil {
+		return err
+	}
+
+	link := func(kind string, name string, linkType LinkType) {
+		if name == "" {
+			return
+		}
+
+		l.set.add(podPathBuilder, l.builder(podPathBuilder.Namespace, kind, name), linkType)
+	}
+
+	for _, volume := range pod.Spec.Volumes {
+		src := volume.VolumeSource
+
+		if src.Secret != nil {
+			link("Secret", src.Secret.SecretName, LinkTypeVolume)
+		}
+
+		if src.ConfigMap != nil {
+			link("ConfigMap", src.ConfigMap.Name, LinkTypeVolume)
+		}
+
+		if src.Projected != nil {
+			for _, source := range src.Projected.Sources {
+				if source.Secret != nil {
+					link("Secret", source.Secret.Name, LinkTypeProjectedVolume)
+				}
+
+				if source.ConfigMap != nil {
+					link("ConfigMap", source.ConfigMap.Name, LinkTypeProjectedVolume)
+				}
+			}
+		}
+
+		if src.CSI != nil && src.CSI.NodePublishSecretRef != nil {
+			link("Secret", src.CSI.NodePublishSecretRef.Name, LinkTypeCSISecret)
+		}
+
+		if src.PersistentVolumeClaim != nil {
+			link("PersistentVolumeClaim", src.PersistentVolumeClaim.ClaimName, LinkTypeClaim)
+		}
+
+		// the claim for an ephemeral volume is always named <pod>-<volume>
+		if src.Ephemeral != nil {
+			link("PersistentVolumeClaim", pod.Name+"-"+volume.Name, LinkTypeEphemeralVolume)
+		}
+	}
+
+	containers := slices.Clone(pod.Spec.InitContainers)
+	containers = append(containers, pod.Spec.Containers...)
+	for _, container := range pod.Spec.EphemeralContainers {
+		containers = append(containers, apicorev1.Container(container.EphemeralContainerCommon))
+	}
+
+	for _, container := range containers {
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.SecretRef != nil {
+				link("Secret", envFrom.SecretRef.Name, LinkTypeEnvFrom)
+			}
+
+			if envFrom.ConfigMapRef != nil {
+				link("ConfigMap", envFrom.ConfigMapRef.Name, LinkTypeEnvFrom)
+			}
+		}
+
+		for _, env := range container.Env {
+			if env.ValueFrom == nil {
+				continue
+			}
+
+			if env.ValueFrom.SecretKeyRef != nil {
+				link("Secret", env.ValueFrom.SecretKeyRef.Name, LinkTypeEnv)
+			}
+
+			if env.ValueFrom.ConfigMapKeyRef != nil {
+				link("ConfigMap", env.ValueFrom.ConfigMapKeyRef.Name, LinkTypeEnv)
+			}
+		}
+	}
+
+	for _, secret := range pod.Spec.ImagePullSecrets {
+		link("Secret", secret.Name, LinkTypeImagePullSecret)
+	}
+
+	link("ServiceAccount", podServiceAccount(&pod), LinkTypeServiceAccount)
+
+	l.nodeLinks(podPathBuilder, &pod)
+
+	return nil
+}
+
+func unmarshalResourceFile(builder ResourcePathBuilder, obj any) error {
+	data, err := readResourceFile(builder)
+	if err != nil {
+		return err
+	}
+
+	if err := yaml.Unmarshal(data, obj); err != nil {
+		return fmt.Errorf("could not unmarshal data to suntructured: %w", err)
+	}
+
+	return nil
+}
+
+// indexedKinds are the kinds of resources which other resources may need to look up when linking, or whose links
+// depend on other indexed resources.
+var indexedKinds = []string{
+	"Pod", "PersistentVolumeClaim", "ServiceAccount",
+	"Service", "NetworkPolicy", "StatefulSet", "RoleBinding", "ClusterRoleBinding",
+}
+
+// dependentKinds maps indexed kinds to the kinds of resources whose links are computed by looking them up. Any
+// dependents of a resource must be re-linked when the resource is added or its labels change.
+var dependentKinds = map[string][]string{
+	"Pod":                   {"Service", "NetworkPolicy"},
+	"PersistentVolumeClaim": {"StatefulSet"},
+	"ServiceAccount":        {"RoleBinding", "ClusterRoleBinding"},
+}
+
+// linker computes the links between the resources in a dump.
+type linker struct {
+	base string
+	set  *linkSet
+
+	// index maps each indexed kind to the resources of that kind in each namespace.
+	index map[string]map[string][]Resource
+
+	// read returns the data for the resource at the given path.
+	read func(ResourcePathBuilder) ([]byte, error)
+}
+
+// newLinker creates a linker for the dump at the root of fsys, whose resources are given the base path base.
+func newLinker(fsys fs.FS, base string) *linker {
+	return &linker{
+		base:  base,
+		set:   newLinkSet(),
+		index: make(map[string]map[string][]Resource),
+		read: func(builder ResourcePathBuilder) ([]byte, error) {
+			data, err := fs.ReadFile(fsys, path.Join(builder.WithBase("").Build(), builder.Name+".yaml"))
+			if err != nil {
+				return nil, fmt.Errorf("could not read resource file: %w", err)
+			}
+
+			return data, nil
+		},
+	}
+}
+
+func readResourceFile(builder ResourcePathBuilder) ([]byte, error) {
+	data, err := os.ReadFile(path.Join(builder.Build(), builder.Name+".yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("could not read resource file: %w", err)
+	}
+
+	return data, nil
+}
+
+// builder returns a ResourcePathBuilder for the given resource in the dump.
+func (l *linker) builder(namespace string, kind string, name string) ResourcePathBuilder {
+	return ResourcePathBuilder{}.
+		WithBase(l.base).
+		WithNamespace(namespace).
+		WithKind(kind).
+		WithName(name)
+}
+
+// unmarshal reads the resource at builder into obj.
+func (l *linker) unmarshal(builder ResourcePathBuilder, obj any) error {
+	data, err := l.read(builder)
+	if err != nil {
+		return err
+	}
+
+	if err := yaml.Unmarshal(data, obj); err != nil {
+		return fmt.Errorf("could not unmarshal data to suntructured: %w", err)
+	}
+
+	return nil
+}
+
+// resource reads the resource at builder.
+func (l *linker) resource(builder ResourcePathBuilder) (Resource, error) {
+	u := &unstructured.Unstructured{}
+	if err := l.unmarshal(builder, &u.Object); err != nil {
+		return nil, err
+	}
+
+	return NewResourceBuilder().FromUnstructured(u).Build(), nil
+}
+
+// indexResource records any resources which other resources may need to look up when linking. Returns true if the
+// resource was not already indexed or its labels changed.
+func (l *linker) indexResource(builder ResourcePathBuilder) (bool, error) {
+	if !slices.Contains(indexedKinds, builder.Kind) {
+		return false, nil
+	}
+
+	resource, err := l.resource(builder)
+	if err != nil {
+		return false, fmt.Errorf("could not read resource from file resource: %w", err)
+	}
+
+	if l.index[builder.Kind] == nil {
+		l.index[builder.Kind] = make(map[string][]Resource)
+	}
+
+	indexed := l.index[builder.Kind][builder.Namespace]
+
+	for i, existing := range indexed {
+		if existing.GetName() == resource.GetName() {
+			indexed[i] = resource
+			return !maps.Equal(existing.GetLabels(), resource.GetLabels()), nil
+		}
+	}
+
+	l.index[builder.Kind][builder.Namespace] = append(indexed, resource)
+
+	return true, nil
+}
+
+// unindexResource removes the resource at builder from the index. Returns true if it was indexed.
+func (l *linker) unindexResource(builder ResourcePathBuilder) bool {
+	indexed := l.index[builder.Kind][builder.Namespace]
+
+	for i, existing := range indexed {
+		if existing.GetName() == builder.Name {
+			l.index[builder.Kind][builder.Namespace] = slices.Delete(indexed, i, i+1)
+			return true
+		}
+	}
+
+	return false
+}
+
+// dependents returns the indexed resources whose links may depend on the resource at builder.
+func (l *linker) dependents(builder ResourcePathBuilder) []ResourcePathBuilder {
+	var builders []ResourcePathBuilder
+
+	for _, kind := range dependentKinds[builder.Kind] {
+		for namespace, resources := range l.index[kind] {
+			// only bindings may refer to resources in other namespaces
+			if builder.Kind != "ServiceAccount" && namespace != builder.Namespace {
+				continue
+			}
+
+			for _, resource := range resources {
+				builders = append(builders, l.builder(namespace, kind, resource.GetName()))
+			}
+		}
+	}
+
+	return builders
+}
+
+// linkSelectedPods links the parent to each pod in the namespace matched by selector.
+func (l *linker) linkSelectedPods(parent ResourcePathBuilder, namespace string, selector labels.Selector, linkType LinkType) {
+	for _, pod := range l.index["Pod"][namespace] {
+		if selector.Matches(labels.Set(pod.GetLabels())) {
+			l.set.add(parent, l.builder(namespace, "Pod", pod.GetName()), linkType)
+		}
+	}
+}
+
+// resourceLinks adds the links for the resource at builder.
+func (l *linker) resourceLinks(builder ResourcePathBuilder) error {
+	resource, err := l.resource(builder)
+	if err != nil {
+		return fmt.Errorf("could not read resource from file resource: %w", err)
+	}
+
+	var linkFn func(ResourcePathBuilder) error
+
+	switch resource.GetKind() {
+	case "Pod":
+		linkFn = l.podLinks
+	case "Service":
+		linkFn = l.serviceLinks
+	case "Endpoints":
+		linkFn = l.endpointsLinks
+	case "EndpointSlice":
+		linkFn = l.endpointSliceLinks
+	case "Ingress":
+		linkFn = l.ingressLinks
+	case "NetworkPolicy":
+		linkFn = l.networkPolicyLinks
+	case "PersistentVolumeClaim":
+		linkFn = l.persistentVolumeClaimLinks
+	case "PersistentVolume":
+		linkFn = l.persistentVolumeLinks
+	case "VolumeAttachment":
+		linkFn = l.volumeAttachmentLinks
+	case "StatefulSet":
+		linkFn = l.statefulSetLinks
+	case "RoleBinding", "ClusterRoleBinding":
+		linkFn = l.bindingLinks
+	}
+
+	if linkFn != nil {
+		if err := linkFn(builder); err != nil {
+			return fmt.Errorf("could not link %s '%s': %w", resource.GetKind(), resource.GetName(), err)
+		}
+	}
+
+	for _, owner := range resource.GetOwnershipReferences() {
+		l.set.add(l.builder(builder.Namespace, owner.Kind, owner.Name), builder, LinkTypeOwner)
+	}
+
+	return nil
+}
+
+// writeLinksFiles records the links under each parent resource in the parent's links file.
+func writeLinksFiles(links []ResourceLink) error {
+	references := make(map[ResourcePathBuilder][]LinkReference)
+
+	for _, link := range links {
+		references[link.Parent] = append(references[link.Parent], LinkReference{
+			Kind:      link.Child.Kind,
+			Namespace: link.Child.Namespace,
+			Name:      link.Child.Name,
+			Types:     link.Types,
+		})
+	}
+
+	for parent, refs := range references {
+		data, err := yaml.Marshal(refs)
+		if err != nil {
+			return fmt.Errorf("could not marshal links for '%s': %w", parent.Name, err)
+		}
+
+		linksFile := path.Join(parent.Build(), parent.Name+LinksFileSuffix)
+		if err := os.WriteFile(linksFile, data, 0644); err != nil {
+			return fmt.Errorf("could not write links file '%s': %w", linksFile, err)
+		}
+	}
+
+	return nil
+}
+
+// ComputeLinks finds the links between each resource in the dump at base. Links whose parent or child was not dumped
+// are included.
+func ComputeLinks(base string) ([]ResourceLink, error) {
+	return computeLinks(DirFS(base), base)
+}
+
+// ComputeLinksFS is like ComputeLinks, but for the dump at the root of fsys. The returned links have no base path.
+func ComputeLinksFS(fsys fs.FS) ([]ResourceLink, error) {
+	return computeLinks(fsys, "")
+}
+
+func computeLinks(fsys fs.FS, base string) ([]ResourceLink, error) {
+	l := newLinker(fsys, base)
+	forEach := withResourceFile(fsys, withBase(base, func(builder ResourcePathBuilder) error {
+		_, err := l.indexResource(builder)
+		return err
+	}))
+
+	if err := ForEachResourceFS(fsys, forEach); err != nil {
+		return nil, err
+	}
+
+	forEach = withResourceFile(fsys, withBase(base, func(builder ResourcePathBuilder) error {
+		if err := l.resourceLinks(builder); err != nil {
+			return fmt.Errorf("could not link resource '%s': %w", builder.Name, err)
+		}
+
+		return nil
+	}))
+
+	if err := ForEachResourceFS(fsys, forEach); err != nil {
+		return nil, err
+	}
+
+	return l.set.list(), nil
+}
+
+// withResourceFile passes builders to fn only if the resource has a description in fsys, skipping the directories which
+// only hold the events of a resource which was not dumped.
+func withResourceFile(fsys fs.FS, fn ForEachFunc) ForEachFunc {
+	return func(builder ResourcePathBuilder) error {
+		if _, err := fs.Stat(fsys, path.Join(builder.Build(), builder.Name+".yaml")); errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+
+		return fn(builder)
+	}
+}
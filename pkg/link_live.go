@@ -0,0 +1,321 @@
+package kubedump
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// LiveLinker maintains the links between resources while they are being dumped. Links are recorded in the sink as soon
+// as both the parent and child have been dumped, and any link waiting on a resource which has not been dumped yet is
+// recorded once it is.
+//
+// Each link is computed from a single resource, its source, like a Service selecting a Pod or a Pod referencing its
+// owner. The links of a source are recomputed each time it is updated, replacing the links it computed before, so that
+// the recorded links match those `kubedump link` would write for the same resources.
+type LiveLinker struct {
+	linker *linker
+	sink   Sink
+
+	// seen holds the paths of the resources which have been dumped and not deleted.
+	seen map[string]bool
+
+	// objects holds the data of each indexed resource, so resources are never read from files which may be partially
+	// written.
+	objects map[string][]byte
+
+	// contributions maps the path of each source to the links it computed, keyed by link key.
+	contributions map[string]map[string]ResourceLink
+
+	// sources maps each link key to the paths of the sources which computed it.
+	sources map[string]map[string]bool
+
+	// links holds the current links, with the types computed by every source merged, keyed by link key.
+	links map[string]*ResourceLink
+
+	// byParent and byChild map the path of a resource to the keys of the links it is the parent or child of.
+	byParent map[string]map[string]bool
+	byChild  map[string]map[string]bool
+
+	mu sync.Mutex
+}
+
+// NewLiveLinker creates a LiveLinker recording links in sink.
+func NewLiveLinker(sink Sink) *LiveLinker {
+	liveLinker := &LiveLinker{
+		linker:        newLinker(nil, ""),
+		sink:          sink,
+		seen:          make(map[string]bool),
+		objects:       make(map[string][]byte),
+		contributions: make(map[string]map[string]ResourceLink),
+		sources:       make(map[string]map[string]bool),
+		links:         make(map[string]*ResourceLink),
+		byParent:      make(map[string]map[string]bool),
+		byChild:       make(map[string]map[string]bool),
+	}
+
+	liveLinker.linker.read = liveLinker.read
+
+	return liveLinker
+}
+
+func (l *LiveLinker) read(builder ResourcePathBuilder) ([]byte, error) {
+	data, found := l.objects[builder.Build()]
+	if !found {
+		return nil, fmt.Errorf("resource '%s' has not been seen: %w", builder.Build(), os.ErrNotExist)
+	}
+
+	return data, nil
+}
+
+// Update links the given resource, which must already have been written to the sink, to any related resources. The
+// links previously computed from the resource are replaced, and any links which were waiting on the resource are also
+// recorded.
+func (l *LiveLinker) Update(u *unstructured.Unstructured) error {
+	data, err := yaml.Marshal(u)
+	if err != nil {
+		return fmt.Errorf("could not marshal %s: %w", u.GetKind(), err)
+	}
+
+	builder := l.linker.builder(u.GetNamespace(), u.GetKind(), u.GetName())
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	first := !l.seen[builder.Build()]
+
+	l.seen[builder.Build()] = true
+	l.objects[builder.Build()] = data
+	if !slices.Contains(indexedKinds, builder.Kind) {
+		defer delete(l.objects, builder.Build())
+	}
+
+	changed, err := l.linker.indexResource(builder)
+	if err != nil {
+		return fmt.Errorf("could not index resource: %w", err)
+	}
+
+	builders := []ResourcePathBuilder{builder}
+	if changed {
+		builders = append(builders, l.linker.dependents(builder)...)
+	}
+
+	affected := make(map[string]ResourcePathBuilder)
+
+	for _, b := range builders {
+		if err := l.relink(b, affected); err != nil {
+			return err
+		}
+	}
+
+	// the links waiting on the resource can now be recorded
+	if first {
+		l.affectLinksOf(builder, affected)
+	}
+
+	return l.record(affected)
+}
+
+// Delete forgets the resource at builder, which was deleted from the cluster. The links computed from it are dropped,
+// and the links to it are removed from their parents. The links already recorded under the resource are left as they
+// were, since they describe its last revision.
+func (l *LiveLinker) Delete(builder ResourcePathBuilder) error {
+	builder = l.linker.builder(builder.Namespace, builder.Kind, builder.Name)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.seen[builder.Build()] {
+		return nil
+	}
+
+	delete(l.seen, builder.Build())
+	delete(l.objects, builder.Build())
+
+	affected := make(map[string]ResourcePathBuilder)
+
+	l.contribute(builder.Build(), nil, affected)
+
+	if l.linker.unindexResource(builder) {
+		for _, dependent := range l.linker.dependents(builder) {
+			if err := l.relink(dependent, affected); err != nil {
+				return err
+			}
+		}
+	}
+
+	l.affectLinksOf(builder, affected)
+	delete(affected, builder.Build())
+
+	return l.record(affected)
+}
+
+// relink recomputes the links of the resource at builder, adding the parents of any links which changed to affected.
+func (l *LiveLinker) relink(builder ResourcePathBuilder, affected map[string]ResourcePathBuilder) error {
+	l.linker.set = newLinkSet()
+
+	if err := l.linker.resourceLinks(builder); err != nil {
+		return fmt.Errorf("could not link resource '%s': %w", builder.Name, err)
+	}
+
+	links := make(map[string]ResourceLink, len(l.linker.set.links))
+	for key, link := range l.linker.set.links {
+		links[key] = *link
+	}
+
+	l.contribute(builder.Build(), links, affected)
+
+	return nil
+}
+
+// contribute replaces the links computed by source, adding the parents of any links which changed to affected.
+func (l *LiveLinker) contribute(source string, links map[string]ResourceLink, affected map[string]ResourcePathBuilder) {
+	previous := l.contributions[source]
+
+	if len(links) == 0 {
+		delete(l.contributions, source)
+	} else {
+		l.contributions[source] = links
+	}
+
+	for key, link := range previous {
+		if _, found := links[key]; !found {
+			delete(l.sources[key], source)
+			l.merge(key, link, affected)
+		}
+	}
+
+	for key, link := range links {
+		if l.sources[key] == nil {
+			l.sources[key] = make(map[string]bool)
+		}
+
+		l.sources[key][source] = true
+		l.merge(key, link, affected)
+	}
+}
+
+// merge recomputes the link with the given key from the links computed by each of its sources, adding its parent to
+// affected if it changed.
+func (l *LiveLinker) merge(key string, link ResourceLink, affected map[string]ResourcePathBuilder) {
+	sources := make([]string, 0, len(l.sources[key]))
+	for source := range l.sources[key] {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	var types []LinkType
+	for _, source := range sources {
+		for _, linkType := range l.contributions[source][key].Types {
+			if !slices.Contains(types, linkType) {
+				types = append(types, linkType)
+			}
+		}
+	}
+
+	parent, child := link.Parent.Build(), link.Child.Build()
+	current, found := l.links[key]
+
+	switch {
+	case len(types) == 0 && !found:
+		return
+	case len(types) == 0:
+		delete(l.links, key)
+		delete(l.sources, key)
+		delete(l.byParent[parent], key)
+		delete(l.byChild[child], key)
+
+		if len(l.byParent[parent]) == 0 {
+			delete(l.byParent, parent)
+		}
+
+		if len(l.byChild[child]) == 0 {
+			delete(l.byChild, child)
+		}
+	case found && slices.Equal(current.Types, types):
+		return
+	default:
+		l.links[key] = &ResourceLink{Parent: link.Parent, Child: link.Child, Types: types}
+
+		if l.byParent[parent] == nil {
+			l.byParent[parent] = make(map[string]bool)
+		}
+		l.byParent[parent][key] = true
+
+		if l.byChild[child] == nil {
+			l.byChild[child] = make(map[string]bool)
+		}
+		l.byChild[child][key] = true
+	}
+
+	affected[parent] = link.Parent
+}
+
+// affectLinksOf adds the resource at builder, and the parents of the links to it, to affected.
+func (l *LiveLinker) affectLinksOf(builder ResourcePathBuilder, affected map[string]ResourcePathBuilder) {
+	affected[builder.Build()] = builder
+
+	for key := range l.byChild[builder.Build()] {
+		parent := l.links[key].Parent
+		affected[parent.Build()] = parent
+	}
+}
+
+// record replaces the links recorded in the sink for each of the affected parents which have been dumped with their
+// links to the children which have been dumped.
+func (l *LiveLinker) record(affected map[string]ResourcePathBuilder) error {
+	parents := make([]string, 0, len(affected))
+	for parent := range affected {
+		if l.seen[parent] {
+			parents = append(parents, parent)
+		}
+	}
+	sort.Strings(parents)
+
+	for _, parent := range parents {
+		keys := make([]string, 0, len(l.byParent[parent]))
+		for key := range l.byParent[parent] {
+			if l.seen[l.links[key].Child.Build()] {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		links := make([]ResourceLink, 0, len(keys))
+		for _, key := range keys {
+			links = append(links, *l.links[key])
+		}
+
+		if err := l.sink.RecordLinks(affected[parent], links); err != nil {
+			return fmt.Errorf("could not record links for '%s': %w", parent, err)
+		}
+	}
+
+	return nil
+}
+
+// Pending returns the links which are waiting on a resource which has not been dumped yet.
+func (l *LiveLinker) Pending() []ResourceLink {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	keys := make([]string, 0)
+	for key, link := range l.links {
+		if !l.seen[link.Parent.Build()] || !l.seen[link.Child.Build()] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	links := make([]ResourceLink, 0, len(keys))
+	for _, key := range keys {
+		links = append(links, *l.links[key])
+	}
+
+	return links
+}
@@ -0,0 +1,168 @@
+package kubedump
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiappsv1 "k8s.io/api/apps/v1"
+	apicorev1 "k8s.io/api/core/v1"
+	apimetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+// dumpAndUpdate writes obj to the dump at base and passes it to the linker, as the controller would.
+func dumpAndUpdate(t *testing.T, linker *LiveLinker, base string, obj runtime.Object) ResourcePathBuilder {
+	builder := writeTestResource(t, base, obj)
+
+	m, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	require.NoError(t, err)
+
+	require.NoError(t, linker.Update(&unstructured.Unstructured{Object: m}))
+
+	return builder
+}
+
+func TestLiveLinker(t *testing.T) {
+	base := t.TempDir()
+	linker := NewLiveLinker(NewDirSink(base))
+
+	service := dumpAndUpdate(t, linker, base, &apicorev1.Service{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       apicorev1.ServiceSpec{Selector: map[string]string{"app": "web"}},
+	})
+
+	pod := dumpAndUpdate(t, linker, base, &apicorev1.Pod{
+		TypeMeta: apimetav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: apimetav1.ObjectMeta{
+			Name:            "web-abc-xyz",
+			Namespace:       "default",
+			Labels:          map[string]string{"app": "web"},
+			OwnerReferences: []apimetav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web-abc"}},
+		},
+		Spec: apicorev1.PodSpec{ServiceAccountName: "web"},
+	})
+
+	// the service was dumped before the pod, but is linked once the pod is seen
+	assert.FileExists(t, path.Join(service.Build(), "Pod", pod.Name, pod.Name+".yaml"))
+
+	// the owner and service account have not been seen yet
+	pending := map[string][]LinkType{}
+	for _, link := range linker.Pending() {
+		pending[link.Parent.Kind+"/"+link.Parent.Name+"->"+link.Child.Kind+"/"+link.Child.Name] = link.Types
+	}
+	assert.Equal(t, map[string][]LinkType{
+		"ReplicaSet/web-abc->Pod/web-abc-xyz": {LinkTypeOwner},
+		"Pod/web-abc-xyz->ServiceAccount/web": {LinkTypeServiceAccount},
+	}, pending)
+
+	replicaSet := dumpAndUpdate(t, linker, base, &apiappsv1.ReplicaSet{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "apps/v1", Kind: "ReplicaSet"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "web-abc", Namespace: "default"},
+	})
+
+	assert.FileExists(t, path.Join(replicaSet.Build(), "Pod", pod.Name, pod.Name+".yaml"))
+	assert.Len(t, linker.Pending(), 1)
+
+	_ = dumpAndUpdate(t, linker, base, &apicorev1.ServiceAccount{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "web", Namespace: "default"},
+	})
+
+	assert.FileExists(t, path.Join(pod.Build(), "ServiceAccount", "web", "web.yaml"))
+	assert.Empty(t, linker.Pending())
+
+	data, err := os.ReadFile(path.Join(pod.Build(), pod.Name+LinksFileSuffix))
+	require.NoError(t, err)
+
+	var references []LinkReference
+	require.NoError(t, yaml.Unmarshal(data, &references))
+	assert.Equal(t, []LinkReference{
+		{Kind: "ServiceAccount", Namespace: "default", Name: "web", Types: []LinkType{LinkTypeServiceAccount}},
+	}, references)
+
+	// updating a resource does not duplicate its links
+	_ = dumpAndUpdate(t, linker, base, &apicorev1.Service{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       apicorev1.ServiceSpec{Selector: map[string]string{"app": "web"}},
+	})
+
+	data, err = os.ReadFile(path.Join(service.Build(), service.Name+LinksFileSuffix))
+	require.NoError(t, err)
+
+	references = nil
+	require.NoError(t, yaml.Unmarshal(data, &references))
+	assert.Len(t, references, 1)
+}
+
+func TestLiveLinkerReplacesLinks(t *testing.T) {
+	base := t.TempDir()
+	linker := NewLiveLinker(NewDirSink(base))
+
+	newService := func(selector map[string]string) *apicorev1.Service {
+		return &apicorev1.Service{
+			TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+			ObjectMeta: apimetav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec:       apicorev1.ServiceSpec{Selector: selector},
+		}
+	}
+
+	newPod := func(name string, app string) *apicorev1.Pod {
+		return &apicorev1.Pod{
+			TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+			ObjectMeta: apimetav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": app}},
+		}
+	}
+
+	service := dumpAndUpdate(t, linker, base, newService(map[string]string{"app": "web"}))
+	_ = dumpAndUpdate(t, linker, base, newPod("web-1", "web"))
+	_ = dumpAndUpdate(t, linker, base, newPod("web-2", "web"))
+
+	linksFile := path.Join(service.Build(), service.Name+LinksFileSuffix)
+	children := func() []string {
+		references, err := readLinksFile(linksFile)
+		require.NoError(t, err)
+
+		names := []string{}
+		for _, reference := range references {
+			names = append(names, reference.Name)
+		}
+
+		return names
+	}
+
+	assert.Equal(t, []string{"web-1", "web-2"}, children())
+
+	// relabeling a pod removes it from the service
+	_ = dumpAndUpdate(t, linker, base, newPod("web-1", "other"))
+	assert.Equal(t, []string{"web-2"}, children())
+	assert.NoDirExists(t, path.Join(service.Build(), "Pod", "web-1"))
+
+	// changing the selector replaces the selected pods
+	_ = dumpAndUpdate(t, linker, base, newService(map[string]string{"app": "other"}))
+	assert.Equal(t, []string{"web-1"}, children())
+	assert.NoDirExists(t, path.Join(service.Build(), "Pod", "web-2"))
+
+	// deleting a pod removes the links to it and forgets it
+	require.NoError(t, linker.Delete(ResourcePathBuilder{}.WithNamespace("default").WithKind("Pod").WithName("web-1")))
+	assert.NoFileExists(t, linksFile)
+	assert.NoDirExists(t, path.Join(service.Build(), "Pod"))
+	for _, link := range linker.Pending() {
+		assert.NotEqual(t, "web-1", link.Parent.Name)
+		assert.NotEqual(t, "web-1", link.Child.Name)
+	}
+	assert.NotContains(t, linker.seen, "default/Pod/web-1")
+	assert.NotContains(t, linker.objects, "default/Pod/web-1")
+	assert.NotContains(t, linker.byChild, "default/Pod/web-1")
+	assert.Len(t, linker.linker.index["Pod"]["default"], 1)
+
+	// a pod created again with the same name is linked again
+	_ = dumpAndUpdate(t, linker, base, newPod("web-1", "other"))
+	assert.Equal(t, []string{"web-1"}, children())
+}
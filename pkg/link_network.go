@@ -0,0 +1,125 @@
+package kubedump
+
+import (
+	"fmt"
+
+	apicorev1 "k8s.io/api/core/v1"
+	apidiscoveryv1 "k8s.io/api/discovery/v1"
+	apinetworkingv1 "k8s.io/api/networking/v1"
+	apimetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// serviceLinks adds links from the service to each pod matched by its selector. Services without a selector have
+// their endpoints managed externally, and are not linked to any pods.
+func (l *linker) serviceLinks(builder ResourcePathBuilder) error {
+	service := apicorev1.Service{}
+	if err := l.unmarshal(builder, &service); err != nil {
+		return err
+	}
+
+	if len(service.Spec.Selector) == 0 {
+		return nil
+	}
+
+	l.linkSelectedPods(builder, builder.Namespace, labels.SelectorFromSet(service.Spec.Selector), LinkTypeSelector)
+
+	return nil
+}
+
+// linkTargetRef links the parent to the pod referenced by ref, if any.
+func (l *linker) linkTargetRef(parent ResourcePathBuilder, ref *apicorev1.ObjectReference) {
+	if ref == nil || ref.Kind != "Pod" || ref.Name == "" {
+		return
+	}
+
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = parent.Namespace
+	}
+
+	l.set.add(parent, l.builder(namespace, "Pod", ref.Name), LinkTypeEndpoint)
+}
+
+// endpointsLinks adds links from the endpoints to each pod targeted by its addresses.
+func (l *linker) endpointsLinks(builder ResourcePathBuilder) error {
+	endpoints := apicorev1.Endpoints{}
+	if err := l.unmarshal(builder, &endpoints); err != nil {
+		return err
+	}
+
+	for _, subset := range endpoints.Subsets {
+		for _, address := range append(subset.Addresses, subset.NotReadyAddresses...) {
+			l.linkTargetRef(builder, address.TargetRef)
+		}
+	}
+
+	return nil
+}
+
+// endpointSliceLinks adds links from the endpoint slice to each pod targeted by its endpoints.
+func (l *linker) endpointSliceLinks(builder ResourcePathBuilder) error {
+	slice := apidiscoveryv1.EndpointSlice{}
+	if err := l.unmarshal(builder, &slice); err != nil {
+		return err
+	}
+
+	for _, endpoint := range slice.Endpoints {
+		l.linkTargetRef(builder, endpoint.TargetRef)
+	}
+
+	return nil
+}
+
+// ingressLinks adds links from the ingress to each service used as a backend. The pods behind each backend are reached
+// through the service's own links.
+func (l *linker) ingressLinks(builder ResourcePathBuilder) error {
+	ingress := apinetworkingv1.Ingress{}
+	if err := l.unmarshal(builder, &ingress); err != nil {
+		return err
+	}
+
+	backends := make([]apinetworkingv1.IngressBackend, 0)
+
+	if ingress.Spec.DefaultBackend != nil {
+		backends = append(backends, *ingress.Spec.DefaultBackend)
+	}
+
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+
+		for _, path := range rule.HTTP.Paths {
+			backends = append(backends, path.Backend)
+		}
+	}
+
+	for _, backend := range backends {
+		if backend.Service == nil || backend.Service.Name == "" {
+			continue
+		}
+
+		l.set.add(builder, l.builder(builder.Namespace, "Service", backend.Service.Name), LinkTypeBackend)
+	}
+
+	return nil
+}
+
+// networkPolicyLinks adds links from the network policy to each pod it selects. An empty pod selector selects every
+// pod in the policy's namespace.
+func (l *linker) networkPolicyLinks(builder ResourcePathBuilder) error {
+	policy := apinetworkingv1.NetworkPolicy{}
+	if err := l.unmarshal(builder, &policy); err != nil {
+		return err
+	}
+
+	selector, err := apimetav1.LabelSelectorAsSelector(&policy.Spec.PodSelector)
+	if err != nil {
+		return fmt.Errorf("could not parse pod selector: %w", err)
+	}
+
+	l.linkSelectedPods(builder, builder.Namespace, selector, LinkTypeNetworkPolicy)
+
+	return nil
+}
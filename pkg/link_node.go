@@ -0,0 +1,152 @@
+package kubedump
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"sort"
+
+	apicorev1 "k8s.io/api/core/v1"
+	apimetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// NodePodsFileSuffix is the suffix of the file in each Node directory which lists the pods observed on the node.
+	NodePodsFileSuffix = ".pods"
+
+	// NodeConditionsFileSuffix is the suffix of the file in each Node directory which lists each transition of the
+	// node's conditions observed when linking, in the order they happened.
+	NodeConditionsFileSuffix = ".conditions"
+)
+
+// ScheduledPod is a pod which was observed on a node.
+type ScheduledPod struct {
+	Namespace string             `json:"namespace"`
+	Name      string             `json:"name"`
+	UID       types.UID          `json:"uid,omitempty"`
+	Phase     apicorev1.PodPhase `json:"phase,omitempty"`
+	StartTime *apimetav1.Time    `json:"startTime,omitempty"`
+}
+
+// nodeLinks adds a link from the pod to the node it was scheduled to.
+func (l *linker) nodeLinks(podPathBuilder ResourcePathBuilder, pod *apicorev1.Pod) {
+	if pod.Spec.NodeName == "" {
+		return
+	}
+
+	l.set.add(podPathBuilder, l.builder("", "Node", pod.Spec.NodeName), LinkTypeNode)
+}
+
+// ComputeNodePods finds the pods observed on each node by following the node links in links.
+func ComputeNodePods(links []ResourceLink) (map[ResourcePathBuilder][]ScheduledPod, error) {
+	scheduled := make(map[ResourcePathBuilder][]ScheduledPod)
+
+	for _, link := range links {
+		if link.Parent.Kind != "Pod" || link.Child.Kind != "Node" {
+			continue
+		}
+
+		pod := apicorev1.Pod{}
+		if err := unmarshalResourceFile(link.Parent, &pod); err != nil {
+			return nil, fmt.Errorf("could not read pod '%s': %w", link.Parent.Name, err)
+		}
+
+		scheduled[link.Child] = append(scheduled[link.Child], ScheduledPod{
+			Namespace: pod.Namespace,
+			Name:      pod.Name,
+			UID:       pod.UID,
+			Phase:     pod.Status.Phase,
+			StartTime: pod.Status.StartTime,
+		})
+	}
+
+	return scheduled, nil
+}
+
+// nodeConditions returns each transition of the conditions of the node at builder, ordered by when it happened. A
+// directory dump only holds the latest revision of the node, so the transitions recorded in its conditions file by an
+// earlier run are kept, and only the transitions seen by some run are recorded.
+func nodeConditions(builder ResourcePathBuilder) ([]apicorev1.NodeCondition, error) {
+	node := apicorev1.Node{}
+	if err := unmarshalResourceFile(builder, &node); err != nil {
+		return nil, err
+	}
+
+	conditionsFile := path.Join(builder.Build(), builder.Name+NodeConditionsFileSuffix)
+
+	var conditions []apicorev1.NodeCondition
+	if data, err := os.ReadFile(conditionsFile); err == nil {
+		if err := yaml.Unmarshal(data, &conditions); err != nil {
+			return nil, fmt.Errorf("could not unmarshal conditions file '%s': %w", conditionsFile, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("could not read conditions file '%s': %w", conditionsFile, err)
+	}
+
+	for _, condition := range node.Status.Conditions {
+		recorded := slices.ContainsFunc(conditions, func(other apicorev1.NodeCondition) bool {
+			return other.Type == condition.Type && other.Status == condition.Status && other.LastTransitionTime.Equal(&condition.LastTransitionTime)
+		})
+
+		if !recorded {
+			conditions = append(conditions, condition)
+		}
+	}
+
+	sort.SliceStable(conditions, func(i, j int) bool {
+		return conditions[i].LastTransitionTime.Before(&conditions[j].LastTransitionTime)
+	})
+
+	if conditions == nil {
+		conditions = []apicorev1.NodeCondition{}
+	}
+
+	return conditions, nil
+}
+
+// writeNodeFiles writes the pods and conditions files for each node in the dump at base.
+func writeNodeFiles(base string, links []ResourceLink) error {
+	scheduled, err := ComputeNodePods(links)
+	if err != nil {
+		return err
+	}
+
+	return ForEachResource(base, func(builder ResourcePathBuilder) error {
+		if builder.Kind != "Node" {
+			return nil
+		}
+
+		conditions, err := nodeConditions(builder)
+		if err != nil {
+			return fmt.Errorf("could not read node '%s': %w", builder.Name, err)
+		}
+
+		pods := scheduled[builder]
+		if pods == nil {
+			pods = []ScheduledPod{}
+		}
+
+		if err := writeYamlFile(path.Join(builder.Build(), builder.Name+NodePodsFileSuffix), pods); err != nil {
+			return err
+		}
+
+		return writeYamlFile(path.Join(builder.Build(), builder.Name+NodeConditionsFileSuffix), conditions)
+	})
+}
+
+func writeYamlFile(filePath string, obj any) error {
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		return fmt.Errorf("could not marshal data for '%s': %w", filePath, err)
+	}
+
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		return fmt.Errorf("could not write file '%s': %w", filePath, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package kubedump
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+
+	apicorev1 "k8s.io/api/core/v1"
+	apirbacv1 "k8s.io/api/rbac/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// RulesFileSuffix is the suffix of the file in each ServiceAccount directory which records the rules granted to it.
+const RulesFileSuffix = ".rules"
+
+// GrantedRules are the rules granted to a ServiceAccount by a single role binding.
+type GrantedRules struct {
+	// Namespace is the namespace the rules apply to, or empty if they apply to the whole cluster.
+	Namespace string `json:"namespace,omitempty"`
+
+	Binding string `json:"binding"`
+	Role    string `json:"role"`
+
+	// RoleMissing is true if the bound role was not found in the dump, in which case Rules will be empty.
+	RoleMissing bool `json:"roleMissing,omitempty"`
+
+	Rules []apirbacv1.PolicyRule `json:"rules"`
+}
+
+// podServiceAccount returns the name of the ServiceAccount the pod runs as.
+func podServiceAccount(pod *apicorev1.Pod) string {
+	switch {
+	case pod.Spec.ServiceAccountName != "":
+		return pod.Spec.ServiceAccountName
+	case pod.Spec.DeprecatedServiceAccount != "":
+		return pod.Spec.DeprecatedServiceAccount
+	default:
+		return "default"
+	}
+}
+
+// subjectMatchesServiceAccount returns true if the subject of a binding in bindingNamespace refers to the given
+// ServiceAccount, either directly or through its user or one of its groups.
+func subjectMatchesServiceAccount(subject apirbacv1.Subject, bindingNamespace string, namespace string, name string) bool {
+	switch subject.Kind {
+	case apirbacv1.ServiceAccountKind:
+		subjectNamespace := subject.Namespace
+		if subjectNamespace == "" {
+			subjectNamespace = bindingNamespace
+		}
+
+		return subjectNamespace == namespace && subject.Name == name
+	case apirbacv1.UserKind:
+		return subject.Name == "system:serviceaccount:"+namespace+":"+name
+	case apirbacv1.GroupKind:
+		return slices.Contains([]string{"system:serviceaccounts", "system:serviceaccounts:" + namespace, "system:authenticated"}, subject.Name)
+	default:
+		return false
+	}
+}
+
+// bindingLinks adds a link from the binding to the role it binds, and from each ServiceAccount in its subjects to the
+// binding.
+func (l *linker) bindingLinks(builder ResourcePathBuilder) error {
+	// RoleBindings and ClusterRoleBindings share the same subjects and roleRef fields
+	binding := apirbacv1.RoleBinding{}
+	if err := l.unmarshal(builder, &binding); err != nil {
+		return err
+	}
+
+	roleNamespace := builder.Namespace
+	if binding.RoleRef.Kind == "ClusterRole" {
+		roleNamespace = ""
+	}
+
+	l.set.add(builder, l.builder(roleNamespace, binding.RoleRef.Kind, binding.RoleRef.Name), LinkTypeRoleRef)
+
+	for namespace, accounts := range l.index["ServiceAccount"] {
+		for _, account := range accounts {
+			for _, subject := range binding.Subjects {
+				if subjectMatchesServiceAccount(subject, builder.Namespace, namespace, account.GetName()) {
+					l.set.add(l.builder(namespace, "ServiceAccount", account.GetName()), builder, LinkTypeRoleBinding)
+					break
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// ComputeServiceAccountRules finds the rules granted to each ServiceAccount in the dump at base by following the role
+// binding links in links. Every dumped ServiceAccount is included, even if no rules are granted to it.
+func ComputeServiceAccountRules(base string, links []ResourceLink) (map[ResourcePathBuilder][]GrantedRules, error) {
+	granted := make(map[ResourcePathBuilder][]GrantedRules)
+
+	if err := ForEachResource(base, func(builder ResourcePathBuilder) error {
+		if builder.Kind == "ServiceAccount" {
+			granted[builder] = []GrantedRules{}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	roles := make(map[ResourcePathBuilder]ResourcePathBuilder)
+	for _, link := range links {
+		if slices.Contains(link.Types, LinkTypeRoleRef) {
+			roles[link.Parent] = link.Child
+		}
+	}
+
+	for _, link := range links {
+		if link.Parent.Kind != "ServiceAccount" || !slices.Contains(link.Types, LinkTypeRoleBinding) {
+			continue
+		}
+
+		binding := link.Child
+		role, found := roles[binding]
+		if !found {
+			continue
+		}
+
+		rules := GrantedRules{
+			Namespace: binding.Namespace,
+			Binding:   binding.Kind + "/" + binding.Name,
+			Role:      role.Kind + "/" + role.Name,
+		}
+
+		// Roles and ClusterRoles share the same rules field
+		obj := apirbacv1.Role{}
+		if err := unmarshalResourceFile(role, &obj); errors.Is(err, os.ErrNotExist) {
+			rules.RoleMissing = true
+		} else if err != nil {
+			return nil, fmt.Errorf("could not read %s '%s': %w", role.Kind, role.Name, err)
+		} else {
+			rules.Rules = obj.Rules
+		}
+
+		granted[link.Parent] = append(granted[link.Parent], rules)
+	}
+
+	return granted, nil
+}
+
+// writeRulesFiles records the rules granted to each ServiceAccount in its rules file.
+func writeRulesFiles(granted map[ResourcePathBuilder][]GrantedRules) error {
+	for account, rules := range granted {
+		if _, err := os.Stat(account.Build()); os.IsNotExist(err) {
+			continue
+		}
+
+		data, err := yaml.Marshal(rules)
+		if err != nil {
+			return fmt.Errorf("could not marshal rules for '%s': %w", account.Name, err)
+		}
+
+		rulesFile := path.Join(account.Build(), account.Name+RulesFileSuffix)
+		if err := os.WriteFile(rulesFile, data, 0644); err != nil {
+			return fmt.Errorf("could not write rules file '%s': %w", rulesFile, err)
+		}
+	}
+
+	return nil
+}
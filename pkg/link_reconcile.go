@@ -0,0 +1,231 @@
+package kubedump
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+// LinkAction is the change made to a path in the dump when linking.
+type LinkAction string
+
+const (
+	LinkActionCreate LinkAction = "create"
+	LinkActionUpdate LinkAction = "update"
+	LinkActionDelete LinkAction = "delete"
+)
+
+// LinkChange is a single change made to the dump when linking. Target is the relative path a created or updated
+// symlink points to, and is empty for deletions.
+type LinkChange struct {
+	Action LinkAction
+	Path   string
+	Target string
+}
+
+func (change LinkChange) String() string {
+	if change.Target == "" {
+		return fmt.Sprintf("%s %s", change.Action, change.Path)
+	}
+
+	return fmt.Sprintf("%s %s -> %s", change.Action, change.Path, change.Target)
+}
+
+// LinkOptions configures how LinkDump links a dump.
+type LinkOptions struct {
+	// Reconcile makes the existing links match the computed links: symlinks pointing to the wrong target are replaced,
+	// and symlinks and links files which are no longer expected are removed. Otherwise, existing links are left as is.
+	Reconcile bool
+
+	// DryRun computes the changes without making them.
+	DryRun bool
+}
+
+// planLinks returns the changes needed to create the given links, and the links whose parent and child were dumped.
+func planLinks(base string, links []ResourceLink, opts LinkOptions) ([]LinkChange, []ResourceLink, error) {
+	changes := make([]LinkChange, 0)
+	linked := make([]ResourceLink, 0, len(links))
+	desired := make(map[string]bool)
+
+	for _, link := range links {
+		linkDest, relative, err := linkTarget(link.Child, link.Parent)
+		if errors.Is(err, errLinkTargetMissing) {
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		linked = append(linked, link)
+		desired[linkDest] = true
+
+		info, err := os.Lstat(linkDest)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			changes = append(changes, LinkChange{Action: LinkActionCreate, Path: linkDest, Target: relative})
+			continue
+		case err != nil:
+			return nil, nil, fmt.Errorf("could not stat '%s': %w", linkDest, err)
+		case !opts.Reconcile:
+			continue
+		}
+
+		if info.Mode()&os.ModeSymlink == os.ModeSymlink {
+			current, err := os.Readlink(linkDest)
+			if err != nil {
+				return nil, nil, fmt.Errorf("could not read symlink '%s': %w", linkDest, err)
+			}
+
+			if current == relative {
+				continue
+			}
+		}
+
+		changes = append(changes, LinkChange{Action: LinkActionUpdate, Path: linkDest, Target: relative})
+	}
+
+	if !opts.Reconcile {
+		return changes, linked, nil
+	}
+
+	err := filepath.WalkDir(base, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if desired[filePath] {
+			// a copied directory which will be replaced by a symlink
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+
+			return nil
+		}
+
+		if d.Type()&fs.ModeSymlink == fs.ModeSymlink {
+			changes = append(changes, LinkChange{Action: LinkActionDelete, Path: filePath})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not walk dump: %w", err)
+	}
+
+	parents := make(map[string]bool)
+	for _, link := range linked {
+		parents[link.Parent.Build()] = true
+	}
+
+	err = ForEachResource(base, func(builder ResourcePathBuilder) error {
+		linksFile := path.Join(builder.Build(), builder.Name+LinksFileSuffix)
+		if parents[builder.Build()] {
+			return nil
+		}
+
+		if _, err := os.Lstat(linksFile); err == nil {
+			changes = append(changes, LinkChange{Action: LinkActionDelete, Path: linksFile})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return changes, linked, nil
+}
+
+// removeEmptyParents removes the empty directories between dir and base, which are left behind after removing a link.
+func removeEmptyParents(base string, dir string) {
+	for dir != base && len(dir) > len(base) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+
+		dir = path.Dir(dir)
+	}
+}
+
+func applyLinkChange(base string, change LinkChange) error {
+	switch change.Action {
+	case LinkActionCreate:
+		if err := createPathParents(change.Path); err != nil {
+			return fmt.Errorf("could not create parents for '%s': %w", change.Path, err)
+		}
+	case LinkActionUpdate:
+		if err := os.RemoveAll(change.Path); err != nil {
+			return fmt.Errorf("could not remove '%s': %w", change.Path, err)
+		}
+	case LinkActionDelete:
+		if err := os.Remove(change.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("could not remove '%s': %w", change.Path, err)
+		}
+
+		removeEmptyParents(base, path.Dir(change.Path))
+
+		return nil
+	}
+
+	if err := os.Symlink(change.Target, change.Path); err != nil {
+		return fmt.Errorf("could not create symlink '%s': %w", change.Path, err)
+	}
+
+	return nil
+}
+
+// LinkDump creates the symlinks and links files for each link between the resources in the dump at base, and the rules
+// file for each ServiceAccount, and the pods and conditions files for each Node. Links whose parent or child was not
+// dumped are skipped. The returned changes have paths relative to base.
+func LinkDump(base string, opts LinkOptions) ([]LinkChange, error) {
+	links, err := ComputeLinks(base)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, linked, err := planLinks(base, links, opts)
+	if err != nil {
+		return nil, fmt.Errorf("could not plan links: %w", err)
+	}
+
+	// deletions are applied last so that the directories they leave empty are not needed by a later change
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Action != LinkActionDelete && changes[j].Action == LinkActionDelete
+	})
+
+	if !opts.DryRun {
+		for _, change := range changes {
+			if err := applyLinkChange(base, change); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := writeLinksFiles(linked); err != nil {
+			return nil, err
+		}
+
+		granted, err := ComputeServiceAccountRules(base, links)
+		if err != nil {
+			return nil, fmt.Errorf("could not compute service account rules: %w", err)
+		}
+
+		if err := writeRulesFiles(granted); err != nil {
+			return nil, err
+		}
+
+		if err := writeNodeFiles(base, links); err != nil {
+			return nil, fmt.Errorf("could not write node files: %w", err)
+		}
+	}
+
+	for i := range changes {
+		if relative, err := filepath.Rel(base, changes[i].Path); err == nil {
+			changes[i].Path = relative
+		}
+	}
+
+	return changes, nil
+}
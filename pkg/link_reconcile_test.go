@@ -0,0 +1,130 @@
+package kubedump
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apicorev1 "k8s.io/api/core/v1"
+	apimetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLinkDumpReconcile(t *testing.T) {
+	base := t.TempDir()
+
+	pod := writeTestResource(t, base, &apicorev1.Pod{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "web", Namespace: "default", Labels: map[string]string{"app": "web"}},
+		Spec: apicorev1.PodSpec{
+			Volumes: []apicorev1.Volume{
+				{
+					Name:         "config",
+					VolumeSource: apicorev1.VolumeSource{Secret: &apicorev1.SecretVolumeSource{SecretName: "current"}},
+				},
+			},
+		},
+	})
+	writeTestResource(t, base, &apicorev1.Secret{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "current", Namespace: "default"},
+	})
+	writeTestResource(t, base, &apicorev1.Secret{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "previous", Namespace: "default"},
+	})
+	service := writeTestResource(t, base, &apicorev1.Service{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       apicorev1.ServiceSpec{Selector: map[string]string{"app": "other"}},
+	})
+
+	currentLink := path.Join(pod.Build(), "Secret", "current")
+	previousLink := path.Join(pod.Build(), "Secret", "previous")
+	danglingLink := path.Join(pod.Build(), "ConfigMap", "deleted")
+	serviceLink := path.Join(service.Build(), "Pod", "web")
+	serviceLinksFile := path.Join(service.Build(), "web"+LinksFileSuffix)
+
+	// links left behind by an older dump, or by resources which have since changed
+	require.NoError(t, os.MkdirAll(path.Dir(currentLink), 0755))
+	require.NoError(t, os.Symlink(path.Join("..", "..", "..", "Secret", "previous"), currentLink))
+	require.NoError(t, os.Symlink(path.Join("..", "..", "..", "Secret", "previous"), previousLink))
+	require.NoError(t, os.MkdirAll(path.Dir(danglingLink), 0755))
+	require.NoError(t, os.Symlink(path.Join("..", "..", "..", "ConfigMap", "deleted"), danglingLink))
+	require.NoError(t, os.MkdirAll(path.Dir(serviceLink), 0755))
+	require.NoError(t, os.Symlink(path.Join("..", "..", "..", "Pod", "web"), serviceLink))
+	require.NoError(t, os.WriteFile(serviceLinksFile, []byte("- kind: Pod\n"), 0644))
+
+	expected := []LinkChange{
+		{Action: LinkActionUpdate, Path: "default/Pod/web/Secret/current", Target: "../../../Secret/current"},
+		{Action: LinkActionDelete, Path: "default/Pod/web/ConfigMap/deleted"},
+		{Action: LinkActionDelete, Path: "default/Pod/web/Secret/previous"},
+		{Action: LinkActionDelete, Path: "default/Service/web/Pod/web"},
+		{Action: LinkActionDelete, Path: "default/Service/web/web" + LinksFileSuffix},
+	}
+
+	changes, err := LinkDump(base, LinkOptions{Reconcile: true, DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, expected, changes)
+
+	target, err := os.Readlink(currentLink)
+	require.NoError(t, err)
+	assert.Equal(t, path.Join("..", "..", "..", "Secret", "previous"), target)
+	assert.FileExists(t, serviceLinksFile)
+
+	changes, err = LinkDump(base, LinkOptions{Reconcile: true})
+	require.NoError(t, err)
+	assert.Equal(t, expected, changes)
+
+	target, err = os.Readlink(currentLink)
+	require.NoError(t, err)
+	assert.Equal(t, path.Join("..", "..", "..", "Secret", "current"), target)
+	assert.NoFileExists(t, previousLink)
+	assert.NoDirExists(t, path.Dir(danglingLink))
+	assert.NoDirExists(t, path.Dir(serviceLink))
+	assert.NoFileExists(t, serviceLinksFile)
+
+	changes, err = LinkDump(base, LinkOptions{Reconcile: true})
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestLinkDumpWithoutReconcile(t *testing.T) {
+	base := t.TempDir()
+
+	pod := writeTestResource(t, base, &apicorev1.Pod{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: apicorev1.PodSpec{
+			Volumes: []apicorev1.Volume{
+				{
+					Name:         "config",
+					VolumeSource: apicorev1.VolumeSource{Secret: &apicorev1.SecretVolumeSource{SecretName: "current"}},
+				},
+			},
+		},
+	})
+	writeTestResource(t, base, &apicorev1.Secret{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "current", Namespace: "default"},
+	})
+
+	danglingLink := path.Join(pod.Build(), "ConfigMap", "deleted")
+	require.NoError(t, os.MkdirAll(path.Dir(danglingLink), 0755))
+	require.NoError(t, os.Symlink(path.Join("..", "..", "..", "ConfigMap", "deleted"), danglingLink))
+
+	changes, err := LinkDump(base, LinkOptions{DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, []LinkChange{
+		{Action: LinkActionCreate, Path: "default/Pod/web/Secret/current", Target: "../../../Secret/current"},
+	}, changes)
+	assert.NoFileExists(t, path.Join(pod.Build(), "Secret", "current"))
+
+	_, err = LinkDump(base, LinkOptions{})
+	require.NoError(t, err)
+	assert.FileExists(t, path.Join(pod.Build(), "Secret", "current", "current.yaml"))
+
+	_, err = os.Lstat(danglingLink)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,80 @@
+package kubedump
+
+import (
+	"strconv"
+	"strings"
+
+	apiappsv1 "k8s.io/api/apps/v1"
+	apicorev1 "k8s.io/api/core/v1"
+	apistoragev1 "k8s.io/api/storage/v1"
+)
+
+// persistentVolumeClaimLinks adds a link from the claim to the persistent volume it is bound to.
+func (l *linker) persistentVolumeClaimLinks(builder ResourcePathBuilder) error {
+	claim := apicorev1.PersistentVolumeClaim{}
+	if err := l.unmarshal(builder, &claim); err != nil {
+		return err
+	}
+
+	if claim.Spec.VolumeName != "" {
+		l.set.add(builder, l.builder("", "PersistentVolume", claim.Spec.VolumeName), LinkTypeBoundVolume)
+	}
+
+	return nil
+}
+
+// persistentVolumeLinks adds a link from the persistent volume to its storage class.
+func (l *linker) persistentVolumeLinks(builder ResourcePathBuilder) error {
+	volume := apicorev1.PersistentVolume{}
+	if err := l.unmarshal(builder, &volume); err != nil {
+		return err
+	}
+
+	if volume.Spec.StorageClassName != "" {
+		l.set.add(builder, l.builder("", "StorageClass", volume.Spec.StorageClassName), LinkTypeStorageClass)
+	}
+
+	return nil
+}
+
+// volumeAttachmentLinks adds a link to the attachment from the persistent volume being attached.
+func (l *linker) volumeAttachmentLinks(builder ResourcePathBuilder) error {
+	attachment := apistoragev1.VolumeAttachment{}
+	if err := l.unmarshal(builder, &attachment); err != nil {
+		return err
+	}
+
+	if name := attachment.Spec.Source.PersistentVolumeName; name != nil && *name != "" {
+		l.set.add(l.builder("", "PersistentVolume", *name), builder, LinkTypeAttachment)
+	}
+
+	return nil
+}
+
+// statefulSetLinks adds links from the stateful set to each claim generated from its volume claim templates. Generated
+// claims are named <template>-<stateful set>-<ordinal>.
+func (l *linker) statefulSetLinks(builder ResourcePathBuilder) error {
+	statefulSet := apiappsv1.StatefulSet{}
+	if err := l.unmarshal(builder, &statefulSet); err != nil {
+		return err
+	}
+
+	for _, template := range statefulSet.Spec.VolumeClaimTemplates {
+		prefix := template.Name + "-" + builder.Name + "-"
+
+		for _, claim := range l.index["PersistentVolumeClaim"][builder.Namespace] {
+			ordinal, found := strings.CutPrefix(claim.GetName(), prefix)
+			if !found {
+				continue
+			}
+
+			if _, err := strconv.ParseUint(ordinal, 10, 32); err != nil {
+				continue
+			}
+
+			l.set.add(builder, l.builder(builder.Namespace, "PersistentVolumeClaim", claim.GetName()), LinkTypeClaimTemplate)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,520 @@
+package kubedump
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiappsv1 "k8s.io/api/apps/v1"
+	apicorev1 "k8s.io/api/core/v1"
+	apidiscoveryv1 "k8s.io/api/discovery/v1"
+	apinetworkingv1 "k8s.io/api/networking/v1"
+	apirbacv1 "k8s.io/api/rbac/v1"
+	apistoragev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	apimetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+// writeTestResource writes obj to its resource file in the dump at base.
+func writeTestResource(t *testing.T, base string, obj runtime.Object) ResourcePathBuilder {
+	accessor, err := meta.Accessor(obj)
+	require.NoError(t, err)
+
+	builder := ResourcePathBuilder{}.
+		WithBase(base).
+		WithNamespace(accessor.GetNamespace()).
+		WithKind(obj.GetObjectKind().GroupVersionKind().Kind).
+		WithName(accessor.GetName())
+
+	data, err := yaml.Marshal(obj)
+	require.NoError(t, err)
+
+	require.NoError(t, os.MkdirAll(builder.Build(), 0755))
+	require.NoError(t, os.WriteFile(path.Join(builder.Build(), builder.Name+".yaml"), data, 0644))
+
+	return builder
+}
+
+// linkChildren returns the types of each link under parent, keyed by the child's kind and name.
+func linkChildren(links []ResourceLink, parent ResourcePathBuilder) map[string][]LinkType {
+	children := map[string][]LinkType{}
+	for _, link := range links {
+		if link.Parent == parent {
+			children[link.Child.Kind+"/"+link.Child.Name] = link.Types
+		}
+	}
+
+	return children
+}
+
+func TestPodLinks(t *testing.T) {
+	base := t.TempDir()
+
+	pod := &apicorev1.Pod{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "sample-pod", Namespace: "default"},
+		Spec: apicorev1.PodSpec{
+			Volumes: []apicorev1.Volume{
+				{
+					Name: "secret-volume",
+					VolumeSource: apicorev1.VolumeSource{
+						Secret: &apicorev1.SecretVolumeSource{SecretName: "volume-secret"},
+					},
+				},
+				{
+					Name: "projected-volume",
+					VolumeSource: apicorev1.VolumeSource{
+						Projected: &apicorev1.ProjectedVolumeSource{
+							Sources: []apicorev1.VolumeProjection{
+								{ConfigMap: &apicorev1.ConfigMapProjection{LocalObjectReference: apicorev1.LocalObjectReference{Name: "projected-configmap"}}},
+								{Secret: &apicorev1.SecretProjection{LocalObjectReference: apicorev1.LocalObjectReference{Name: "volume-secret"}}},
+							},
+						},
+					},
+				},
+				{
+					Name: "csi-volume",
+					VolumeSource: apicorev1.VolumeSource{
+						CSI: &apicorev1.CSIVolumeSource{
+							Driver:               "secrets-store.csi.k8s.io",
+							NodePublishSecretRef: &apicorev1.LocalObjectReference{Name: "csi-secret"},
+						},
+					},
+				},
+			},
+			InitContainers: []apicorev1.Container{
+				{
+					Name: "init",
+					EnvFrom: []apicorev1.EnvFromSource{
+						{ConfigMapRef: &apicorev1.ConfigMapEnvSource{LocalObjectReference: apicorev1.LocalObjectReference{Name: "env-configmap"}}},
+					},
+				},
+			},
+			Containers: []apicorev1.Container{
+				{
+					Name: "main",
+					Env: []apicorev1.EnvVar{
+						{Name: "PLAIN", Value: "value"},
+						{Name: "PASSWORD", ValueFrom: &apicorev1.EnvVarSource{SecretKeyRef: &apicorev1.SecretKeySelector{LocalObjectReference: apicorev1.LocalObjectReference{Name: "env-secret"}, Key: "password"}}},
+					},
+				},
+			},
+			ImagePullSecrets: []apicorev1.LocalObjectReference{{Name: "registry-secret"}},
+		},
+	}
+
+	podBuilder := writeTestResource(t, base, pod)
+
+	links, err := ComputeLinks(base)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]LinkType{
+		"Secret/volume-secret":          {LinkTypeVolume, LinkTypeProjectedVolume},
+		"ConfigMap/projected-configmap": {LinkTypeProjectedVolume},
+		"Secret/csi-secret":             {LinkTypeCSISecret},
+		"ConfigMap/env-configmap":       {LinkTypeEnvFrom},
+		"Secret/env-secret":             {LinkTypeEnv},
+		"Secret/registry-secret":        {LinkTypeImagePullSecret},
+		"ServiceAccount/default":        {LinkTypeServiceAccount},
+	}, linkChildren(links, podBuilder))
+}
+
+func TestNetworkLinks(t *testing.T) {
+	base := t.TempDir()
+
+	_ = writeTestResource(t, base, &apicorev1.Pod{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "web", Namespace: "default", Labels: map[string]string{"app": "web"}},
+	})
+	_ = writeTestResource(t, base, &apicorev1.Pod{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "db", Namespace: "default", Labels: map[string]string{"app": "db"}},
+	})
+	_ = writeTestResource(t, base, &apicorev1.Pod{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "other-web", Namespace: "other", Labels: map[string]string{"app": "web"}},
+	})
+
+	service := writeTestResource(t, base, &apicorev1.Service{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       apicorev1.ServiceSpec{Selector: map[string]string{"app": "web"}},
+	})
+	external := writeTestResource(t, base, &apicorev1.Service{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "external", Namespace: "default"},
+	})
+
+	endpoints := writeTestResource(t, base, &apicorev1.Endpoints{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "Endpoints"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Subsets: []apicorev1.EndpointSubset{{
+			Addresses:         []apicorev1.EndpointAddress{{IP: "10.0.0.1", TargetRef: &apicorev1.ObjectReference{Kind: "Pod", Name: "web"}}},
+			NotReadyAddresses: []apicorev1.EndpointAddress{{IP: "10.0.0.2", TargetRef: &apicorev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "db"}}},
+		}},
+	})
+
+	slice := writeTestResource(t, base, &apidiscoveryv1.EndpointSlice{
+		TypeMeta:    apimetav1.TypeMeta{APIVersion: "discovery.k8s.io/v1", Kind: "EndpointSlice"},
+		ObjectMeta:  apimetav1.ObjectMeta{Name: "web-abcde", Namespace: "default"},
+		AddressType: apidiscoveryv1.AddressTypeIPv4,
+		Endpoints: []apidiscoveryv1.Endpoint{
+			{Addresses: []string{"10.0.0.1"}, TargetRef: &apicorev1.ObjectReference{Kind: "Pod", Name: "web"}},
+			{Addresses: []string{"10.0.0.3"}, TargetRef: &apicorev1.ObjectReference{Kind: "Node", Name: "node"}},
+		},
+	})
+
+	ingress := writeTestResource(t, base, &apinetworkingv1.Ingress{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "networking.k8s.io/v1", Kind: "Ingress"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: apinetworkingv1.IngressSpec{
+			DefaultBackend: &apinetworkingv1.IngressBackend{Service: &apinetworkingv1.IngressServiceBackend{Name: "external"}},
+			Rules: []apinetworkingv1.IngressRule{{
+				IngressRuleValue: apinetworkingv1.IngressRuleValue{HTTP: &apinetworkingv1.HTTPIngressRuleValue{
+					Paths: []apinetworkingv1.HTTPIngressPath{{
+						Path:    "/",
+						Backend: apinetworkingv1.IngressBackend{Service: &apinetworkingv1.IngressServiceBackend{Name: "web"}},
+					}},
+				}},
+			}},
+		},
+	})
+
+	denyAll := writeTestResource(t, base, &apinetworkingv1.NetworkPolicy{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "networking.k8s.io/v1", Kind: "NetworkPolicy"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "deny-all", Namespace: "default"},
+	})
+	allowDb := writeTestResource(t, base, &apinetworkingv1.NetworkPolicy{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "networking.k8s.io/v1", Kind: "NetworkPolicy"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "allow-db", Namespace: "default"},
+		Spec: apinetworkingv1.NetworkPolicySpec{
+			PodSelector: apimetav1.LabelSelector{
+				MatchExpressions: []apimetav1.LabelSelectorRequirement{{Key: "app", Operator: apimetav1.LabelSelectorOpIn, Values: []string{"db"}}},
+			},
+		},
+	})
+
+	links, err := ComputeLinks(base)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]LinkType{"Pod/web": {LinkTypeSelector}}, linkChildren(links, service))
+	assert.Empty(t, linkChildren(links, external))
+	assert.Equal(t, map[string][]LinkType{"Pod/web": {LinkTypeEndpoint}, "Pod/db": {LinkTypeEndpoint}}, linkChildren(links, endpoints))
+	assert.Equal(t, map[string][]LinkType{"Pod/web": {LinkTypeEndpoint}}, linkChildren(links, slice))
+	assert.Equal(t, map[string][]LinkType{"Service/web": {LinkTypeBackend}, "Service/external": {LinkTypeBackend}}, linkChildren(links, ingress))
+	assert.Equal(t, map[string][]LinkType{"Pod/web": {LinkTypeNetworkPolicy}, "Pod/db": {LinkTypeNetworkPolicy}}, linkChildren(links, denyAll))
+	assert.Equal(t, map[string][]LinkType{"Pod/db": {LinkTypeNetworkPolicy}}, linkChildren(links, allowDb))
+
+	_, err = LinkDump(base, LinkOptions{})
+	require.NoError(t, err)
+
+	assert.FileExists(t, path.Join(ingress.Build(), "Service", "web", "Pod", "web", "web.yaml"))
+}
+
+func TestStorageLinks(t *testing.T) {
+	base := t.TempDir()
+
+	pod := writeTestResource(t, base, &apicorev1.Pod{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "db-0", Namespace: "default"},
+		Spec: apicorev1.PodSpec{
+			Volumes: []apicorev1.Volume{
+				{Name: "data", VolumeSource: apicorev1.VolumeSource{PersistentVolumeClaim: &apicorev1.PersistentVolumeClaimVolumeSource{ClaimName: "data-db-0"}}},
+				{Name: "scratch", VolumeSource: apicorev1.VolumeSource{Ephemeral: &apicorev1.EphemeralVolumeSource{}}},
+			},
+		},
+	})
+
+	statefulSet := writeTestResource(t, base, &apiappsv1.StatefulSet{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "apps/v1", Kind: "StatefulSet"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "db", Namespace: "default"},
+		Spec: apiappsv1.StatefulSetSpec{
+			VolumeClaimTemplates: []apicorev1.PersistentVolumeClaim{{ObjectMeta: apimetav1.ObjectMeta{Name: "data"}}},
+		},
+	})
+
+	claim := writeTestResource(t, base, &apicorev1.PersistentVolumeClaim{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "PersistentVolumeClaim"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "data-db-0", Namespace: "default"},
+		Spec:       apicorev1.PersistentVolumeClaimSpec{VolumeName: "pv-data"},
+	})
+	_ = writeTestResource(t, base, &apicorev1.PersistentVolumeClaim{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "PersistentVolumeClaim"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "data-db-backup", Namespace: "default"},
+	})
+
+	volume := writeTestResource(t, base, &apicorev1.PersistentVolume{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "PersistentVolume"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "pv-data"},
+		Spec:       apicorev1.PersistentVolumeSpec{StorageClassName: "standard"},
+	})
+
+	_ = writeTestResource(t, base, &apistoragev1.StorageClass{
+		TypeMeta:    apimetav1.TypeMeta{APIVersion: "storage.k8s.io/v1", Kind: "StorageClass"},
+		ObjectMeta:  apimetav1.ObjectMeta{Name: "standard"},
+		Provisioner: "rancher.io/local-path",
+	})
+
+	volumeName := "pv-data"
+	_ = writeTestResource(t, base, &apistoragev1.VolumeAttachment{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "storage.k8s.io/v1", Kind: "VolumeAttachment"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "csi-abcdef"},
+		Spec: apistoragev1.VolumeAttachmentSpec{
+			Attacher: "rancher.io/local-path",
+			NodeName: "node",
+			Source:   apistoragev1.VolumeAttachmentSource{PersistentVolumeName: &volumeName},
+		},
+	})
+
+	links, err := ComputeLinks(base)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]LinkType{
+		"PersistentVolumeClaim/data-db-0":    {LinkTypeClaim},
+		"PersistentVolumeClaim/db-0-scratch": {LinkTypeEphemeralVolume},
+		"ServiceAccount/default":             {LinkTypeServiceAccount},
+	}, linkChildren(links, pod))
+	assert.Equal(t, map[string][]LinkType{"PersistentVolumeClaim/data-db-0": {LinkTypeClaimTemplate}}, linkChildren(links, statefulSet))
+	assert.Equal(t, map[string][]LinkType{"PersistentVolume/pv-data": {LinkTypeBoundVolume}}, linkChildren(links, claim))
+	assert.Equal(t, map[string][]LinkType{
+		"StorageClass/standard":       {LinkTypeStorageClass},
+		"VolumeAttachment/csi-abcdef": {LinkTypeAttachment},
+	}, linkChildren(links, volume))
+
+	_, err = LinkDump(base, LinkOptions{})
+	require.NoError(t, err)
+
+	assert.FileExists(t, path.Join(base, "default", "Pod", "db-0", "PersistentVolumeClaim", "data-db-0", "PersistentVolume", "pv-data", "pv-data.yaml"))
+	assert.FileExists(t, path.Join(base, "PersistentVolume", "pv-data", "StorageClass", "standard", "standard.yaml"))
+	assert.FileExists(t, path.Join(base, "PersistentVolume", "pv-data", "VolumeAttachment", "csi-abcdef", "csi-abcdef.yaml"))
+	assert.NoDirExists(t, path.Join(base, "default", "Pod", "db-0", "PersistentVolumeClaim", "db-0-scratch"))
+}
+
+func TestRbacLinks(t *testing.T) {
+	base := t.TempDir()
+
+	pod := writeTestResource(t, base, &apicorev1.Pod{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       apicorev1.PodSpec{ServiceAccountName: "web"},
+	})
+
+	account := writeTestResource(t, base, &apicorev1.ServiceAccount{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "web", Namespace: "default"},
+	})
+	other := writeTestResource(t, base, &apicorev1.ServiceAccount{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "other", Namespace: "other"},
+	})
+
+	_ = writeTestResource(t, base, &apirbacv1.Role{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "Role"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "config-reader", Namespace: "default"},
+		Rules:      []apirbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get", "list"}}},
+	})
+	binding := writeTestResource(t, base, &apirbacv1.RoleBinding{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "RoleBinding"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "web-config-reader", Namespace: "default"},
+		Subjects:   []apirbacv1.Subject{{Kind: "ServiceAccount", Name: "web"}},
+		RoleRef:    apirbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "Role", Name: "config-reader"},
+	})
+	missingRoleBinding := writeTestResource(t, base, &apirbacv1.RoleBinding{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "RoleBinding"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "web-missing", Namespace: "default"},
+		Subjects:   []apirbacv1.Subject{{Kind: "User", Name: "system:serviceaccount:default:web"}},
+		RoleRef:    apirbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: "missing"},
+	})
+
+	_ = writeTestResource(t, base, &apirbacv1.ClusterRole{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRole"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "node-reader"},
+		Rules:      []apirbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"nodes"}, Verbs: []string{"get"}}},
+	})
+	clusterBinding := writeTestResource(t, base, &apirbacv1.ClusterRoleBinding{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRoleBinding"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "all-node-readers"},
+		Subjects:   []apirbacv1.Subject{{Kind: "Group", Name: "system:serviceaccounts"}},
+		RoleRef:    apirbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: "node-reader"},
+	})
+
+	links, err := ComputeLinks(base)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]LinkType{"ServiceAccount/web": {LinkTypeServiceAccount}}, linkChildren(links, pod))
+	assert.Equal(t, map[string][]LinkType{
+		"RoleBinding/web-config-reader":       {LinkTypeRoleBinding},
+		"RoleBinding/web-missing":             {LinkTypeRoleBinding},
+		"ClusterRoleBinding/all-node-readers": {LinkTypeRoleBinding},
+	}, linkChildren(links, account))
+	assert.Equal(t, map[string][]LinkType{"ClusterRoleBinding/all-node-readers": {LinkTypeRoleBinding}}, linkChildren(links, other))
+	assert.Equal(t, map[string][]LinkType{"Role/config-reader": {LinkTypeRoleRef}}, linkChildren(links, binding))
+	assert.Equal(t, map[string][]LinkType{"ClusterRole/missing": {LinkTypeRoleRef}}, linkChildren(links, missingRoleBinding))
+	assert.Equal(t, map[string][]LinkType{"ClusterRole/node-reader": {LinkTypeRoleRef}}, linkChildren(links, clusterBinding))
+
+	_, err = LinkDump(base, LinkOptions{})
+	require.NoError(t, err)
+
+	assert.FileExists(t, path.Join(pod.Build(), "ServiceAccount", "web", "RoleBinding", "web-config-reader", "Role", "config-reader", "config-reader.yaml"))
+	assert.FileExists(t, path.Join(other.Build(), "ClusterRoleBinding", "all-node-readers", "ClusterRole", "node-reader", "node-reader.yaml"))
+
+	data, err := os.ReadFile(path.Join(account.Build(), account.Name+RulesFileSuffix))
+	require.NoError(t, err)
+
+	var granted []GrantedRules
+	require.NoError(t, yaml.Unmarshal(data, &granted))
+	assert.ElementsMatch(t, []GrantedRules{
+		{Binding: "ClusterRoleBinding/all-node-readers", Role: "ClusterRole/node-reader", Rules: []apirbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"nodes"}, Verbs: []string{"get"}}}},
+		{Namespace: "default", Binding: "RoleBinding/web-config-reader", Role: "Role/config-reader", Rules: []apirbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get", "list"}}}},
+		{Namespace: "default", Binding: "RoleBinding/web-missing", Role: "ClusterRole/missing", RoleMissing: true},
+	}, granted)
+}
+
+func TestRbacLinksAcrossNamespaces(t *testing.T) {
+	base := t.TempDir()
+
+	account := writeTestResource(t, base, &apicorev1.ServiceAccount{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "app", Namespace: "default"},
+	})
+
+	// bindings of the same name in different namespaces both grant rules to the account
+	for namespace, resource := range map[string]string{"default": "configmaps", "other": "secrets"} {
+		_ = writeTestResource(t, base, &apirbacv1.Role{
+			TypeMeta:   apimetav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "Role"},
+			ObjectMeta: apimetav1.ObjectMeta{Name: "reader", Namespace: namespace},
+			Rules:      []apirbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{resource}, Verbs: []string{"get"}}},
+		})
+		_ = writeTestResource(t, base, &apirbacv1.RoleBinding{
+			TypeMeta:   apimetav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "RoleBinding"},
+			ObjectMeta: apimetav1.ObjectMeta{Name: "read", Namespace: namespace},
+			Subjects:   []apirbacv1.Subject{{Kind: "ServiceAccount", Name: "app", Namespace: "default"}},
+			RoleRef:    apirbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "Role", Name: "reader"},
+		})
+	}
+
+	_, err := LinkDump(base, LinkOptions{})
+	require.NoError(t, err)
+
+	target, err := os.Readlink(path.Join(account.Build(), "RoleBinding", "read"))
+	require.NoError(t, err)
+	assert.Equal(t, "../../../RoleBinding/read", target)
+
+	target, err = os.Readlink(path.Join(account.Build(), "other", "RoleBinding", "read"))
+	require.NoError(t, err)
+	assert.Equal(t, "../../../../../other/RoleBinding/read", target)
+
+	assert.FileExists(t, path.Join(account.Build(), "other", "RoleBinding", "read", "Role", "reader", "reader.yaml"))
+
+	data, err := os.ReadFile(path.Join(account.Build(), account.Name+RulesFileSuffix))
+	require.NoError(t, err)
+
+	var granted []GrantedRules
+	require.NoError(t, yaml.Unmarshal(data, &granted))
+	assert.ElementsMatch(t, []GrantedRules{
+		{Namespace: "default", Binding: "RoleBinding/read", Role: "Role/reader", Rules: []apirbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get"}}}},
+		{Namespace: "other", Binding: "RoleBinding/read", Role: "Role/reader", Rules: []apirbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}}}},
+	}, granted)
+}
+
+func TestNodeLinks(t *testing.T) {
+	base := t.TempDir()
+
+	startTime := apimetav1.NewTime(time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC))
+
+	web := writeTestResource(t, base, &apicorev1.Pod{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "web", Namespace: "default", UID: "web-uid"},
+		Spec:       apicorev1.PodSpec{NodeName: "node-7"},
+		Status:     apicorev1.PodStatus{Phase: apicorev1.PodRunning, StartTime: &startTime},
+	})
+	_ = writeTestResource(t, base, &apicorev1.Pod{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "web", Namespace: "other"},
+		Spec:       apicorev1.PodSpec{NodeName: "node-7"},
+		Status:     apicorev1.PodStatus{Phase: apicorev1.PodFailed},
+	})
+	_ = writeTestResource(t, base, &apicorev1.Pod{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "pending", Namespace: "default"},
+		Status:     apicorev1.PodStatus{Phase: apicorev1.PodPending},
+	})
+
+	node := writeTestResource(t, base, &apicorev1.Node{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "Node"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "node-7"},
+		Status: apicorev1.NodeStatus{
+			Conditions: []apicorev1.NodeCondition{
+				{Type: apicorev1.NodeReady, Status: apicorev1.ConditionFalse, LastTransitionTime: apimetav1.NewTime(startTime.Add(time.Hour))},
+				{Type: apicorev1.NodeMemoryPressure, Status: apicorev1.ConditionTrue, LastTransitionTime: apimetav1.NewTime(startTime.Add(time.Minute))},
+			},
+		},
+	})
+
+	links, err := ComputeLinks(base)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]LinkType{
+		"Node/node-7":            {LinkTypeNode},
+		"ServiceAccount/default": {LinkTypeServiceAccount},
+	}, linkChildren(links, web))
+
+	_, err = LinkDump(base, LinkOptions{})
+	require.NoError(t, err)
+
+	assert.FileExists(t, path.Join(web.Build(), "Node", "node-7", "node-7.yaml"))
+
+	data, err := os.ReadFile(path.Join(node.Build(), node.Name+NodePodsFileSuffix))
+	require.NoError(t, err)
+
+	var pods []ScheduledPod
+	require.NoError(t, yaml.Unmarshal(data, &pods))
+	require.Len(t, pods, 2)
+
+	assert.True(t, startTime.Equal(pods[0].StartTime))
+	pods[0].StartTime = nil
+
+	assert.Equal(t, []ScheduledPod{
+		{Namespace: "default", Name: "web", UID: "web-uid", Phase: apicorev1.PodRunning},
+		{Namespace: "other", Name: "web", Phase: apicorev1.PodFailed},
+	}, pods)
+
+	data, err = os.ReadFile(path.Join(node.Build(), node.Name+NodeConditionsFileSuffix))
+	require.NoError(t, err)
+
+	var conditions []apicorev1.NodeCondition
+	require.NoError(t, yaml.Unmarshal(data, &conditions))
+	require.Len(t, conditions, 2)
+	assert.Equal(t, apicorev1.NodeMemoryPressure, conditions[0].Type)
+	assert.Equal(t, apicorev1.NodeReady, conditions[1].Type)
+
+	// the node became ready after it was linked, so linking again records the transition alongside the earlier ones
+	_ = writeTestResource(t, base, &apicorev1.Node{
+		TypeMeta:   apimetav1.TypeMeta{APIVersion: "v1", Kind: "Node"},
+		ObjectMeta: apimetav1.ObjectMeta{Name: "node-7"},
+		Status: apicorev1.NodeStatus{
+			Conditions: []apicorev1.NodeCondition{
+				{Type: apicorev1.NodeReady, Status: apicorev1.ConditionTrue, LastTransitionTime: apimetav1.NewTime(startTime.Add(2 * time.Hour))},
+				{Type: apicorev1.NodeMemoryPressure, Status: apicorev1.ConditionTrue, LastTransitionTime: apimetav1.NewTime(startTime.Add(time.Minute))},
+			},
+		},
+	})
+
+	_, err = LinkDump(base, LinkOptions{})
+	require.NoError(t, err)
+
+	data, err = os.ReadFile(path.Join(node.Build(), node.Name+NodeConditionsFileSuffix))
+	require.NoError(t, err)
+
+	conditions = nil
+	require.NoError(t, yaml.Unmarshal(data, &conditions))
+	require.Len(t, conditions, 3)
+	assert.Equal(t, apicorev1.NodeMemoryPressure, conditions[0].Type)
+	assert.Equal(t, []apicorev1.ConditionStatus{apicorev1.ConditionFalse, apicorev1.ConditionTrue}, []apicorev1.ConditionStatus{conditions[1].Status, conditions[2].Status})
+	assert.Equal(t, apicorev1.NodeReady, conditions[2].Type)
+}
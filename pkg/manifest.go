@@ -0,0 +1,132 @@
+package kubedump
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"time"
+)
+
+// ManifestFileName is the name of the file at the root of a dump holding its Manifest.
+const ManifestFileName = "manifest.json"
+
+// Manifest describes how and when a dump was collected, and what has been done to it since, so that a dump can be
+// understood without knowing the command which created it.
+type Manifest struct {
+	KubedumpVersion string `json:"kubedumpVersion"`
+
+	// Cluster is the address of the api server the dump was collected from.
+	Cluster string `json:"cluster,omitempty"`
+
+	// Context is the kubeconfig context used to connect to the cluster, if any.
+	Context string `json:"context,omitempty"`
+
+	// Format is the format the dump was written in.
+	Format string `json:"format,omitempty"`
+
+	StartTime time.Time `json:"startTime"`
+
+	// StopTime is the time the dump was stopped, or nil if it has not been stopped.
+	StopTime *time.Time `json:"stopTime,omitempty"`
+
+	Filter string `json:"filter"`
+
+	// Resources are the resources which were watched, formatted like "<group>/<version>/<resource>".
+	Resources []string `json:"resources"`
+
+	// Counts is the number of resources of each kind in the dump.
+	Counts map[string]int `json:"counts,omitempty"`
+
+	// Errors are the errors encountered while collecting the dump.
+	Errors []string `json:"errors,omitempty"`
+
+	// Checksums are the hex encoded SHA-256 checksums of every file in the dump keyed by their path, recorded when the
+	// dump is stopped or written by an offline command so the dump can be checked with `kubedump verify`.
+	Checksums map[string]string `json:"checksums,omitempty"`
+
+	// History lists the commands which modified the dump, or created it from other dumps, in the order they were run.
+	History []ManifestEntry `json:"history,omitempty"`
+}
+
+// ManifestEntry records a command which modified a dump, or created it from another dump.
+type ManifestEntry struct {
+	Command         string    `json:"command"`
+	Time            time.Time `json:"time"`
+	KubedumpVersion string    `json:"kubedumpVersion"`
+
+	// Sources are the dumps the command read from, if they differ from the dump itself.
+	Sources []string `json:"sources,omitempty"`
+
+	// Details describes how the command was run (ex the filter used by `kubedump filter`).
+	Details string `json:"details,omitempty"`
+}
+
+// ReadManifestFS reads the manifest at the root of the dump in fsys. If the dump has no manifest, the returned error
+// wraps fs.ErrNotExist.
+func ReadManifestFS(fsys fs.FS) (*Manifest, error) {
+	data, err := fs.ReadFile(fsys, ManifestFileName)
+	if err != nil {
+		return nil, fmt.Errorf("could not read manifest: %w", err)
+	}
+
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("could not unmarshal manifest: %w", err)
+	}
+
+	return manifest, nil
+}
+
+// WriteManifest writes manifest to the root of the dump in dir, replacing any existing manifest. The manifest is written
+// to a temporary file first, so readers never see a partially written manifest.
+func WriteManifest(dir string, manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal manifest: %w", err)
+	}
+
+	f, err := os.CreateTemp(dir, "."+ManifestFileName+"-*")
+	if err != nil {
+		return fmt.Errorf("could not create manifest: %w", err)
+	}
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("could not write manifest: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("could not write manifest: %w", err)
+	}
+
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("could not write manifest: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), path.Join(dir, ManifestFileName)); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("could not write manifest: %w", err)
+	}
+
+	return nil
+}
+
+// CountResourcesFS returns the number of resources of each kind in the dump at the root of fsys.
+func CountResourcesFS(fsys fs.FS) (map[string]int, error) {
+	counts := map[string]int{}
+
+	err := ForEachResourceFS(fsys, func(builder ResourcePathBuilder) error {
+		counts[builder.Kind]++
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not count resources: %w", err)
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,76 @@
+package kubedump
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifestRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := ReadManifestFS(os.DirFS(dir))
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	stop := time.Date(2023, 1, 1, 1, 0, 0, 0, time.UTC)
+	expected := &Manifest{
+		KubedumpVersion: "v1.0.0",
+		Cluster:         "https://127.0.0.1:6443",
+		Context:         "kind-kind",
+		Format:          "dir",
+		StartTime:       time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		StopTime:        &stop,
+		Filter:          "namespace default",
+		Resources:       []string{"v1/pods"},
+		Counts:          map[string]int{"Pod": 1},
+		Errors:          []string{"could not get logs"},
+		History: []ManifestEntry{
+			{Command: "filter", Time: stop, KubedumpVersion: "v1.0.0", Sources: []string{"/tmp/original.dump"}, Details: "related 'pod default/*'"},
+		},
+	}
+
+	require.NoError(t, WriteManifest(dir, expected))
+
+	actual, err := ReadManifestFS(os.DirFS(dir))
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+
+	info, err := os.Stat(path.Join(dir, ManifestFileName))
+	require.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0644), info.Mode().Perm())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "temporary manifest files should be removed")
+}
+
+func TestCountResources(t *testing.T) {
+	counts, err := CountResourcesFS(DirFS(dumpDir))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"ConfigMap": 1, "Pod": 1, "Secret": 1, "Service": 1}, counts)
+
+	dbPath := path.Join(t.TempDir(), DBFileName)
+	require.NoError(t, ConvertToDB(DirFS(dumpDir), dbPath))
+
+	sink, err := NewDBSink(dbPath)
+	require.NoError(t, err)
+	require.NoError(t, sink.WriteManifest(&Manifest{KubedumpVersion: "v1.0.0", Counts: counts}))
+	require.NoError(t, sink.Close())
+
+	dump, err := OpenDBDump(dbPath)
+	require.NoError(t, err)
+	defer dump.Close()
+
+	dbCounts, err := dump.CountResources()
+	require.NoError(t, err)
+	assert.Equal(t, counts, dbCounts)
+
+	manifest, err := dump.Manifest()
+	require.NoError(t, err)
+	assert.Equal(t, &Manifest{KubedumpVersion: "v1.0.0", Counts: counts}, manifest)
+}
@@ -0,0 +1,758 @@
+package kubedump
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// MergeConflict is a resource with the same resourceVersion in two dumps, but different content. The resource from the
+// dump given first is kept.
+type MergeConflict struct {
+	Builder         ResourcePathBuilder
+	ResourceVersion string
+
+	// Kept is the dump whose resource was kept, and Dropped is the dump whose resource was dropped.
+	Kept    string
+	Dropped string
+}
+
+func (conflict MergeConflict) String() string {
+	name := conflict.Builder.Name
+	if conflict.Builder.Namespace != "" {
+		name = conflict.Builder.Namespace + "/" + name
+	}
+
+	return fmt.Sprintf("%s '%s' has resourceVersion %s in both '%s' and '%s' with different content, keeping '%s'",
+		conflict.Builder.Kind, name, conflict.ResourceVersion, conflict.Kept, conflict.Dropped, conflict.Kept)
+}
+
+// mergeInput is a dump being merged, read into memory.
+type mergeInput struct {
+	name  string
+	start time.Time
+
+	revisions map[ResourcePathBuilder][]revision
+	events    map[ResourcePathBuilder][]eventLine
+	logs      map[ResourcePathBuilder]map[string]*containerLogs
+	links     map[ResourcePathBuilder][]LinkReference
+	incidents []incidentFile
+}
+
+// revision is the description of a resource read from one of the merged dumps.
+type revision struct {
+	input           *mergeInput
+	data            []byte
+	resourceVersion string
+	modTime         time.Time
+}
+
+// newerThan returns true if revision was collected after other. Resource versions are compared as integers when
+// possible, as they are for every resource stored in etcd, falling back to the times the revisions were written.
+func (revision revision) newerThan(other revision) bool {
+	a, errA := strconv.ParseUint(revision.resourceVersion, 10, 64)
+	b, errB := strconv.ParseUint(other.resourceVersion, 10, 64)
+
+	if errA == nil && errB == nil {
+		return a > b
+	}
+
+	return revision.modTime.After(other.modTime)
+}
+
+// eventLine is a line of an events file read from one of the merged dumps.
+type eventLine struct {
+	t    time.Time
+	line []byte
+}
+
+// containerLogs are the logs of a container read from one of the merged dumps, and the time they were last written.
+type containerLogs struct {
+	t    time.Time
+	data []byte
+}
+
+// incidentFile is a file written for an incident in one of the merged dumps.
+type incidentFile struct {
+	incident string
+	name     string
+	data     []byte
+}
+
+func newMergeInput(name string) *mergeInput {
+	return &mergeInput{
+		name:      name,
+		revisions: map[ResourcePathBuilder][]revision{},
+		events:    map[ResourcePathBuilder][]eventLine{},
+		logs:      map[ResourcePathBuilder]map[string]*containerLogs{},
+		links:     map[ResourcePathBuilder][]LinkReference{},
+	}
+}
+
+func (input *mergeInput) addRevision(builder ResourcePathBuilder, t time.Time, data []byte) error {
+	resource, err := newResourceFromData(data)
+	if err != nil {
+		return fmt.Errorf("could not parse %s '%s': %w", builder.Kind, builder.Name, err)
+	}
+
+	resourceVersion, _, _ := unstructured.NestedString(resource.GetObject(), "metadata", "resourceVersion")
+
+	input.revisions[builder] = append(input.revisions[builder], revision{
+		input:           input,
+		data:            bytes.Clone(data),
+		resourceVersion: resourceVersion,
+		modTime:         t,
+	})
+
+	return nil
+}
+
+func (input *mergeInput) addEventLine(builder ResourcePathBuilder, fallback time.Time, line []byte) {
+	line = bytes.Clone(line)
+	if !bytes.HasSuffix(line, []byte("\n")) {
+		line = append(line, '\n')
+	}
+
+	input.events[builder] = append(input.events[builder], eventLine{t: eventLineTime(line, fallback), line: line})
+}
+
+func (input *mergeInput) addLogs(builder ResourcePathBuilder, container string, t time.Time, data []byte) {
+	if input.logs[builder] == nil {
+		input.logs[builder] = map[string]*containerLogs{}
+	}
+
+	logs, found := input.logs[builder][container]
+	if !found {
+		logs = &containerLogs{}
+		input.logs[builder][container] = logs
+	}
+
+	logs.data = append(logs.data, data...)
+	if t.After(logs.t) {
+		logs.t = t
+	}
+}
+
+func (input *mergeInput) addIncidentFile(incident string, name string, data []byte) error {
+	input.incidents = append(input.incidents, incidentFile{incident: incident, name: name, data: bytes.Clone(data)})
+	return nil
+}
+
+// readMergeInput reads the dump at dumpPath, which may be a directory, archive, or db dump.
+func readMergeInput(dumpPath string) (*mergeInput, error) {
+	if strings.HasSuffix(dumpPath, ".db") {
+		return readDBMergeInput(dumpPath)
+	}
+
+	fsys, err := OpenDump(dumpPath)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseDump(fsys)
+
+	input := newMergeInput(dumpPath)
+
+	if manifest, err := ReadManifestFS(fsys); err == nil {
+		input.start = manifest.StartTime
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("could not read manifest of '%s': %w", dumpPath, err)
+	}
+
+	err = ForEachResourceFS(fsys, func(builder ResourcePathBuilder) error {
+		return input.readResourceDir(fsys, builder)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read resources of '%s': %w", dumpPath, err)
+	}
+
+	if err := ForEachIncidentFileFS(fsys, input.addIncidentFile); err != nil {
+		return nil, fmt.Errorf("could not read incidents of '%s': %w", dumpPath, err)
+	}
+
+	return input, nil
+}
+
+// readResourceDir reads the description, events, links, and logs in the directory of the resource at builder. Any of
+// them may be missing, as when events were collected for a resource which was not watched.
+func (input *mergeInput) readResourceDir(fsys DumpFS, builder ResourcePathBuilder) error {
+	dir := builder.Build()
+
+	resourceFile := path.Join(dir, builder.Name+".yaml")
+	if data, err := fs.ReadFile(fsys, resourceFile); err == nil {
+		if err := input.addRevision(builder, modTime(fsys, resourceFile), data); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("could not read resource file '%s': %w", resourceFile, err)
+	}
+
+	eventsFile := path.Join(dir, builder.Name+EventsFileSuffix)
+	if data, err := fs.ReadFile(fsys, eventsFile); err == nil {
+		fallback := modTime(fsys, eventsFile)
+
+		for _, line := range splitLines(data) {
+			input.addEventLine(builder, fallback, line)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("could not read events file '%s': %w", eventsFile, err)
+	}
+
+	linksFile := path.Join(dir, builder.Name+LinksFileSuffix)
+	if data, err := fs.ReadFile(fsys, linksFile); err == nil {
+		var references []LinkReference
+		if err := yaml.Unmarshal(data, &references); err != nil {
+			return fmt.Errorf("could not unmarshal links file '%s': %w", linksFile, err)
+		}
+
+		input.links[builder] = references
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("could not read links file '%s': %w", linksFile, err)
+	}
+
+	if builder.Kind != "Pod" {
+		return nil
+	}
+
+	containers, err := containerNames(fsys, dir)
+	if err != nil {
+		return err
+	}
+
+	for _, container := range containers {
+		data, err := ReadContainerLog(fsys, dir, container)
+		if err != nil {
+			return err
+		}
+
+		input.addLogs(builder, container, modTime(fsys, path.Join(dir, container+".log")), data)
+	}
+
+	return nil
+}
+
+// readDBMergeInput reads every revision of each resource in the db dump at dbPath.
+func readDBMergeInput(dbPath string) (*mergeInput, error) {
+	dump, err := OpenDBDump(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer dump.Close()
+
+	input := newMergeInput(dbPath)
+
+	// log chunks are not read with their times, so the logs are treated as written when the dump was stopped
+	logTime := time.Time{}
+
+	if manifest, err := dump.Manifest(); err == nil {
+		input.start = manifest.StartTime
+		logTime = manifest.StartTime
+
+		if manifest.StopTime != nil {
+			logTime = *manifest.StopTime
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("could not read manifest of '%s': %w", dbPath, err)
+	}
+
+	if err := dump.ForEachRevision(input.addRevision); err != nil {
+		return nil, fmt.Errorf("could not read resources of '%s': %w", dbPath, err)
+	}
+
+	err = dump.ForEachEvent(func(builder ResourcePathBuilder, line []byte) error {
+		input.addEventLine(builder, input.start, line)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read events of '%s': %w", dbPath, err)
+	}
+
+	err = dump.ForEachLog(func(namespace string, pod string, container string, data []byte) error {
+		input.addLogs(ResourcePathBuilder{}.WithNamespace(namespace).WithKind("Pod").WithName(pod), container, logTime, data)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read logs of '%s': %w", dbPath, err)
+	}
+
+	err = dump.ForEachLinks(func(parent ResourcePathBuilder, references []LinkReference) error {
+		input.links[parent] = references
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read links of '%s': %w", dbPath, err)
+	}
+
+	if err := dump.ForEachIncidentFile(input.addIncidentFile); err != nil {
+		return nil, fmt.Errorf("could not read incidents of '%s': %w", dbPath, err)
+	}
+
+	return input, nil
+}
+
+// MergeDumps writes a new dump to dst holding the union of the resources in the dumps at dumpPaths, which may be
+// directories, archives, or db dumps. If dst ends with ".db" a db dump is written holding every distinct revision of
+// each resource ordered by resourceVersion, otherwise a directory dump is written holding the latest revision. When
+// dumps hold the same resourceVersion of a resource with different content, the revision from the dump given first is
+// kept and a conflict is returned for each of the others. Events are merged by time, removing the events which were
+// collected by more than one dump, and container logs are joined in the order the dumps were started, removing the
+// lines captured by more than one dump. Links are recomputed for a merged directory dump, and copied from the inputs
+// for a merged db dump.
+func MergeDumps(dst string, dumpPaths ...string) ([]MergeConflict, error) {
+	if _, err := os.Stat(dst); err == nil {
+		return nil, fmt.Errorf("destination '%s' already exists", dst)
+	}
+
+	inputs := make([]*mergeInput, 0, len(dumpPaths))
+
+	for _, dumpPath := range dumpPaths {
+		input, err := readMergeInput(dumpPath)
+		if err != nil {
+			return nil, err
+		}
+
+		inputs = append(inputs, input)
+	}
+
+	merged := &mergedDump{
+		histories: map[ResourcePathBuilder][]revision{},
+		events:    map[ResourcePathBuilder][]eventLine{},
+		logs:      map[ResourcePathBuilder][]mergedLogs{},
+	}
+
+	var conflicts []MergeConflict
+
+	for _, builder := range mergeBuilders(inputs) {
+		history, builderConflicts := mergeRevisions(inputs, builder)
+		conflicts = append(conflicts, builderConflicts...)
+
+		merged.builders = append(merged.builders, builder)
+		merged.histories[builder] = history
+		merged.events[builder] = mergeEvents(inputs, builder)
+		merged.logs[builder] = mergeLogs(inputs, builder)
+	}
+
+	merged.links = mergeLinks(inputs, merged.histories)
+	merged.incidents = mergeIncidents(inputs)
+
+	if strings.HasSuffix(dst, ".db") {
+		if err := merged.writeDB(dst); err != nil {
+			return nil, err
+		}
+
+		return conflicts, nil
+	}
+
+	if err := merged.writeDir(dst); err != nil {
+		return nil, err
+	}
+
+	if _, err := LinkDump(dst, LinkOptions{}); err != nil {
+		return nil, fmt.Errorf("could not link merged dump: %w", err)
+	}
+
+	return conflicts, nil
+}
+
+// mergedDump is the result of merging dumps, before it is written.
+type mergedDump struct {
+	builders  []ResourcePathBuilder
+	histories map[ResourcePathBuilder][]revision
+	events    map[ResourcePathBuilder][]eventLine
+	logs      map[ResourcePathBuilder][]mergedLogs
+	links     map[ResourcePathBuilder][]LinkReference
+	incidents []incidentFile
+}
+
+// mergedLogs are the joined logs of a container.
+type mergedLogs struct {
+	container string
+	containerLogs
+}
+
+func (merged *mergedDump) writeDir(dst string) error {
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return fmt.Errorf("could not create destination '%s': %w", dst, err)
+	}
+
+	sink := NewDirSink(dst)
+
+	for _, builder := range merged.builders {
+		// a directory dump only holds the latest revision
+		if history := merged.histories[builder]; len(history) > 0 {
+			if err := sink.writeResource(builder, history[len(history)-1].data); err != nil {
+				return err
+			}
+		}
+
+		if events := merged.events[builder]; len(events) > 0 {
+			lines := make([]byte, 0)
+			for _, event := range events {
+				lines = append(lines, event.line...)
+			}
+
+			if err := sink.appendEventLines(builder, lines); err != nil {
+				return err
+			}
+		}
+
+		for _, logs := range merged.logs[builder] {
+			if err := sink.AppendLog(builder.Namespace, builder.Name, logs.container, logs.data); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, file := range merged.incidents {
+		if err := sink.WriteIncidentFile(file.incident, file.name, file.data); err != nil {
+			return err
+		}
+	}
+
+	return sink.Close()
+}
+
+func (merged *mergedDump) writeDB(dst string) error {
+	sink, err := NewDBSink(dst)
+	if err != nil {
+		return err
+	}
+
+	if err := merged.writeDBRecords(sink); err != nil {
+		sink.Close()
+		return err
+	}
+
+	return sink.Close()
+}
+
+func (merged *mergedDump) writeDBRecords(sink *DBSink) error {
+	for _, builder := range merged.builders {
+		key := resourceKey(builder.Kind, builder.Namespace, builder.Name)
+
+		// revisions are read back in the order they are indexed, so a revision is never indexed before an older one
+		var t time.Time
+		for _, revision := range merged.histories[builder] {
+			if revision.modTime.After(t) {
+				t = revision.modTime
+			}
+
+			if err := sink.writeResource(builder, t, revision.data); err != nil {
+				return err
+			}
+		}
+
+		for _, event := range merged.events[builder] {
+			if err := sink.appendEventLine(key, event.t, event.line); err != nil {
+				return err
+			}
+		}
+
+		for _, logs := range merged.logs[builder] {
+			if err := sink.appendLog(containerKey(builder.Namespace, builder.Name, logs.container), logs.t, logs.data); err != nil {
+				return err
+			}
+		}
+
+		if references := merged.links[builder]; len(references) > 0 {
+			if err := sink.RecordLinks(builder, referenceLinks(builder, references)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, file := range merged.incidents {
+		if err := sink.WriteIncidentFile(file.incident, file.name, file.data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mergeBuilders returns every resource with a revision, events, or logs in any of the inputs, sorted by their path.
+func mergeBuilders(inputs []*mergeInput) []ResourcePathBuilder {
+	seen := map[ResourcePathBuilder]bool{}
+	var builders []ResourcePathBuilder
+
+	add := func(builder ResourcePathBuilder) {
+		if !seen[builder] {
+			seen[builder] = true
+			builders = append(builders, builder)
+		}
+	}
+
+	for _, input := range inputs {
+		for builder := range input.revisions {
+			add(builder)
+		}
+
+		for builder := range input.events {
+			add(builder)
+		}
+
+		for builder := range input.logs {
+			add(builder)
+		}
+	}
+
+	sort.Slice(builders, func(i, j int) bool {
+		return builders[i].Build() < builders[j].Build()
+	})
+
+	return builders
+}
+
+// mergeRevisions returns the distinct revisions of the resource at builder from oldest to newest. Revisions are
+// grouped by resourceVersion, or by content for revisions without one, keeping the revision from the first input of
+// each group. A conflict is returned for each later input holding the same resourceVersion with different content.
+func mergeRevisions(inputs []*mergeInput, builder ResourcePathBuilder) ([]revision, []MergeConflict) {
+	var history []revision
+	var conflicts []MergeConflict
+
+	groups := map[string]int{}
+	reported := map[string]bool{}
+
+	for _, input := range inputs {
+		for _, next := range input.revisions[builder] {
+			group := "resourceVersion " + next.resourceVersion
+			if next.resourceVersion == "" {
+				group = "content " + string(next.data)
+			}
+
+			i, found := groups[group]
+			if !found {
+				groups[group] = len(history)
+				history = append(history, next)
+
+				continue
+			}
+
+			kept := history[i]
+			if kept.input == input || bytes.Equal(kept.data, next.data) || reported[group+"\x00"+input.name] {
+				continue
+			}
+
+			reported[group+"\x00"+input.name] = true
+			conflicts = append(conflicts, MergeConflict{
+				Builder:         builder,
+				ResourceVersion: next.resourceVersion,
+				Kept:            kept.input.name,
+				Dropped:         input.name,
+			})
+		}
+	}
+
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[j].newerThan(history[i])
+	})
+
+	return history, conflicts
+}
+
+// mergeEvents returns the events regarding the resource at builder from every input sorted by time. An event collected
+// by more than one input is kept once, while an event repeated within a single input is kept as many times as it was
+// repeated.
+func mergeEvents(inputs []*mergeInput, builder ResourcePathBuilder) []eventLine {
+	var lines []eventLine
+	counts := map[string]int{}
+
+	for _, input := range inputs {
+		inputCounts := map[string]int{}
+
+		for _, line := range input.events[builder] {
+			inputCounts[string(line.line)]++
+
+			if inputCounts[string(line.line)] > counts[string(line.line)] {
+				counts[string(line.line)]++
+				lines = append(lines, line)
+			}
+		}
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].t.Before(lines[j].t)
+	})
+
+	return lines
+}
+
+// containerNames returns the names of the containers with logs in the resource directory dir of fsys.
+func containerNames(fsys fs.FS, dir string) ([]string, error) {
+	entries, err := fs.ReadDir(fsys, fsPath(dir))
+	if err != nil {
+		return nil, fmt.Errorf("could not read directory '%s': %w", dir, err)
+	}
+
+	var names []string
+	seen := map[string]bool{}
+
+	for _, entry := range entries {
+		match := segmentPattern.FindStringSubmatch(entry.Name())
+		if match == nil || !entry.Type().IsRegular() || seen[match[1]] {
+			continue
+		}
+
+		seen[match[1]] = true
+		names = append(names, match[1])
+	}
+
+	return names, nil
+}
+
+// mergeLogs returns the logs of each container in the pod at builder, joining the logs from each input in the order
+// the inputs were started, since log lines have no timestamps.
+func mergeLogs(inputs []*mergeInput, builder ResourcePathBuilder) []mergedLogs {
+	byStart := append([]*mergeInput{}, inputs...)
+	sort.SliceStable(byStart, func(i, j int) bool {
+		return byStart[i].start.Before(byStart[j].start)
+	})
+
+	var merged []mergedLogs
+	indices := map[string]int{}
+
+	for _, input := range byStart {
+		containers := make([]string, 0, len(input.logs[builder]))
+		for container := range input.logs[builder] {
+			containers = append(containers, container)
+		}
+
+		sort.Strings(containers)
+
+		for _, container := range containers {
+			logs := input.logs[builder][container]
+
+			i, found := indices[container]
+			if !found {
+				indices[container] = len(merged)
+				merged = append(merged, mergedLogs{container: container, containerLogs: containerLogs{t: logs.t, data: append([]byte{}, logs.data...)}})
+
+				continue
+			}
+
+			merged[i].data = joinLogs(merged[i].data, logs.data)
+			if logs.t.After(merged[i].t) {
+				merged[i].t = logs.t
+			}
+		}
+	}
+
+	return merged
+}
+
+// mergeLinks returns the links recorded in any input, keyed by their parent, keeping only the links between resources
+// in the merged dump. When inputs record a link to the same child, the link from the first input is kept.
+func mergeLinks(inputs []*mergeInput, histories map[ResourcePathBuilder][]revision) map[ResourcePathBuilder][]LinkReference {
+	links := map[ResourcePathBuilder][]LinkReference{}
+	seen := map[ResourcePathBuilder]map[ResourcePathBuilder]bool{}
+
+	for _, input := range inputs {
+		for parent, references := range input.links {
+			if len(histories[parent]) == 0 {
+				continue
+			}
+
+			if seen[parent] == nil {
+				seen[parent] = map[ResourcePathBuilder]bool{}
+			}
+
+			for _, reference := range references {
+				child := ResourcePathBuilder{}.WithKind(reference.Kind).WithNamespace(reference.Namespace).WithName(reference.Name)
+				if len(histories[child]) == 0 || seen[parent][child] {
+					continue
+				}
+
+				seen[parent][child] = true
+				links[parent] = append(links[parent], reference)
+			}
+		}
+	}
+
+	return links
+}
+
+// mergeIncidents returns the incident files of every input, keeping the file from the first input when inputs hold the
+// same file.
+func mergeIncidents(inputs []*mergeInput) []incidentFile {
+	var files []incidentFile
+	seen := map[string]bool{}
+
+	for _, input := range inputs {
+		for _, file := range input.incidents {
+			if key := path.Join(file.incident, file.name); !seen[key] {
+				seen[key] = true
+				files = append(files, file)
+			}
+		}
+	}
+
+	return files
+}
+
+// joinLogs appends next to logs, skipping the lines at the start of next which are already at the end of logs, as
+// happens when captures overlap. Lines of next found anywhere else in logs are kept, since containers often log the
+// same lines again.
+func joinLogs(logs []byte, next []byte) []byte {
+	if len(logs) == 0 {
+		return append([]byte{}, next...)
+	} else if len(next) == 0 {
+		return logs
+	}
+
+	if !bytes.HasSuffix(logs, []byte("\n")) {
+		logs = append(logs, '\n')
+	}
+
+	a := splitLines(logs)
+	b := splitLines(next)
+
+	// Knuth-Morris-Pratt over lines, finding the longest prefix of b which ends a
+	failure := make([]int, len(b))
+	for i, k := 1, 0; i < len(b); i++ {
+		for k > 0 && !bytes.Equal(b[i], b[k]) {
+			k = failure[k-1]
+		}
+
+		if bytes.Equal(b[i], b[k]) {
+			k++
+		}
+
+		failure[i] = k
+	}
+
+	matched := 0
+	for _, line := range a {
+		if matched == len(b) {
+			matched = failure[matched-1]
+		}
+
+		for matched > 0 && !bytes.Equal(line, b[matched]) {
+			matched = failure[matched-1]
+		}
+
+		if bytes.Equal(line, b[matched]) {
+			matched++
+		}
+	}
+
+	return append(logs, bytes.Join(b[matched:], nil)...)
+}
+
+// splitLines splits data after each newline, without the empty line following a trailing newline.
+func splitLines(data []byte) [][]byte {
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
@@ -0,0 +1,240 @@
+package kubedump
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apicorev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	apimetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+func TestJoinLogs(t *testing.T) {
+	assert.Equal(t, "a\nb\n", string(joinLogs(nil, []byte("a\nb\n"))))
+	assert.Equal(t, "a\nb\n", string(joinLogs([]byte("a\nb\n"), nil)))
+	assert.Equal(t, "a\nb\nc\nd\n", string(joinLogs([]byte("a\nb\nc\n"), []byte("b\nc\nd\n"))))
+	assert.Equal(t, "a\nb\nc\n", string(joinLogs([]byte("a\nb\nc\n"), []byte("b\nc\n"))), "logs ending the previous logs should not be repeated")
+	assert.Equal(t, "a\nb\nc\nb\n", string(joinLogs([]byte("a\nb\nc\n"), []byte("b\n"))), "logs only found before the end should be kept")
+	assert.Equal(t, "ok\nerror\nok\nerror\n", string(joinLogs([]byte("ok\nerror\nok\n"), []byte("error\n"))))
+	assert.Equal(t, "a\nb\na\nb\na\nc\n", string(joinLogs([]byte("a\nb\na\nb\n"), []byte("a\nb\na\nc\n"))))
+	assert.Equal(t, "a\nb\nc\nd", string(joinLogs([]byte("a\nb"), []byte("c\nd"))))
+	assert.Equal(t, "a\na\na\nb\n", string(joinLogs([]byte("a\na\n"), []byte("a\na\na\nb\n"))))
+}
+
+func testEvent(t time.Time, reason string) *eventsv1.Event {
+	return &eventsv1.Event{
+		EventTime: apimetav1.NewMicroTime(t),
+		Type:      apicorev1.EventTypeNormal,
+		Reason:    reason,
+		Regarding: apicorev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "sample-pod"},
+	}
+}
+
+func TestMergeDumps(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	first := path.Join(dir, "first")
+	sink := NewDirSink(first)
+
+	pod := testUnstructured("Pod", "default", "sample-pod")
+	pod.SetResourceVersion("10")
+	require.NoError(t, sink.WriteResource(pod))
+
+	secret := testUnstructured("Secret", "default", "sample-secret")
+	secret.SetResourceVersion("5")
+	require.NoError(t, sink.WriteResource(secret))
+
+	require.NoError(t, sink.AppendEvent(testEvent(start.Add(time.Minute), "Scheduled")))
+	require.NoError(t, sink.AppendEvent(testEvent(start.Add(3*time.Minute), "Started")))
+	require.NoError(t, sink.AppendLog("default", "sample-pod", "app", []byte("1\n2\n3\n")))
+	require.NoError(t, sink.WriteIncidentFile("crash-loop", IncidentMarkerFileName, []byte("trigger: crash-loop\n")))
+	require.NoError(t, sink.Close())
+	require.NoError(t, WriteManifest(first, &Manifest{StartTime: start.Add(time.Hour)}))
+
+	second := path.Join(dir, "second")
+	sink = NewDirSink(second)
+
+	pod.SetResourceVersion("12")
+	pod.SetLabels(map[string]string{"a": "b"})
+	require.NoError(t, sink.WriteResource(pod))
+
+	secret.SetLabels(map[string]string{"a": "b"})
+	require.NoError(t, sink.WriteResource(secret))
+
+	require.NoError(t, sink.WriteResource(testUnstructured("ConfigMap", "default", "sample-configmap")))
+	require.NoError(t, sink.AppendEvent(testEvent(start.Add(2*time.Minute), "Pulled")))
+	require.NoError(t, sink.AppendEvent(testEvent(start.Add(3*time.Minute), "Started")))
+	require.NoError(t, sink.AppendLog("default", "sample-pod", "app", []byte("0\n1\n2\n")))
+	require.NoError(t, sink.Close())
+	require.NoError(t, WriteManifest(second, &Manifest{StartTime: start}))
+
+	dst := path.Join(dir, "merged")
+	conflicts, err := MergeDumps(dst, first, second)
+	require.NoError(t, err)
+
+	assert.Equal(t, []MergeConflict{{
+		Builder:         ResourcePathBuilder{}.WithNamespace("default").WithKind("Secret").WithName("sample-secret"),
+		ResourceVersion: "5",
+		Kept:            first,
+		Dropped:         second,
+	}}, conflicts)
+
+	resource, err := NewResourceFromFile(path.Join(dst, "default", "Pod", "sample-pod", "sample-pod.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "b"}, resource.GetLabels(), "the revision with the highest resourceVersion should be kept")
+
+	resource, err = NewResourceFromFile(path.Join(dst, "default", "Secret", "sample-secret", "sample-secret.yaml"))
+	require.NoError(t, err)
+	assert.Empty(t, resource.GetLabels(), "the first dump should win conflicts")
+
+	assert.FileExists(t, path.Join(dst, "default", "ConfigMap", "sample-configmap", "sample-configmap.yaml"))
+	assert.FileExists(t, path.Join(dst, IncidentsDirName, "crash-loop", IncidentMarkerFileName))
+
+	data, err := os.ReadFile(path.Join(dst, "default", "Pod", "sample-pod", "sample-pod"+EventsFileSuffix))
+	require.NoError(t, err)
+
+	lines := splitLines(data)
+	require.Len(t, lines, 3)
+	assert.Contains(t, string(lines[0]), "Scheduled")
+	assert.Contains(t, string(lines[1]), "Pulled")
+	assert.Contains(t, string(lines[2]), "Started")
+
+	data, err = os.ReadFile(path.Join(dst, "default", "Pod", "sample-pod", "app.log"))
+	require.NoError(t, err)
+	assert.Equal(t, "0\n1\n2\n3\n", string(data), "logs should be joined in the order the dumps were started")
+
+	_, err = MergeDumps(dst, first, second)
+	assert.Error(t, err, "merging into an existing destination should fail")
+}
+
+func TestMergeDumpsConflicts(t *testing.T) {
+	dir := t.TempDir()
+	builder := ResourcePathBuilder{}.WithNamespace("default").WithKind("ConfigMap").WithName("sample-configmap")
+
+	writeDump := func(name string, resourceVersion string, labels map[string]string) string {
+		dumpPath := path.Join(dir, name)
+		sink := NewDirSink(dumpPath)
+
+		configMap := testUnstructured("ConfigMap", "default", "sample-configmap")
+		configMap.SetResourceVersion(resourceVersion)
+		configMap.SetLabels(labels)
+		require.NoError(t, sink.WriteResource(configMap))
+		require.NoError(t, sink.Close())
+
+		return dumpPath
+	}
+
+	a := writeDump("a", "5", map[string]string{"dump": "a"})
+	b := writeDump("b", "7", nil)
+	c := writeDump("c", "5", map[string]string{"dump": "c"})
+
+	conflicts, err := MergeDumps(path.Join(dir, "merged"), a, b, c)
+	require.NoError(t, err)
+
+	assert.Equal(t, []MergeConflict{{Builder: builder, ResourceVersion: "5", Kept: a, Dropped: c}}, conflicts,
+		"revisions with the same resourceVersion should be compared even when a newer revision was seen between them")
+}
+
+func TestMergeDumpsEvents(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	unwatched := testEvent(start.Add(2*time.Minute), "Unhealthy")
+	unwatched.Regarding = apicorev1.ObjectReference{Kind: "Deployment", Namespace: "default", Name: "sample-deployment"}
+
+	first := path.Join(dir, "first")
+	sink := NewDirSink(first)
+	require.NoError(t, sink.AppendEvent(testEvent(start.Add(time.Minute), "BackOff")))
+	require.NoError(t, sink.AppendEvent(testEvent(start.Add(time.Minute), "BackOff")))
+	require.NoError(t, sink.AppendEvent(unwatched))
+	require.NoError(t, sink.Close())
+
+	second := path.Join(dir, "second")
+	sink = NewDirSink(second)
+	require.NoError(t, sink.AppendEvent(testEvent(start.Add(time.Minute), "BackOff")))
+	require.NoError(t, sink.AppendEvent(unwatched))
+	require.NoError(t, sink.Close())
+
+	dst := path.Join(dir, "merged")
+	_, err := MergeDumps(dst, first, second)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(path.Join(dst, "default", "Pod", "sample-pod", "sample-pod"+EventsFileSuffix))
+	require.NoError(t, err)
+	assert.Len(t, splitLines(data), 2, "events repeated within a dump should be kept")
+
+	data, err = os.ReadFile(path.Join(dst, "default", "Deployment", "sample-deployment", "sample-deployment"+EventsFileSuffix))
+	require.NoError(t, err)
+	assert.Len(t, splitLines(data), 1, "events for resources which were not dumped should be kept")
+}
+
+func TestMergeDumpsDB(t *testing.T) {
+	dir := t.TempDir()
+	builder := ResourcePathBuilder{}.WithNamespace("default").WithKind("Pod").WithName("sample-pod")
+	pod := testUnstructured("Pod", "default", "sample-pod")
+
+	first := path.Join(dir, "first.db")
+	dbSink, err := NewDBSink(first)
+	require.NoError(t, err)
+
+	for _, resourceVersion := range []string{"1", "3"} {
+		pod.SetResourceVersion(resourceVersion)
+		require.NoError(t, dbSink.WriteResource(pod))
+	}
+
+	require.NoError(t, dbSink.AppendLog("default", "sample-pod", "app", []byte("1\n2\n")))
+	require.NoError(t, dbSink.Close())
+
+	second := path.Join(dir, "second")
+	dirSink := NewDirSink(second)
+
+	pod.SetResourceVersion("2")
+	require.NoError(t, dirSink.WriteResource(pod))
+	require.NoError(t, dirSink.AppendLog("default", "sample-pod", "app", []byte("2\n3\n")))
+	require.NoError(t, dirSink.Close())
+
+	dst := path.Join(dir, "merged.db")
+	conflicts, err := MergeDumps(dst, first, second)
+	require.NoError(t, err)
+	assert.Empty(t, conflicts)
+
+	dump, err := OpenDBDump(dst)
+	require.NoError(t, err)
+	defer dump.Close()
+
+	revisions, err := dump.Revisions(builder)
+	require.NoError(t, err)
+
+	versions := []string{}
+	for _, data := range revisions {
+		obj := map[string]interface{}{}
+		require.NoError(t, yaml.Unmarshal(data, &obj))
+
+		versions = append(versions, (&unstructured.Unstructured{Object: obj}).GetResourceVersion())
+	}
+
+	assert.Equal(t, []string{"1", "2", "3"}, versions, "every revision should be kept in resourceVersion order")
+
+	logs := []byte{}
+	require.NoError(t, dump.ForEachLog(func(namespace string, pod string, container string, data []byte) error {
+		logs = append(logs, data...)
+		return nil
+	}))
+	assert.Equal(t, "1\n2\n3\n", string(logs))
+
+	// a directory dump only holds the latest revision
+	dirDst := path.Join(dir, "merged")
+	_, err = MergeDumps(dirDst, first, second)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(path.Join(dirDst, "default", "Pod", "sample-pod", "sample-pod.yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `resourceVersion: "3"`)
+}
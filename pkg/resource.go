@@ -2,6 +2,7 @@ package kubedump
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
 	"path"
 
@@ -28,6 +29,9 @@ type Resource interface {
 	GetKind() string
 
 	GetUID() types.UID
+
+	// GetObject returns the full contents of the resource, or nil if the resource was not built from an object.
+	GetObject() map[string]interface{}
 }
 
 func NewResourceFromFile(path string) (Resource, error) {
@@ -36,6 +40,20 @@ func NewResourceFromFile(path string) (Resource, error) {
 		return nil, fmt.Errorf("could not read resource file: %w", err)
 	}
 
+	return newResourceFromData(data)
+}
+
+// NewResourceFromFS reads the resource file with the given name from fsys.
+func NewResourceFromFS(fsys fs.FS, name string) (Resource, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("could not read resource file: %w", err)
+	}
+
+	return newResourceFromData(data)
+}
+
+func newResourceFromData(data []byte) (Resource, error) {
 	m := map[string]interface{}{}
 	if err := yaml.Unmarshal(data, &m); err != nil {
 		return nil, fmt.Errorf("could not unmarshal data to suntructured: %w", err)
@@ -54,6 +72,7 @@ type resource struct {
 	ownerReferences []apimetav1.OwnerReference
 	kind            string
 	id              types.UID
+	object          map[string]interface{}
 }
 
 func (resource *resource) String() string {
@@ -84,6 +103,10 @@ func (resource *resource) GetUID() types.UID {
 	return resource.id
 }
 
+func (resource *resource) GetObject() map[string]interface{} {
+	return resource.object
+}
+
 type ResourceBuilder struct {
 	resource resource
 }
@@ -99,6 +122,7 @@ func (builder *ResourceBuilder) FromUnstructured(u *unstructured.Unstructured) *
 	builder.resource.ownerReferences = u.GetOwnerReferences()
 	builder.resource.kind = u.GetKind()
 	builder.resource.id = u.GetUID()
+	builder.resource.object = u.Object
 	return builder
 }
 
@@ -155,8 +179,9 @@ type ResourcePathBuilder struct {
 	BasePath  string
 	Namespace string
 
-	ParentName string
-	ParentKind string
+	ParentNamespace string
+	ParentName      string
+	ParentKind      string
 
 	Name string
 	Kind string
@@ -182,6 +207,11 @@ func (builder ResourcePathBuilder) WithKind(kind string) ResourcePathBuilder {
 	return builder
 }
 
+func (builder ResourcePathBuilder) WithParentNamespace(namespace string) ResourcePathBuilder {
+	builder.ParentNamespace = namespace
+	return builder
+}
+
 func (builder ResourcePathBuilder) WithParentName(name string) ResourcePathBuilder {
 	builder.ParentName = name
 	return builder
@@ -211,6 +241,16 @@ func (builder ResourcePathBuilder) Build() string {
 	return path.Join(builder.BasePath, builder.Namespace, builder.Kind, builder.Name)
 }
 
+// BuildWithParent builds the path to the resource under its parent's directory. Cluster-scoped resources have no
+// namespace, so either the resource or its parent may be cluster-scoped. Namespaced resources outside their parent's
+// namespace, including those under a cluster-scoped parent, are nested under their namespace, since resources in
+// different namespaces may share a name.
 func (builder ResourcePathBuilder) BuildWithParent() string {
-	return path.Join(builder.BasePath, builder.Namespace, builder.ParentKind, builder.ParentName, builder.Kind, builder.Name)
+	parentPath := path.Join(builder.BasePath, builder.ParentNamespace, builder.ParentKind, builder.ParentName)
+
+	if builder.Namespace != "" && builder.Namespace != builder.ParentNamespace {
+		return path.Join(parentPath, builder.Namespace, builder.Kind, builder.Name)
+	}
+
+	return path.Join(parentPath, builder.Kind, builder.Name)
 }
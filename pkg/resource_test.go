@@ -19,3 +19,23 @@ func TestResourceFromFile(t *testing.T) {
 	assert.Equal(t, "default", resource.GetNamespace())
 	assert.Equal(t, "Pod", resource.GetKind())
 }
+
+func TestResourcePathBuilderBuildWithParent(t *testing.T) {
+	builder := ResourcePathBuilder{}.WithBase("base")
+
+	pod := builder.WithNamespace("default").WithKind("Pod").WithName("web").
+		WithParentNamespace("default").WithParentKind("Service").WithParentName("web")
+	assert.Equal(t, filepath.Join("base", "default", "Service", "web", "Pod", "web"), pod.BuildWithParent())
+
+	volume := builder.WithKind("PersistentVolume").WithName("pv").
+		WithParentNamespace("default").WithParentKind("PersistentVolumeClaim").WithParentName("claim")
+	assert.Equal(t, filepath.Join("base", "default", "PersistentVolumeClaim", "claim", "PersistentVolume", "pv"), volume.BuildWithParent())
+
+	scheduled := builder.WithNamespace("default").WithKind("Pod").WithName("web").
+		WithParentKind("Node").WithParentName("node")
+	assert.Equal(t, filepath.Join("base", "Node", "node", "default", "Pod", "web"), scheduled.BuildWithParent())
+
+	binding := builder.WithNamespace("other").WithKind("RoleBinding").WithName("read").
+		WithParentNamespace("default").WithParentKind("ServiceAccount").WithParentName("app")
+	assert.Equal(t, filepath.Join("base", "default", "ServiceAccount", "app", "other", "RoleBinding", "read"), binding.BuildWithParent())
+}
@@ -0,0 +1,36 @@
+package kubedump
+
+import (
+	eventsv1 "k8s.io/api/events/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Sink stores the resources, events, logs, and links collected while dumping a cluster. Resources passed to a Sink
+// are identified by ResourcePathBuilders without a base path. Implementations must be safe for concurrent use.
+type Sink interface {
+	// WriteResource stores the latest revision of a resource.
+	WriteResource(u *unstructured.Unstructured) error
+
+	// AppendEvent appends an event to the events of the resource it regards.
+	AppendEvent(event *eventsv1.Event) error
+
+	// AppendLog appends a chunk of logs for a container in a pod.
+	AppendLog(namespace string, pod string, container string, data []byte) error
+
+	// RecordLinks stores the links under parent, replacing any links previously recorded for it. The parent and
+	// children of each link have already been written.
+	RecordLinks(parent ResourcePathBuilder, links []ResourceLink) error
+
+	// WriteIncidentFile stores a file collected for an incident, replacing any file of the same name already written for
+	// it. The name is a slash separated path relative to the incident.
+	WriteIncidentFile(incident string, name string, data []byte) error
+
+	// Close flushes any buffered data and releases the resources held by the sink.
+	Close() error
+}
+
+// DeletionRecorder is implemented by sinks which need to know when a resource is deleted from the cluster. The last
+// revision of the resource is written with WriteResource before RecordDeletion is called.
+type DeletionRecorder interface {
+	RecordDeletion(builder ResourcePathBuilder) error
+}
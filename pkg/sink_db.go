@@ -0,0 +1,301 @@
+package kubedump
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	eventsv1 "k8s.io/api/events/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// DBFileName is the name of the database file written in a dump's directory when dumping with the db format.
+const DBFileName = "kubedump.db"
+
+// Buckets of a db dump. Resources are keyed by "<kind>/<namespace>/<name>", with an empty namespace for cluster scoped
+// resources. Revisions, events, and logs hold a nested bucket for each resource (or container) whose values are keyed
+// by a big endian sequence number, so they are iterated in the order they were written.
+var (
+	bucketResources = []byte("resources")
+	bucketRevisions = []byte("revisions")
+	bucketEvents    = []byte("events")
+	bucketLogs      = []byte("logs")
+	bucketLinks     = []byte("links")
+
+	// bucketIncidents holds a nested bucket for each incident whose values are keyed by the name of the incident file.
+	bucketIncidents = []byte("incidents")
+
+	// bucketMeta holds information about the dump itself, like its manifest at keyManifest.
+	bucketMeta = []byte("meta")
+
+	// bucketIndexNamespace is keyed by "<namespace>/<kind>/<name>".
+	bucketIndexNamespace = []byte("index-namespace")
+
+	// bucketIndexName is keyed by "<name>/<kind>/<namespace>".
+	bucketIndexName = []byte("index-name")
+
+	// bucketIndexTime is keyed by "<timestamp>/<sequence>" and holds "<record> <key>" for each revision, event, and log
+	// chunk, where record is one of the record constants below.
+	bucketIndexTime = []byte("index-time")
+
+	dbBuckets = [][]byte{
+		bucketResources, bucketRevisions, bucketEvents, bucketLogs, bucketLinks,
+		bucketIndexNamespace, bucketIndexName, bucketIndexTime,
+	}
+
+	// dbOptionalBuckets were added after the db format was introduced, so they may be missing from older dumps.
+	dbOptionalBuckets = [][]byte{bucketIncidents, bucketMeta}
+
+	keyManifest = []byte("manifest")
+)
+
+// The kinds of records in the time index of a db dump.
+const (
+	RecordRevision = "revision"
+	RecordEvent    = "event"
+	RecordLog      = "log"
+)
+
+// indexTimeFormat is a fixed width time format, so that index keys sort by time.
+const indexTimeFormat = "2006-01-02T15:04:05.000000000Z"
+
+func resourceKey(kind string, namespace string, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+func builderFromResourceKey(key string) (ResourcePathBuilder, error) {
+	parts := strings.SplitN(key, "/", 3)
+	if len(parts) != 3 {
+		return ResourcePathBuilder{}, fmt.Errorf("invalid resource key '%s'", key)
+	}
+
+	return ResourcePathBuilder{}.WithKind(parts[0]).WithNamespace(parts[1]).WithName(parts[2]), nil
+}
+
+func containerKey(namespace string, pod string, container string) string {
+	return namespace + "/" + pod + "/" + container
+}
+
+func sequenceKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// DBSink is a Sink storing a dump in a single bbolt database file. Unlike a directory dump, every revision of a
+// resource is kept, and resources, events, and logs are indexed by namespace, name, and time.
+type DBSink struct {
+	db  *bolt.DB
+	now func() time.Time
+}
+
+// NewDBSink creates a Sink writing the dump to the database at dbPath, creating it if it does not exist.
+func NewDBSink(dbPath string) (*DBSink, error) {
+	db, err := bolt.Open(dbPath, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("could not open database '%s': %w", dbPath, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range append(dbBuckets, dbOptionalBuckets...) {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return fmt.Errorf("could not create bucket '%s': %w", name, err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &DBSink{
+		db:  db,
+		now: time.Now,
+	}, nil
+}
+
+// appendRecord appends value to the nested bucket key of parent, and indexes it at t.
+func appendRecord(tx *bolt.Tx, parent []byte, record string, key string, t time.Time, value []byte) error {
+	bucket, err := tx.Bucket(parent).CreateBucketIfNotExists([]byte(key))
+	if err != nil {
+		return fmt.Errorf("could not create %s bucket for '%s': %w", record, key, err)
+	}
+
+	seq, err := bucket.NextSequence()
+	if err != nil {
+		return fmt.Errorf("could not get next %s sequence for '%s': %w", record, key, err)
+	}
+
+	if err := bucket.Put(sequenceKey(seq), value); err != nil {
+		return fmt.Errorf("could not write %s for '%s': %w", record, key, err)
+	}
+
+	index := tx.Bucket(bucketIndexTime)
+
+	indexSeq, err := index.NextSequence()
+	if err != nil {
+		return fmt.Errorf("could not get next time index sequence: %w", err)
+	}
+
+	indexKey := fmt.Sprintf("%s/%016x", t.UTC().Format(indexTimeFormat), indexSeq)
+	if err := index.Put([]byte(indexKey), []byte(record+" "+key)); err != nil {
+		return fmt.Errorf("could not index %s for '%s': %w", record, key, err)
+	}
+
+	return nil
+}
+
+func (sink *DBSink) WriteResource(u *unstructured.Unstructured) error {
+	data, err := yaml.Marshal(u)
+	if err != nil {
+		return fmt.Errorf("could not marshal %s: %w", u.GetKind(), err)
+	}
+
+	builder := ResourcePathBuilder{}.WithKind(u.GetKind()).WithNamespace(u.GetNamespace()).WithName(u.GetName())
+
+	return sink.writeResource(builder, sink.now(), data)
+}
+
+// writeResource stores data as the latest revision of the resource, and records it as a revision written at t. Data
+// identical to the latest revision, like the unchanged resources delivered on every informer resync, is not recorded
+// again.
+func (sink *DBSink) writeResource(builder ResourcePathBuilder, t time.Time, data []byte) error {
+	kind, namespace, name := builder.Kind, builder.Namespace, builder.Name
+	key := resourceKey(kind, namespace, name)
+
+	return sink.db.Batch(func(tx *bolt.Tx) error {
+		if latest := tx.Bucket(bucketResources).Get([]byte(key)); latest != nil && bytes.Equal(latest, data) {
+			return nil
+		}
+
+		if err := tx.Bucket(bucketResources).Put([]byte(key), data); err != nil {
+			return fmt.Errorf("could not write resource '%s': %w", key, err)
+		}
+
+		if err := tx.Bucket(bucketIndexNamespace).Put([]byte(namespace+"/"+kind+"/"+name), nil); err != nil {
+			return fmt.Errorf("could not index resource '%s' by namespace: %w", key, err)
+		}
+
+		if err := tx.Bucket(bucketIndexName).Put([]byte(name+"/"+kind+"/"+namespace), nil); err != nil {
+			return fmt.Errorf("could not index resource '%s' by name: %w", key, err)
+		}
+
+		return appendRecord(tx, bucketRevisions, RecordRevision, key, t, data)
+	})
+}
+
+func (sink *DBSink) AppendEvent(event *eventsv1.Event) error {
+	line := fmt.Sprintf(eventFormat, event.EventTime, event.Type, event.Reason, event.ReportingController, event.Note)
+	key := resourceKey(event.Regarding.Kind, event.Regarding.Namespace, event.Regarding.Name)
+
+	return sink.appendEventLine(key, event.EventTime.Time, []byte(line))
+}
+
+func (sink *DBSink) appendEventLine(key string, t time.Time, line []byte) error {
+	return sink.db.Batch(func(tx *bolt.Tx) error {
+		return appendRecord(tx, bucketEvents, RecordEvent, key, t, line)
+	})
+}
+
+func (sink *DBSink) AppendLog(namespace string, pod string, container string, data []byte) error {
+	key := containerKey(namespace, pod, container)
+
+	return sink.appendLog(key, sink.now(), data)
+}
+
+func (sink *DBSink) appendLog(key string, t time.Time, data []byte) error {
+	return sink.db.Batch(func(tx *bolt.Tx) error {
+		return appendRecord(tx, bucketLogs, RecordLog, key, t, data)
+	})
+}
+
+// RecordLinks replaces the links stored for parent, removing them if links is empty.
+func (sink *DBSink) RecordLinks(parent ResourcePathBuilder, links []ResourceLink) error {
+	key := resourceKey(parent.Kind, parent.Namespace, parent.Name)
+
+	if len(links) == 0 {
+		return sink.db.Batch(func(tx *bolt.Tx) error {
+			if err := tx.Bucket(bucketLinks).Delete([]byte(key)); err != nil {
+				return fmt.Errorf("could not remove links for '%s': %w", key, err)
+			}
+
+			return nil
+		})
+	}
+
+	references := make([]LinkReference, 0, len(links))
+	for _, link := range links {
+		references = append(references, LinkReference{
+			Kind:      link.Child.Kind,
+			Namespace: link.Child.Namespace,
+			Name:      link.Child.Name,
+			Types:     link.Types,
+		})
+	}
+
+	data, err := yaml.Marshal(references)
+	if err != nil {
+		return fmt.Errorf("could not marshal links for '%s': %w", parent.Name, err)
+	}
+
+	return sink.db.Batch(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(bucketLinks).Put([]byte(key), data); err != nil {
+			return fmt.Errorf("could not write links for '%s': %w", key, err)
+		}
+
+		return nil
+	})
+}
+
+func (sink *DBSink) WriteIncidentFile(incident string, name string, data []byte) error {
+	return sink.db.Batch(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(bucketIncidents).CreateBucketIfNotExists([]byte(incident))
+		if err != nil {
+			return fmt.Errorf("could not create bucket for incident '%s': %w", incident, err)
+		}
+
+		if err := bucket.Put([]byte(name), data); err != nil {
+			return fmt.Errorf("could not write file '%s' for incident '%s': %w", name, incident, err)
+		}
+
+		return nil
+	})
+}
+
+// WriteManifest stores the manifest of the dump, replacing any manifest already stored.
+func (sink *DBSink) WriteManifest(manifest *Manifest) error {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("could not marshal manifest: %w", err)
+	}
+
+	return sink.db.Batch(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(bucketMeta).Put(keyManifest, data); err != nil {
+			return fmt.Errorf("could not write manifest: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// CopyTo writes a consistent copy of the database to dbPath while the sink may still be written to.
+func (sink *DBSink) CopyTo(dbPath string) error {
+	return sink.db.View(func(tx *bolt.Tx) error {
+		if err := tx.CopyFile(dbPath, 0644); err != nil {
+			return fmt.Errorf("could not copy database to '%s': %w", dbPath, err)
+		}
+
+		return nil
+	})
+}
+
+func (sink *DBSink) Close() error {
+	return sink.db.Close()
+}
@@ -0,0 +1,160 @@
+package kubedump
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apicorev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	apimetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func testUnstructured(kind string, namespace string, name string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	u.SetKind(kind)
+	u.SetNamespace(namespace)
+	u.SetName(name)
+
+	return u
+}
+
+func TestDBSink(t *testing.T) {
+	dbPath := path.Join(t.TempDir(), DBFileName)
+
+	sink, err := NewDBSink(dbPath)
+	require.NoError(t, err)
+
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	sink.now = func() time.Time {
+		now = now.Add(time.Minute)
+		return now
+	}
+
+	pod := testUnstructured("Pod", "default", "sample-pod")
+	require.NoError(t, sink.WriteResource(pod))
+	pod.SetLabels(map[string]string{"a": "b"})
+	require.NoError(t, sink.WriteResource(pod))
+
+	// an unchanged resource, as delivered on each resync, is not another revision
+	require.NoError(t, sink.WriteResource(pod))
+
+	require.NoError(t, sink.WriteResource(testUnstructured("Secret", "default", "sample-secret")))
+	require.NoError(t, sink.WriteResource(testUnstructured("Secret", "other", "sample-secret")))
+	require.NoError(t, sink.WriteResource(testUnstructured("Node", "", "sample-node")))
+
+	require.NoError(t, sink.AppendEvent(&eventsv1.Event{
+		EventTime: apimetav1.NewMicroTime(start.Add(time.Hour)),
+		Type:      apicorev1.EventTypeNormal,
+		Reason:    "Pulled",
+		Regarding: apicorev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "sample-pod"},
+	}))
+
+	require.NoError(t, sink.AppendLog("default", "sample-pod", "app", []byte("first\n")))
+	require.NoError(t, sink.AppendLog("default", "sample-pod", "app", []byte("second\n")))
+
+	podBuilder := ResourcePathBuilder{}.WithNamespace("default").WithKind("Pod").WithName("sample-pod")
+	secretBuilder := ResourcePathBuilder{}.WithNamespace("default").WithKind("Secret").WithName("sample-secret")
+	require.NoError(t, sink.RecordLinks(podBuilder, []ResourceLink{{Parent: podBuilder, Child: secretBuilder, Types: []LinkType{LinkTypeVolume}}}))
+
+	require.NoError(t, sink.Close())
+
+	dump, err := OpenDBDump(dbPath)
+	require.NoError(t, err)
+	defer dump.Close()
+
+	data, err := dump.Resource(podBuilder)
+	require.NoError(t, err)
+	assert.Equal(t, "kind: Pod\nmetadata:\n  labels:\n    a: b\n  name: sample-pod\n  namespace: default\n", string(data))
+
+	revisions, err := dump.Revisions(podBuilder)
+	require.NoError(t, err)
+	assert.Len(t, revisions, 2)
+	assert.Equal(t, data, revisions[1])
+
+	resourcesAt := func(at time.Time) map[ResourcePathBuilder]string {
+		resources := map[ResourcePathBuilder]string{}
+		require.NoError(t, dump.ForEachResourceAt(at, func(builder ResourcePathBuilder, data []byte) error {
+			resources[builder] = string(data)
+			return nil
+		}))
+
+		return resources
+	}
+
+	assert.Empty(t, resourcesAt(start))
+	assert.Equal(t, map[ResourcePathBuilder]string{podBuilder: string(revisions[0])}, resourcesAt(start.Add(time.Minute)))
+	assert.Equal(t, map[ResourcePathBuilder]string{podBuilder: string(revisions[1])}, resourcesAt(start.Add(2*time.Minute+time.Second)))
+	assert.Len(t, resourcesAt(start.Add(time.Hour)), 4)
+
+	secrets, err := dump.ResourcesOfKind("Secret")
+	require.NoError(t, err)
+	assert.Equal(t, []ResourcePathBuilder{secretBuilder, secretBuilder.WithNamespace("other")}, secrets)
+
+	inDefault, err := dump.ResourcesInNamespace("default")
+	require.NoError(t, err)
+	assert.Equal(t, []ResourcePathBuilder{podBuilder, secretBuilder}, inDefault)
+
+	clusterScoped, err := dump.ResourcesInNamespace("")
+	require.NoError(t, err)
+	assert.Equal(t, []ResourcePathBuilder{ResourcePathBuilder{}.WithKind("Node").WithName("sample-node")}, clusterScoped)
+
+	named, err := dump.ResourcesNamed("sample-secret")
+	require.NoError(t, err)
+	assert.Len(t, named, 2)
+
+	logs := ""
+	require.NoError(t, dump.ForEachLog(func(namespace string, pod string, container string, data []byte) error {
+		assert.Equal(t, []string{"default", "sample-pod", "app"}, []string{namespace, pod, container})
+		logs += string(data)
+		return nil
+	}))
+	assert.Equal(t, "first\nsecond\n", logs)
+
+	require.NoError(t, dump.ForEachLinks(func(parent ResourcePathBuilder, references []LinkReference) error {
+		assert.Equal(t, podBuilder, parent)
+		assert.Equal(t, []LinkReference{{Kind: "Secret", Namespace: "default", Name: "sample-secret", Types: []LinkType{LinkTypeVolume}}}, references)
+		return nil
+	}))
+
+	// the pod revisions are written in the first 2 minutes, and the event at 1 hour
+	records, err := dump.Records(start, start.Add(2*time.Minute+time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, []DBRecord{
+		{Time: start.Add(time.Minute), Kind: RecordRevision, Key: "Pod/default/sample-pod"},
+		{Time: start.Add(2 * time.Minute), Kind: RecordRevision, Key: "Pod/default/sample-pod"},
+	}, records)
+
+	records, err = dump.Records(start.Add(time.Hour), start.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []DBRecord{
+		{Time: start.Add(time.Hour), Kind: RecordEvent, Key: "Pod/default/sample-pod"},
+	}, records)
+}
+
+func TestDBSinkRecordLinksEmpty(t *testing.T) {
+	dbPath := path.Join(t.TempDir(), DBFileName)
+
+	sink, err := NewDBSink(dbPath)
+	require.NoError(t, err)
+
+	podBuilder := ResourcePathBuilder{}.WithNamespace("default").WithKind("Pod").WithName("sample-pod")
+	secretBuilder := ResourcePathBuilder{}.WithNamespace("default").WithKind("Secret").WithName("sample-secret")
+
+	require.NoError(t, sink.RecordLinks(podBuilder, []ResourceLink{{Parent: podBuilder, Child: secretBuilder, Types: []LinkType{LinkTypeVolume}}}))
+	require.NoError(t, sink.RecordLinks(podBuilder, []ResourceLink{}))
+	require.NoError(t, sink.Close())
+
+	dump, err := OpenDBDump(dbPath)
+	require.NoError(t, err)
+	defer dump.Close()
+
+	require.NoError(t, dump.ForEachLinks(func(parent ResourcePathBuilder, references []LinkReference) error {
+		t.Errorf("unexpected links for '%s'", parent.Build())
+		return nil
+	}))
+}
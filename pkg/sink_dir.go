@@ -0,0 +1,255 @@
+package kubedump
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+
+	eventsv1 "k8s.io/api/events/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// EventsFileSuffix is the suffix of the file in each resource directory holding the events regarding the resource.
+	EventsFileSuffix = ".events"
+
+	// [<event-time>] <type> <reason> <from> <message>
+	eventFormat = "[%s] %s %s %s %s\n"
+)
+
+// DirSink is a Sink storing a dump as a directory tree, as described in docs/storage.md.
+type DirSink struct {
+	// LogLimits caps the size of the container logs written to the dump. It must not be changed after logs are written.
+	LogLimits LogLimits
+
+	// OnRotate, if set, is called with the path of each log file once it is rotated to <container>.log.1, along with
+	// the segment opened for reading. The segment may be renamed or compressed by later rotations at any time, but the
+	// opened file keeps its content. OnRotate is called once logs are unlocked, and must close the file.
+	OnRotate func(segmentPath string, segment *os.File)
+
+	base string
+
+	logsMu    sync.Mutex
+	logs      map[string]*containerLog
+	logsTotal int64
+	rotations uint64
+
+	// rotated holds the segments rotated while logs were locked, which are passed to OnRotate once they are unlocked.
+	rotated []rotatedSegment
+}
+
+// NewDirSink creates a Sink writing the dump to the directory at base.
+func NewDirSink(base string) *DirSink {
+	return &DirSink{
+		base: base,
+	}
+}
+
+func (sink *DirSink) builder(namespace string, kind string, name string) ResourcePathBuilder {
+	return ResourcePathBuilder{}.
+		WithNamespace(namespace).
+		WithKind(kind).
+		WithName(name)
+}
+
+// appendFile appends data to the file at filePath, creating it and its parents if needed.
+func appendFile(filePath string, data []byte) error {
+	if err := createPathParents(filePath); err != nil {
+		return fmt.Errorf("could not create parents for '%s': %w", filePath, err)
+	}
+
+	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open file '%s': %w", filePath, err)
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write to file '%s': %w", filePath, err)
+	}
+
+	return f.Close()
+}
+
+func (sink *DirSink) WriteResource(u *unstructured.Unstructured) error {
+	data, err := yaml.Marshal(u)
+	if err != nil {
+		return fmt.Errorf("could not marshal %s: %w", u.GetKind(), err)
+	}
+
+	return sink.writeResource(sink.builder(u.GetNamespace(), u.GetKind(), u.GetName()), data)
+}
+
+// writeResource writes the already marshalled description of the resource at builder, which has no base path.
+func (sink *DirSink) writeResource(builder ResourcePathBuilder, data []byte) error {
+	builder = builder.WithBase(sink.base)
+	filePath := path.Join(builder.Build(), builder.Name+".yaml")
+
+	if err := createPathParents(filePath); err != nil {
+		return fmt.Errorf("error creating parents for obj file '%s': %w", filePath, err)
+	}
+
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		return fmt.Errorf("could not write %s to file '%s': %w", builder.Kind, filePath, err)
+	}
+
+	return nil
+}
+
+func (sink *DirSink) AppendEvent(event *eventsv1.Event) error {
+	builder := sink.builder(event.Regarding.Namespace, event.Regarding.Kind, event.Regarding.Name)
+	line := fmt.Sprintf(eventFormat, event.EventTime, event.Type, event.Reason, event.ReportingController, event.Note)
+
+	return sink.appendEventLines(builder, []byte(line))
+}
+
+// appendEventLines appends already formatted events to the events file of the resource at builder.
+func (sink *DirSink) appendEventLines(builder ResourcePathBuilder, lines []byte) error {
+	builder = builder.WithBase(sink.base)
+
+	return appendFile(path.Join(builder.Build(), builder.Name+EventsFileSuffix), lines)
+}
+
+func (sink *DirSink) AppendLog(namespace string, pod string, container string, data []byte) error {
+	builder := sink.builder(namespace, "Pod", pod).WithBase(sink.base)
+	logPath := path.Join(builder.Build(), container+".log")
+
+	if sink.LogLimits == (LogLimits{}) {
+		return appendFile(logPath, data)
+	}
+
+	rotated, err := sink.appendLog(logPath, data)
+
+	for _, segment := range rotated {
+		sink.OnRotate(segment.path, segment.file)
+	}
+
+	return err
+}
+
+// appendLog appends data to the log at logPath within the sink's LogLimits, returning the segments rotated to make room
+// for it.
+func (sink *DirSink) appendLog(logPath string, data []byte) ([]rotatedSegment, error) {
+	sink.logsMu.Lock()
+	defer sink.logsMu.Unlock()
+
+	log, err := sink.containerLog(logPath)
+	if err == nil {
+		err = sink.appendLimited(log, data)
+	}
+
+	rotated := sink.rotated
+	sink.rotated = nil
+
+	return rotated, err
+}
+
+// RecordLinks creates the symlinks for links and rewrites the parent's links file. The symlinks of the links recorded
+// previously which are not in links are removed, along with the links file if links is empty.
+func (sink *DirSink) RecordLinks(parent ResourcePathBuilder, links []ResourceLink) error {
+	parent = parent.WithBase(sink.base)
+	linksFile := path.Join(parent.Build(), parent.Name+LinksFileSuffix)
+
+	previous, err := readLinksFile(linksFile)
+	if err != nil {
+		return err
+	}
+
+	rebased := make([]ResourceLink, 0, len(links))
+	children := make(map[string]bool, len(links))
+
+	for _, link := range links {
+		link.Parent = link.Parent.WithBase(sink.base)
+		link.Child = link.Child.WithBase(sink.base)
+
+		if err := linkToParent(link.Child, link.Parent); err != nil {
+			return fmt.Errorf("could not create link: %w", err)
+		}
+
+		rebased = append(rebased, link)
+		children[link.Child.Build()] = true
+	}
+
+	for _, reference := range previous {
+		child := ResourcePathBuilder{}.WithBase(sink.base).WithNamespace(reference.Namespace).WithKind(reference.Kind).WithName(reference.Name)
+		if children[child.Build()] {
+			continue
+		}
+
+		if err := sink.unlink(child, parent); err != nil {
+			return err
+		}
+	}
+
+	if len(rebased) == 0 {
+		if err := os.Remove(linksFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("could not remove links file '%s': %w", linksFile, err)
+		}
+
+		return nil
+	}
+
+	return writeLinksFiles(rebased)
+}
+
+// unlink removes the symlink to child under parent, if there is one.
+func (sink *DirSink) unlink(child ResourcePathBuilder, parent ResourcePathBuilder) error {
+	linkPath := child.
+		WithParentNamespace(parent.Namespace).
+		WithParentKind(parent.Kind).
+		WithParentName(parent.Name).
+		BuildWithParent()
+
+	info, err := os.Lstat(linkPath)
+	if errors.Is(err, os.ErrNotExist) || err == nil && info.Mode()&os.ModeSymlink == 0 {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("could not stat '%s': %w", linkPath, err)
+	}
+
+	if err := os.Remove(linkPath); err != nil {
+		return fmt.Errorf("could not remove stale link '%s': %w", linkPath, err)
+	}
+
+	removeEmptyParents(sink.base, path.Dir(linkPath))
+
+	return nil
+}
+
+// readLinksFile reads the references in a links file, or none if it does not exist.
+func readLinksFile(linksFile string) ([]LinkReference, error) {
+	data, err := os.ReadFile(linksFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not read links file '%s': %w", linksFile, err)
+	}
+
+	var references []LinkReference
+	if err := yaml.Unmarshal(data, &references); err != nil {
+		return nil, fmt.Errorf("could not unmarshal links file '%s': %w", linksFile, err)
+	}
+
+	return references, nil
+}
+
+func (sink *DirSink) WriteIncidentFile(incident string, name string, data []byte) error {
+	filePath := path.Join(sink.base, IncidentsDirName, incident, name)
+
+	if err := createPathParents(filePath); err != nil {
+		return fmt.Errorf("could not create parents for '%s': %w", filePath, err)
+	}
+
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		return fmt.Errorf("could not write incident file '%s': %w", filePath, err)
+	}
+
+	return nil
+}
+
+func (sink *DirSink) Close() error {
+	return sink.closeLogs()
+}
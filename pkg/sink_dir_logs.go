@@ -0,0 +1,420 @@
+package kubedump
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LogDropPolicy decides which logs are dropped once the total size of the logs in a dump reaches its limit.
+type LogDropPolicy string
+
+const (
+	// LogDropNewest drops any new logs once the limit is reached, keeping the earliest logs of each container.
+	LogDropNewest LogDropPolicy = "newest"
+
+	// LogDropOldest removes the oldest rotated log segments, from any container, to make room for new logs. If there
+	// are no rotated segments left to remove, new logs are dropped as with LogDropNewest.
+	LogDropOldest LogDropPolicy = "oldest"
+)
+
+// LogLimits caps the size of the container logs written by a DirSink.
+type LogLimits struct {
+	// MaxContainerSize is the size in bytes a container's log file may reach before it is rotated to
+	// <container>.log.1. Older segments are compressed to <container>.log.<n>.gz. If 0, logs are never rotated.
+	MaxContainerSize int64
+
+	// MaxSegments is the number of rotated segments kept for each container. If 0, segments are kept until they are
+	// removed by the LogDropOldest policy.
+	MaxSegments int
+
+	// MaxTotalSize is the size in bytes that every log file in the dump, including rotated segments, may add up to.
+	// If 0, the total size is not limited.
+	MaxTotalSize int64
+
+	// DropPolicy decides which logs are dropped once MaxTotalSize is reached, defaulting to LogDropNewest.
+	DropPolicy LogDropPolicy
+}
+
+// logMarkerPrefix starts each line kubedump writes to a log file to note where logs were dropped.
+const logMarkerPrefix = "[kubedump] "
+
+// logSegment is a rotated log file.
+type logSegment struct {
+	path string
+	size int64
+
+	// rotation orders segments from every container by the time they were rotated.
+	rotation uint64
+}
+
+// rotatedSegment is a log file which was rotated while logs were locked, opened so its content can be read after they
+// are unlocked.
+type rotatedSegment struct {
+	path string
+	file *os.File
+}
+
+// containerLog tracks the size of a container's log file and its rotated segments.
+type containerLog struct {
+	path string
+	size int64
+
+	// segments holds the rotated segments from newest to oldest.
+	segments []logSegment
+
+	// dropped is the number of bytes dropped since logs were last written.
+	dropped int64
+}
+
+// segmentPattern matches the name of a log file or one of its rotated segments, capturing the container name and
+// segment number.
+var segmentPattern = regexp.MustCompile(`^(.+)\.log(?:\.([0-9]+)(?:\.gz)?)?$`)
+
+// IsLogFile returns true if name is a container log file or one of its rotated segments.
+func IsLogFile(name string) bool {
+	return segmentPattern.MatchString(name)
+}
+
+// segmentPath returns the path to the nth rotated segment of the log file at logPath. Only the most recent segment is
+// left uncompressed.
+func segmentPath(logPath string, n int) string {
+	if n == 1 {
+		return logPath + ".1"
+	}
+
+	return fmt.Sprintf("%s.%d.gz", logPath, n)
+}
+
+func (sink *DirSink) containerLog(logPath string) (*containerLog, error) {
+	if log, found := sink.logs[logPath]; found {
+		return log, nil
+	}
+
+	log := &containerLog{path: logPath}
+
+	if info, err := os.Stat(logPath); err == nil {
+		log.size = info.Size()
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("could not stat log file '%s': %w", logPath, err)
+	}
+
+	if sink.logs == nil {
+		sink.logs = make(map[string]*containerLog)
+	}
+
+	sink.logs[logPath] = log
+	sink.logsTotal += log.size
+
+	return log, nil
+}
+
+// appendLimited appends data to the container's log, rotating the log file or dropping data to stay within the
+// sink's LogLimits.
+func (sink *DirSink) appendLimited(log *containerLog, data []byte) error {
+	limits := sink.LogLimits
+	size := int64(len(data))
+
+	if limits.MaxContainerSize > 0 && log.size > 0 && log.size+size > limits.MaxContainerSize {
+		if err := sink.rotate(log); err != nil {
+			return err
+		}
+	}
+
+	if limits.MaxTotalSize > 0 {
+		fits, err := sink.makeRoom(size)
+		if err != nil {
+			return err
+		}
+
+		if !fits {
+			if log.dropped == 0 {
+				if err := sink.writeMarker(log, "total log size limit of %d bytes reached, dropping logs", limits.MaxTotalSize); err != nil {
+					return err
+				}
+			}
+
+			log.dropped += size
+
+			return nil
+		}
+	}
+
+	if log.dropped > 0 {
+		if err := sink.writeMarker(log, "dropped %d bytes of logs", log.dropped); err != nil {
+			return err
+		}
+
+		log.dropped = 0
+	}
+
+	return sink.writeLog(log, data)
+}
+
+func (sink *DirSink) writeLog(log *containerLog, data []byte) error {
+	if err := appendFile(log.path, data); err != nil {
+		return err
+	}
+
+	log.size += int64(len(data))
+	sink.logsTotal += int64(len(data))
+
+	return nil
+}
+
+// writeMarker writes a line to the container's log noting that logs were dropped. Markers are written regardless of
+// the limits.
+func (sink *DirSink) writeMarker(log *containerLog, format string, a ...any) error {
+	return sink.writeLog(log, []byte(logMarkerPrefix+fmt.Sprintf(format, a...)+"\n"))
+}
+
+// makeRoom returns true if size more bytes of logs fit within the total limit, removing the oldest rotated segments to
+// make room if the drop policy allows.
+func (sink *DirSink) makeRoom(size int64) (bool, error) {
+	for sink.logsTotal+size > sink.LogLimits.MaxTotalSize {
+		if sink.LogLimits.DropPolicy != LogDropOldest {
+			return false, nil
+		}
+
+		var oldest *containerLog
+		for _, log := range sink.logs {
+			if len(log.segments) == 0 {
+				continue
+			}
+
+			if oldest == nil || log.segments[len(log.segments)-1].rotation < oldest.segments[len(oldest.segments)-1].rotation {
+				oldest = log
+			}
+		}
+
+		if oldest == nil {
+			return false, nil
+		}
+
+		segment, err := sink.removeOldestSegment(oldest)
+		if err != nil {
+			return false, err
+		}
+
+		if err := sink.writeMarker(oldest, "removed log segment %s (%d bytes) to stay under the total log size limit", path.Base(segment.path), segment.size); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func (sink *DirSink) removeOldestSegment(log *containerLog) (logSegment, error) {
+	segment := log.segments[len(log.segments)-1]
+
+	if err := os.Remove(segment.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return segment, fmt.Errorf("could not remove log segment '%s': %w", segment.path, err)
+	}
+
+	log.segments = log.segments[:len(log.segments)-1]
+	sink.logsTotal -= segment.size
+
+	return segment, nil
+}
+
+// rotate moves the container's log file to <container>.log.1, compressing and renumbering any older segments.
+func (sink *DirSink) rotate(log *containerLog) error {
+	removed := []logSegment{}
+
+	if max := sink.LogLimits.MaxSegments; max > 0 {
+		for len(log.segments) >= max {
+			segment, err := sink.removeOldestSegment(log)
+			if err != nil {
+				return err
+			}
+
+			removed = append(removed, segment)
+		}
+	}
+
+	for i := len(log.segments) - 1; i >= 1; i-- {
+		newPath := segmentPath(log.path, i+2)
+
+		if err := os.Rename(log.segments[i].path, newPath); err != nil {
+			return fmt.Errorf("could not rename log segment '%s': %w", log.segments[i].path, err)
+		}
+
+		log.segments[i].path = newPath
+	}
+
+	if len(log.segments) > 0 {
+		compressedPath := segmentPath(log.path, 2)
+
+		size, err := compressFile(log.segments[0].path, compressedPath)
+		if err != nil {
+			return err
+		}
+
+		sink.logsTotal += size - log.segments[0].size
+		log.segments[0].path = compressedPath
+		log.segments[0].size = size
+	}
+
+	if err := os.Rename(log.path, segmentPath(log.path, 1)); err != nil {
+		return fmt.Errorf("could not rotate log file '%s': %w", log.path, err)
+	}
+
+	sink.rotations++
+	log.segments = append([]logSegment{{path: segmentPath(log.path, 1), size: log.size, rotation: sink.rotations}}, log.segments...)
+	log.size = 0
+
+	if sink.OnRotate != nil {
+		f, err := os.Open(log.segments[0].path)
+		if err != nil {
+			return fmt.Errorf("could not open rotated log segment '%s': %w", log.segments[0].path, err)
+		}
+
+		sink.rotated = append(sink.rotated, rotatedSegment{path: log.segments[0].path, file: f})
+	}
+
+	for _, segment := range removed {
+		if err := sink.writeMarker(log, "removed log segment %s (%d bytes) to keep at most %d segments", path.Base(segment.path), segment.size, sink.LogLimits.MaxSegments); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// compressFile gzips the file at src to dst and removes src, returning the size of the compressed file.
+func compressFile(src string, dst string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, fmt.Errorf("could not open log segment '%s': %w", src, err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return 0, fmt.Errorf("could not create compressed log segment '%s': %w", dst, err)
+	}
+
+	writer := gzip.NewWriter(out)
+
+	if _, err := io.Copy(writer, in); err != nil {
+		out.Close()
+		return 0, fmt.Errorf("could not compress log segment '%s': %w", src, err)
+	}
+
+	if err := writer.Close(); err != nil {
+		out.Close()
+		return 0, fmt.Errorf("could not compress log segment '%s': %w", src, err)
+	}
+
+	info, err := out.Stat()
+	if err != nil {
+		out.Close()
+		return 0, fmt.Errorf("could not stat compressed log segment '%s': %w", dst, err)
+	}
+
+	if err := out.Close(); err != nil {
+		return 0, fmt.Errorf("could not close compressed log segment '%s': %w", dst, err)
+	}
+
+	if err := os.Remove(src); err != nil {
+		return 0, fmt.Errorf("could not remove compressed log segment '%s': %w", src, err)
+	}
+
+	return info.Size(), nil
+}
+
+// closeLogs notes the size of any logs which were still being dropped when the sink was closed.
+func (sink *DirSink) closeLogs() error {
+	sink.logsMu.Lock()
+	defer sink.logsMu.Unlock()
+
+	for _, log := range sink.logs {
+		if log.dropped > 0 {
+			if err := sink.writeMarker(log, "dropped %d bytes of logs", log.dropped); err != nil {
+				return err
+			}
+
+			log.dropped = 0
+		}
+	}
+
+	return nil
+}
+
+// ReadContainerLog returns the logs of a container in the resource directory dir of fsys, decompressing and joining
+// any rotated segments from oldest to newest.
+func ReadContainerLog(fsys fs.FS, dir string, container string) ([]byte, error) {
+	entries, err := fs.ReadDir(fsys, fsPath(dir))
+	if err != nil {
+		return nil, fmt.Errorf("could not read directory '%s': %w", dir, err)
+	}
+
+	type segment struct {
+		name string
+		n    int
+	}
+
+	segments := []segment{}
+	for _, entry := range entries {
+		match := segmentPattern.FindStringSubmatch(entry.Name())
+		if match == nil || match[1] != container || !entry.Type().IsRegular() {
+			continue
+		}
+
+		n := 0
+		if match[2] != "" {
+			n, _ = strconv.Atoi(match[2])
+		}
+
+		segments = append(segments, segment{name: entry.Name(), n: n})
+	}
+
+	// higher numbered segments are older, and the current log file is numbered 0
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].n > segments[j].n
+	})
+
+	data := []byte{}
+	for _, segment := range segments {
+		segmentData, err := readLogSegment(fsys, path.Join(dir, segment.name))
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(data, segmentData...)
+	}
+
+	return data, nil
+}
+
+func readLogSegment(fsys fs.FS, name string) ([]byte, error) {
+	if !strings.HasSuffix(name, ".gz") {
+		return fs.ReadFile(fsys, name)
+	}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not open log segment '%s': %w", name, err)
+	}
+	defer f.Close()
+
+	reader, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not decompress log segment '%s': %w", name, err)
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("could not decompress log segment '%s': %w", name, err)
+	}
+
+	return data, nil
+}
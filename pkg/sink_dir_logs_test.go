@@ -0,0 +1,136 @@
+package kubedump
+
+import (
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// podDir returns the directory of the sample pod in the dump at base.
+func podDir(base string) string {
+	return ResourcePathBuilder{}.WithBase(base).WithNamespace("default").WithKind("Pod").WithName("sample-pod").Build()
+}
+
+func readLog(t *testing.T, base string, name string) string {
+	data, err := os.ReadFile(path.Join(podDir(base), name))
+	require.NoError(t, err)
+
+	return string(data)
+}
+
+func TestDirSinkLogRotation(t *testing.T) {
+	base := t.TempDir()
+	sink := NewDirSink(base)
+	sink.LogLimits = LogLimits{MaxContainerSize: 10, MaxSegments: 2}
+
+	for _, chunk := range []string{"first\n", "second\n", "third\n"} {
+		require.NoError(t, sink.AppendLog("default", "sample-pod", "app", []byte(chunk)))
+	}
+
+	assert.Equal(t, "third\n", readLog(t, base, "app.log"))
+	assert.Equal(t, "second\n", readLog(t, base, "app.log.1"))
+	assert.FileExists(t, path.Join(podDir(base), "app.log.2.gz"))
+
+	data, err := ReadContainerLog(DirFS(base), "default/Pod/sample-pod", "app")
+	require.NoError(t, err)
+	assert.Equal(t, "first\nsecond\nthird\n", string(data))
+
+	// only 2 segments are kept, so the oldest is removed
+	require.NoError(t, sink.AppendLog("default", "sample-pod", "app", []byte("fourth\n")))
+
+	assert.Regexp(t, `^\[kubedump\] removed log segment app.log.2.gz \([0-9]+ bytes\) to keep at most 2 segments\nfourth\n$`, readLog(t, base, "app.log"))
+	assert.Equal(t, "third\n", readLog(t, base, "app.log.1"))
+	assert.FileExists(t, path.Join(podDir(base), "app.log.2.gz"))
+	assert.NoFileExists(t, path.Join(podDir(base), "app.log.3.gz"))
+
+	data, err = ReadContainerLog(DirFS(base), "default/Pod/sample-pod", "app")
+	require.NoError(t, err)
+	assert.Regexp(t, `^second\nthird\n\[kubedump\] removed log segment app.log.2.gz \([0-9]+ bytes\) to keep at most 2 segments\nfourth\n$`, string(data))
+
+	require.NoError(t, sink.Close())
+}
+
+func TestDirSinkLogOnRotate(t *testing.T) {
+	base := t.TempDir()
+	sink := NewDirSink(base)
+	sink.LogLimits = LogLimits{MaxContainerSize: 10, MaxSegments: 2}
+
+	segments := []string{}
+	sink.OnRotate = func(segmentPath string, segment *os.File) {
+		defer segment.Close()
+		sink.OnRotate = nil
+
+		// logs are unlocked, so OnRotate may append logs itself
+		require.NoError(t, sink.AppendLog("default", "sample-pod", "other", []byte("rotated\n")))
+
+		// the segment is read after it is compressed by a later rotation
+		require.NoError(t, sink.AppendLog("default", "sample-pod", "app", []byte("0123456789\n")))
+
+		data, err := io.ReadAll(segment)
+		require.NoError(t, err)
+
+		segments = append(segments, path.Base(segmentPath)+": "+string(data))
+	}
+
+	require.NoError(t, sink.AppendLog("default", "sample-pod", "app", []byte("first\n")))
+	require.NoError(t, sink.AppendLog("default", "sample-pod", "app", []byte("second\n")))
+	require.NoError(t, sink.Close())
+
+	assert.Equal(t, []string{"app.log.1: first\n"}, segments)
+	assert.FileExists(t, path.Join(podDir(base), "app.log.2.gz"))
+	assert.Equal(t, "rotated\n", readLog(t, base, "other.log"))
+}
+
+func TestDirSinkLogDropNewest(t *testing.T) {
+	base := t.TempDir()
+	sink := NewDirSink(base)
+	sink.LogLimits = LogLimits{MaxTotalSize: 10, DropPolicy: LogDropNewest}
+
+	require.NoError(t, sink.AppendLog("default", "sample-pod", "app", []byte("first\n")))
+	require.NoError(t, sink.AppendLog("default", "sample-pod", "app", []byte("second\n")))
+	require.NoError(t, sink.AppendLog("default", "sample-pod", "other", []byte("third\n")))
+	require.NoError(t, sink.AppendLog("default", "sample-pod", "app", []byte("fourth\n")))
+
+	require.NoError(t, sink.Close())
+
+	assert.Equal(t, "first\n[kubedump] total log size limit of 10 bytes reached, dropping logs\n[kubedump] dropped 14 bytes of logs\n", readLog(t, base, "app.log"))
+	assert.Equal(t, "[kubedump] total log size limit of 10 bytes reached, dropping logs\n[kubedump] dropped 6 bytes of logs\n", readLog(t, base, "other.log"))
+}
+
+func TestDirSinkLogDropOldest(t *testing.T) {
+	base := t.TempDir()
+	sink := NewDirSink(base)
+	sink.LogLimits = LogLimits{MaxContainerSize: 200, MaxTotalSize: 700, DropPolicy: LogDropOldest}
+
+	chunk := func(c string) []byte {
+		return []byte(strings.Repeat(c, 200))
+	}
+
+	require.NoError(t, sink.AppendLog("default", "sample-pod", "app", chunk("a")))
+	require.NoError(t, sink.AppendLog("default", "sample-pod", "other", chunk("b")))
+	require.NoError(t, sink.AppendLog("default", "sample-pod", "app", chunk("c")))
+	require.NoError(t, sink.AppendLog("default", "sample-pod", "other", chunk("d")))
+
+	// app.log.1 is the oldest segment, so it is removed to make room
+	assert.NoFileExists(t, path.Join(podDir(base), "app.log.1"))
+	assert.Equal(t, string(chunk("b")), readLog(t, base, "other.log.1"))
+	assert.Equal(t, string(chunk("c"))+"[kubedump] removed log segment app.log.1 (200 bytes) to stay under the total log size limit\n", readLog(t, base, "app.log"))
+	assert.Equal(t, string(chunk("d")), readLog(t, base, "other.log"))
+
+	require.NoError(t, sink.Close())
+}
+
+func TestIsLogFile(t *testing.T) {
+	for _, name := range []string{"app.log", "app.log.1", "app.log.2.gz"} {
+		assert.True(t, IsLogFile(name), name)
+	}
+
+	for _, name := range []string{"app.yaml", "app.log.gz", "app.log.x"} {
+		assert.False(t, IsLogFile(name), name)
+	}
+}
@@ -0,0 +1,112 @@
+package kubedump
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apicorev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	apimetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestDirSinkWriteResource(t *testing.T) {
+	base := t.TempDir()
+	sink := NewDirSink(base)
+
+	u := &unstructured.Unstructured{
+		Object: map[string]interface{}{},
+	}
+	u.SetKind("nothing")
+	u.SetName("some-resource")
+	u.SetNamespace("ns")
+
+	dumpPath := path.Join(base, "ns", "nothing", "some-resource", "some-resource.yaml")
+
+	require.NoError(t, sink.WriteResource(u))
+
+	data, err := os.ReadFile(dumpPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "kind: nothing\nmetadata:\n  name: some-resource\n  namespace: ns\n", string(data))
+
+	// test overwriting file
+	u.SetLabels(map[string]string{"a": "b"})
+	require.NoError(t, sink.WriteResource(u))
+
+	data, err = os.ReadFile(dumpPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "kind: nothing\nmetadata:\n  labels:\n    a: b\n  name: some-resource\n  namespace: ns\n", string(data))
+}
+
+func TestDirSinkAppend(t *testing.T) {
+	base := t.TempDir()
+	sink := NewDirSink(base)
+
+	require.NoError(t, sink.AppendLog("default", "sample-pod", "app", []byte("first\n")))
+	require.NoError(t, sink.AppendLog("default", "sample-pod", "app", []byte("second\n")))
+
+	data, err := os.ReadFile(path.Join(base, "default", "Pod", "sample-pod", "app.log"))
+	require.NoError(t, err)
+	assert.Equal(t, "first\nsecond\n", string(data))
+
+	eventTime := apimetav1.NewMicroTime(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	event := &eventsv1.Event{
+		EventTime:           eventTime,
+		Type:                apicorev1.EventTypeNormal,
+		Reason:              "Pulled",
+		ReportingController: "kubelet",
+		Note:                "pulled image",
+		Regarding:           apicorev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "sample-pod"},
+	}
+
+	require.NoError(t, sink.AppendEvent(event))
+	require.NoError(t, sink.AppendEvent(event))
+
+	data, err = os.ReadFile(path.Join(base, "default", "Pod", "sample-pod", "sample-pod"+EventsFileSuffix))
+	require.NoError(t, err)
+
+	line := "[" + eventTime.String() + "] Normal Pulled kubelet pulled image\n"
+	assert.Equal(t, line+line, string(data))
+}
+
+func TestDirSinkRecordLinksReplaces(t *testing.T) {
+	base := t.TempDir()
+	sink := NewDirSink(base)
+
+	require.NoError(t, sink.WriteResource(testUnstructured("Pod", "default", "sample-pod")))
+	require.NoError(t, sink.WriteResource(testUnstructured("Secret", "default", "sample-secret")))
+	require.NoError(t, sink.WriteResource(testUnstructured("ConfigMap", "default", "sample-configmap")))
+
+	podBuilder := ResourcePathBuilder{}.WithNamespace("default").WithKind("Pod").WithName("sample-pod")
+	secretBuilder := ResourcePathBuilder{}.WithNamespace("default").WithKind("Secret").WithName("sample-secret")
+	configMapBuilder := ResourcePathBuilder{}.WithNamespace("default").WithKind("ConfigMap").WithName("sample-configmap")
+
+	podDir := path.Join(base, "default", "Pod", "sample-pod")
+	linksFile := path.Join(podDir, "sample-pod"+LinksFileSuffix)
+
+	require.NoError(t, sink.RecordLinks(podBuilder, []ResourceLink{
+		{Parent: podBuilder, Child: secretBuilder, Types: []LinkType{LinkTypeVolume}},
+		{Parent: podBuilder, Child: configMapBuilder, Types: []LinkType{LinkTypeVolume}},
+	}))
+	assert.FileExists(t, path.Join(podDir, "Secret", "sample-secret", "sample-secret.yaml"))
+	assert.FileExists(t, path.Join(podDir, "ConfigMap", "sample-configmap", "sample-configmap.yaml"))
+
+	require.NoError(t, sink.RecordLinks(podBuilder, []ResourceLink{
+		{Parent: podBuilder, Child: secretBuilder, Types: []LinkType{LinkTypeVolume}},
+	}))
+	assert.FileExists(t, path.Join(podDir, "Secret", "sample-secret", "sample-secret.yaml"))
+	assert.NoDirExists(t, path.Join(podDir, "ConfigMap"))
+
+	references, err := readLinksFile(linksFile)
+	require.NoError(t, err)
+	assert.Equal(t, []LinkReference{{Kind: "Secret", Namespace: "default", Name: "sample-secret", Types: []LinkType{LinkTypeVolume}}}, references)
+
+	require.NoError(t, sink.RecordLinks(podBuilder, []ResourceLink{}))
+	assert.NoDirExists(t, path.Join(podDir, "Secret"))
+	assert.NoFileExists(t, linksFile)
+	assert.FileExists(t, path.Join(base, "default", "Secret", "sample-secret", "sample-secret.yaml"))
+}
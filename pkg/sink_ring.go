@@ -0,0 +1,318 @@
+package kubedump
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	eventsv1 "k8s.io/api/events/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ringRecord is an event or chunk of logs held by a RingSink until it is flushed or falls out of the window.
+type ringRecord struct {
+	time  time.Time
+	size  int64
+	write func(Sink) error
+}
+
+// RingSink is a Sink which holds the events and logs collected within a trailing window in memory, and only writes
+// them to another Sink once triggered. After a trigger, everything is written straight to the other Sink for the post
+// trigger window, after which the RingSink goes back to buffering.
+//
+// The latest revision of every resource and its links are kept regardless of the window, so that each flush describes
+// the state of the cluster at the time of the trigger. A resource recorded as deleted with RecordDeletion is kept until
+// it falls out of the window, after which it and its links are dropped.
+type RingSink struct {
+	// Window is how long events and logs are held before a trigger.
+	Window time.Duration
+
+	// PostWindow is how long events, logs, and resources are written to the inner Sink after a trigger.
+	PostWindow time.Duration
+
+	// TriggerOn is called with each resource and event written to the sink, triggering a flush if it returns true.
+	// Events are passed with the "Event" kind. If nil, the sink is only triggered by calls to Trigger.
+	//
+	// A resource only triggers a flush when it starts matching, so that it does not trigger again on every resync
+	// while it keeps matching. Likewise, events with the same reason regarding the same resource only trigger once
+	// until the resource is deleted.
+	TriggerOn func(u *unstructured.Unstructured) bool
+
+	// OnTrigger is called with the reason for each trigger, before the buffered data is flushed.
+	OnTrigger func(reason string)
+
+	// MaxBytes is the most bytes of events and logs held before a trigger, after which the oldest are dropped. If 0,
+	// only the window limits what is held.
+	MaxBytes int64
+
+	inner Sink
+
+	mu         sync.Mutex
+	resources  map[ResourcePathBuilder]*unstructured.Unstructured
+	links      map[ResourcePathBuilder][]ResourceLink
+	deleted    map[ResourcePathBuilder]time.Time
+	records    []ringRecord
+	bytes      int64
+	flushUntil time.Time
+
+	// triggered holds the resources matching TriggerOn, and triggeredEvents the reasons of the matching events
+	// regarding each resource.
+	triggered       map[ResourcePathBuilder]bool
+	triggeredEvents map[ResourcePathBuilder]map[string]bool
+
+	now func() time.Time
+}
+
+// NewRingSink creates a RingSink holding the last window of events and logs before flushing them to inner.
+func NewRingSink(inner Sink, window time.Duration) *RingSink {
+	return &RingSink{
+		Window:     window,
+		PostWindow: window,
+		inner:      inner,
+		resources:  make(map[ResourcePathBuilder]*unstructured.Unstructured),
+		links:      make(map[ResourcePathBuilder][]ResourceLink),
+		deleted:    make(map[ResourcePathBuilder]time.Time),
+		now:        time.Now,
+
+		triggered:       make(map[ResourcePathBuilder]bool),
+		triggeredEvents: make(map[ResourcePathBuilder]map[string]bool),
+	}
+}
+
+// passing returns true if the sink is within the post trigger window. The caller must hold mu.
+func (sink *RingSink) passing(now time.Time) bool {
+	return now.Before(sink.flushUntil)
+}
+
+// prune drops the records which fell out of the window or exceed MaxBytes, and the resources which were deleted before
+// the window. The caller must hold mu.
+func (sink *RingSink) prune(now time.Time) {
+	cutoff := now.Add(-sink.Window)
+
+	i := 0
+	for i < len(sink.records) && (sink.records[i].time.Before(cutoff) || sink.MaxBytes > 0 && sink.bytes > sink.MaxBytes) {
+		sink.bytes -= sink.records[i].size
+		i++
+	}
+
+	// the dropped records are cleared so that the backing array does not keep them alive
+	clear(sink.records[:i])
+	sink.records = sink.records[i:]
+
+	for builder, deletedAt := range sink.deleted {
+		if deletedAt.Before(cutoff) {
+			sink.evict(builder)
+		}
+	}
+}
+
+// evict drops a deleted resource, its links, and the links to it. The caller must hold mu.
+func (sink *RingSink) evict(builder ResourcePathBuilder) {
+	delete(sink.resources, builder)
+	delete(sink.links, builder)
+	delete(sink.deleted, builder)
+
+	for parent, links := range sink.links {
+		kept := slices.DeleteFunc(slices.Clone(links), func(link ResourceLink) bool {
+			return link.Child == builder
+		})
+
+		if len(kept) < len(links) {
+			sink.links[parent] = kept
+		}
+	}
+}
+
+// push buffers write, or passes it to the inner sink if within the post trigger window. The caller must hold mu.
+func (sink *RingSink) push(size int64, write func(Sink) error) error {
+	now := sink.now()
+
+	if sink.passing(now) {
+		return write(sink.inner)
+	}
+
+	sink.records = append(sink.records, ringRecord{time: now, size: size, write: write})
+	sink.bytes += size
+	sink.prune(now)
+
+	return nil
+}
+
+// Trigger flushes the buffered window to the inner sink, and starts the post trigger window.
+func (sink *RingSink) Trigger(reason string) error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	return sink.trigger(reason)
+}
+
+// trigger is Trigger for callers which already hold mu.
+func (sink *RingSink) trigger(reason string) error {
+	if sink.OnTrigger != nil {
+		sink.OnTrigger(reason)
+	}
+
+	now := sink.now()
+	sink.prune(now)
+
+	for _, u := range sink.resources {
+		if err := sink.inner.WriteResource(u); err != nil {
+			return fmt.Errorf("could not flush resource: %w", err)
+		}
+	}
+
+	for parent, links := range sink.links {
+		if err := sink.inner.RecordLinks(parent, links); err != nil {
+			return fmt.Errorf("could not flush links: %w", err)
+		}
+	}
+
+	for _, record := range sink.records {
+		if err := record.write(sink.inner); err != nil {
+			return fmt.Errorf("could not flush ring buffer: %w", err)
+		}
+	}
+
+	sink.records = nil
+	sink.bytes = 0
+	sink.flushUntil = now.Add(sink.PostWindow)
+
+	return nil
+}
+
+func (sink *RingSink) WriteResource(u *unstructured.Unstructured) error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	builder := ResourcePathBuilder{}.WithNamespace(u.GetNamespace()).WithKind(u.GetKind()).WithName(u.GetName())
+	sink.resources[builder] = u
+	delete(sink.deleted, builder)
+
+	if sink.passing(sink.now()) {
+		if err := sink.inner.WriteResource(u); err != nil {
+			return err
+		}
+	}
+
+	if sink.TriggerOn == nil {
+		return nil
+	}
+
+	if !sink.TriggerOn(u) {
+		delete(sink.triggered, builder)
+		return nil
+	}
+
+	if sink.triggered[builder] {
+		return nil
+	}
+
+	sink.triggered[builder] = true
+
+	return sink.trigger(fmt.Sprintf("%s '%s' matched the trigger", u.GetKind(), builder.Build()))
+}
+
+func (sink *RingSink) AppendEvent(event *eventsv1.Event) error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	err := sink.push(int64(event.Size()), func(inner Sink) error {
+		return inner.AppendEvent(event)
+	})
+	if err != nil {
+		return err
+	}
+
+	if sink.TriggerOn == nil {
+		return nil
+	}
+
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(event)
+	if err != nil {
+		return fmt.Errorf("could not convert event: %w", err)
+	}
+
+	u := &unstructured.Unstructured{Object: obj}
+	u.SetAPIVersion(eventsv1.SchemeGroupVersion.String())
+	u.SetKind("Event")
+
+	if !sink.TriggerOn(u) {
+		return nil
+	}
+
+	regarding := ResourcePathBuilder{}.WithNamespace(event.Regarding.Namespace).WithKind(event.Regarding.Kind).WithName(event.Regarding.Name)
+
+	reasons, found := sink.triggeredEvents[regarding]
+	if !found {
+		reasons = make(map[string]bool)
+		sink.triggeredEvents[regarding] = reasons
+	}
+
+	if reasons[event.Reason] {
+		return nil
+	}
+
+	reasons[event.Reason] = true
+
+	return sink.trigger(fmt.Sprintf("%s event '%s' regarding %s '%s' matched the trigger", event.Type, event.Reason, event.Regarding.Kind, event.Regarding.Name))
+}
+
+func (sink *RingSink) AppendLog(namespace string, pod string, container string, data []byte) error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	return sink.push(int64(len(data)), func(inner Sink) error {
+		return inner.AppendLog(namespace, pod, container, data)
+	})
+}
+
+func (sink *RingSink) RecordLinks(parent ResourcePathBuilder, links []ResourceLink) error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	sink.links[parent] = links
+
+	if sink.passing(sink.now()) {
+		return sink.inner.RecordLinks(parent, links)
+	}
+
+	return nil
+}
+
+// RecordDeletion records that the resource at builder was deleted, so that it and its links are dropped once the
+// deletion falls out of the window.
+func (sink *RingSink) RecordDeletion(builder ResourcePathBuilder) error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	now := sink.now()
+
+	if _, found := sink.resources[builder]; found {
+		sink.deleted[builder] = now
+	}
+
+	delete(sink.triggered, builder)
+	delete(sink.triggeredEvents, builder)
+
+	sink.prune(now)
+
+	return nil
+}
+
+// WriteIncidentFile writes straight to the inner sink, since incidents are always kept.
+func (sink *RingSink) WriteIncidentFile(incident string, name string, data []byte) error {
+	return sink.inner.WriteIncidentFile(incident, name, data)
+}
+
+// Close closes the inner sink. Anything still buffered is discarded.
+func (sink *RingSink) Close() error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	sink.records = nil
+	sink.bytes = 0
+
+	return sink.inner.Close()
+}
@@ -0,0 +1,217 @@
+package kubedump
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apicorev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	apimetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// fakeClock is a clock which only moves when advanced.
+type fakeClock struct {
+	t time.Time
+}
+
+func (clock *fakeClock) now() time.Time {
+	return clock.t
+}
+
+func (clock *fakeClock) advance(d time.Duration) {
+	clock.t = clock.t.Add(d)
+}
+
+func newTestRingSink(base string) (*RingSink, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	sink := NewRingSink(NewDirSink(base), time.Minute)
+	sink.PostWindow = 30 * time.Second
+	sink.now = clock.now
+
+	return sink, clock
+}
+
+func samplePod() *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	u.SetKind("Pod")
+	u.SetName("sample-pod")
+	u.SetNamespace("default")
+
+	return u
+}
+
+func TestRingSinkTrigger(t *testing.T) {
+	base := t.TempDir()
+	sink, clock := newTestRingSink(base)
+
+	require.NoError(t, sink.WriteResource(samplePod()))
+	require.NoError(t, sink.AppendLog("default", "sample-pod", "app", []byte("old\n")))
+
+	clock.advance(2 * time.Minute)
+	require.NoError(t, sink.AppendLog("default", "sample-pod", "app", []byte("recent\n")))
+
+	entries, err := os.ReadDir(base)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	require.NoError(t, sink.Trigger("manual"))
+
+	assert.FileExists(t, path.Join(podDir(base), "sample-pod.yaml"))
+	assert.Equal(t, "recent\n", readLog(t, base, "app.log"))
+
+	// logs are written straight through during the post trigger window
+	clock.advance(10 * time.Second)
+	require.NoError(t, sink.AppendLog("default", "sample-pod", "app", []byte("after\n")))
+	assert.Equal(t, "recent\nafter\n", readLog(t, base, "app.log"))
+
+	clock.advance(time.Minute)
+	require.NoError(t, sink.AppendLog("default", "sample-pod", "app", []byte("later\n")))
+	assert.Equal(t, "recent\nafter\n", readLog(t, base, "app.log"))
+
+	require.NoError(t, sink.Close())
+	assert.Equal(t, "recent\nafter\n", readLog(t, base, "app.log"))
+}
+
+func TestRingSinkTriggerOn(t *testing.T) {
+	base := t.TempDir()
+	sink, _ := newTestRingSink(base)
+
+	reasons := []string{}
+	sink.OnTrigger = func(reason string) {
+		reasons = append(reasons, reason)
+	}
+	sink.TriggerOn = func(u *unstructured.Unstructured) bool {
+		return u.GetKind() == "Event" && u.Object["type"] == apicorev1.EventTypeWarning
+	}
+
+	event := &eventsv1.Event{
+		EventTime:           apimetav1.NewMicroTime(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)),
+		Type:                apicorev1.EventTypeNormal,
+		Reason:              "Pulled",
+		ReportingController: "kubelet",
+		Note:                "pulled image",
+		Regarding:           apicorev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "sample-pod"},
+	}
+
+	require.NoError(t, sink.WriteResource(samplePod()))
+	require.NoError(t, sink.AppendEvent(event))
+	assert.Empty(t, reasons)
+	assert.NoDirExists(t, podDir(base))
+
+	warning := event.DeepCopy()
+	warning.Type = apicorev1.EventTypeWarning
+	warning.Reason = "BackOff"
+
+	require.NoError(t, sink.AppendEvent(warning))
+	assert.Equal(t, []string{"Warning event 'BackOff' regarding Pod 'sample-pod' matched the trigger"}, reasons)
+
+	data, err := os.ReadFile(path.Join(podDir(base), "sample-pod"+EventsFileSuffix))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "Normal Pulled")
+	assert.Contains(t, string(data), "Warning BackOff")
+	assert.FileExists(t, path.Join(podDir(base), "sample-pod.yaml"))
+
+	require.NoError(t, sink.Close())
+}
+
+func TestRingSinkMaxBytes(t *testing.T) {
+	base := t.TempDir()
+	sink, clock := newTestRingSink(base)
+	sink.MaxBytes = 10
+
+	require.NoError(t, sink.WriteResource(samplePod()))
+	require.NoError(t, sink.AppendLog("default", "sample-pod", "app", []byte("first\n")))
+	clock.advance(time.Second)
+	require.NoError(t, sink.AppendLog("default", "sample-pod", "app", []byte("second\n")))
+	clock.advance(time.Second)
+	require.NoError(t, sink.AppendLog("default", "sample-pod", "app", []byte("third\n")))
+
+	require.NoError(t, sink.Trigger("manual"))
+	assert.Equal(t, "third\n", readLog(t, base, "app.log"))
+
+	require.NoError(t, sink.Close())
+}
+
+func TestRingSinkEvictsDeleted(t *testing.T) {
+	base := t.TempDir()
+	sink, clock := newTestRingSink(base)
+
+	secret := samplePod()
+	secret.SetKind("Secret")
+	secret.SetName("sample-secret")
+
+	podBuilder := ResourcePathBuilder{}.WithNamespace("default").WithKind("Pod").WithName("sample-pod")
+	secretBuilder := ResourcePathBuilder{}.WithNamespace("default").WithKind("Secret").WithName("sample-secret")
+
+	require.NoError(t, sink.WriteResource(samplePod()))
+	require.NoError(t, sink.WriteResource(secret))
+	require.NoError(t, sink.RecordLinks(podBuilder, []ResourceLink{{Parent: podBuilder, Child: secretBuilder, Types: []LinkType{LinkTypeVolume}}}))
+	require.NoError(t, sink.RecordDeletion(secretBuilder))
+
+	// the secret was deleted within the window, so it is still flushed
+	assert.Len(t, sink.resources, 2)
+
+	clock.advance(2 * time.Minute)
+	require.NoError(t, sink.AppendLog("default", "sample-pod", "app", []byte("recent\n")))
+
+	assert.Len(t, sink.resources, 1)
+	assert.Empty(t, sink.deleted)
+	assert.Empty(t, sink.links[podBuilder])
+
+	require.NoError(t, sink.Trigger("manual"))
+	assert.FileExists(t, path.Join(podDir(base), "sample-pod.yaml"))
+	assert.NoDirExists(t, path.Join(base, "default", "Secret"))
+	assert.NoFileExists(t, path.Join(podDir(base), "sample-pod"+LinksFileSuffix))
+
+	require.NoError(t, sink.Close())
+}
+
+func TestRingSinkTriggerOnceWhileMatching(t *testing.T) {
+	base := t.TempDir()
+	sink, clock := newTestRingSink(base)
+
+	reasons := []string{}
+	sink.OnTrigger = func(reason string) {
+		reasons = append(reasons, reason)
+	}
+	sink.TriggerOn = func(u *unstructured.Unstructured) bool {
+		return u.GetLabels()["crashing"] == "true" || u.GetKind() == "Event"
+	}
+
+	crashing := samplePod()
+	crashing.SetLabels(map[string]string{"crashing": "true"})
+
+	// resyncs of a resource which keeps matching do not trigger again
+	require.NoError(t, sink.WriteResource(crashing))
+	clock.advance(time.Hour)
+	require.NoError(t, sink.WriteResource(crashing))
+	assert.Len(t, reasons, 1)
+
+	require.NoError(t, sink.WriteResource(samplePod()))
+	require.NoError(t, sink.WriteResource(crashing))
+	assert.Len(t, reasons, 2)
+
+	event := &eventsv1.Event{
+		Type:      apicorev1.EventTypeWarning,
+		Reason:    "BackOff",
+		Regarding: apicorev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "sample-pod"},
+	}
+
+	require.NoError(t, sink.AppendEvent(event))
+	require.NoError(t, sink.AppendEvent(event))
+	assert.Len(t, reasons, 3)
+
+	// deleting the resource forgets that it and its events triggered
+	require.NoError(t, sink.RecordDeletion(ResourcePathBuilder{}.WithNamespace("default").WithKind("Pod").WithName("sample-pod")))
+	require.NoError(t, sink.AppendEvent(event))
+	require.NoError(t, sink.WriteResource(crashing))
+	assert.Len(t, reasons, 5)
+
+	require.NoError(t, sink.Close())
+}
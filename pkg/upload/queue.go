@@ -0,0 +1,130 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+type queuedFile struct {
+	name     string
+	filePath string
+	remove   bool
+}
+
+// Queue uploads files in the background, one at a time in the order they were added, so that finished chunks of a
+// dump can be uploaded while the dump continues. The queue is unbounded, so adding a file never waits on uploads.
+type Queue struct {
+	uploader *Uploader
+	logger   *slog.Logger
+	ctx      context.Context
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	files  []queuedFile
+	closed bool
+	done   chan struct{}
+
+	errsMu sync.Mutex
+	errs   []error
+}
+
+// NewQueue starts a Queue uploading files with uploader until ctx is cancelled or the Queue is closed.
+func NewQueue(ctx context.Context, uploader *Uploader, logger *slog.Logger) *Queue {
+	queue := &Queue{
+		uploader: uploader,
+		logger:   logger,
+		ctx:      ctx,
+		done:     make(chan struct{}),
+	}
+	queue.cond = sync.NewCond(&queue.mu)
+
+	go queue.run()
+
+	return queue
+}
+
+func (queue *Queue) run() {
+	defer close(queue.done)
+
+	for {
+		file, ok := queue.next()
+		if !ok {
+			return
+		}
+
+		if err := queue.uploader.UploadFile(queue.ctx, file.name, file.filePath); err != nil {
+			queue.logger.Error(fmt.Sprintf("could not upload '%s': %s", file.filePath, err))
+
+			queue.errsMu.Lock()
+			queue.errs = append(queue.errs, err)
+			queue.errsMu.Unlock()
+		} else {
+			queue.logger.Debug(fmt.Sprintf("uploaded '%s' to '%s'", file.filePath, queue.uploader.Key(file.name)))
+		}
+
+		// files to be removed are temporary copies, which are removed even if the upload failed so they do not pile up
+		if file.remove {
+			if err := os.Remove(file.filePath); err != nil {
+				queue.logger.Error(fmt.Sprintf("could not remove uploaded file '%s': %s", file.filePath, err))
+			}
+		}
+	}
+}
+
+// next waits for the next queued file, returning false once the queue is closed and every file has been taken.
+func (queue *Queue) next() (queuedFile, bool) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	for len(queue.files) == 0 && !queue.closed {
+		queue.cond.Wait()
+	}
+
+	if len(queue.files) == 0 {
+		return queuedFile{}, false
+	}
+
+	file := queue.files[0]
+	queue.files = queue.files[1:]
+
+	return file, true
+}
+
+// Add queues the file at filePath to be uploaded to the object for name without waiting for earlier uploads. If remove
+// is true, the file is removed once the upload is done, whether or not it succeeded. Files added after Close are not
+// uploaded.
+func (queue *Queue) Add(name string, filePath string, remove bool) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	if queue.closed {
+		queue.logger.Error(fmt.Sprintf("could not upload '%s': queue is closed", filePath))
+		return
+	}
+
+	queue.files = append(queue.files, queuedFile{
+		name:     name,
+		filePath: filePath,
+		remove:   remove,
+	})
+	queue.cond.Signal()
+}
+
+// Close waits for every queued file to be uploaded, and returns the errors of any failed uploads.
+func (queue *Queue) Close() error {
+	queue.mu.Lock()
+	queue.closed = true
+	queue.cond.Signal()
+	queue.mu.Unlock()
+
+	<-queue.done
+
+	queue.errsMu.Lock()
+	defer queue.errsMu.Unlock()
+
+	return errors.Join(queue.errs...)
+}
@@ -0,0 +1,120 @@
+package upload
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	signingAlgorithm = "AWS4-HMAC-SHA256"
+	amzDateFormat    = "20060102T150405Z"
+	amzShortDate     = "20060102"
+
+	headerContentSha256 = "X-Amz-Content-Sha256"
+	headerDate          = "X-Amz-Date"
+	headerSecurityToken = "X-Amz-Security-Token"
+)
+
+// Credentials used to sign requests. Requests are sent unsigned if AccessKeyID is empty.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// SessionToken is only needed for temporary credentials.
+	SessionToken string
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// escapePath escapes every byte of an object path other than '/' and the unreserved characters, as required by the
+// canonical request.
+func escapePath(p string) string {
+	escaped := &strings.Builder{}
+
+	for _, b := range []byte(p) {
+		switch {
+		case 'a' <= b && b <= 'z', 'A' <= b && b <= 'Z', '0' <= b && b <= '9', strings.IndexByte("-_.~/", b) >= 0:
+			escaped.WriteByte(b)
+		default:
+			fmt.Fprintf(escaped, "%%%02X", b)
+		}
+	}
+
+	return escaped.String()
+}
+
+// canonicalQuery sorts and escapes the query parameters, which url.Values.Encode does except for escaping spaces as '+'.
+func canonicalQuery(query url.Values) string {
+	return strings.ReplaceAll(query.Encode(), "+", "%20")
+}
+
+// signRequest signs req with AWS signature version 4, signing the host and every header already set on req. The
+// payload hash must already be set in the X-Amz-Content-Sha256 header.
+func signRequest(req *http.Request, creds Credentials, region string, t time.Time) {
+	if creds.AccessKeyID == "" {
+		return
+	}
+
+	t = t.UTC()
+	req.Header.Set(headerDate, t.Format(amzDateFormat))
+
+	if creds.SessionToken != "" {
+		req.Header.Set(headerSecurityToken, creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	canonicalHeaders := &strings.Builder{}
+	for _, name := range names {
+		fmt.Fprintf(canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		escapePath(req.URL.Path),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get(headerContentSha256),
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", t.Format(amzShortDate), region)
+	stringToSign := strings.Join([]string{signingAlgorithm, t.Format(amzDateFormat), scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSha256([]byte("AWS4"+creds.SecretAccessKey), t.Format(amzShortDate))
+	key = hmacSha256(key, region)
+	key = hmacSha256(key, "s3")
+	key = hmacSha256(key, "aws4_request")
+
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signingAlgorithm, creds.AccessKeyID, scope, signedHeaders, signature))
+}
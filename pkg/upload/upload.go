@@ -0,0 +1,335 @@
+// Package upload pushes dumps to S3 compatible object storage.
+package upload
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultPartSize is the size of each part of a multipart upload. Objects smaller than a single part are uploaded
+	// with a single request.
+	DefaultPartSize = 8 * 1024 * 1024
+
+	DefaultMaxRetries = 3
+
+	DefaultRetryBackoff = time.Second
+
+	DefaultRegion = "us-east-1"
+)
+
+// Options configures an Uploader.
+type Options struct {
+	// Endpoint is the url of the S3 compatible service (ex. https://s3.us-east-1.amazonaws.com or
+	// http://localhost:9000).
+	Endpoint string
+
+	// Region is used when signing requests, defaulting to DefaultRegion.
+	Region string
+
+	Bucket string
+
+	// Prefix is prepended to the key of every uploaded object.
+	Prefix string
+
+	Credentials Credentials
+
+	// PathStyle addresses the bucket in the url path (<endpoint>/<bucket>/<key>) rather than as a subdomain of the
+	// endpoint. Most S3 compatible services other than AWS require path style addressing.
+	PathStyle bool
+
+	// PartSize is the size of each part of a multipart upload, defaulting to DefaultPartSize. Note that S3 requires
+	// parts other than the last to be at least 5MiB.
+	PartSize int64
+
+	// MaxRetries is the number of times a failed request is retried, defaulting to DefaultMaxRetries. Requests are
+	// retried for connection errors, 5xx responses, and throttling responses.
+	MaxRetries int
+
+	// RetryBackoff is how long to wait before the first retry, and is doubled for each following retry. Defaults to
+	// DefaultRetryBackoff.
+	RetryBackoff time.Duration
+
+	// Client sends the requests, defaulting to http.DefaultClient.
+	Client *http.Client
+}
+
+// Uploader uploads objects to a bucket of an S3 compatible service.
+type Uploader struct {
+	Options
+
+	endpoint *url.URL
+	now      func() time.Time
+}
+
+func NewUploader(opts Options) (*Uploader, error) {
+	if opts.Bucket == "" {
+		return nil, fmt.Errorf("no bucket given")
+	}
+
+	endpoint, err := url.Parse(opts.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse endpoint '%s': %w", opts.Endpoint, err)
+	}
+
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("endpoint '%s' must be an http or https url", opts.Endpoint)
+	}
+
+	if opts.Region == "" {
+		opts.Region = DefaultRegion
+	}
+
+	if opts.PartSize <= 0 {
+		opts.PartSize = DefaultPartSize
+	}
+
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = DefaultMaxRetries
+	}
+
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = DefaultRetryBackoff
+	}
+
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+
+	return &Uploader{
+		Options:  opts,
+		endpoint: endpoint,
+		now:      time.Now,
+	}, nil
+}
+
+// Key returns the key of the object for name, under the configured prefix.
+func (uploader *Uploader) Key(name string) string {
+	return strings.TrimPrefix(path.Join(uploader.Prefix, name), "/")
+}
+
+// objectURL returns the url of the object with the given key.
+func (uploader *Uploader) objectURL(key string, query url.Values) *url.URL {
+	u := *uploader.endpoint
+
+	if uploader.PathStyle {
+		u.Path = path.Join("/", u.Path, uploader.Bucket, key)
+	} else {
+		u.Host = uploader.Bucket + "." + u.Host
+		u.Path = path.Join("/", u.Path, key)
+	}
+
+	u.RawPath = escapePath(u.Path)
+	u.RawQuery = canonicalQuery(query)
+
+	return &u
+}
+
+// s3Error is the body of an error response.
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// retryable returns true if the response status is worth retrying.
+func retryable(status int) bool {
+	return status >= 500 || status == http.StatusTooManyRequests
+}
+
+// do sends a signed request for the object key, retrying on failure, and returns the body and headers of the
+// successful response.
+func (uploader *Uploader) do(ctx context.Context, method string, key string, query url.Values, body []byte) ([]byte, http.Header, error) {
+	var lastErr error
+
+	for attempt := 0; attempt <= uploader.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, nil, fmt.Errorf("%w (last error: %s)", ctx.Err(), lastErr)
+			case <-time.After(uploader.RetryBackoff << (attempt - 1)):
+			}
+		}
+
+		data, header, retry, err := uploader.send(ctx, method, key, query, body)
+		if err == nil {
+			return data, header, nil
+		}
+
+		if !retry {
+			return nil, nil, err
+		}
+
+		lastErr = err
+	}
+
+	return nil, nil, fmt.Errorf("giving up after %d retries: %w", uploader.MaxRetries, lastErr)
+}
+
+// send sends a single signed request, and reports whether the request should be retried if it failed.
+func (uploader *Uploader) send(ctx context.Context, method string, key string, query url.Values, body []byte) ([]byte, http.Header, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, method, uploader.objectURL(key, query).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("could not create request: %w", err)
+	}
+
+	req.Header.Set(headerContentSha256, sha256Hex(body))
+	signRequest(req, uploader.Credentials, uploader.Region, uploader.now())
+
+	resp, err := uploader.Client.Do(req)
+	if err != nil {
+		return nil, nil, ctx.Err() == nil, fmt.Errorf("%s request failed: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, true, fmt.Errorf("could not read response: %w", err)
+	}
+
+	if resp.StatusCode/100 != 2 {
+		s3err := s3Error{}
+		_ = xml.Unmarshal(data, &s3err)
+
+		return nil, nil, retryable(resp.StatusCode), fmt.Errorf("%s '%s' failed with status %d: %s %s", method, key, resp.StatusCode, s3err.Code, s3err.Message)
+	}
+
+	return data, resp.Header, false, nil
+}
+
+type initiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+// Upload uploads the contents of r to the object for name. The contents are read one part at a time, so objects
+// larger than a single part are uploaded with a multipart upload without reading all of r into memory.
+func (uploader *Uploader) Upload(ctx context.Context, name string, r io.Reader) error {
+	key := uploader.Key(name)
+	br := bufio.NewReader(r)
+
+	part, last, err := readPart(br, uploader.PartSize)
+	if err != nil {
+		return fmt.Errorf("could not read '%s': %w", name, err)
+	}
+
+	if last {
+		if _, _, err := uploader.do(ctx, http.MethodPut, key, nil, part); err != nil {
+			return fmt.Errorf("could not upload '%s': %w", key, err)
+		}
+
+		return nil
+	}
+
+	return uploader.uploadMultipart(ctx, key, part, br)
+}
+
+// readPart reads up to size bytes from r, and reports whether r has been exhausted.
+func readPart(r *bufio.Reader, size int64) ([]byte, bool, error) {
+	buf := make([]byte, size)
+
+	n, err := io.ReadFull(r, buf)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return buf[:n], true, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	if _, err := r.Peek(1); errors.Is(err, io.EOF) {
+		return buf, true, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	return buf, false, nil
+}
+
+func (uploader *Uploader) uploadMultipart(ctx context.Context, key string, part []byte, r *bufio.Reader) error {
+	data, _, err := uploader.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return fmt.Errorf("could not start multipart upload of '%s': %w", key, err)
+	}
+
+	result := initiateMultipartUploadResult{}
+	if err := xml.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("could not parse multipart upload of '%s': %w", key, err)
+	}
+
+	complete := completeMultipartUpload{}
+	last := false
+
+	for number := 1; ; number++ {
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {result.UploadID}}
+
+		_, header, err := uploader.do(ctx, http.MethodPut, key, query, part)
+		if err != nil {
+			uploader.abort(key, result.UploadID)
+			return fmt.Errorf("could not upload part %d of '%s': %w", number, key, err)
+		}
+
+		complete.Parts = append(complete.Parts, completedPart{PartNumber: number, ETag: header.Get("ETag")})
+
+		if last {
+			return uploader.completeMultipart(ctx, key, result.UploadID, complete)
+		}
+
+		if part, last, err = readPart(r, uploader.PartSize); err != nil {
+			uploader.abort(key, result.UploadID)
+			return fmt.Errorf("could not read part %d of '%s': %w", number+1, key, err)
+		}
+	}
+}
+
+func (uploader *Uploader) completeMultipart(ctx context.Context, key string, uploadID string, complete completeMultipartUpload) error {
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return fmt.Errorf("could not marshal parts of '%s': %w", key, err)
+	}
+
+	if _, _, err := uploader.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, body); err != nil {
+		uploader.abort(key, uploadID)
+		return fmt.Errorf("could not complete multipart upload of '%s': %w", key, err)
+	}
+
+	return nil
+}
+
+// abort cancels a multipart upload so the service can discard its parts. Since it is only called after a failure, any
+// error aborting is ignored.
+func (uploader *Uploader) abort(key string, uploadID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, _, _ = uploader.do(ctx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil)
+}
+
+// UploadFile uploads the file at filePath to the object for name.
+func (uploader *Uploader) UploadFile(ctx context.Context, name string, filePath string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("could not open file '%s': %w", filePath, err)
+	}
+	defer f.Close()
+
+	return uploader.Upload(ctx, name, f)
+}
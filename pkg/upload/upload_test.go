@@ -0,0 +1,310 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 is an in-process S3 compatible server supporting path style object and multipart uploads.
+type fakeS3 struct {
+	mu sync.Mutex
+
+	// objects is keyed by "<bucket>/<key>".
+	objects map[string][]byte
+
+	// uploads holds the parts of each unfinished multipart upload.
+	uploads map[string]map[int][]byte
+
+	// failures is the number of following requests to fail with a 503.
+	failures int
+
+	// rejectParts fails every part upload with a 400.
+	rejectParts bool
+
+	// requests records each request as "<method> <path>?<query>".
+	requests []string
+
+	nextUploadID int
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	fake := &fakeS3{
+		objects: map[string][]byte{},
+		uploads: map[string]map[int][]byte{},
+	}
+
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	return fake, server
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func (fake *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	fake.requests = append(fake.requests, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery)
+
+	if fake.failures > 0 {
+		fake.failures--
+		writeS3Error(w, http.StatusServiceUnavailable, "SlowDown")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+
+	if r.Header.Get(headerContentSha256) != sha256Hex(body) {
+		writeS3Error(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch")
+		return
+	}
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), signingAlgorithm) {
+		writeS3Error(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+
+	object := strings.TrimPrefix(r.URL.Path, "/")
+	query := r.URL.Query()
+	uploadID := query.Get("uploadId")
+
+	switch {
+	case r.Method == http.MethodPut && uploadID == "":
+		fake.objects[object] = body
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		fake.nextUploadID++
+		id := strconv.Itoa(fake.nextUploadID)
+		fake.uploads[id] = map[int][]byte{}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPut:
+		parts, ok := fake.uploads[uploadID]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+
+		if fake.rejectParts {
+			writeS3Error(w, http.StatusBadRequest, "EntityTooSmall")
+			return
+		}
+
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		parts[number] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"%s-%d"`, uploadID, number))
+	case r.Method == http.MethodPost:
+		parts, ok := fake.uploads[uploadID]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+
+		complete := completeMultipartUpload{}
+		if err := xml.Unmarshal(body, &complete); err != nil {
+			writeS3Error(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+
+		data := []byte{}
+		for _, part := range complete.Parts {
+			if part.ETag != fmt.Sprintf(`"%s-%d"`, uploadID, part.PartNumber) {
+				writeS3Error(w, http.StatusBadRequest, "InvalidPart")
+				return
+			}
+
+			data = append(data, parts[part.PartNumber]...)
+		}
+
+		fake.objects[object] = data
+		delete(fake.uploads, uploadID)
+	case r.Method == http.MethodDelete:
+		delete(fake.uploads, uploadID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func (fake *fakeS3) methods() []string {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	methods := []string{}
+	for _, request := range fake.requests {
+		method, _, _ := strings.Cut(request, " ")
+		methods = append(methods, method)
+	}
+
+	return methods
+}
+
+func newTestUploader(t *testing.T, server *httptest.Server, partSize int64) *Uploader {
+	uploader, err := NewUploader(Options{
+		Endpoint:     server.URL,
+		Bucket:       "bucket",
+		Prefix:       "dumps",
+		PathStyle:    true,
+		PartSize:     partSize,
+		RetryBackoff: time.Millisecond,
+		Credentials:  Credentials{AccessKeyID: "access", SecretAccessKey: "secret"},
+	})
+	require.NoError(t, err)
+
+	return uploader
+}
+
+func TestUploadSingle(t *testing.T) {
+	fake, server := newFakeS3(t)
+	uploader := newTestUploader(t, server, 16)
+
+	require.NoError(t, uploader.Upload(context.Background(), "some dump/kubedump.log", strings.NewReader("some logs")))
+
+	assert.Equal(t, []byte("some logs"), fake.objects["bucket/dumps/some dump/kubedump.log"])
+	assert.Equal(t, []string{http.MethodPut}, fake.methods())
+}
+
+func TestUploadMultipart(t *testing.T) {
+	for _, data := range []string{"0123456789", "01234567"} {
+		t.Run(strconv.Itoa(len(data)), func(t *testing.T) {
+			fake, server := newFakeS3(t)
+			uploader := newTestUploader(t, server, 4)
+
+			require.NoError(t, uploader.Upload(context.Background(), "kubedump.tar.gz", strings.NewReader(data)))
+
+			assert.Equal(t, []byte(data), fake.objects["bucket/dumps/kubedump.tar.gz"])
+			assert.Empty(t, fake.uploads)
+
+			// no empty part is uploaded when the data is a multiple of the part size
+			parts := (len(data) + 3) / 4
+			expected := []string{http.MethodPost}
+			for i := 0; i < parts; i++ {
+				expected = append(expected, http.MethodPut)
+			}
+			expected = append(expected, http.MethodPost)
+
+			assert.Equal(t, expected, fake.methods())
+		})
+	}
+}
+
+func TestUploadRetry(t *testing.T) {
+	fake, server := newFakeS3(t)
+	uploader := newTestUploader(t, server, 4)
+
+	fake.failures = DefaultMaxRetries
+	require.NoError(t, uploader.Upload(context.Background(), "kubedump.log", strings.NewReader("abc")))
+	assert.Equal(t, []byte("abc"), fake.objects["bucket/dumps/kubedump.log"])
+
+	fake.failures = DefaultMaxRetries + 1
+	assert.ErrorContains(t, uploader.Upload(context.Background(), "other.log", strings.NewReader("abc")), "SlowDown")
+	assert.NotContains(t, fake.objects, "bucket/dumps/other.log")
+}
+
+func TestUploadMultipartAbort(t *testing.T) {
+	fake, server := newFakeS3(t)
+	uploader := newTestUploader(t, server, 4)
+
+	// a client error is not retried, and aborts the upload
+	fake.rejectParts = true
+
+	err := uploader.Upload(context.Background(), "kubedump.tar.gz", strings.NewReader("0123456789"))
+	assert.ErrorContains(t, err, "EntityTooSmall")
+	assert.Equal(t, []string{http.MethodPost, http.MethodPut, http.MethodDelete}, fake.methods())
+	assert.Empty(t, fake.uploads)
+	assert.Empty(t, fake.objects)
+}
+
+func TestObjectURL(t *testing.T) {
+	uploader, err := NewUploader(Options{Endpoint: "https://s3.amazonaws.com", Bucket: "bucket", Prefix: "/dumps/"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "https://bucket.s3.amazonaws.com/dumps/a%20b.log?partNumber=1&uploadId=x",
+		uploader.objectURL(uploader.Key("a b.log"), map[string][]string{"uploadId": {"x"}, "partNumber": {"1"}}).String())
+
+	uploader.PathStyle = true
+	assert.Equal(t, "https://s3.amazonaws.com/bucket/dumps/a.log", uploader.objectURL(uploader.Key("a.log"), nil).String())
+}
+
+func TestNewUploaderInvalid(t *testing.T) {
+	_, err := NewUploader(Options{Endpoint: "https://s3.amazonaws.com"})
+	assert.Error(t, err)
+
+	_, err = NewUploader(Options{Endpoint: "s3.amazonaws.com", Bucket: "bucket"})
+	assert.Error(t, err)
+}
+
+func TestQueue(t *testing.T) {
+	fake, server := newFakeS3(t)
+	uploader := newTestUploader(t, server, 4)
+	dir := t.TempDir()
+
+	queue := NewQueue(context.Background(), uploader, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	for i, remove := range []bool{true, false} {
+		filePath := path.Join(dir, fmt.Sprintf("chunk-%d", i))
+		require.NoError(t, os.WriteFile(filePath, bytes.Repeat([]byte{'a' + byte(i)}, 6), 0644))
+
+		queue.Add(fmt.Sprintf("chunk-%d", i), filePath, remove)
+	}
+
+	queue.Add("missing", path.Join(dir, "missing"), false)
+
+	assert.ErrorContains(t, queue.Close(), "missing")
+
+	keys := []string{}
+	for key := range fake.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	assert.Equal(t, []string{"bucket/dumps/chunk-0", "bucket/dumps/chunk-1"}, keys)
+	assert.Equal(t, []byte("aaaaaa"), fake.objects["bucket/dumps/chunk-0"])
+
+	assert.NoFileExists(t, path.Join(dir, "chunk-0"))
+	assert.FileExists(t, path.Join(dir, "chunk-1"))
+}
+
+func TestQueueRemovesFailedUploads(t *testing.T) {
+	fake, server := newFakeS3(t)
+	uploader := newTestUploader(t, server, 4)
+	dir := t.TempDir()
+
+	fake.failures = DefaultMaxRetries + 1
+
+	queue := NewQueue(context.Background(), uploader, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	filePath := path.Join(dir, "chunk")
+	require.NoError(t, os.WriteFile(filePath, []byte("abc"), 0644))
+
+	queue.Add("chunk", filePath, true)
+
+	assert.ErrorContains(t, queue.Close(), "SlowDown")
+	assert.NoFileExists(t, filePath)
+
+	// files added after the queue is closed are dropped rather than blocking or panicking
+	queue.Add("late", filePath, true)
+}
@@ -0,0 +1,174 @@
+package kubedump
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+)
+
+// ProblemKind is the kind of problem found when verifying a dump.
+type ProblemKind string
+
+const (
+	// ProblemMissing is reported for a file in the manifest's checksums which is not in the dump, or for a dump without a
+	// manifest.
+	ProblemMissing ProblemKind = "missing"
+
+	// ProblemModified is reported for a file whose checksum does not match the checksum in the manifest.
+	ProblemModified ProblemKind = "modified"
+
+	// ProblemTruncated is reported for a resource file which can not be parsed.
+	ProblemTruncated ProblemKind = "truncated"
+
+	// ProblemDangling is reported for a symlink whose target does not exist.
+	ProblemDangling ProblemKind = "dangling"
+)
+
+// Problem is a problem found when verifying a dump.
+type Problem struct {
+	Kind ProblemKind
+
+	// Path is the path of the file with the problem relative to the root of the dump.
+	Path string
+
+	// Detail explains the problem.
+	Detail string
+}
+
+func (problem Problem) String() string {
+	if problem.Detail == "" {
+		return fmt.Sprintf("%s: %s", problem.Kind, problem.Path)
+	}
+
+	return fmt.Sprintf("%s: %s: %s", problem.Kind, problem.Path, problem.Detail)
+}
+
+// checksumFS returns the hex encoded SHA-256 checksum of the named file.
+func checksumFS(fsys fs.FS, name string) (string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// ChecksumsFS returns the SHA-256 checksum of every regular file in the dump in fsys keyed by its path, except for the
+// manifest itself. Symlinks are not followed, since the files they point to are already included under their own path.
+func ChecksumsFS(fsys DumpFS) (map[string]string, error) {
+	checksums := map[string]string{}
+
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !entry.Type().IsRegular() || name == ManifestFileName {
+			return nil
+		}
+
+		checksum, err := checksumFS(fsys, name)
+		if err != nil {
+			return fmt.Errorf("could not checksum '%s': %w", name, err)
+		}
+
+		checksums[name] = checksum
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not compute checksums: %w", err)
+	}
+
+	return checksums, nil
+}
+
+// VerifyFS checks the dump in fsys for files which are missing or modified since the checksums in its manifest were
+// recorded, resource files which can not be parsed, and dangling symlinks. The returned problems are sorted by path.
+func VerifyFS(fsys DumpFS) ([]Problem, error) {
+	var problems []Problem
+
+	manifest, err := ReadManifestFS(fsys)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		problems = append(problems, Problem{Kind: ProblemMissing, Path: ManifestFileName, Detail: "checksums can not be verified"})
+	case err != nil:
+		return nil, err
+	default:
+		problems = append(problems, verifyChecksums(fsys, manifest.Checksums)...)
+	}
+
+	err = ForEachResourceFS(fsys, func(builder ResourcePathBuilder) error {
+		name := path.Join(builder.Build(), builder.Name+".yaml")
+
+		resource, err := NewResourceFromFS(fsys, name)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			problems = append(problems, Problem{Kind: ProblemMissing, Path: name})
+		case err != nil:
+			problems = append(problems, Problem{Kind: ProblemTruncated, Path: name, Detail: err.Error()})
+		case resource.GetKind() == "":
+			problems = append(problems, Problem{Kind: ProblemTruncated, Path: name, Detail: "resource has no kind"})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+
+		if _, err := fs.Stat(fsys, name); err != nil {
+			target, _ := fsys.ReadLink(name)
+			problems = append(problems, Problem{Kind: ProblemDangling, Path: name, Detail: fmt.Sprintf("target '%s' does not exist", target)})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not check symlinks: %w", err)
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Path < problems[j].Path
+	})
+
+	return problems, nil
+}
+
+func verifyChecksums(fsys DumpFS, checksums map[string]string) []Problem {
+	var problems []Problem
+
+	for name, expected := range checksums {
+		actual, err := checksumFS(fsys, name)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			problems = append(problems, Problem{Kind: ProblemMissing, Path: name})
+		case err != nil:
+			problems = append(problems, Problem{Kind: ProblemModified, Path: name, Detail: err.Error()})
+		case actual != expected:
+			problems = append(problems, Problem{Kind: ProblemModified, Path: name, Detail: "checksum does not match the manifest"})
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,48 @@
+package kubedump
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/otiai10/copy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	dir := path.Join(t.TempDir(), "kubedump")
+	require.NoError(t, copy.Copy(dumpDir, dir))
+
+	problems, err := VerifyFS(DirFS(dir))
+	require.NoError(t, err)
+	assert.Equal(t, []Problem{{Kind: ProblemMissing, Path: ManifestFileName, Detail: "checksums can not be verified"}}, problems)
+
+	checksums, err := ChecksumsFS(DirFS(dir))
+	require.NoError(t, err)
+	assert.Contains(t, checksums, "default/Pod/sample-pod/sample-pod.yaml")
+	assert.NotContains(t, checksums, "default/Service/sample-service/Pod/sample-pod/sample-pod.yaml", "symlinks should not be followed")
+
+	require.NoError(t, WriteManifest(dir, &Manifest{Checksums: checksums}))
+
+	problems, err = VerifyFS(DirFS(dir))
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+
+	require.NoError(t, os.WriteFile(path.Join(dir, "kubedump.log"), []byte("modified\n"), 0644))
+	require.NoError(t, os.RemoveAll(path.Join(dir, "default", "ConfigMap")))
+	require.NoError(t, os.WriteFile(path.Join(dir, "default", "Secret", "sample-secret", "sample-secret.yaml"), []byte("apiVersion: v1\nkind: Secret\nmetadata: {name: sample-"), 0644))
+
+	problems, err = VerifyFS(DirFS(dir))
+	require.NoError(t, err)
+	require.Len(t, problems, 5)
+
+	assert.Equal(t, Problem{Kind: ProblemMissing, Path: "default/ConfigMap/sample-configmap/sample-configmap.yaml"}, problems[0])
+	assert.Equal(t, ProblemDangling, problems[1].Kind)
+	assert.Equal(t, "default/Pod/sample-pod/ConfigMap/sample-configmap", problems[1].Path)
+	assert.Equal(t, ProblemModified, problems[2].Kind)
+	assert.Equal(t, "default/Secret/sample-secret/sample-secret.yaml", problems[2].Path)
+	assert.Equal(t, ProblemTruncated, problems[3].Kind)
+	assert.Equal(t, "default/Secret/sample-secret/sample-secret.yaml", problems[3].Path)
+	assert.Equal(t, Problem{Kind: ProblemModified, Path: "kubedump.log", Detail: "checksum does not match the manifest"}, problems[4])
+}